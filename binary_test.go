@@ -0,0 +1,137 @@
+package jsonpath
+
+import (
+	"encoding"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Path)(nil)
+	_ encoding.BinaryUnmarshaler = (*Path)(nil)
+)
+
+func TestPath_MarshalBinary_CTS(t *testing.T) {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	require.NoError(t, err)
+	var suite struct {
+		Tests []struct {
+			Name     string `json:"name"`
+			Selector string `json:"selector"`
+			Document any    `json:"document"`
+			Invalid  bool   `json:"invalid_selector"`
+		} `json:"tests"`
+	}
+	require.NoError(t, json.Unmarshal(data, &suite))
+
+	for _, tc := range suite.Tests {
+		if tc.Invalid {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			p, err := Parse(tc.Selector)
+			require.NoError(t, err)
+			bin, err := p.MarshalBinary()
+			require.NoError(t, err)
+
+			var q Path
+			require.NoError(t, q.UnmarshalBinary(bin))
+			assert.Equal(t, p.String(), q.String())
+			// Object members have no defined order, so compare sorted results.
+			assert.ElementsMatch(t, p.Select(tc.Document), q.Select(tc.Document))
+			want, got := p.SelectLocated(tc.Document), q.SelectLocated(tc.Document)
+			want.Sort()
+			got.Sort()
+			assert.Equal(t, want, got)
+
+			again, err := q.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, bin, again)
+		})
+	}
+}
+
+func TestParser_ParseBinary(t *testing.T) {
+	t.Parallel()
+
+	ingest := NewParser(WithFunctions(newUpperFunc()))
+	p := ingest.MustParse("$[?upper(@.name) == 'A' && length(@.tags) > 1]")
+	bin, err := p.MarshalBinary()
+	require.NoError(t, err)
+
+	input := []any{
+		map[string]any{"name": "a", "tags": []any{1.0, 2.0}},
+		map[string]any{"name": "b", "tags": []any{1.0, 2.0}},
+		map[string]any{"name": "a", "tags": []any{}},
+	}
+
+	t.Run("resolves_local_functions", func(t *testing.T) {
+		t.Parallel()
+		worker := NewParser(WithFunctions(newUpperFunc()), WithReverseOrder())
+		q, err := worker.ParseBinary(bin)
+		require.NoError(t, err)
+		assert.Equal(t, NodeList{input[0]}, q.Select(input))
+		// Evaluation settings come from the decoding parser.
+		assert.True(t, q.opts.reverse)
+	})
+
+	t.Run("missing_function", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewParser().ParseBinary(bin)
+		require.ErrorIs(t, err, ErrBinaryPath)
+		require.ErrorIs(t, err, ErrUnknownFunction)
+		assert.ErrorContains(t, err, "upper")
+
+		var q Path
+		require.ErrorIs(t, q.UnmarshalBinary(bin), ErrUnknownFunction)
+	})
+
+	t.Run("unknown_version", func(t *testing.T) {
+		t.Parallel()
+		bad := append([]byte(nil), bin...)
+		bad[3]++
+		_, err := ingest.ParseBinary(bad)
+		require.ErrorIs(t, err, ErrBinaryPath)
+		require.ErrorIs(t, err, ErrBinaryVersion)
+	})
+
+	t.Run("not_binary", func(t *testing.T) {
+		t.Parallel()
+		for _, data := range [][]byte{nil, []byte("$.a"), bin[:len(bin)-1], append(bin[:len(bin):len(bin)], 0)} {
+			_, err := ingest.ParseBinary(data)
+			require.ErrorIs(t, err, ErrBinaryPath)
+			require.NotErrorIs(t, err, ErrBinaryVersion)
+		}
+	})
+
+	t.Run("zero_path", func(t *testing.T) {
+		t.Parallel()
+		bin, err := new(Path).MarshalBinary()
+		require.NoError(t, err)
+		var q Path
+		require.NoError(t, q.UnmarshalBinary(bin))
+		assert.Nil(t, q.Select(input))
+	})
+}
+
+func BenchmarkParser_ParseBinary(b *testing.B) {
+	const expr = "$.store.book[?@.price < 10 && match(@.category, 'fic.*') || @.isbn].title"
+	bin, err := MustParse(expr).MarshalBinary()
+	require.NoError(b, err)
+	p := NewParser()
+
+	b.Run("text", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = p.Parse(expr)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = p.ParseBinary(bin)
+		}
+	})
+}
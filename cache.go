@@ -0,0 +1,108 @@
+package jsonpath
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the number of paths [ParseCached] keeps.
+const DefaultCacheSize = 1024
+
+// Cache is a cache of compiled paths keyed by expression, for programs that
+// parse the same expressions over and over. It holds at most a fixed number
+// of paths and evicts the least recently used one to make room for another.
+// Since a [Path] is immutable, every caller parsing an expression gets the
+// same shared Path. Invalid expressions are not cached: parsing one again
+// returns its error again, so a flood of distinct invalid expressions cannot
+// evict the valid ones. A Cache is safe for concurrent use; two goroutines
+// missing the same expression at once may both parse it.
+type Cache struct {
+	parser *Parser
+	size   int
+
+	mu    sync.Mutex
+	paths map[string]*list.Element // of *cacheEntry in lru
+	lru   list.List                // most recently used first
+}
+
+// cacheEntry is an expression held by a [Cache] and its path.
+type cacheEntry struct {
+	expr string
+	path *Path
+}
+
+// NewCache returns a [Cache] holding up to size paths compiled with the
+// default [Parser], as by [Parse]. A size below 1 is taken as 1.
+func NewCache(size int) *Cache {
+	return newCache(defaultParser, size)
+}
+
+// newCache returns a [Cache] holding up to size paths compiled by p.
+func newCache(p *Parser, size int) *Cache {
+	return &Cache{
+		parser: p,
+		size:   max(size, 1),
+		paths:  make(map[string]*list.Element),
+	}
+}
+
+// Parse returns the cached path for expr, compiling and caching it first if
+// it is not cached. It returns the errors of [Parser.Parse], caching nothing.
+func (c *Cache) Parse(expr string) (*Path, error) {
+	if path, ok := c.get(expr); ok {
+		return path, nil
+	}
+	path, err := c.parser.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return c.add(expr, path), nil
+}
+
+// Len returns the number of paths in c.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// get returns the path cached for expr, marking it as the most recently used.
+func (c *Cache) get(expr string) (*Path, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.paths[expr]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).path, true
+}
+
+// add caches path for expr, evicting the least recently used path if c is
+// full, and returns the path cached for expr: another goroutine may have
+// cached one since c.get missed it.
+func (c *Cache) add(expr string, path *Path) *Path {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.paths[expr]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*cacheEntry).path
+	}
+	if c.lru.Len() >= c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.paths, oldest.Value.(*cacheEntry).expr)
+	}
+	c.paths[expr] = c.lru.PushFront(&cacheEntry{expr: expr, path: path})
+	return path
+}
+
+// defaultCache holds the paths of [ParseCached].
+var defaultCache = NewCache(DefaultCacheSize)
+
+// ParseCached is like [Parse] but keeps the last [DefaultCacheSize]
+// expressions it compiled in a package-level [Cache], so parsing one of them
+// again costs a map lookup. Use [NewCache] for a cache of another size.
+func ParseCached(expr string) (*Path, error) {
+	return defaultCache.Parse(expr)
+}
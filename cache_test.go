@@ -0,0 +1,110 @@
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_Parse(t *testing.T) {
+	c := NewCache(2)
+	a, err := c.Parse("$.a")
+	require.NoError(t, err)
+	again, err := c.Parse("$.a")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+	assert.Equal(t, NodeList{1}, again.Select(map[string]any{"a": 1}))
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCache_Eviction(t *testing.T) {
+	c := NewCache(2)
+	a, _ := c.Parse("$.a")
+	b, _ := c.Parse("$.b")
+
+	// Using $.a makes $.b the least recently used path.
+	got, _ := c.Parse("$.a")
+	assert.Same(t, a, got)
+	_, _ = c.Parse("$.c")
+	assert.Equal(t, 2, c.Len())
+
+	got, _ = c.Parse("$.a")
+	assert.Same(t, a, got, "$.a was used more recently than $.b")
+	got, _ = c.Parse("$.b")
+	assert.NotSame(t, b, got, "$.b should have been evicted")
+	assert.Equal(t, b.String(), got.String())
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestCache_Errors(t *testing.T) {
+	c := NewCache(2)
+	a, _ := c.Parse("$.a")
+	for i := range 10 {
+		_, err := c.Parse("$[" + strconv.Itoa(i))
+		require.ErrorIs(t, err, ErrPathParse)
+		var pe *ParseError
+		require.ErrorAs(t, err, &pe)
+	}
+	assert.Equal(t, 1, c.Len(), "invalid expressions must not be cached")
+	got, _ := c.Parse("$.a")
+	assert.Same(t, a, got)
+}
+
+func TestCache_MinimumSize(t *testing.T) {
+	c := NewCache(0)
+	_, _ = c.Parse("$.a")
+	_, _ = c.Parse("$.b")
+	assert.Equal(t, 1, c.Len())
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c := NewCache(4)
+	var wg sync.WaitGroup
+	for g := range concurrency {
+		wg.Go(func() {
+			for i := range 200 {
+				expr := fmt.Sprintf("$.k%d", (g+i)%8)
+				path, err := c.Parse(expr)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, expr, path.Shorthand())
+			}
+		})
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, c.Len(), 4)
+}
+
+func TestParseCached(t *testing.T) {
+	a, err := ParseCached("$.store.book[0]")
+	require.NoError(t, err)
+	again, err := ParseCached("$.store.book[0]")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+
+	_, err = ParseCached("$.store.book[")
+	require.ErrorIs(t, err, ErrPathParse)
+}
+
+func BenchmarkParse_Cached(b *testing.B) {
+	const expr = `$.store.book[?@.price < 10 && @.category == 'fiction'].title`
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = Parse(expr)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		c := NewCache(DefaultCacheSize)
+		_, _ = c.Parse(expr)
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = c.Parse(expr)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package jsonpath
+
+import (
+	jsonv1 "encoding/json"
+	"reflect"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// convertV1 maps a value left by encoding/json or a custom unmarshaler to the
+// JSON data model, one level deep. See [WithEncodingJSONValues].
+func convertV1(node any) any {
+	if p, ok := node.(*any); ok {
+		if p == nil {
+			return nil
+		}
+		node = *p
+	}
+	switch v := node.(type) {
+	case nil, map[string]any, []any, string, float64, bool:
+		return v
+	case jsonv1.RawMessage:
+		return decodeRaw(v, node)
+	case jsontext.Value:
+		return decodeRaw(v, node)
+	case map[int]any, map[int64]any:
+		// Sparse arrays; see [Path.Select].
+		return v
+	}
+	rv := reflect.ValueOf(node)
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return node
+		}
+		fallthrough
+	case reflect.Array:
+		arr := make([]any, rv.Len())
+		for i := range arr {
+			arr[i] = rv.Index(i).Interface()
+		}
+		return arr
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return node
+		}
+		if rv.IsNil() {
+			return nil
+		}
+		obj := make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			obj[it.Key().String()] = it.Value().Interface()
+		}
+		return obj
+	default:
+		return node
+	}
+}
+
+// decodeRaw decodes raw, returning node if raw is not valid JSON.
+func decodeRaw(raw []byte, node any) any {
+	var v any
+	if err := json.Unmarshal(raw, &v, decodeOptions); err != nil {
+		return node
+	}
+	return v
+}
@@ -0,0 +1,271 @@
+package jsonpath
+
+import (
+	jsonv1 "encoding/json"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type key string
+
+func TestConvertV1(t *testing.T) {
+	t.Parallel()
+
+	var nilAny *any
+	anyPtr := any(jsonv1.RawMessage(`[1]`))
+	nested := any(&anyPtr)
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{"null", nil, nil},
+		{"object", map[string]any{"a": 1.0}, map[string]any{"a": 1.0}},
+		{"raw_message", jsonv1.RawMessage(`{"a": [1, "x"]}`), map[string]any{"a": []any{1.0, "x"}}},
+		{"jsontext_value", jsontext.Value(`"s"`), "s"},
+		{"raw_null", jsonv1.RawMessage(`null`), nil},
+		{"raw_invalid", jsonv1.RawMessage(`{"a"`), jsonv1.RawMessage(`{"a"`)},
+		{"any_pointer", &anyPtr, []any{1.0}},
+		{"nil_any_pointer", nilAny, nil},
+		{"single_level", &nested, &anyPtr},
+		{"typed_slice", []string{"a", "b"}, []any{"a", "b"}},
+		{"typed_array", [2]int{1, 2}, []any{1, 2}},
+		{"slice_of_maps", []map[string]any{{"a": 1}}, []any{map[string]any{"a": 1}}},
+		{"nil_slice", []string(nil), nil},
+		{"bytes", []byte("ab"), []byte("ab")},
+		{"typed_map", map[string]int{"a": 1}, map[string]any{"a": 1}},
+		{"named_keys", map[key]string{"k": "v"}, map[string]any{"k": "v"}},
+		{"nil_map", map[string]string(nil), nil},
+		{"int_keys", map[int]any{1: "a"}, map[int]any{1: "a"}},
+		{"int_keys_typed", map[int]string{1: "a"}, map[int]string{1: "a"}},
+		{"number", 3, 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, convertV1(tc.in))
+		})
+	}
+}
+
+func TestWithEncodingJSONValues(t *testing.T) {
+	t.Parallel()
+
+	price := any(8.95)
+	input := map[string]any{
+		"raw":   jsonv1.RawMessage(`{"book": [{"title": "A", "price": 12}, {"title": "B", "price": 5}]}`),
+		"tags":  []string{"x", "y"},
+		"sizes": map[string]int{"s": 1, "m": 2},
+		"ptr":   &price,
+		"bad":   jsonv1.RawMessage(`{`),
+	}
+	p := NewParser(WithEncodingJSONValues())
+
+	tests := []struct {
+		expr string
+		want NodeList
+	}{
+		{"$.raw.book[0].title", NodeList{"A"}},
+		{"$.raw.book[?@.price > 10].title", NodeList{"A"}},
+		{"$.raw.book[?length(@.title) == 1].price", NodeList{12.0, 5.0}},
+		{"$.raw..title", NodeList{"A", "B"}},
+		{"$.tags[-1]", NodeList{"y"}},
+		{"$.tags[?@ == 'x']", NodeList{"x"}},
+		{"$[?count(@.*) == 2]", nil},
+		{"$.sizes.m", NodeList{2}},
+		{"$.ptr", NodeList{8.95}},
+		{"$.raw.book[?@.price > $.ptr].title", NodeList{"A"}},
+		{"$.raw.book[1]", NodeList{map[string]any{"title": "B", "price": 5.0}}},
+		{"$.bad.a", nil},
+		{"$.bad", NodeList{jsonv1.RawMessage(`{`)}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			path := p.MustParse(tc.expr)
+			got := path.Select(input)
+			if tc.expr == "$[?count(@.*) == 2]" {
+				// tags and sizes have two members each.
+				assert.Len(t, got, 2)
+				return
+			}
+			if tc.want == nil {
+				assert.Empty(t, got)
+			} else {
+				assert.ElementsMatch(t, tc.want, got)
+			}
+			assert.Equal(t, len(got), len(path.SelectLocated(input)))
+			if v, ok := path.SelectFirst(input); ok {
+				assert.Contains(t, []any(got), v)
+			}
+		})
+	}
+
+	t.Run("off_by_default", func(t *testing.T) {
+		t.Parallel()
+		assert.Empty(t, MustParse("$.raw.book").Select(input))
+		assert.Equal(t, NodeList{input["raw"]}, MustParse("$.raw").Select(input))
+	})
+}
+
+func TestWithEncodingJSONValues_Bookstore(t *testing.T) {
+	t.Parallel()
+
+	const bookstore = `{"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 399}
+	}}`
+	var want any
+	require.NoError(t, json.Unmarshal([]byte(bookstore), &want, decodeOptions))
+
+	// The shapes encoding/json leaves behind when decoding into typed fields.
+	var native any
+	require.NoError(t, jsonv1.Unmarshal([]byte(bookstore), &native))
+	var raw map[string]jsonv1.RawMessage
+	require.NoError(t, jsonv1.Unmarshal([]byte(bookstore), &raw))
+	var store map[string]map[string]jsonv1.RawMessage
+	require.NoError(t, jsonv1.Unmarshal([]byte(bookstore), &store))
+	var books struct {
+		Store struct {
+			Book    []map[string]any             `json:"book"`
+			Bicycle map[string]jsonv1.RawMessage `json:"bicycle"`
+		} `json:"store"`
+	}
+	require.NoError(t, jsonv1.Unmarshal([]byte(bookstore), &books))
+	typed := map[string]any{"store": map[string]any{"book": books.Store.Book, "bicycle": books.Store.Bicycle}}
+	docs := map[string]any{
+		"native": native,
+		"raw":    raw,
+		"store":  store,
+		"typed":  typed,
+		"root":   jsonv1.RawMessage(bookstore),
+	}
+
+	queries := []string{
+		"$.store.book[*].author",
+		"$..author",
+		"$.store.*",
+		"$.store..price",
+		"$..book[2]",
+		"$..book[-1:]",
+		"$..book[0,1]",
+		"$..book[:2]",
+		"$..book[?@.isbn]",
+		"$..book[?@.price < 10]",
+		"$..book[?@.price <= $.store.bicycle.price]",
+		"$..book[?match(@.author, '.*Tolkien')].title",
+		"$..book[?length(@.title) > 10].title",
+		"$..*",
+		"$.store.book[?@.category == 'fiction' && @.price > 10].title",
+		"$[?count(@.store.book) == 4]",
+	}
+	p := NewParser(WithEncodingJSONValues())
+	for name, doc := range docs {
+		for _, expr := range queries {
+			t.Run(name+"/"+expr, func(t *testing.T) {
+				t.Parallel()
+				path := p.MustParse(expr)
+				wantNodes := MustParse(expr).SelectLocated(want)
+				gotNodes := path.SelectLocated(doc)
+				wantNodes.Sort()
+				gotNodes.Sort()
+				require.Equal(t, slices.Collect(wantNodes.Paths()), slices.Collect(gotNodes.Paths()))
+				for i := range gotNodes {
+					assert.Equal(t, wantNodes[i].Value, roundTripV1(t, gotNodes[i].Value))
+				}
+				assert.ElementsMatch(t, slices.Collect(wantNodes.Values()), roundTripV1(t, []any(path.Select(doc))))
+			})
+		}
+	}
+}
+
+func TestWithEncodingJSONValues_CTS(t *testing.T) {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	require.NoError(t, err)
+	var suite struct {
+		Tests []struct {
+			Name     string `json:"name"`
+			Selector string `json:"selector"`
+			Document any    `json:"document"`
+			Invalid  bool   `json:"invalid_selector"`
+		} `json:"tests"`
+	}
+	require.NoError(t, json.Unmarshal(data, &suite))
+
+	p := NewParser(WithEncodingJSONValues())
+	for _, tc := range suite.Tests {
+		if tc.Invalid {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			want := MustParse(tc.Selector).SelectLocated(tc.Document)
+			got := p.MustParse(tc.Selector).SelectLocated(wrapV1(t, tc.Document, 0))
+			want.Sort()
+			got.Sort()
+			require.Equal(t, slices.Collect(want.Paths()), slices.Collect(got.Paths()))
+			for i := range got {
+				assert.Equal(t, want[i].Value, roundTripV1(t, got[i].Value))
+			}
+		})
+	}
+}
+
+// wrapV1 rebuilds v out of the shapes [WithEncodingJSONValues] accepts,
+// cycling by depth through typed containers, pointers and raw messages.
+func wrapV1(t *testing.T, v any, depth int) any {
+	t.Helper()
+	switch depth % 3 {
+	case 1:
+		w := wrapV1(t, v, depth+1)
+		return &w
+	case 0:
+		if depth > 0 {
+			raw, err := jsonv1.Marshal(v)
+			require.NoError(t, err)
+			return jsonv1.RawMessage(raw)
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]*any, len(v))
+		for k, child := range v {
+			w := wrapV1(t, child, depth+1)
+			if p, ok := w.(*any); ok {
+				m[k] = p
+			} else {
+				m[k] = &w
+			}
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, child := range v {
+			s[i] = wrapV1(t, child, depth+1)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// roundTripV1 marshals v with encoding/json, which writes raw messages and
+// typed containers as plain JSON, and decodes the result like [QueryJSON].
+func roundTripV1(t *testing.T, v any) any {
+	t.Helper()
+	data, err := jsonv1.Marshal(v)
+	require.NoError(t, err)
+	var out any
+	require.NoError(t, json.Unmarshal(data, &out, decodeOptions))
+	return out
+}
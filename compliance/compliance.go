@@ -0,0 +1,198 @@
+// Package compliance runs the JSONPath Compliance Test Suite (CTS) against
+// the jsonpath package as built, so programs embedding it can check at
+// startup that the features they rely on conform to RFC 9535.
+//
+// The CTS is maintained as a git submodule at
+// .references/jsonpath-compliance-test-suite and embedded from
+// testdata/cts.json. To update it to the latest version:
+//
+//	cd .references/jsonpath-compliance-test-suite
+//	git pull origin main
+//	cd ../..
+//	cp .references/jsonpath-compliance-test-suite/cts.json compliance/testdata/cts.json
+//	git add compliance/testdata/cts.json
+//	git commit -m "chore: update JSONPath CTS to latest version"
+package compliance
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/agentable/jsonpath"
+)
+
+//go:embed testdata/cts.json
+var ctsJSON []byte
+
+// ErrUnknownTag is returned by [Run] when a requested tag labels no test case.
+var ErrUnknownTag = errors.New("compliance: unknown tag")
+
+// ctsFile represents the structure of the CTS JSON file.
+type ctsFile struct {
+	Description string     `json:"description"`
+	Tests       []testCase `json:"tests"`
+}
+
+// testCase represents a single test case from the CTS.
+type testCase struct {
+	Name            string     `json:"name"`
+	Selector        string     `json:"selector"`
+	Document        any        `json:"document"`
+	Result          []any      `json:"result"`
+	Results         [][]any    `json:"results"`
+	ResultPaths     []string   `json:"result_paths"`
+	ResultsPaths    [][]string `json:"results_paths"`
+	InvalidSelector bool       `json:"invalid_selector"`
+	Tags            []string   `json:"tags"`
+}
+
+// RunOptions configures [Run].
+type RunOptions struct {
+	// Tags restricts the run to the test cases labeled with at least one of
+	// the tags, such as "slice", "function" or "unicode". All test cases run
+	// when Tags is empty; untagged cases run only then.
+	Tags []string
+	// Parser compiles the selectors. The default [jsonpath.Parser] is used
+	// when Parser is nil. Options that change results, such as
+	// [jsonpath.WithReverseOrder], make test cases fail.
+	Parser *jsonpath.Parser
+}
+
+// Report is the outcome of [Run].
+type Report struct {
+	// Total is the number of test cases run.
+	Total int
+	// Passed is the number of test cases that passed.
+	Passed int
+	// Failed is the number of test cases that failed.
+	Failed int
+	// Failures describes the failed test cases in suite order.
+	Failures []Failure
+}
+
+// OK reports whether every test case run passed.
+func (r Report) OK() bool { return r.Failed == 0 }
+
+// Failure describes one failed test case.
+type Failure struct {
+	// Name is the name of the test case in the CTS.
+	Name string
+	// Selector is the JSONPath expression under test.
+	Selector string
+	// Reason explains how the result differed from the expected one.
+	Reason string
+}
+
+// Run executes the embedded CTS, or the part of it selected by opts.Tags,
+// against the jsonpath package and reports which test cases pass. A test
+// case that panics fails with the panic as its reason. Run returns an error
+// only if the suite cannot be loaded or a tag in opts.Tags labels no test
+// case.
+func Run(opts RunOptions) (Report, error) {
+	var suite ctsFile
+	if err := json.Unmarshal(ctsJSON, &suite); err != nil {
+		return Report{}, fmt.Errorf("compliance: decoding the embedded suite: %w", err)
+	}
+	for _, tag := range opts.Tags {
+		if !slices.ContainsFunc(suite.Tests, func(tc testCase) bool { return slices.Contains(tc.Tags, tag) }) {
+			return Report{}, fmt.Errorf("%w: %q", ErrUnknownTag, tag)
+		}
+	}
+	parser := opts.Parser
+	if parser == nil {
+		parser = jsonpath.NewParser()
+	}
+
+	var report Report
+	for i := range suite.Tests {
+		tc := &suite.Tests[i]
+		if len(opts.Tags) > 0 && !slices.ContainsFunc(opts.Tags, func(tag string) bool { return slices.Contains(tc.Tags, tag) }) {
+			continue
+		}
+		report.Total++
+		if reason := runCase(parser, tc); reason != "" {
+			report.Failed++
+			report.Failures = append(report.Failures, Failure{Name: tc.Name, Selector: tc.Selector, Reason: reason})
+			continue
+		}
+		report.Passed++
+	}
+	return report, nil
+}
+
+// runCase runs one test case, returning why it failed or "" if it passed.
+func runCase(parser *jsonpath.Parser, tc *testCase) (reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+
+	path, err := parser.Parse(tc.Selector)
+	if tc.InvalidSelector {
+		if err == nil {
+			return "expected parse error for invalid selector"
+		}
+		return ""
+	}
+	if err != nil {
+		return fmt.Sprintf("failed to parse valid selector: %v", err)
+	}
+
+	got := []any(path.Select(tc.Document))
+	if tc.Results != nil {
+		// Multiple possible results (non-deterministic ordering)
+		if !slices.ContainsFunc(tc.Results, func(want []any) bool { return equalNodes(want, got) }) {
+			return fmt.Sprintf("result %v not in expected results %v", got, tc.Results)
+		}
+	} else if !elementsMatch(tc.Result, got) {
+		return fmt.Sprintf("result mismatch: got %v, want %v", got, tc.Result)
+	}
+
+	if tc.ResultPaths == nil && tc.ResultsPaths == nil {
+		return ""
+	}
+	located := path.SelectLocated(tc.Document)
+	gotPaths := make([]string, len(located))
+	for i, loc := range located {
+		gotPaths[i] = loc.Path.String()
+	}
+	if tc.ResultsPaths != nil {
+		// Multiple possible path orderings
+		if !slices.ContainsFunc(tc.ResultsPaths, func(want []string) bool { return slices.Equal(want, gotPaths) }) {
+			return fmt.Sprintf("paths %q not in expected paths %q", gotPaths, tc.ResultsPaths)
+		}
+	} else if !slices.Equal(tc.ResultPaths, gotPaths) {
+		return fmt.Sprintf("paths mismatch: got %q, want %q", gotPaths, tc.ResultPaths)
+	}
+	return ""
+}
+
+// equalNodes reports whether a and b hold deeply equal nodes in the same
+// order.
+func equalNodes(a, b []any) bool {
+	return slices.EqualFunc(a, b, func(x, y any) bool { return reflect.DeepEqual(x, y) })
+}
+
+// elementsMatch reports whether a and b hold deeply equal nodes in any order.
+func elementsMatch(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	used := make([]bool, len(b))
+next:
+	for _, x := range a {
+		for i, y := range b {
+			if !used[i] && reflect.DeepEqual(x, y) {
+				used[i] = true
+				continue next
+			}
+		}
+		return false
+	}
+	return true
+}
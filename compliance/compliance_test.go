@@ -1,91 +1,59 @@
 package compliance
 
 import (
-	_ "embed"
-	"encoding/json"
 	"testing"
 
 	"github.com/agentable/jsonpath"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// The CTS (Compliance Test Suite) is maintained as a git submodule at:
-// .references/jsonpath-compliance-test-suite
-//
-// To update the CTS to the latest version:
-//   cd .references/jsonpath-compliance-test-suite
-//   git pull origin main
-//   cd ../..
-//   cp .references/jsonpath-compliance-test-suite/cts.json compliance/testdata/cts.json
-//   git add compliance/testdata/cts.json
-//   git commit -m "chore: update JSONPath CTS to latest version"
-
-//go:embed testdata/cts.json
-var ctsJSON []byte
-
-// ctsFile represents the structure of the CTS JSON file.
-type ctsFile struct {
-	Description string     `json:"description"`
-	Tests       []testCase `json:"tests"`
-}
-
-// testCase represents a single test case from the CTS.
-type testCase struct {
-	Name            string     `json:"name"`
-	Selector        string     `json:"selector"`
-	Document        any        `json:"document"`
-	Result          []any      `json:"result"`
-	Results         [][]any    `json:"results"`
-	ResultPaths     []string   `json:"result_paths"`
-	ResultsPaths    [][]string `json:"results_paths"`
-	InvalidSelector bool       `json:"invalid_selector"`
-	Tags            []string   `json:"tags"`
-}
-
 func TestCompliance(t *testing.T) {
-	var suite ctsFile
-	require.NoError(t, json.Unmarshal(ctsJSON, &suite))
+	report, err := Run(RunOptions{})
+	require.NoError(t, err)
+	for _, f := range report.Failures {
+		t.Errorf("%s (%s): %s", f.Name, f.Selector, f.Reason)
+	}
+	assert.Positive(t, report.Total)
+	assert.Equal(t, report.Total, report.Passed)
+	assert.True(t, report.OK())
+}
 
-	for _, tc := range suite.Tests {
-		t.Run(tc.Name, func(t *testing.T) {
-			// Invalid selector tests
-			if tc.InvalidSelector {
-				_, err := jsonpath.Parse(tc.Selector)
-				require.Error(t, err, "expected parse error for invalid selector")
-				return
-			}
+func TestRun_Tags(t *testing.T) {
+	all, err := Run(RunOptions{})
+	require.NoError(t, err)
 
-			// Valid selector tests
-			path, err := jsonpath.Parse(tc.Selector)
-			require.NoError(t, err, "failed to parse valid selector")
+	slice, err := Run(RunOptions{Tags: []string{"slice"}})
+	require.NoError(t, err)
+	assert.Positive(t, slice.Total)
+	assert.Less(t, slice.Total, all.Total)
+	assert.True(t, slice.OK())
 
-			got := path.Select(tc.Document)
+	either, err := Run(RunOptions{Tags: []string{"slice", "index"}})
+	require.NoError(t, err)
+	assert.Greater(t, either.Total, slice.Total)
 
-			// Handle single result vs multiple results
-			if tc.Results != nil {
-				// Multiple possible results (non-deterministic ordering)
-				require.Contains(t, tc.Results, []any(got), "result not in expected results")
-			} else {
-				// Single expected result
-				require.ElementsMatch(t, tc.Result, got, "result mismatch")
-			}
+	_, err = Run(RunOptions{Tags: []string{"slice", "no-such-tag"}})
+	require.ErrorIs(t, err, ErrUnknownTag)
+}
 
-			// Validate paths if SelectLocated is implemented
-			if tc.ResultPaths != nil || tc.ResultsPaths != nil {
-				located := path.SelectLocated(tc.Document)
-				gotPaths := make([]string, len(located))
-				for i, loc := range located {
-					gotPaths[i] = loc.Path.String()
-				}
+func TestRun_Failures(t *testing.T) {
+	// Reverse order breaks the cases with a defined result order.
+	report, err := Run(RunOptions{Parser: jsonpath.NewParser(jsonpath.WithReverseOrder())})
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, report.Total, report.Passed+report.Failed)
+	require.Len(t, report.Failures, report.Failed)
+	f := report.Failures[0]
+	assert.NotEmpty(t, f.Name)
+	assert.NotEmpty(t, f.Selector)
+	assert.Contains(t, f.Reason, "mismatch")
+}
 
-				if tc.ResultsPaths != nil {
-					// Multiple possible path orderings
-					require.Contains(t, tc.ResultsPaths, gotPaths, "paths not in expected paths")
-				} else if tc.ResultPaths != nil {
-					// Single expected path ordering
-					require.Equal(t, tc.ResultPaths, gotPaths, "paths mismatch")
-				}
-			}
-		})
-	}
+func TestElementsMatch(t *testing.T) {
+	assert.True(t, elementsMatch(nil, []any{}))
+	assert.True(t, elementsMatch([]any{1.0, "a", 1.0}, []any{"a", 1.0, 1.0}))
+	assert.False(t, elementsMatch([]any{1.0, 1.0}, []any{1.0, 2.0}))
+	assert.False(t, elementsMatch([]any{1.0}, []any{1.0, 1.0}))
+	assert.True(t, elementsMatch([]any{map[string]any{"a": []any{1.0}}}, []any{map[string]any{"a": []any{1.0}}}))
 }
@@ -0,0 +1,109 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meaningful under -race; they share compiled values across
+// goroutines the way a server would.
+
+const concurrency = 16
+
+func concurrentDoc(i int) any {
+	return map[string]any{
+		"id": float64(i),
+		"items": []any{
+			map[string]any{"name": fmt.Sprintf("item-%d", i), "tags": []any{"a", "b"}},
+			map[string]any{"name": fmt.Sprintf("other-%d", i), "tags": []any{}},
+		},
+	}
+}
+
+func TestPath_ConcurrentSelect(t *testing.T) {
+	paths := []*Path{
+		MustParse(`$.items[?match(@.name, 'item-[0-9]+')].name`),
+		MustParse(`$.items[?search(@.name, 'other')].name`),
+		MustParse(`$.items[?length(@.tags) > 0 && count(@.tags[*]) == 2].name`),
+		MustParse(`$..[?value(@..name) == $.items[0].name]`),
+		MustParse(`$.items[?@.name == $.items[1].name]`),
+	}
+
+	var wg sync.WaitGroup
+	for g := range concurrency {
+		wg.Go(func() {
+			for i := range 50 {
+				n := g*100 + i
+				doc := concurrentDoc(n)
+				for _, p := range paths {
+					got := p.Select(doc)
+					located := p.SelectLocated(doc)
+					if !assert.Len(t, located, len(got)) {
+						return
+					}
+					for j := range got {
+						assert.Equal(t, got[j], located[j].Value)
+					}
+				}
+				assert.Equal(t, NodeList{fmt.Sprintf("item-%d", n)}, paths[0].Select(doc))
+				assert.Equal(t, NodeList{fmt.Sprintf("other-%d", n)}, paths[1].Select(doc))
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestParser_ConcurrentParse(t *testing.T) {
+	p := NewParser(WithReverseOrder())
+	exprs := []string{
+		`$.a.b`,
+		`$..[?match(@, 'x.*')]`,
+		`$[?length(@) > 1 || search(@.s, '^a')]`,
+		`$[1:10:2]`,
+	}
+
+	input := map[string]any{"a": map[string]any{"b": "xy"}, "s": "abc"}
+	want := make([]NodeList, len(exprs))
+	for i, expr := range exprs {
+		want[i] = p.MustParse(expr).Select(input)
+	}
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for range 50 {
+				for i, expr := range exprs {
+					path, err := p.Parse(expr)
+					if !assert.NoError(t, err) {
+						return
+					}
+					assert.Equal(t, want[i], path.Select(input))
+				}
+				_, err := p.Parse(`$[`)
+				assert.ErrorIs(t, err, ErrPathParse)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestPath_ConcurrentSelectSharedDocument(t *testing.T) {
+	doc := concurrentDoc(1)
+	p := MustParse(`$..name`)
+	want := p.Select(doc)
+	require.Len(t, want, 2)
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for range 100 {
+				assert.ElementsMatch(t, want, p.Select(doc))
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,188 @@
+package jsonpath
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+var (
+	errTrailingData = errors.New("jsonpath: unexpected data after top-level value")
+	errNumberRange  = errors.New("jsonpath: number out of range")
+)
+
+// decodeOptions are the options QueryJSON and its variants unmarshal with.
+// Options values are immutable, so one value serves every call.
+var decodeOptions = json.DefaultOptionsV2()
+
+// QueryJSONPooled is like [QueryJSON] but decodes src into maps and slices
+// recycled from earlier calls and passes the results to fn instead of
+// returning them. The decoded document, and with it every map and slice in the
+// results, is recycled as soon as fn returns: fn must neither retain nor modify
+// them, and must copy whatever it needs to keep. Scalars such as strings and
+// numbers are safe to retain. Decoding follows [QueryJSON]; fn is not called
+// if src is not valid JSON.
+func QueryJSONPooled(src []byte, path *Path, fn func(NodeList)) error {
+	d := treeDecoderPool.Get().(*treeDecoder)
+	defer treeDecoderPool.Put(d)
+
+	v, err := d.decode(src)
+	if err != nil {
+		return errors.Join(ErrUnmarshal, err)
+	}
+	fn(path.Select(v))
+	d.recycle(v)
+	return nil
+}
+
+// maxPooledContainers is the largest number of maps, and separately of slices,
+// a pooled decoder keeps for reuse; the rest are left to the garbage collector.
+const maxPooledContainers = 1024
+
+var treeDecoderPool = sync.Pool{
+	New: func() any { return new(treeDecoder) },
+}
+
+// treeDecoder decodes JSON into the values json.Unmarshal produces for an
+// any, taking maps and slices from free lists filled by recycle.
+type treeDecoder struct {
+	r      bytes.Reader
+	dec    jsontext.Decoder
+	maps   []map[string]any
+	slices [][]any
+}
+
+// decode decodes src, which must hold exactly one JSON value.
+func (d *treeDecoder) decode(src []byte) (any, error) {
+	d.r.Reset(src)
+	d.dec.Reset(&d.r)
+	defer d.r.Reset(nil)
+
+	v, err := d.value()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if _, err := d.dec.ReadToken(); !errors.Is(err, io.EOF) {
+		d.recycle(v)
+		if err == nil {
+			err = fmt.Errorf("%w at offset %d", errTrailingData, d.dec.InputOffset())
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// value decodes the next JSON value.
+func (d *treeDecoder) value() (any, error) {
+	tok, err := d.dec.ReadToken()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.Kind() {
+	case 'n':
+		return nil, nil
+	case 't', 'f':
+		return tok.Bool(), nil
+	case '"':
+		return tok.String(), nil
+	case '0':
+		f := tok.Float()
+		if math.Abs(f) == math.MaxFloat64 {
+			// Float clamps out-of-range numbers; reject them like json.Unmarshal.
+			if exact, _ := strconv.ParseFloat(tok.String(), 64); math.IsInf(exact, 0) {
+				return nil, fmt.Errorf("%w: %s", errNumberRange, tok.String())
+			}
+		}
+		return f, nil
+	case '{':
+		m := d.takeMap()
+		for d.dec.PeekKind() != '}' {
+			tok, err := d.dec.ReadToken()
+			if err != nil {
+				d.recycle(m)
+				return nil, err
+			}
+			name := tok.String() // tok is voided by the next read
+			v, err := d.value()
+			if err != nil {
+				d.recycle(m)
+				return nil, err
+			}
+			m[name] = v
+		}
+		if _, err := d.dec.ReadToken(); err != nil {
+			d.recycle(m)
+			return nil, err
+		}
+		return m, nil
+	case '[':
+		s := d.takeSlice()
+		for d.dec.PeekKind() != ']' {
+			v, err := d.value()
+			if err != nil {
+				d.recycle(s)
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		if _, err := d.dec.ReadToken(); err != nil {
+			d.recycle(s)
+			return nil, err
+		}
+		return s, nil
+	default:
+		panic(fmt.Sprintf("jsonpath: unexpected token %v", tok))
+	}
+}
+
+// takeMap returns an empty map, reusing a recycled one if available.
+func (d *treeDecoder) takeMap() map[string]any {
+	if n := len(d.maps); n > 0 {
+		m := d.maps[n-1]
+		d.maps = d.maps[:n-1]
+		return m
+	}
+	return make(map[string]any)
+}
+
+// takeSlice returns an empty slice, reusing a recycled one if available.
+func (d *treeDecoder) takeSlice() []any {
+	if n := len(d.slices); n > 0 {
+		s := d.slices[n-1]
+		d.slices = d.slices[:n-1]
+		return s
+	}
+	return []any{}
+}
+
+// recycle returns the maps and slices of a decoded value to the free lists.
+func (d *treeDecoder) recycle(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, child := range v {
+			d.recycle(child)
+		}
+		if len(d.maps) < maxPooledContainers {
+			clear(v)
+			d.maps = append(d.maps, v)
+		}
+	case []any:
+		for _, child := range v {
+			d.recycle(child)
+		}
+		if len(d.slices) < maxPooledContainers && cap(v) > 0 {
+			clear(v)
+			d.slices = append(d.slices, v[:0])
+		}
+	}
+}
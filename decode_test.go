@@ -0,0 +1,121 @@
+package jsonpath
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-json-experiment/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeDecoder_MatchesUnmarshal(t *testing.T) {
+	docs := []string{
+		`null`, `true`, `false`, `0`, `-1.5e-3`, `1e-400`, `12345678901234567890`,
+		`""`, `"a\u0000b😀"`, `[]`, `{}`, ` [ 1 , [ ] , { } ] `,
+		`{"a": {"b": [1, "x", null, true]}, "c": []}`,
+		`[[[[[]]]], {"": {"": ""}}]`,
+	}
+	d := new(treeDecoder)
+	for _, doc := range docs {
+		t.Run(doc, func(t *testing.T) {
+			var want any
+			require.NoError(t, json.Unmarshal([]byte(doc), &want, decodeOptions))
+
+			// Decode twice so the second pass runs on recycled containers.
+			for range 2 {
+				got, err := d.decode([]byte(doc))
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+				d.recycle(got)
+			}
+		})
+	}
+
+	invalid := []string{
+		``, ` `, `{`, `[1,]`, `{"a" 1}`, `{"a": 1} x`, `1 2`, `{"a": 1, "a": 2}`,
+		"\"\xff\"", `1e400`, `-1e400`, `nul`, `[1}`,
+	}
+	for _, doc := range invalid {
+		t.Run("invalid/"+doc, func(t *testing.T) {
+			var want any
+			require.Error(t, json.Unmarshal([]byte(doc), &want, decodeOptions))
+			_, err := d.decode([]byte(doc))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestQueryJSONPooled(t *testing.T) {
+	path := MustParse("$.items[?@.n > 1].name")
+	first := []byte(`{"items": [{"n": 1, "name": "a"}, {"n": 2, "name": "b"}, {"n": 3, "name": "c"}]}`)
+	second := []byte(`{"items": [{"n": 5, "name": "d"}], "extra": {"n": 9}}`)
+
+	var got []any
+	require.NoError(t, QueryJSONPooled(first, path, func(nodes NodeList) {
+		got = append(got, nodes...)
+	}))
+	assert.Equal(t, []any{"b", "c"}, got)
+
+	// Recycled maps must not carry members over from the previous document.
+	var sizes []int
+	require.NoError(t, QueryJSONPooled(second, MustParse("$..[?@.n]"), func(nodes NodeList) {
+		for _, n := range nodes {
+			sizes = append(sizes, len(n.(map[string]any)))
+		}
+	}))
+	slices.Sort(sizes)
+	assert.Equal(t, []int{1, 2}, sizes)
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		err := QueryJSONPooled([]byte(`{"items": `), path, func(NodeList) {
+			t.Fatal("fn called for invalid JSON")
+		})
+		require.ErrorIs(t, err, ErrUnmarshal)
+	})
+
+	t.Run("matches QueryJSON", func(t *testing.T) {
+		for _, src := range [][]byte{first, second} {
+			want, err := QueryJSON(src, path)
+			require.NoError(t, err)
+			require.NoError(t, QueryJSONPooled(src, path, func(nodes NodeList) {
+				assert.Equal(t, want, nodes)
+			}))
+		}
+	})
+}
+
+func TestTreeDecoder_RecycleLimit(t *testing.T) {
+	d := new(treeDecoder)
+	v, err := d.decode([]byte(`[` + repeatJSON(`{"a": [1]}`, maxPooledContainers+10) + `]`))
+	require.NoError(t, err)
+	d.recycle(v)
+	assert.Len(t, d.maps, maxPooledContainers)
+	assert.Len(t, d.slices, maxPooledContainers)
+}
+
+func repeatJSON(elem string, n int) string {
+	out := elem
+	for range n - 1 {
+		out += "," + elem
+	}
+	return out
+}
+
+var benchPooledSrc = []byte(`{"user": {"id": 42, "name": "Ada", "roles": ["admin", "dev"]}, ` +
+	`"items": [{"sku": "a", "qty": 1}, {"sku": "b", "qty": 3}, {"sku": "c", "qty": 0}]}`)
+
+func BenchmarkQueryJSON_SmallBody(b *testing.B) {
+	path := MustParse("$.items[?@.qty > 0].sku")
+
+	b.Run("QueryJSON", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = QueryJSON(benchPooledSrc, path)
+		}
+	})
+	b.Run("QueryJSONPooled", func(b *testing.B) {
+		for b.Loop() {
+			_ = QueryJSONPooled(benchPooledSrc, path, func(NodeList) {})
+		}
+	})
+}
@@ -3,6 +3,8 @@ package jsonpath
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -49,3 +51,240 @@ func TestSentinelErrorsDistinct(t *testing.T) {
 		t.Fatal("ErrPathParse and ErrFunction should be distinct")
 	}
 }
+
+func TestErrLex(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		expr    string
+		lexical bool
+	}{
+		{"unexpected character", "$.a#", true},
+		{"single equals", "$[?@.a = 1]", true},
+		{"invalid escape", `$['\q']`, true},
+		{"unterminated string", `$['abc`, true},
+		{"leading zero", "$[01]", true},
+		{"unclosed bracket", "$[0", false},
+		{"trailing token", "$.a]", false},
+		{"missing root", "a", false},
+		{"unknown function", "$[?foo(@)]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tt.expr)
+			if !errors.Is(err, ErrPathParse) {
+				t.Fatalf("Parse(%q) error = %v, want ErrPathParse", tt.expr, err)
+			}
+			if got := errors.Is(err, ErrLex); got != tt.lexical {
+				t.Fatalf("errors.Is(%v, ErrLex) = %v, want %v", err, got, tt.lexical)
+			}
+		})
+	}
+}
+
+func TestParseErrorKinds(t *testing.T) {
+	t.Parallel()
+
+	kinds := []error{ErrLex, ErrInvalidEscape, ErrInvalidIndex, ErrInvalidSlice, ErrUnknownFunction, ErrInvalidFunction}
+	tests := []struct {
+		name string
+		expr string
+		want []error
+	}{
+		{"invalid escape", `$['\q']`, []error{ErrLex, ErrInvalidEscape}},
+		{"unpaired surrogate", `$["\ud800"]`, []error{ErrLex, ErrInvalidEscape}},
+		{"unexpected character", "$.a#", []error{ErrLex}},
+		{"negative zero index", "$[-0]", []error{ErrInvalidIndex}},
+		{"index out of range", "$[9007199254740992]", []error{ErrInvalidIndex}},
+		{"index overflow", "$[99999999999999999999]", []error{ErrInvalidIndex}},
+		{"index in filter query", "$[?@[-0]]", []error{ErrInvalidIndex}},
+		{"negative zero slice start", "$[-0:1]", []error{ErrInvalidSlice}},
+		{"slice end out of range", "$[:9007199254740992]", []error{ErrInvalidSlice}},
+		{"negative zero slice step", "$[::-0]", []error{ErrInvalidSlice}},
+		{"unknown function", "$[?lenght(@) > 1]", []error{ErrUnknownFunction}},
+		{"wrong argument count", "$[?length(@, 1) > 1]", []error{ErrInvalidFunction}},
+		{"unbalanced brackets", "$[0", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tt.expr)
+			if !errors.Is(err, ErrPathParse) {
+				t.Fatalf("Parse(%q) error = %v, want ErrPathParse", tt.expr, err)
+			}
+			for _, kind := range kinds {
+				if got, want := errors.Is(err, kind), slices.Contains(tt.want, kind); got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrTooDeep(t *testing.T) {
+	t.Parallel()
+
+	expr := "$[?" + strings.Repeat("(", 100_000) + "@" + strings.Repeat(")", 100_000) + "]"
+	_, err := Parse(expr)
+	if !errors.Is(err, ErrPathParse) || !errors.Is(err, ErrTooDeep) {
+		t.Fatalf("Parse of deeply nested filter error = %v, want ErrPathParse and ErrTooDeep", err)
+	}
+	if Valid(expr) {
+		t.Fatal("Valid of deeply nested filter = true, want false")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expr     string
+		pos      int
+		msg      string
+		expected []string
+	}{
+		{"missing root", "a", 0, "expected $", []string{"$"}},
+		{"relative", "@.a", 0, "@ is only allowed in filter expressions; expected $", []string{"$"}},
+		{"trailing token", "$.a]", 3, "unexpected token after path", nil},
+		{"unclosed bracket", "$[0", 3, "expected ] or ,", []string{"]", ","}},
+		{"bad dot child", "$.[0]", 2, "expected * or identifier after .", []string{"*", "identifier"}},
+		{"negative zero", "$[1:-0]", 4, "-0 is not allowed", nil},
+		{"unknown function", "$[?foo(@)]", 3, "foo", nil},
+		{"trailing whitespace", "$.a ", 3, "trailing whitespace not allowed", nil},
+		{"multibyte name", "$.café]", 7, "unexpected token after path", nil},
+		{"number out of range", "$[?@.a == 1e999]", 10, "invalid number literal", nil},
+		{"negative number out of range", "$[?@.a == -1e999]", 10, "invalid number literal", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tt.expr)
+			if !errors.Is(err, ErrPathParse) {
+				t.Fatalf("Parse(%q) error = %v, want ErrPathParse", tt.expr, err)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Parse(%q) error = %v, want a *ParseError", tt.expr, err)
+			}
+			if pe.Expr != tt.expr || pe.Pos != tt.pos || pe.Msg != tt.msg || !slices.Equal(pe.Expected, tt.expected) {
+				t.Fatalf("Parse(%q) ParseError = {%q %d %q %q}, want {%q %d %q %q}",
+					tt.expr, pe.Expr, pe.Pos, pe.Msg, pe.Expected, tt.expr, tt.pos, tt.msg, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseError_Error(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$.a]", "jsonpath: parse error: unexpected token after path at position 3\n\t$.a]\n\t   ^"},
+		{"$[0", "jsonpath: parse error: expected ] or , at position 3\n\t$[0\n\t   ^"},
+		{"$.café]", "jsonpath: parse error: unexpected token after path at position 7\n\t$.café]\n\t      ^"},
+		{"$[?@.a ==\n]", "jsonpath: parse error: expected literal value at position 10\n\t$[?@.a == ]\n\t          ^"},
+		{"$[?foo(@)]", "jsonpath: parse error: foo at position 3: unknown function\n\t$[?foo(@)]\n\t   ^"},
+		{"$[-a]", "jsonpath: parse error: expected digit after '-' at position 2: lexical error\n\t$[-a]\n\t  ^"},
+		{"$[?" + strings.Repeat("(", 200) + "@" + strings.Repeat(")", 200) + "]", "jsonpath: parse error: more than 128 levels at position 131: expression nested too deeply\n\t$[?" + strings.Repeat("(", 200) + "@" + strings.Repeat(")", 200) + "]\n\t" + strings.Repeat(" ", 131) + "^"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("Parse(%q) error = %q, want %q", tt.expr, err, tt.want)
+		}
+	}
+	if _, err := Parse("$[?foo(@)]"); !errors.Is(err, ErrUnknownFunction) {
+		t.Fatalf("Parse of unknown function error = %v, want ErrUnknownFunction", err)
+	}
+}
+
+func TestParser_ParseAll(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		pos  []int
+	}{
+		{"valid", "$.a[0]", nil},
+		{"one mistake", "$.a[0", []int{5}},
+		{"dot before bracket and trailing token", "$.store.[0].price >", []int{8, 18}},
+		{"selectors", "$[1 2, ?@.a ==, 3]", []int{4, 14}},
+		{"separate segments", "$[?foo(@)].a[-0]", []int{3, 13}},
+		{"whitespace after dot", "$. a[0 0]", []int{3, 7}},
+		{"lexical", "$[1 2, 01]", []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path, errs := NewParser().ParseAll(tt.expr)
+			if (path == nil) != (len(tt.pos) > 0) {
+				t.Fatalf("ParseAll(%q) path = %v, want nil %v", tt.expr, path, len(tt.pos) > 0)
+			}
+			var pos []int
+			for _, err := range errs {
+				var pe *ParseError
+				if !errors.Is(err, ErrPathParse) || !errors.As(err, &pe) {
+					t.Fatalf("ParseAll(%q) error = %v, want ErrPathParse and a *ParseError", tt.expr, err)
+				}
+				pos = append(pos, pe.Pos)
+			}
+			if !slices.Equal(pos, tt.pos) {
+				t.Fatalf("ParseAll(%q) error positions = %v, want %v: %v", tt.expr, pos, tt.pos, errs)
+			}
+			if _, err := Parse(tt.expr); len(tt.pos) > 0 && errs[0].Error() != err.Error() {
+				t.Fatalf("ParseAll(%q) first error = %v, want Parse error %v", tt.expr, errs[0], err)
+			}
+		})
+	}
+}
+
+func TestParseError_Detail(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{"ascii", "$.a[0 1]", "" +
+			"$.a[0 1]\n" +
+			"      ^"},
+		{"multibyte", "$.café.naïve[x]", "" +
+			"$.café.naïve[x]\n" +
+			"             ^"},
+		{"combining mark", "$.cafe\u0301 x", "" +
+			"$.cafe\u0301 x\n" +
+			"       ^"},
+		{"end of input", "$.a[0", "" +
+			"$.a[0\n" +
+			"     ^"},
+		{"end of multibyte input", "$['日本'", "" +
+			"$['日本'\n" +
+			"      ^"},
+		{"blank space", "$[?@.a ==\n\t]", "" +
+			"$[?@.a ==  ]\n" +
+			"           ^"},
+		{"start", "a", "" +
+			"a\n" +
+			"^"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tt.expr)
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Parse(%q) error = %v, want a *ParseError", tt.expr, err)
+			}
+			if got := pe.Detail(); got != tt.want {
+				t.Fatalf("Parse(%q) Detail() =\n%s\nwant\n%s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package jsonpath_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/agentable/jsonpath"
+)
+
+func Example() {
+	store := map[string]any{
+		"book": []any{
+			map[string]any{"title": "Sayings of the Century", "price": 8.95},
+			map[string]any{"title": "Moby Dick", "price": 8.99},
+			map[string]any{"title": "The Lord of the Rings", "price": 22.99},
+		},
+	}
+
+	path, err := jsonpath.Parse("$.book[?@.price < 10].title")
+	if err != nil {
+		panic(err)
+	}
+	for title := range path.Select(store).All() {
+		fmt.Println(title)
+	}
+	// Output:
+	// Sayings of the Century
+	// Moby Dick
+}
+
+func ExampleQueryJSON() {
+	src := []byte(`{"users": [{"name": "Alice", "age": 31}, {"name": "Bob", "age": 17}]}`)
+
+	nodes, err := jsonpath.QueryJSON(src, jsonpath.MustParse("$.users[?@.age >= 18].name"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(nodes)
+	// Output:
+	// [Alice]
+}
+
+func ExamplePath_SelectLocated() {
+	doc := map[string]any{
+		"a/b": []any{"x", "y"},
+	}
+
+	for node := range jsonpath.MustParse("$['a/b'][*]").SelectLocated(doc).All() {
+		fmt.Println(node.Path, node.Path.Pointer(), node.Value)
+	}
+	// Output:
+	// $['a/b'][0] /a~1b/0 x
+	// $['a/b'][1] /a~1b/1 y
+}
+
+var errUpperArgs = errors.New("upper() takes one value argument")
+
+// upperFunc is a custom filter function that upper-cases a string.
+type upperFunc struct{}
+
+func (upperFunc) Name() string                  { return "upper" }
+func (upperFunc) ResultType() jsonpath.FuncType { return jsonpath.FuncValue }
+
+func (upperFunc) Validate(args []jsonpath.ArgType) error {
+	if len(args) != 1 || args[0] == jsonpath.ArgFilterQuery {
+		return errUpperArgs
+	}
+	return nil
+}
+
+func (upperFunc) Call(args []any) any {
+	if s, ok := args[0].(string); ok {
+		return strings.ToUpper(s)
+	}
+	return nil
+}
+
+func ExampleNodeList_Enumerate() {
+	nodes := jsonpath.MustParse("$.items[?@ < 0]").Select(map[string]any{
+		"items": []any{3, -1, 4, -5},
+	})
+	for i, v := range nodes.Enumerate() {
+		fmt.Printf("negative #%d: %v\n", i+1, v)
+	}
+	// Output:
+	// negative #1: -1
+	// negative #2: -5
+}
+
+func ExampleNodeList_First() {
+	nodes := jsonpath.MustParse("$.items[?@ < 0]").Select(map[string]any{
+		"items": []any{3, -1, 4, -5},
+	})
+	first, _ := nodes.First()
+	last, _ := nodes.Last()
+	fmt.Println(first, last)
+
+	if _, ok := jsonpath.MustParse("$.items[?@ > 10]").Select(map[string]any{"items": []any{3}}).First(); !ok {
+		fmt.Println("none above 10")
+	}
+	// Output:
+	// -1 -5
+	// none above 10
+}
+
+func ExampleNodeList_One() {
+	config := map[string]any{
+		"servers": []any{
+			map[string]any{"name": "primary", "host": "db1.internal"},
+			map[string]any{"name": "replica", "host": "db2.internal"},
+		},
+	}
+
+	host, err := jsonpath.MustParse("$.servers[?@.name == 'primary'].host").Select(config).One()
+	fmt.Println(host, err)
+
+	_, err = jsonpath.MustParse("$.servers[*].host").Select(config).One()
+	fmt.Println(errors.Is(err, jsonpath.ErrMultipleMatches))
+	// Output:
+	// db1.internal <nil>
+	// true
+}
+
+func ExampleWithFunctions() {
+	parser := jsonpath.NewParser(jsonpath.WithFunctions(upperFunc{}))
+	path := parser.MustParse("$[?upper(@) == 'GO']")
+
+	fmt.Println(path.Select([]any{"go", "Go", "rust"}))
+	// Output:
+	// [go Go]
+}
+
+func ExampleWithReverseOrder() {
+	path := jsonpath.NewParser(jsonpath.WithReverseOrder()).MustParse("$[*]")
+
+	fmt.Println(path.Select([]any{1, 2, 3}))
+	// Output:
+	// [3 2 1]
+}
+
+func ExampleNormalizedPath_Compare() {
+	paths := []jsonpath.NormalizedPath{
+		{jsonpath.NameElement("b")},
+		{jsonpath.NameElement("a"), jsonpath.IndexElement(1)},
+		{jsonpath.IndexElement(0)},
+		{jsonpath.NameElement("a")},
+	}
+
+	slices.SortFunc(paths, jsonpath.NormalizedPath.Compare)
+	for _, p := range paths {
+		fmt.Println(p)
+	}
+	// Output:
+	// $[0]
+	// $['a']
+	// $['a'][1]
+	// $['b']
+}
+
+func ExampleLocatedNodeList_Deduplicate() {
+	nodes := jsonpath.MustParse("$[0, 1, 0]").SelectLocated([]any{"x", "y"})
+	fmt.Println(len(nodes))
+
+	for p := range nodes.Deduplicate().Paths() {
+		fmt.Println(p)
+	}
+	// Output:
+	// 3
+	// $[0]
+	// $[1]
+}
+
+func ExampleLocatedNodeList_Query() {
+	doc := map[string]any{
+		"orders": []any{
+			map[string]any{"id": "a1", "items": []any{"pen"}},
+			map[string]any{"id": "b2", "items": []any{"ink", "pad"}},
+		},
+	}
+
+	orders := jsonpath.MustParse("$.orders[*]").SelectLocated(doc)
+	items, err := orders.Query(jsonpath.MustParseRelative("@.items[-1]"))
+	if err != nil {
+		panic(err)
+	}
+	for _, n := range items {
+		fmt.Println(n.Path, n.Value)
+	}
+	// Output:
+	// $['orders'][0]['items'][0] pen
+	// $['orders'][1]['items'][1] pad
+}
+
+func ExampleNormalizedPath_Elements() {
+	doc := map[string]any{"store": map[string]any{"book": []any{map[string]any{"title": "Moby Dick"}}}}
+	n, _ := jsonpath.MustParse("$..title").SelectLocated(doc).First()
+
+	// Render the path in dot notation.
+	var buf strings.Builder
+	buf.WriteString("$")
+	for _, e := range n.Path.Elements() {
+		if name, ok := jsonpath.IsName(e); ok {
+			buf.WriteString("." + name)
+		} else if idx, ok := jsonpath.IsIndex(e); ok {
+			fmt.Fprintf(&buf, "[%d]", idx)
+		}
+	}
+	fmt.Println(buf.String())
+	// Output:
+	// $.store.book[0].title
+}
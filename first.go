@@ -0,0 +1,478 @@
+package jsonpath
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/agentable/jsonpath/internal/ast"
+)
+
+// SelectFirst returns the first node [Path.Select] would return for input,
+// and false if p matches nothing. Rather than building each segment's node
+// list, it follows one node at a time through the remaining segments and
+// stops at the first leaf, so wildcards and descendant segments such as
+// ..price walk the document only until the first match is found. Filter
+// expressions are still evaluated in full for the nodes visited. As with
+// Select, which node comes first is undefined when it depends on the order of
+// object members.
+func (p *Path) SelectFirst(input any) (any, bool) {
+	if p.query == nil {
+		return nil, false
+	}
+	if p.singular() {
+		// A separate evaluator, which the closures of first cannot make
+		// escape, keeps singular queries free of allocations.
+		e := p.opts.evaluator(input)
+		v, ok := e.singular(p.query.Segments(), input)
+		e.env.Release()
+		return v, ok
+	}
+	e := p.opts.evaluator(input)
+	v, ok := e.first(p.query.Segments(), input)
+	e.env.Release()
+	return v, ok
+}
+
+// Exists reports whether p matches at least one node in input. Like
+// [Path.SelectFirst] it stops at the first match; for a singular query, one
+// with only name and index selectors, it allocates nothing. A member or
+// element that holds null exists, as in an RFC 9535 existence test.
+func (p *Path) Exists(input any) bool {
+	_, ok := p.SelectFirst(input)
+	return ok
+}
+
+// SelectOne returns the only node p matches in input. It returns an error
+// wrapping [ErrNoMatch] if nothing matches and [ErrMultipleMatches] if more
+// than one node does, naming the path and the number of matches, and the
+// error of [Path.SelectE] if evaluation aborts.
+func (p *Path) SelectOne(input any) (any, error) {
+	if p.query != nil && p.singular() {
+		if v, ok := p.SelectFirst(input); ok {
+			return v, nil
+		}
+		return nil, p.checkOne(0)
+	}
+	nodes, _, err := p.SelectE(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkOne(len(nodes)); err != nil {
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// SelectOneLocated is the located variant of [Path.SelectOne]. When more
+// than one node matches, the error also lists the normalized paths of the
+// first few.
+func (p *Path) SelectOneLocated(input any) (*LocatedNode, error) {
+	nodes, _, err := p.SelectLocatedE(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkOne(len(nodes)); err != nil {
+		if len(nodes) > 1 {
+			const maxListed = 3
+			paths := make([]string, 0, maxListed)
+			for _, n := range nodes[:min(len(nodes), maxListed)] {
+				paths = append(paths, n.Path.String())
+			}
+			if len(nodes) > maxListed {
+				paths = append(paths, "...")
+			}
+			return nil, fmt.Errorf("%w at %s", err, strings.Join(paths, ", "))
+		}
+		return nil, err
+	}
+	return nodes[0], nil
+}
+
+// checkOne returns the error of [Path.SelectOne] for n matches, or nil if n
+// is 1.
+func (p *Path) checkOne(n int) error {
+	switch n {
+	case 0:
+		return fmt.Errorf("%w: %s selected 0 nodes", ErrNoMatch, p)
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s selected %d nodes", ErrMultipleMatches, p, n)
+	}
+}
+
+// Count returns the number of nodes [Path.Select] would return for input,
+// counting duplicates such as those of $[0,0], without collecting them: like
+// [Path.SelectFirst] it follows one node at a time through the segments.
+// Holding no node lists, it is not subject to [WithMaxIntermediateNodes].
+func (p *Path) Count(input any) int {
+	if p.query == nil {
+		return 0
+	}
+	if p.singular() {
+		if _, ok := p.SelectFirst(input); ok {
+			return 1
+		}
+		return 0
+	}
+	e := p.opts.evaluator(input)
+	n := 0
+	e.walk(p.query.Segments(), input, func(any) bool {
+		n++
+		return e.maxResults == 0 || n < e.maxResults
+	})
+	e.env.Release()
+	return n
+}
+
+// SelectFunc calls fn with each node [Path.Select] would return for input, in
+// the same order, until fn returns false. Like [Path.SelectFirst] it follows
+// one node at a time through the segments, so no node list is built and
+// returning false stops the traversal where it is, even inside a wildcard or
+// descendant segment. The limit set by [WithMaxIntermediateNodes] does not
+// apply.
+func (p *Path) SelectFunc(input any, fn func(value any) bool) {
+	if p.query == nil {
+		return
+	}
+	e := p.opts.evaluator(input)
+	e.walk(p.query.Segments(), input, fn)
+	e.env.Release()
+}
+
+// SelectLocatedFunc is the located variant of [Path.SelectFunc].
+func (p *Path) SelectLocatedFunc(input any, fn func(node *LocatedNode) bool) {
+	if p.query == nil {
+		return
+	}
+	e := p.opts.evaluator(input)
+	e.walkLocated(p.query.Segments(), input, nil, fn)
+	e.env.Release()
+}
+
+// SelectSeq returns an iterator over the nodes [Path.Select] would return for
+// input, in the same order. Evaluation happens as the iterator is ranged
+// over, as in [Path.SelectFunc], and stops when the loop breaks.
+func (p *Path) SelectSeq(input any) iter.Seq[any] {
+	return func(yield func(any) bool) {
+		p.SelectFunc(input, yield)
+	}
+}
+
+// SelectLocatedSeq is the located variant of [Path.SelectSeq], yielding the
+// path and value of each node.
+func (p *Path) SelectLocatedSeq(input any) iter.Seq2[NormalizedPath, any] {
+	return func(yield func(NormalizedPath, any) bool) {
+		p.SelectLocatedFunc(input, func(n *LocatedNode) bool {
+			return yield(n.Path, n.Value)
+		})
+	}
+}
+
+// SelectFirstLocated is the located variant of [Path.SelectFirst]. It returns
+// nil if p matches nothing.
+func (p *Path) SelectFirstLocated(input any) *LocatedNode {
+	if p.query == nil {
+		return nil
+	}
+	e := p.opts.evaluator(input)
+	n := e.firstLocated(p.query.Segments(), input, nil)
+	e.env.Release()
+	return n
+}
+
+// first applies segments to node depth first, returning the first resulting
+// node in the order of [Path.Select].
+func (e *evaluator) first(segments []ast.Segment, node any) (v any, ok bool) {
+	e.walk(segments, node, func(n any) bool {
+		v, ok = n, true
+		return false
+	})
+	return v, ok
+}
+
+// walk applies segments to node depth first, calling yield with each
+// resulting node in the order of [Path.Select] until yield returns false.
+// Only the matches of one selector list applied to one node are collected at
+// a time; wildcards and descendant segments visit children in place. It
+// reports whether yield never returned false.
+func (e *evaluator) walk(segments []ast.Segment, node any, yield func(any) bool) bool {
+	if (e.ctx != nil || e.env.Err != nil) && e.over(0) {
+		return false
+	}
+	node = e.env.Node(node)
+	if len(segments) == 0 {
+		return yield(node)
+	}
+	seg, rest := &segments[0], segments[1:]
+	switch {
+	case seg.IsDescendant():
+		if e.maxDepth > 0 && e.over(0) {
+			return false
+		}
+		if !e.enter(node) {
+			return true
+		}
+		ok := (e.reverse || e.walkMatches(seg, rest, node, yield)) &&
+			e.walkChildren(segments, node, nil, yield) &&
+			(!e.reverse || e.walkMatches(seg, rest, node, yield))
+		e.leave()
+		return ok
+	default:
+		return e.walkSelected(seg, rest, node, yield)
+	}
+}
+
+// walkMatches is walkSelected for a descendant segment visiting node: a later
+// descendant segment tracks the ancestors of its nodes, and with them their
+// depth, from each match.
+func (e *evaluator) walkMatches(seg *ast.Segment, rest []ast.Segment, node any, yield func(any) bool) bool {
+	ancestors := e.ancestors
+	e.ancestors = ancestors[len(ancestors):]
+	ok := e.walkSelected(seg, rest, node, yield)
+	e.ancestors = ancestors
+	return ok
+}
+
+// walkSelected applies the selectors of seg to node, then walks the rest of
+// the segments from each match. A lone selector other than a slice is applied
+// without collecting its matches.
+func (e *evaluator) walkSelected(seg *ast.Segment, rest []ast.Segment, node any, yield func(any) bool) bool {
+	if filter, ok := childSelector(seg); ok {
+		return e.walkChildren(rest, node, filter, yield)
+	}
+	if selectors := seg.Selectors(); len(selectors) == 1 && selectors[0].IsSingular() && !e.env.FoldNames {
+		v, ok := e.selectOne(&selectors[0], node)
+		return !ok || e.walk(rest, v, yield)
+	}
+	for _, child := range e.appendSelectors(nil, seg, node) {
+		if !e.walk(rest, child, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// singular reports whether p always selects at most one node, so that it can
+// be evaluated by [evaluator.singular]. With [WithCaseInsensitiveNames] a
+// name selector may select several members.
+func (p *Path) singular() bool {
+	return p.query.IsSingular() && !p.opts.foldNames
+}
+
+// singular applies segments of one name or index selector each to node.
+func (e *evaluator) singular(segments []ast.Segment, node any) (any, bool) {
+	node = e.env.Node(node)
+	for i := range segments {
+		v, ok := e.selectOne(&segments[i].Selectors()[0], node)
+		if !ok {
+			return nil, false
+		}
+		node = e.env.Node(v)
+	}
+	return node, true
+}
+
+// selectOne applies a name or index selector to node without collecting the
+// match in a node list.
+func (e *evaluator) selectOne(sel *ast.Selector, node any) (any, bool) {
+	switch sel.Kind {
+	case ast.Name:
+		if m, ok := node.(map[string]any); ok {
+			return e.env.Member(m, sel.Name)
+		}
+	case ast.Index:
+		if arr, ok := node.([]any); ok {
+			if idx := normalizeIndex(sel.Index, len(arr)); idx >= 0 {
+				return arr[idx], true
+			}
+			return nil, false
+		}
+		return ast.SparseIndex(node, sel.Index)
+	}
+	return nil, false
+}
+
+// walkChildren walks segments from each element or member value of node in
+// evaluation order that satisfies filter, or from all of them if filter is
+// nil.
+func (e *evaluator) walkChildren(segments []ast.Segment, node any, filter *ast.FilterExpr, yield func(any) bool) bool {
+	switch v := node.(type) {
+	case map[string]any:
+		for _, child := range v {
+			if (filter == nil || filter.Eval(child, &e.env)) && !e.walk(segments, child, yield) {
+				return false
+			}
+		}
+	case []any:
+		for i := range v {
+			if e.reverse {
+				i = len(v) - 1 - i
+			}
+			if (filter == nil || filter.Eval(v[i], &e.env)) && !e.walk(segments, v[i], yield) {
+				return false
+			}
+		}
+	default:
+		for _, entry := range e.sparseEntries(node) {
+			if (filter == nil || filter.Eval(entry.Value, &e.env)) && !e.walk(segments, entry.Value, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// firstLocated is the located variant of first.
+func (e *evaluator) firstLocated(segments []ast.Segment, node any, path NormalizedPath) (n *LocatedNode) {
+	e.walkLocated(segments, node, path, func(found *LocatedNode) bool {
+		n = found
+		return false
+	})
+	return n
+}
+
+// walkLocated is the located variant of walk.
+func (e *evaluator) walkLocated(segments []ast.Segment, node any, path NormalizedPath, yield func(*LocatedNode) bool) bool {
+	if (e.ctx != nil || e.env.Err != nil) && e.over(0) {
+		return false
+	}
+	node = e.env.Node(node)
+	if len(segments) == 0 {
+		return yield(&LocatedNode{Value: node, Path: path})
+	}
+	seg, rest := &segments[0], segments[1:]
+	if !seg.IsDescendant() {
+		return e.walkSelectedLocated(seg, rest, node, path, yield)
+	}
+	buf := slices.Clone(path)
+	return e.walkDescendantLocated(seg, rest, node, &buf, len(path), yield)
+}
+
+// walkDescendantLocated is the descendant segment seg of walkLocated, for
+// node at (*path)[:depth]. Like appendDescendantLocated it shares the path
+// buffer with the descendants it visits, as their paths are only copied
+// once they match.
+func (e *evaluator) walkDescendantLocated(seg *ast.Segment, rest []ast.Segment, node any, path *NormalizedPath, depth int, yield func(*LocatedNode) bool) bool {
+	if e.maxDepth > 0 && e.over(0) {
+		return false
+	}
+	if !e.enter(node) {
+		return true
+	}
+	ok := (e.reverse || e.walkMatchesLocated(seg, rest, node, (*path)[:depth], yield)) &&
+		e.walkDescendantChildrenLocated(seg, rest, node, path, depth, yield) &&
+		(!e.reverse || e.walkMatchesLocated(seg, rest, node, (*path)[:depth], yield))
+	e.leave()
+	return ok
+}
+
+// walkDescendantChildrenLocated calls walkDescendantLocated on each child of
+// node, in the order of walkChildrenLocated.
+func (e *evaluator) walkDescendantChildrenLocated(seg *ast.Segment, rest []ast.Segment, node any, path *NormalizedPath, depth int, yield func(*LocatedNode) bool) bool {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if !e.descendLocated(seg, rest, child, e.nameElement(key), path, depth, yield) {
+				return false
+			}
+		}
+	case []any:
+		for i := range v {
+			if e.reverse {
+				i = len(v) - 1 - i
+			}
+			if !e.descendLocated(seg, rest, v[i], IndexElement(i), path, depth, yield) {
+				return false
+			}
+		}
+	default:
+		for _, entry := range e.sparseEntries(node) {
+			if !e.descendLocated(seg, rest, entry.Value, IndexElement(entry.Index), path, depth, yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// descendLocated visits child, the member or element elem of the node at
+// (*path)[:depth], with walkDescendantLocated, after the checks walkLocated
+// makes on every node.
+func (e *evaluator) descendLocated(seg *ast.Segment, rest []ast.Segment, child any, elem PathElement, path *NormalizedPath, depth int, yield func(*LocatedNode) bool) bool {
+	if (e.ctx != nil || e.env.Err != nil) && e.over(0) {
+		return false
+	}
+	*path = append((*path)[:depth], elem)
+	return e.walkDescendantLocated(seg, rest, e.env.Node(child), path, depth+1, yield)
+}
+
+// walkMatchesLocated is the located variant of walkMatches.
+func (e *evaluator) walkMatchesLocated(seg *ast.Segment, rest []ast.Segment, node any, path NormalizedPath, yield func(*LocatedNode) bool) bool {
+	ancestors := e.ancestors
+	e.ancestors = ancestors[len(ancestors):]
+	ok := e.walkSelectedLocated(seg, rest, node, path, yield)
+	e.ancestors = ancestors
+	return ok
+}
+
+// walkSelectedLocated is the located variant of walkSelected.
+func (e *evaluator) walkSelectedLocated(seg *ast.Segment, rest []ast.Segment, node any, path NormalizedPath, yield func(*LocatedNode) bool) bool {
+	if filter, ok := childSelector(seg); ok {
+		return e.walkChildrenLocated(rest, node, path, filter, yield)
+	}
+	for _, child := range e.appendSelectorsLocated(nil, seg, node, path) {
+		if !e.walkLocated(rest, child.Value, child.Path, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkChildrenLocated is the located variant of walkChildren.
+func (e *evaluator) walkChildrenLocated(segments []ast.Segment, node any, path NormalizedPath, filter *ast.FilterExpr, yield func(*LocatedNode) bool) bool {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if (filter == nil || filter.Eval(child, &e.env)) && !e.walkLocated(segments, child, extendPath(path, e.nameElement(key)), yield) {
+				return false
+			}
+		}
+	case []any:
+		for i := range v {
+			if e.reverse {
+				i = len(v) - 1 - i
+			}
+			if (filter == nil || filter.Eval(v[i], &e.env)) && !e.walkLocated(segments, v[i], extendPath(path, IndexElement(i)), yield) {
+				return false
+			}
+		}
+	default:
+		for _, entry := range e.sparseEntries(node) {
+			if (filter == nil || filter.Eval(entry.Value, &e.env)) && !e.walkLocated(segments, entry.Value, extendPath(path, IndexElement(entry.Index)), yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// childSelector reports whether seg has a single wildcard or filter selector,
+// whose matches can be visited without collecting them, and returns the
+// filter, or nil for a wildcard.
+func childSelector(seg *ast.Segment) (*ast.FilterExpr, bool) {
+	selectors := seg.Selectors()
+	if len(selectors) != 1 {
+		return nil, false
+	}
+	switch selectors[0].Kind {
+	case ast.Wildcard:
+		return nil, true
+	case ast.Filter:
+		return selectors[0].Filter, true
+	default:
+		return nil, false
+	}
+}
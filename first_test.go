@@ -0,0 +1,548 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath_SelectFirst(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"title": "Sayings", "price": 8.95, "tags": []any{"a", "b"}},
+				map[string]any{"title": "Sword", "price": 12.99},
+				map[string]any{"title": "Moby Dick", "price": 8.99, "isbn": "0-553"},
+			},
+		},
+		"items": []any{[]any{1.0, 2.0}, []any{}, []any{3.0, []any{4.0}}},
+	}
+
+	tests := []struct {
+		expr string
+		want any
+		path string
+		ok   bool
+	}{
+		{expr: "$", want: input, path: "$", ok: true},
+		{expr: "$.store.book[0].title", want: "Sayings", path: "$['store']['book'][0]['title']", ok: true},
+		{expr: "$.store.book[*].price", want: 8.95, path: "$['store']['book'][0]['price']", ok: true},
+		{expr: "$.store.book[-1:0:-1].title", want: "Moby Dick", path: "$['store']['book'][2]['title']", ok: true},
+		{expr: "$.store.book[2,0].title", want: "Moby Dick", path: "$['store']['book'][2]['title']", ok: true},
+		{expr: "$.store.book[?@.price > 10].title", want: "Sword", path: "$['store']['book'][1]['title']", ok: true},
+		{expr: "$.store.book[*].isbn", want: "0-553", path: "$['store']['book'][2]['isbn']", ok: true},
+		{expr: "$.store..isbn", want: "0-553", path: "$['store']['book'][2]['isbn']", ok: true},
+		{expr: "$.items[*][*]", want: 1.0, path: "$['items'][0][0]", ok: true},
+		{expr: "$.items[1:][*][*]", want: 4.0, path: "$['items'][2][1][0]", ok: true},
+		{expr: "$.items..[1]", want: []any{}, path: "$['items'][1]", ok: true},
+		{expr: "$.items..*[?@ > 2]", want: 3.0, path: "$['items'][2][0]", ok: true},
+		{expr: "$.missing"},
+		{expr: "$.store.book[*].missing"},
+		{expr: "$..missing"},
+		{expr: "$.items[1][*]"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			p := MustParse(tc.expr)
+			got, ok := p.SelectFirst(input)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.want, got)
+
+			n := p.SelectFirstLocated(input)
+			if !tc.ok {
+				assert.Nil(t, n)
+				return
+			}
+			require.NotNil(t, n)
+			assert.Equal(t, tc.want, n.Value)
+			assert.Equal(t, tc.path, n.Path.String())
+		})
+	}
+
+	t.Run("reverse", func(t *testing.T) {
+		t.Parallel()
+		p := NewParser(WithReverseOrder())
+		for expr, want := range map[string]any{
+			"$.store.book[*].title": "Moby Dick",
+			"$.items..*":            4.0,
+			"$.items[*][*]":         []any{4.0},
+			"$.items..[0]":          4.0,
+		} {
+			got, ok := p.MustParse(expr).SelectFirst(input)
+			assert.True(t, ok, expr)
+			assert.Equal(t, want, got, expr)
+			n := p.MustParse(expr).SelectFirstLocated(input)
+			require.NotNil(t, n, expr)
+			assert.Equal(t, want, n.Value, expr)
+		}
+	})
+
+	t.Run("stops_at_first_match", func(t *testing.T) {
+		t.Parallel()
+		// The second element contains itself.
+		cyclic := []any{map[string]any{"price": 1.0}, nil}
+		cyclic[1] = cyclic
+		for _, expr := range []string{"$..price", "$[*].price", "$..*[?@ == 1]"} {
+			got, ok := MustParse(expr).SelectFirst(cyclic)
+			assert.True(t, ok, expr)
+			assert.Equal(t, 1.0, got, expr)
+			n := MustParse(expr).SelectFirstLocated(cyclic)
+			require.NotNil(t, n, expr)
+			assert.Equal(t, 1.0, n.Value, expr)
+		}
+	})
+
+	t.Run("zero_path", func(t *testing.T) {
+		t.Parallel()
+		var p Path
+		_, ok := p.SelectFirst(input)
+		assert.False(t, ok)
+		assert.Nil(t, p.SelectFirstLocated(input))
+	})
+}
+
+func TestPath_SelectFirst_CTS(t *testing.T) {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	require.NoError(t, err)
+	var suite struct {
+		Tests []struct {
+			Name     string `json:"name"`
+			Selector string `json:"selector"`
+			Document any    `json:"document"`
+			Invalid  bool   `json:"invalid_selector"`
+		} `json:"tests"`
+	}
+	require.NoError(t, json.Unmarshal(data, &suite))
+
+	for _, tc := range suite.Tests {
+		if tc.Invalid {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			p := MustParse(tc.Selector)
+			all := p.SelectLocated(tc.Document)
+			got, ok := p.SelectFirst(tc.Document)
+			n := p.SelectFirstLocated(tc.Document)
+			if len(all) == 0 {
+				assert.False(t, ok)
+				assert.Nil(t, n)
+				return
+			}
+			// Object members have no defined order, so the first match need
+			// only be one of the matches.
+			require.True(t, ok)
+			assert.Contains(t, slices.Collect(all.Values()), got)
+			require.NotNil(t, n)
+			assert.Contains(t, all, n)
+		})
+	}
+}
+
+func TestPath_SelectFunc(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"a": []any{1.0, []any{2.0, 3.0}, map[string]any{"b": 4.0}},
+		"c": []any{5.0, 5.0},
+	}
+	for _, expr := range []string{"$", "$.a[*]", "$.a..*", "$.c[0,1,0]", "$.a[?@ > 0]", "$.a[1][-1:0:-1]", "$.missing"} {
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+			p := MustParse(expr)
+			var got []any
+			p.SelectFunc(input, func(v any) bool {
+				got = append(got, v)
+				return true
+			})
+			want := p.Select(input)
+			if len(want) == 0 {
+				assert.Empty(t, got)
+			} else {
+				assert.Equal(t, []any(want), got)
+			}
+			var located LocatedNodeList
+			p.SelectLocatedFunc(input, func(n *LocatedNode) bool {
+				located = append(located, n)
+				return true
+			})
+			if wantLocated := p.SelectLocated(input); len(wantLocated) == 0 {
+				assert.Empty(t, located)
+			} else {
+				assert.Equal(t, wantLocated, located)
+			}
+		})
+	}
+
+	// The second element contains itself.
+	cyclic := []any{1.0, nil, 2.0}
+	cyclic[1] = cyclic
+	nested := []any{1.0, []any{1.0, []any{1.0, []any{1.0}, 2.0}, 2.0}, 2.0}
+
+	t.Run("stop_mid_wildcard", func(t *testing.T) {
+		t.Parallel()
+		var got []any
+		MustParse("$[*]").SelectFunc([]any{1.0, 2.0, 3.0, 4.0}, func(v any) bool {
+			got = append(got, v)
+			return len(got) < 2
+		})
+		assert.Equal(t, []any{1.0, 2.0}, got)
+
+		var paths []string
+		MustParse("$[*][*]").SelectLocatedFunc(cyclic, func(n *LocatedNode) bool {
+			paths = append(paths, n.Path.String())
+			return len(paths) < 2
+		})
+		assert.Equal(t, []string{"$[1][0]", "$[1][1]"}, paths)
+	})
+
+	t.Run("stop_mid_descendant", func(t *testing.T) {
+		t.Parallel()
+		var got []any
+		MustParse("$..[0]").SelectFunc(nested, func(v any) bool {
+			got = append(got, v)
+			return len(got) < 3
+		})
+		assert.Equal(t, []any{1.0, 1.0, 1.0}, got)
+
+		var paths []string
+		MustParse("$..[?@ == 2]").SelectLocatedFunc([]any{[]any{2.0}, nested}, func(n *LocatedNode) bool {
+			paths = append(paths, n.Path.String())
+			return len(paths) < 3
+		})
+		assert.Equal(t, []string{"$[0][0]", "$[1][2]", "$[1][1][2]"}, paths)
+
+		// In reverse order a node's own matches follow its descendants'.
+		paths = nil
+		NewParser(WithReverseOrder()).MustParse("$..[?@ == 2]").SelectLocatedFunc([]any{[]any{2.0}, []any{2.0, []any{2.0}}}, func(n *LocatedNode) bool {
+			paths = append(paths, n.Path.String())
+			return len(paths) < 2
+		})
+		assert.Equal(t, []string{"$[1][1][0]", "$[1][0]"}, paths)
+	})
+
+	t.Run("zero_path", func(t *testing.T) {
+		t.Parallel()
+		var p Path
+		p.SelectFunc(input, func(any) bool { panic("unreachable") })
+		p.SelectLocatedFunc(input, func(*LocatedNode) bool { panic("unreachable") })
+	})
+}
+
+func TestPath_SelectSeq(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{"store": map[string]any{"book": []any{
+		map[string]any{"title": "A", "price": 12.0},
+		map[string]any{"title": "B", "price": 8.0},
+		map[string]any{"title": "C", "price": 9.0},
+		map[string]any{"title": "D", "price": 5.0},
+	}}}
+	p := MustParse("$..book[?@.price < 10].title")
+	assert.Equal(t, []any(p.Select(input)), slices.Collect(p.SelectSeq(input)))
+
+	var paths []string
+	for path, v := range p.SelectLocatedSeq(input) {
+		paths = append(paths, path.String())
+		assert.Equal(t, MustParse(path.String()).Select(input), NodeList{v})
+	}
+	assert.Equal(t, []string{
+		"$['store']['book'][1]['title']",
+		"$['store']['book'][2]['title']",
+		"$['store']['book'][3]['title']",
+	}, paths)
+
+	// The iterator can be ranged over more than once.
+	assert.Len(t, slices.Collect(p.SelectSeq(input)), 3)
+}
+
+func TestPath_SelectSeq_StopsOnBreak(t *testing.T) {
+	t.Parallel()
+
+	// visit counts the nodes the filter is evaluated on.
+	var visits int
+	visit := newTestFunc("visit", FuncLogical)
+	visit.validateFn = func([]ArgType) error { return nil }
+	visit.callFn = func([]any) any {
+		visits++
+		return true
+	}
+	p := NewParser(WithFunctions(visit))
+
+	books := make([]any, 100)
+	for i := range books {
+		books[i] = map[string]any{"price": float64(100 - i)}
+	}
+	input := []any{map[string]any{"book": books}, []any{[]any{[]any{1.0}}}}
+
+	path := p.MustParse("$..[?visit(@) && @.price < 10]")
+	for v := range path.SelectSeq(input) {
+		assert.Equal(t, map[string]any{"price": 9.0}, v)
+		break
+	}
+	// The filter ran on the root's elements, on the object holding the books
+	// and on the first 92 books; the nested arrays after it were never
+	// reached.
+	assert.Equal(t, 2+1+92, visits)
+
+	visits = 0
+	for path := range p.MustParse("$..[?visit(@)]").SelectLocatedSeq(input) {
+		assert.Equal(t, "$[0]", path.String())
+		break
+	}
+	assert.Equal(t, 1, visits)
+}
+
+func TestPath_Count(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"a": []any{1.0, 2.0, map[string]any{"items": []any{3.0, 4.0}}},
+		"b": map[string]any{"items": []any{5.0}},
+	}
+	tests := []struct {
+		expr string
+		want int
+	}{
+		{"$", 1},
+		{"$.a[0]", 1},
+		{"$.missing", 0},
+		{"$.a[0,0]", 2},
+		{"$.a[0,0,-3]", 3},
+		{"$.a[*]", 3},
+		{"$..items[*]", 3},
+		{"$..items[0,0]", 4},
+		{"$..*", 10},
+		{"$.a[?@ > 1]", 1},
+		{"$..[?@ > 1]", 4},
+		{"$.a[:2]", 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			p := MustParse(tc.expr)
+			assert.Equal(t, tc.want, p.Count(input))
+			assert.Len(t, p.Select(input), tc.want)
+			assert.Equal(t, tc.want, NewParser(WithReverseOrder()).MustParse(tc.expr).Count(input))
+		})
+	}
+
+	var p Path
+	assert.Zero(t, p.Count(input))
+}
+
+func TestPath_Count_CTS(t *testing.T) {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	require.NoError(t, err)
+	var suite struct {
+		Tests []struct {
+			Name     string `json:"name"`
+			Selector string `json:"selector"`
+			Document any    `json:"document"`
+			Invalid  bool   `json:"invalid_selector"`
+		} `json:"tests"`
+	}
+	require.NoError(t, json.Unmarshal(data, &suite))
+
+	for _, tc := range suite.Tests {
+		if tc.Invalid {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			p := MustParse(tc.Selector)
+			assert.Len(t, p.Select(tc.Document), p.Count(tc.Document))
+		})
+	}
+}
+
+func BenchmarkPath_Count(b *testing.B) {
+	// A deep document: 10 levels of objects with 3 members, each holding a
+	// short items array.
+	var build func(depth int) any
+	build = func(depth int) any {
+		node := map[string]any{"items": []any{1.0, 2.0, 3.0}}
+		if depth > 0 {
+			for _, k := range []string{"x", "y", "z"} {
+				node[k] = build(depth - 1)
+			}
+		}
+		return node
+	}
+	input := build(8)
+
+	for _, expr := range []string{"$..items[*]", "$..*"} {
+		path := MustParse(expr)
+		b.Run(expr+"/Count", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_ = path.Count(input)
+			}
+		})
+		b.Run(expr+"/len(Select)", func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_ = len(path.Select(input))
+			}
+		})
+	}
+}
+
+func BenchmarkPath_SelectFirst(b *testing.B) {
+	// A large catalog whose first entry has a price.
+	books := make([]any, 10_000)
+	for i := range books {
+		books[i] = map[string]any{
+			"title":   "t",
+			"price":   float64(i),
+			"authors": []any{map[string]any{"name": "a"}, map[string]any{"name": "b"}},
+		}
+	}
+	input := map[string]any{"store": map[string]any{"book": books}}
+	path := MustParse("$.store.book..price")
+
+	b.Run("SelectFirst", func(b *testing.B) {
+		for b.Loop() {
+			_, _ = path.SelectFirst(input)
+		}
+	})
+	b.Run("Select", func(b *testing.B) {
+		for b.Loop() {
+			_ = path.Select(input)
+		}
+	})
+}
+
+func TestPath_Exists(t *testing.T) {
+	t.Parallel()
+
+	cyclic := []any{map[string]any{"a": nil, "n": 1.0}, nil, []any{}}
+	cyclic[1] = cyclic
+	input := map[string]any{
+		"metadata": map[string]any{"labels": map[string]any{"app": "web", "none": nil}},
+		"items":    cyclic,
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"$", true},
+		{"$.metadata.labels['app']", true},
+		{"$.metadata.labels.none", true},
+		{"$.metadata.labels.missing", false},
+		{"$.items[0].a", true},
+		{"$.items[-3].n", true},
+		{"$.items[3]", false},
+		{"$.metadata.labels[0]", false},
+		{"$.items[*].a", true},
+		{"$.items[*].missing", false},
+		{"$.items[0:2].n", true},
+		{"$.items[?@.n == 1]", true},
+		{"$.items[?@.a == null].n", true},
+		{"$.metadata..app", true},
+		{"$..a", true},
+		{"$.items..n", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, MustParse(tc.expr).Exists(input))
+		})
+	}
+
+	var p Path
+	assert.False(t, p.Exists(input))
+}
+
+func TestPath_Exists_Allocs(t *testing.T) {
+	input := map[string]any{
+		"metadata": map[string]any{"labels": map[string]any{"app": "web"}},
+		"items":    []any{1.0, []any{2.0}},
+	}
+	for _, expr := range []string{"$.metadata.labels['app']", "$.metadata.labels.missing", "$.items[-1][0]", "$"} {
+		path := MustParse(expr)
+		allocs := testing.AllocsPerRun(100, func() {
+			_ = path.Exists(input)
+		})
+		assert.Zero(t, allocs, expr)
+	}
+}
+
+func BenchmarkPath_Exists(b *testing.B) {
+	input := map[string]any{
+		"metadata": map[string]any{"labels": map[string]any{"app": "web"}},
+	}
+	path := MustParse(`$.metadata.labels["app"]`)
+	for b.Loop() {
+		_ = path.Exists(input)
+	}
+}
+
+func TestPath_SelectOne(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"database": map[string]any{"host": "db1", "port": nil},
+		"replicas": []any{map[string]any{"host": "r1"}, map[string]any{"host": "r2"}, map[string]any{"host": "r3"}, map[string]any{"host": "r4"}},
+	}
+	tests := []struct {
+		expr    string
+		want    any
+		path    string
+		wantErr error
+		msg     string
+	}{
+		{expr: "$.database.host", want: "db1", path: "$['database']['host']"},
+		{expr: "$.database.port", want: nil, path: "$['database']['port']"},
+		{expr: "$.replicas[?@.host == 'r2'].host", want: "r2", path: "$['replicas'][1]['host']"},
+		{expr: "$..port", want: nil, path: "$['database']['port']"},
+		{expr: "$.database.user", wantErr: ErrNoMatch, msg: `jsonpath: no match: $["database"]["user"] selected 0 nodes`},
+		{expr: "$.replicas[?@.host == 'x']", wantErr: ErrNoMatch, msg: "selected 0 nodes"},
+		{expr: "$.replicas[0:2].host", wantErr: ErrMultipleMatches, msg: `jsonpath: multiple matches: $["replicas"][0:2]["host"] selected 2 nodes`},
+		{expr: "$.replicas[*].host", wantErr: ErrMultipleMatches, msg: "selected 4 nodes"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			p := MustParse(tc.expr)
+			got, err := p.SelectOne(input)
+			n, locErr := p.SelectOneLocated(input)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				assert.Contains(t, err.Error(), tc.msg)
+				assert.Nil(t, got)
+				require.ErrorIs(t, locErr, tc.wantErr)
+				assert.Contains(t, locErr.Error(), tc.msg)
+				assert.Nil(t, n)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			require.NoError(t, locErr)
+			assert.Equal(t, tc.want, n.Value)
+			assert.Equal(t, tc.path, n.Path.String())
+		})
+	}
+
+	t.Run("located_lists_paths", func(t *testing.T) {
+		t.Parallel()
+		_, err := MustParse("$.replicas[0:2].host").SelectOneLocated(input)
+		assert.EqualError(t, err, `jsonpath: multiple matches: $["replicas"][0:2]["host"] selected 2 nodes at $['replicas'][0]['host'], $['replicas'][1]['host']`)
+		_, err = MustParse("$.replicas[*].host").SelectOneLocated(input)
+		assert.ErrorContains(t, err, "at $['replicas'][0]['host'], $['replicas'][1]['host'], $['replicas'][2]['host'], ...")
+	})
+
+	t.Run("node_limit", func(t *testing.T) {
+		t.Parallel()
+		p := NewParser(WithMaxIntermediateNodes(2)).MustParse("$.replicas[*].host")
+		_, err := p.SelectOne(input)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+		_, err = p.SelectOneLocated(input)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+	})
+}
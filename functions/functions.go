@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"regexp/syntax"
 	"sync"
+	"sync/atomic"
 	"unicode/utf8"
 
 	"github.com/agentable/jsonpath/internal/ast"
@@ -24,6 +25,48 @@ func clearRegexCache() {
 	})
 }
 
+// Stats counts the lookups of the pattern cache shared by match() and
+// search() since the program started or [ResetCacheStats] was last called.
+type Stats struct {
+	Hits     uint64 // lookups answered from the cache
+	Misses   uint64 // lookups of patterns not in the cache
+	Compiles uint64 // patterns compiled successfully after a miss
+	Rejected uint64 // patterns that failed to compile; these are never cached
+	Patterns int    // distinct patterns currently cached
+}
+
+// cacheStats holds the counters behind [CacheStats].
+var cacheStats struct {
+	hits, misses, compiles, rejected atomic.Uint64
+}
+
+// CacheStats returns the current pattern cache counters. A Patterns count
+// that keeps growing points at queries building patterns from data, each of
+// which is compiled and kept once.
+func CacheStats() Stats {
+	s := Stats{
+		Hits:     cacheStats.hits.Load(),
+		Misses:   cacheStats.misses.Load(),
+		Compiles: cacheStats.compiles.Load(),
+		Rejected: cacheStats.rejected.Load(),
+	}
+	reCache.Range(func(_, _ any) bool {
+		s.Patterns++
+		return true
+	})
+	return s
+}
+
+// ResetCacheStats zeroes the counters and empties the pattern cache. It is
+// meant for tests; lookups running concurrently may be counted either way.
+func ResetCacheStats() {
+	clearRegexCache()
+	cacheStats.hits.Store(0)
+	cacheStats.misses.Store(0)
+	cacheStats.compiles.Store(0)
+	cacheStats.rejected.Store(0)
+}
+
 // ErrArgType indicates a function argument has an incompatible type.
 var ErrArgType = errors.New("incompatible argument type")
 
@@ -219,18 +262,87 @@ func (ValueFunc) Call(args []any) any {
 	return nodes[0]
 }
 
+// QuoteFunc implements quote(), an extension function that escapes a string
+// for literal use as a match() or search() pattern, as in
+// search(@.name, quote($.needle)). It is not an RFC 9535 built-in and is not
+// included in [Builtins]; register it explicitly.
+//
+// Parameters: 1 ValueType (string)
+// Result: ValueType (string, nil for non-string input)
+type QuoteFunc struct{}
+
+func (QuoteFunc) Name() string             { return "quote" }
+func (QuoteFunc) ResultType() ast.FuncType { return ast.Value }
+
+func (QuoteFunc) Validate(args []ast.ArgType) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected 1, got %d: %w", len(args), ast.ErrArgCount)
+	}
+	if !ast.ArgConvertsTo(args[0], ast.Value) {
+		return fmt.Errorf("cannot convert argument to ValueType: %w", ErrArgType)
+	}
+	return nil
+}
+
+// Call returns the argument quoted by [QuoteRegexLiteral], or nil if the
+// argument is not a string.
+func (QuoteFunc) Call(args []any) any {
+	if len(args) == 0 {
+		return nil
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil
+	}
+	return QuoteRegexLiteral(s)
+}
+
+// QuoteRegexLiteral returns a pattern that matches s literally. Unlike
+// [regexp.QuoteMeta] it only emits escapes valid in RFC 9485 I-Regexp: the
+// metacharacters .+*?()|[]{}^\ are escaped with a backslash, and $, which
+// I-Regexp has no escape for but Go treats as an anchor, becomes [$].
+func QuoteRegexLiteral(s string) string {
+	var buf []byte
+	for i := range len(s) {
+		switch c := s[i]; c {
+		case '.', '+', '*', '?', '(', ')', '|', '[', ']', '{', '}', '^', '\\':
+			if buf == nil {
+				buf = append(make([]byte, 0, len(s)+8), s[:i]...)
+			}
+			buf = append(buf, '\\', c)
+		case '$':
+			if buf == nil {
+				buf = append(make([]byte, 0, len(s)+8), s[:i]...)
+			}
+			buf = append(buf, "[$]"...)
+		default:
+			if buf != nil {
+				buf = append(buf, c)
+			}
+		}
+	}
+	if buf == nil {
+		return s
+	}
+	return string(buf)
+}
+
 // compileIRegexp compiles an I-Regexp pattern (RFC 9485) into a Go *regexp.Regexp.
 // It replaces "." (OpAnyChar) with "[^\n\r]" per RFC 9485 §5.
 // Results are cached via sync.Map for concurrent safety.
 // Returns nil if the pattern is invalid.
 func compileIRegexp(pattern string) *regexp.Regexp {
 	if v, ok := reCache.Load(pattern); ok {
+		cacheStats.hits.Add(1)
 		return v.(*regexp.Regexp)
 	}
+	cacheStats.misses.Add(1)
 	re, err := compileIRegexpUncached(pattern)
 	if err != nil {
+		cacheStats.rejected.Add(1)
 		return nil
 	}
+	cacheStats.compiles.Add(1)
 	reCache.Store(pattern, re)
 	return re
 }
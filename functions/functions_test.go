@@ -870,3 +870,114 @@ func BenchmarkRegexCache(b *testing.B) {
 		})
 	})
 }
+
+func TestQuoteRegexLiteral(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "abc", want: "abc"},
+		{name: "empty", in: "", want: ""},
+		{name: "dot", in: "a.b", want: `a\.b`},
+		{name: "quantifiers", in: "+*?{2}", want: `\+\*\?\{2\}`},
+		{name: "groups", in: "(a|b)", want: `\(a\|b\)`},
+		{name: "class", in: "[^x]", want: `\[\^x\]`},
+		{name: "backslash", in: `\d`, want: `\\d`},
+		{name: "dollar", in: "$5", want: "[$]5"},
+		{name: "hyphen_unescaped", in: "a-b", want: "a-b"},
+		{name: "non_ascii", in: "é.日", want: `é\.日`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got := QuoteRegexLiteral(tc.in)
+			assert.Equal(t, tc.want, got)
+
+			// The quoted pattern matches exactly the input, both through
+			// the I-Regexp translation and when anchored by match().
+			assert.Equal(t, true, MatchFunc{}.Call([]any{tc.in, got}))
+			assert.Equal(t, false, MatchFunc{}.Call([]any{tc.in + "x", got}))
+		})
+	}
+}
+
+func TestQuoteRegexLiteralDiffersFromQuoteMeta(t *testing.T) {
+	t.Parallel()
+
+	// regexp.QuoteMeta escapes $ as \$, which I-Regexp does not allow.
+	assert.Equal(t, `\$`, regexp.QuoteMeta("$"))
+	assert.Equal(t, "[$]", QuoteRegexLiteral("$"))
+
+	// Unquoted, $ is an anchor in the Go translation and matches nothing
+	// mid-string; quoted, it matches the literal character.
+	assert.Equal(t, false, SearchFunc{}.Call([]any{"a$b", "a$b"}))
+	assert.Equal(t, true, SearchFunc{}.Call([]any{"a$b", QuoteRegexLiteral("a$b")}))
+}
+
+func TestQuoteFunc(t *testing.T) {
+	t.Parallel()
+
+	fn := QuoteFunc{}
+	assert.Equal(t, "quote", fn.Name())
+	assert.Equal(t, ast.Value, fn.ResultType())
+	assert.Equal(t, `a\.b`, fn.Call([]any{"a.b"}))
+	assert.Nil(t, fn.Call([]any{42}))
+	assert.Nil(t, fn.Call(nil))
+
+	assert.NoError(t, fn.Validate([]ast.ArgType{ast.QueryArg}))
+	assert.ErrorIs(t, fn.Validate(nil), ast.ErrArgCount)
+	assert.ErrorIs(t, fn.Validate([]ast.ArgType{ast.LogicalArg}), ErrArgType)
+
+	for _, b := range Builtins() {
+		assert.NotEqual(t, "quote", b.Name(), "quote is not an RFC 9535 built-in")
+	}
+}
+
+// TestCacheStats is not parallel: the counters are global, and parallel tests
+// only start once the sequential ones have finished.
+func TestCacheStats(t *testing.T) {
+	ResetCacheStats()
+	assert.Equal(t, Stats{}, CacheStats())
+
+	require.NotNil(t, compileIRegexp("a+"))
+	require.NotNil(t, compileIRegexp("a+"))
+	require.NotNil(t, compileIRegexp("b+"))
+	require.Nil(t, compileIRegexp("(["))
+	require.Nil(t, compileIRegexp("(["))
+	assert.Equal(t, Stats{Hits: 1, Misses: 4, Compiles: 2, Rejected: 2, Patterns: 2}, CacheStats())
+
+	search := &SearchFunc{}
+	assert.Equal(t, true, search.Call([]any{"baaa", "a+"}))
+	assert.Equal(t, uint64(2), CacheStats().Hits)
+
+	ResetCacheStats()
+	assert.Equal(t, Stats{}, CacheStats())
+}
+
+func TestCacheStats_Concurrent(t *testing.T) {
+	ResetCacheStats()
+
+	const goroutines, patterns, rounds = 8, 16, 50
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Go(func() {
+			for r := range rounds {
+				p := string(rune('a'+(g+r)%patterns)) + "+"
+				assert.NotNil(t, compileIRegexp(p))
+				assert.Nil(t, compileIRegexp("(["))
+			}
+		})
+	}
+	wg.Wait()
+
+	s := CacheStats()
+	assert.Equal(t, uint64(2*goroutines*rounds), s.Hits+s.Misses)
+	assert.Equal(t, s.Misses, s.Compiles+s.Rejected)
+	assert.Equal(t, uint64(goroutines*rounds), s.Rejected)
+	assert.Equal(t, patterns, s.Patterns)
+	// Goroutines racing on a new pattern may each compile it.
+	assert.GreaterOrEqual(t, s.Compiles, uint64(patterns))
+	ResetCacheStats()
+}
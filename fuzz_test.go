@@ -0,0 +1,95 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/agentable/jsonpath/internal/ast"
+)
+
+// fuzzSeeds are expressions exercising every selector, segment and filter
+// construct, including invalid ones.
+var fuzzSeeds = []string{
+	"$", "@", "$.a", "$['a']", `$["a\"b"]`, "$[0]", "$[-1]", "$[1:5:2]", "$[::-1]",
+	"$[*]", "$.*", "$..a", "$..[0,'a',*]", "$[?@.a]", "$[?!@.a]", "$[?@.a == 1]",
+	"$[?@.a < 1 && @.b >= 'x' || !(@.c != null)]", "$[?length(@) > 2]",
+	"$[?count(@.*) == 1]", "$[?match(@, 'a.*')]", "$[?search(@, '[0-9]')]",
+	"$[?value(@..a) == true]", "$[?@[?@.b]]", `$['é😀']`,
+	"$[", "$[?", "$['", "$[1:2:3:4]", "$..", "$[?@.a ==]", "$[?((((@))))]",
+}
+
+// ctsSelectors returns the selectors of the compliance test suite, or nil if
+// it cannot be read.
+func ctsSelectors(tb testing.TB) []string {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	if err != nil {
+		tb.Logf("no CTS seeds: %v", err)
+		return nil
+	}
+	var suite struct {
+		Tests []struct {
+			Selector string `json:"selector"`
+		} `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &suite); err != nil {
+		tb.Logf("no CTS seeds: %v", err)
+		return nil
+	}
+	selectors := make([]string, len(suite.Tests))
+	for i, tc := range suite.Tests {
+		selectors[i] = tc.Selector
+	}
+	return selectors
+}
+
+// hasFilter reports whether q contains a filter selector, which is equal only
+// to itself, so a reparsed query compares unequal to q.
+func hasFilter(q *ast.PathQuery) bool {
+	for _, seg := range q.Segments() {
+		for _, sel := range seg.Selectors() {
+			if sel.Kind == ast.Filter {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	for _, s := range ctsSelectors(f) {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		p, err := Parse(expr)
+		if valid := Valid(expr); valid != (err == nil) {
+			t.Fatalf("Valid(%q) = %v, Parse error: %v", expr, valid, err)
+		}
+		if err != nil {
+			return
+		}
+		bin, err := p.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Parse(%q).MarshalBinary() error: %v", expr, err)
+		}
+		decoded, err := NewParser().ParseBinary(bin)
+		if err != nil || decoded.String() != p.String() {
+			t.Fatalf("Parse(%q) does not round-trip through MarshalBinary: %v", expr, err)
+		}
+		s := p.String()
+		again, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q).String() = %q does not parse: %v", expr, s, err)
+		}
+		if again.String() != s {
+			t.Fatalf("Parse(%q).String() = %q reparses as %q", expr, s, again.String())
+		}
+		short, err := Parse(p.Shorthand())
+		if err != nil || short.String() != s {
+			t.Fatalf("Parse(%q).Shorthand() = %q does not reparse as %q: %v", expr, p.Shorthand(), s, err)
+		}
+	})
+}
@@ -3,6 +3,7 @@ module github.com/agentable/jsonpath
 go 1.26
 
 require (
+	github.com/evanphx/json-patch/v5 v5.9.11
 	github.com/go-json-experiment/json v0.0.0-20251027170946-4849db3c2f7e
 	github.com/stretchr/testify v1.11.1
 )
@@ -0,0 +1,640 @@
+package ast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Binary format errors.
+var (
+	// ErrBinaryFormat indicates binary data that is not a well-formed encoded
+	// query.
+	ErrBinaryFormat = errors.New("malformed binary query")
+	// ErrBinaryVersion indicates an encoded query of a version this package
+	// cannot decode.
+	ErrBinaryVersion = errors.New("jsonpath: unsupported binary path version")
+	// ErrUnknownFunction indicates a call to a function that is not
+	// registered.
+	ErrUnknownFunction = errors.New("unknown function")
+)
+
+// BinaryVersion is the version of the binary query format written by
+// [AppendBinary]. It changes whenever the format does, and [DecodeBinary]
+// rejects every other version.
+const BinaryVersion = 1
+
+// binaryMagic starts every encoded query.
+const binaryMagic = "JPQ"
+
+// MaxDepth is the deepest nesting of logical expressions and function calls
+// a query may have, counted like [FilterExpr] trees are built: once per
+// filter selector or parenthesized expression and once per function call.
+// Parsing, decoding and evaluation recurse once per level; the limit keeps
+// them far from the stack limit.
+const MaxDepth = 1000
+
+// Tags of the encoded expression nodes.
+const (
+	tagExist byte = iota + 1
+	tagNonExist
+	tagParen
+	tagNotParen
+	tagNegFunc
+	tagComp
+	tagFunc
+)
+
+const (
+	tagLiteral byte = iota + 1
+	tagQuery
+	tagFuncValue
+)
+
+const (
+	litString byte = iota + 1
+	litInt
+	litFloat
+	litTrue
+	litFalse
+	litNull
+)
+
+// AppendBinary appends the binary encoding of q to buf: a magic header and
+// version byte followed by the segments, selectors and filter expressions of
+// q. Function calls are encoded by name and argument types only. A nil q
+// encodes as the header alone. It returns an error if q holds a node the
+// parser does not produce.
+func AppendBinary(buf []byte, q *PathQuery) ([]byte, error) {
+	buf = append(buf, binaryMagic...)
+	buf = append(buf, BinaryVersion)
+	if q == nil {
+		return buf, nil
+	}
+	return appendQuery(buf, q)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+func appendQuery(buf []byte, q *PathQuery) ([]byte, error) {
+	buf = appendBool(buf, q.root)
+	buf = binary.AppendUvarint(buf, uint64(len(q.segments)))
+	for i := range q.segments {
+		seg := &q.segments[i]
+		buf = appendBool(buf, seg.descendant)
+		buf = binary.AppendUvarint(buf, uint64(len(seg.selectors)))
+		for j := range seg.selectors {
+			var err error
+			if buf, err = appendSelector(buf, &seg.selectors[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf, nil
+}
+
+func appendSelector(buf []byte, s *Selector) ([]byte, error) {
+	buf = append(buf, byte(s.Kind))
+	switch s.Kind {
+	case Name:
+		buf = appendString(buf, s.Name)
+	case Index:
+		buf = binary.AppendVarint(buf, s.Index)
+	case Slice:
+		a := s.Slice
+		var flags byte
+		if a.HasStart {
+			flags |= 1
+		}
+		if a.HasEnd {
+			flags |= 2
+		}
+		if a.HasStep {
+			flags |= 4
+		}
+		buf = append(buf, flags)
+		if a.HasStart {
+			buf = binary.AppendVarint(buf, a.Start)
+		}
+		if a.HasEnd {
+			buf = binary.AppendVarint(buf, a.End)
+		}
+		if a.HasStep {
+			buf = binary.AppendVarint(buf, a.Step)
+		}
+	case Wildcard:
+	case Filter:
+		return appendOr(buf, s.Filter.Or)
+	default:
+		return nil, fmt.Errorf("selector kind %d: %w", s.Kind, ErrBinaryFormat)
+	}
+	return buf, nil
+}
+
+func appendOr(buf []byte, or LogicalOr) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, uint64(len(or)))
+	for _, and := range or {
+		buf = binary.AppendUvarint(buf, uint64(len(and)))
+		for _, expr := range and {
+			var err error
+			if buf, err = appendBasic(buf, expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf, nil
+}
+
+func appendBasic(buf []byte, expr BasicExpr) ([]byte, error) {
+	switch e := expr.(type) {
+	case *ExistExpr:
+		return appendQuery(append(buf, tagExist), e.Query)
+	case *NonExistExpr:
+		return appendQuery(append(buf, tagNonExist), e.Query)
+	case *ParenExpr:
+		return appendOr(append(buf, tagParen), *e.Expr)
+	case *NotParenExpr:
+		return appendOr(append(buf, tagNotParen), *e.Expr)
+	case *NegFuncExpr:
+		return appendFunc(append(buf, tagNegFunc), e.Func)
+	case *FuncExpr:
+		return appendFunc(append(buf, tagFunc), e)
+	case *CompExpr:
+		buf, err := appendCompValue(append(buf, tagComp), e.Left)
+		if err != nil {
+			return nil, err
+		}
+		return appendCompValue(append(buf, byte(e.Op)), e.Right)
+	default:
+		return nil, fmt.Errorf("expression %T: %w", expr, ErrBinaryFormat)
+	}
+}
+
+func appendCompValue(buf []byte, v CompValue) ([]byte, error) {
+	switch v := v.(type) {
+	case *LiteralValue:
+		return appendLiteral(append(buf, tagLiteral), v.Val)
+	case *QueryValue:
+		return appendQuery(append(buf, tagQuery), v.Query)
+	case *FuncValue:
+		return appendFunc(append(buf, tagFuncValue), v.Func)
+	default:
+		return nil, fmt.Errorf("comparison operand %T: %w", v, ErrBinaryFormat)
+	}
+}
+
+func appendLiteral(buf []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return appendString(append(buf, litString), v), nil
+	case int64:
+		return binary.AppendVarint(append(buf, litInt), v), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(buf, litFloat), math.Float64bits(v)), nil
+	case bool:
+		if v {
+			return append(buf, litTrue), nil
+		}
+		return append(buf, litFalse), nil
+	case jsonNull:
+		return append(buf, litNull), nil
+	default:
+		return nil, fmt.Errorf("literal %T: %w", v, ErrBinaryFormat)
+	}
+}
+
+func appendFunc(buf []byte, fe *FuncExpr) ([]byte, error) {
+	buf = appendString(buf, fe.name)
+	buf = binary.AppendUvarint(buf, uint64(len(fe.args)))
+	for i, arg := range fe.args {
+		var argType ArgType
+		if i < len(fe.argTypes) {
+			argType = fe.argTypes[i]
+		}
+		buf = append(buf, byte(argType))
+		var err error
+		switch a := arg.(type) {
+		case *PathQuery:
+			buf, err = appendQuery(append(buf, tagQuery), a)
+		case *FuncExpr:
+			buf, err = appendFunc(append(buf, tagFuncValue), a)
+		default:
+			buf, err = appendLiteral(append(buf, tagLiteral), a)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// DecodeBinary decodes a query encoded by [AppendBinary], resolving function
+// names with lookup and validating each call's argument types against the
+// resolved function. It returns a nil query for an encoded nil query.
+func DecodeBinary(data []byte, lookup func(name string) (Function, bool)) (*PathQuery, error) {
+	if len(data) < len(binaryMagic)+1 || string(data[:len(binaryMagic)]) != binaryMagic {
+		return nil, fmt.Errorf("missing header: %w", ErrBinaryFormat)
+	}
+	if v := data[len(binaryMagic)]; v != BinaryVersion {
+		return nil, fmt.Errorf("version %d: %w", v, ErrBinaryVersion)
+	}
+	d := &binaryDecoder{data: data, off: len(binaryMagic) + 1, lookup: lookup}
+	if d.off == len(data) {
+		return nil, nil
+	}
+	q, err := d.query()
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, d.errorf("trailing data")
+	}
+	return q, nil
+}
+
+// binaryDecoder reads an encoded query.
+type binaryDecoder struct {
+	data   []byte
+	off    int
+	depth  int
+	lookup func(name string) (Function, bool)
+}
+
+func (d *binaryDecoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at offset %d: %w", fmt.Sprintf(format, args...), d.off, ErrBinaryFormat)
+}
+
+func (d *binaryDecoder) byte() (byte, error) {
+	if d.off >= len(d.data) {
+		return 0, d.errorf("unexpected end")
+	}
+	b := d.data[d.off]
+	d.off++
+	return b, nil
+}
+
+func (d *binaryDecoder) bool() (bool, error) {
+	b, err := d.byte()
+	if err != nil {
+		return false, err
+	}
+	if b > 1 {
+		return false, d.errorf("invalid bool %d", b)
+	}
+	return b == 1, nil
+}
+
+func (d *binaryDecoder) varint() (int64, error) {
+	v, n := binary.Varint(d.data[d.off:])
+	if n <= 0 {
+		return 0, d.errorf("invalid varint")
+	}
+	d.off += n
+	return v, nil
+}
+
+// count reads a length prefix, rejecting counts larger than the remaining
+// data could hold so that corrupt input cannot force large allocations.
+func (d *binaryDecoder) count() (int, error) {
+	v, n := binary.Uvarint(d.data[d.off:])
+	if n <= 0 {
+		return 0, d.errorf("invalid length")
+	}
+	d.off += n
+	if v > uint64(len(d.data)-d.off) {
+		return 0, d.errorf("length %d exceeds data", v)
+	}
+	return int(v), nil
+}
+
+func (d *binaryDecoder) string() (string, error) {
+	n, err := d.count()
+	if err != nil {
+		return "", err
+	}
+	s := string(d.data[d.off : d.off+n])
+	d.off += n
+	return s, nil
+}
+
+// enter records one more level of nesting and fails beyond MaxDepth.
+func (d *binaryDecoder) enter() error {
+	d.depth++
+	if d.depth > MaxDepth {
+		return d.errorf("more than %d levels", MaxDepth)
+	}
+	return nil
+}
+
+func (d *binaryDecoder) leave() { d.depth-- }
+
+func (d *binaryDecoder) query() (*PathQuery, error) {
+	root, err := d.bool()
+	if err != nil {
+		return nil, err
+	}
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]Segment, n)
+	for i := range segments {
+		descendant, err := d.bool()
+		if err != nil {
+			return nil, err
+		}
+		m, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		if m == 0 {
+			return nil, d.errorf("empty segment")
+		}
+		selectors := make([]Selector, m)
+		for j := range selectors {
+			if selectors[j], err = d.selector(); err != nil {
+				return nil, err
+			}
+		}
+		if descendant {
+			segments[i] = Descendant(selectors...)
+		} else {
+			segments[i] = Child(selectors...)
+		}
+	}
+	return NewPathQuery(root, segments...), nil
+}
+
+func (d *binaryDecoder) selector() (Selector, error) {
+	kind, err := d.byte()
+	if err != nil {
+		return Selector{}, err
+	}
+	switch SelectorKind(kind) {
+	case Name:
+		name, err := d.string()
+		return NameSelector(name), err
+	case Index:
+		idx, err := d.varint()
+		return IndexSelector(idx), err
+	case Slice:
+		flags, err := d.byte()
+		if err != nil {
+			return Selector{}, err
+		}
+		if flags > 7 {
+			return Selector{}, d.errorf("invalid slice flags %d", flags)
+		}
+		a := SliceArgs{HasStart: flags&1 != 0, HasEnd: flags&2 != 0, HasStep: flags&4 != 0}
+		if a.HasStart {
+			if a.Start, err = d.varint(); err != nil {
+				return Selector{}, err
+			}
+		}
+		if a.HasEnd {
+			if a.End, err = d.varint(); err != nil {
+				return Selector{}, err
+			}
+		}
+		if a.HasStep {
+			if a.Step, err = d.varint(); err != nil {
+				return Selector{}, err
+			}
+		}
+		return SliceSelector(a), nil
+	case Wildcard:
+		return WildcardSelector(), nil
+	case Filter:
+		or, err := d.or()
+		if err != nil {
+			return Selector{}, err
+		}
+		return FilterSelector(NewFilterExpr(or)), nil
+	default:
+		return Selector{}, d.errorf("invalid selector kind %d", kind)
+	}
+}
+
+func (d *binaryDecoder) or() (LogicalOr, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, d.errorf("empty logical expression")
+	}
+	or := make(LogicalOr, n)
+	for i := range or {
+		m, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		if m == 0 {
+			return nil, d.errorf("empty logical expression")
+		}
+		or[i] = make(LogicalAnd, m)
+		for j := range or[i] {
+			if or[i][j], err = d.basic(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return or, nil
+}
+
+func (d *binaryDecoder) basic() (BasicExpr, error) {
+	tag, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagExist, tagNonExist:
+		q, err := d.query()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagExist {
+			return &ExistExpr{Query: q}, nil
+		}
+		return &NonExistExpr{Query: q}, nil
+	case tagParen, tagNotParen:
+		or, err := d.or()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagParen {
+			return &ParenExpr{Expr: &or}, nil
+		}
+		return &NotParenExpr{Expr: &or}, nil
+	case tagNegFunc, tagFunc:
+		fe, err := d.funcExpr()
+		if err != nil {
+			return nil, err
+		}
+		if fe.fn.ResultType() != Logical {
+			return nil, d.errorf("%s() is not a logical function", fe.name)
+		}
+		if tag == tagNegFunc {
+			return &NegFuncExpr{Func: fe}, nil
+		}
+		return fe, nil
+	case tagComp:
+		left, err := d.compValue()
+		if err != nil {
+			return nil, err
+		}
+		op, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if CompOp(op) > GreaterEqual {
+			return nil, d.errorf("invalid comparison operator %d", op)
+		}
+		right, err := d.compValue()
+		if err != nil {
+			return nil, err
+		}
+		return &CompExpr{Left: left, Op: CompOp(op), Right: right}, nil
+	default:
+		return nil, d.errorf("invalid expression tag %d", tag)
+	}
+}
+
+func (d *binaryDecoder) compValue() (CompValue, error) {
+	tag, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagLiteral:
+		v, err := d.literal()
+		if err != nil {
+			return nil, err
+		}
+		return &LiteralValue{Val: v}, nil
+	case tagQuery:
+		q, err := d.query()
+		if err != nil {
+			return nil, err
+		}
+		if !q.IsSingular() {
+			return nil, d.errorf("non-singular query in comparison")
+		}
+		return &QueryValue{Query: q}, nil
+	case tagFuncValue:
+		fe, err := d.funcExpr()
+		if err != nil {
+			return nil, err
+		}
+		if fe.fn.ResultType() == Logical {
+			return nil, d.errorf("logical function %s() in comparison", fe.name)
+		}
+		return &FuncValue{Func: fe}, nil
+	default:
+		return nil, d.errorf("invalid operand tag %d", tag)
+	}
+}
+
+func (d *binaryDecoder) literal() (any, error) {
+	tag, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case litString:
+		return d.string()
+	case litInt:
+		return d.varint()
+	case litFloat:
+		if len(d.data)-d.off < 8 {
+			return nil, d.errorf("unexpected end")
+		}
+		bits := binary.LittleEndian.Uint64(d.data[d.off:])
+		d.off += 8
+		return math.Float64frombits(bits), nil
+	case litTrue:
+		return true, nil
+	case litFalse:
+		return false, nil
+	case litNull:
+		return JSONNull(), nil
+	default:
+		return nil, d.errorf("invalid literal tag %d", tag)
+	}
+}
+
+func (d *binaryDecoder) funcExpr() (*FuncExpr, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer d.leave()
+	name, err := d.string()
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := d.lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnknownFunction)
+	}
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	argTypes := make([]ArgType, n)
+	args := make([]any, n)
+	for i := range args {
+		t, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if ArgType(t) > FunctionArg {
+			return nil, d.errorf("invalid argument type %d", t)
+		}
+		argTypes[i] = ArgType(t)
+		tag, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagQuery:
+			args[i], err = d.query()
+		case tagFuncValue:
+			args[i], err = d.funcExpr()
+		case tagLiteral:
+			args[i], err = d.literal()
+		default:
+			err = d.errorf("invalid argument tag %d", tag)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The parser validates singular queries as QueryArg and only then records
+	// those the function also accepts as node lists as FilterArg.
+	validate := slices.Clone(argTypes)
+	for i, arg := range args {
+		if q, ok := arg.(*PathQuery); ok && q.IsSingular() {
+			validate[i] = QueryArg
+		}
+	}
+	if err := fn.Validate(validate); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return NewFuncExpr(fn, argTypes, args...), nil
+}
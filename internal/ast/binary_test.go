@@ -0,0 +1,200 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errArgs = errors.New("bad arguments")
+
+// binaryTestQuery returns a query using every selector kind, filter
+// expression node and literal type.
+func binaryTestQuery(logical, value Function) *PathQuery {
+	or := LogicalOr{
+		LogicalAnd{
+			&ExistExpr{Query: relQuery("a")},
+			&NonExistExpr{Query: NewPathQuery(true, Child(IndexSelector(-1)))},
+			&CompExpr{Left: &QueryValue{Query: relQuery("a")}, Op: LessEqual, Right: &LiteralValue{Val: int64(-3)}},
+			&CompExpr{Left: &LiteralValue{Val: 1.5}, Op: NotEqual, Right: &LiteralValue{Val: "x"}},
+		},
+		LogicalAnd{
+			&ParenExpr{Expr: &LogicalOr{LogicalAnd{&CompExpr{
+				Left: &LiteralValue{Val: true}, Op: Equal, Right: &LiteralValue{Val: JSONNull()},
+			}}}},
+			&NotParenExpr{Expr: &LogicalOr{LogicalAnd{&ExistExpr{Query: relQuery("b")}}}},
+			NewFuncExpr(logical, []ArgType{FilterArg, Literal}, NewPathQuery(false, Descendant(WildcardSelector())), false),
+			&NegFuncExpr{Func: NewFuncExpr(logical, []ArgType{FunctionArg, Literal},
+				NewFuncExpr(value, []ArgType{QueryArg}, relQuery("c")), "re")},
+			&CompExpr{
+				Left:  &FuncValue{Func: NewFuncExpr(value, []ArgType{FilterArg}, relQuery("d"))},
+				Op:    Greater,
+				Right: &LiteralValue{Val: int64(0)},
+			},
+		},
+	}
+	return NewPathQuery(true,
+		Child(NameSelector("store"), NameSelector("")),
+		Descendant(IndexSelector(3), WildcardSelector()),
+		Child(SliceSelector(SliceArgs{Start: -2, HasStart: true}), SliceSelector(SliceArgs{End: 5, Step: -1, HasEnd: true, HasStep: true})),
+		Child(FilterSelector(NewFilterExpr(or))),
+	)
+}
+
+func binaryTestFuncs() (logical, value *mockFunc, lookup func(string) (Function, bool)) {
+	logical = &mockFunc{name: "logical", resultType: Logical, validateFn: func(args []ArgType) error {
+		if len(args) != 2 {
+			return errArgs
+		}
+		return nil
+	}}
+	value = &mockFunc{name: "value", resultType: Value, validateFn: func(args []ArgType) error {
+		if len(args) != 1 {
+			return errArgs
+		}
+		return nil
+	}}
+	lookup = func(name string) (Function, bool) {
+		switch name {
+		case logical.name:
+			return logical, true
+		case value.name:
+			return value, true
+		}
+		return nil, false
+	}
+	return logical, value, lookup
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	logical, value, lookup := binaryTestFuncs()
+	q := binaryTestQuery(logical, value)
+	data, err := AppendBinary(nil, q)
+	require.NoError(t, err)
+
+	got, err := DecodeBinary(data, lookup)
+	require.NoError(t, err)
+	assert.Equal(t, q.String(), got.String())
+	assert.Equal(t, q.segments[:3], got.segments[:3])
+	// Shared sub-queries are merged again when decoding.
+	assert.Equal(t, q.segments[3].selectors[0].Filter.slots, got.segments[3].selectors[0].Filter.slots)
+	assert.Equal(t, 1, got.segments[3].selectors[0].Filter.slots)
+
+	again, err := AppendBinary(nil, got)
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+
+	prefixed, err := AppendBinary([]byte("prefix"), q)
+	require.NoError(t, err)
+	assert.Equal(t, data, prefixed[len("prefix"):])
+
+	t.Run("nil_query", func(t *testing.T) {
+		t.Parallel()
+		data, err := AppendBinary(nil, nil)
+		require.NoError(t, err)
+		q, err := DecodeBinary(data, lookup)
+		require.NoError(t, err)
+		assert.Nil(t, q)
+	})
+}
+
+func TestDecodeBinaryErrors(t *testing.T) {
+	t.Parallel()
+
+	logical, value, lookup := binaryTestFuncs()
+	data, err := AppendBinary(nil, binaryTestQuery(logical, value))
+	require.NoError(t, err)
+
+	t.Run("every_truncation", func(t *testing.T) {
+		t.Parallel()
+		for n := range len(data) {
+			if n == len(binaryMagic)+1 {
+				continue // the header alone encodes a nil query
+			}
+			_, err := DecodeBinary(data[:n], lookup)
+			require.ErrorIs(t, err, ErrBinaryFormat, "truncated to %d bytes", n)
+		}
+	})
+
+	t.Run("every_corruption", func(t *testing.T) {
+		t.Parallel()
+		for i := range data {
+			for _, b := range []byte{0, 1, 0x7f, 0xff} {
+				bad := append([]byte(nil), data...)
+				bad[i] = b
+				assert.NotPanics(t, func() { _, _ = DecodeBinary(bad, lookup) })
+			}
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		t.Parallel()
+		bad := append([]byte(nil), data...)
+		bad[len(binaryMagic)] = BinaryVersion + 1
+		_, err := DecodeBinary(bad, lookup)
+		require.ErrorIs(t, err, ErrBinaryVersion)
+	})
+
+	t.Run("trailing_data", func(t *testing.T) {
+		t.Parallel()
+		_, err := DecodeBinary(append(data[:len(data):len(data)], 0), lookup)
+		require.ErrorIs(t, err, ErrBinaryFormat)
+	})
+
+	t.Run("unknown_function", func(t *testing.T) {
+		t.Parallel()
+		_, err := DecodeBinary(data, func(name string) (Function, bool) {
+			if name == "value" {
+				return nil, false
+			}
+			return lookup(name)
+		})
+		require.ErrorIs(t, err, ErrUnknownFunction)
+	})
+
+	t.Run("signature_mismatch", func(t *testing.T) {
+		t.Parallel()
+		strict := &mockFunc{name: "value", resultType: Value, validateFn: func([]ArgType) error { return errArgs }}
+		_, err := DecodeBinary(data, func(name string) (Function, bool) {
+			if name == "value" {
+				return strict, true
+			}
+			return lookup(name)
+		})
+		require.ErrorIs(t, err, errArgs)
+	})
+
+	t.Run("too_deep", func(t *testing.T) {
+		t.Parallel()
+		or := LogicalOr{LogicalAnd{&ExistExpr{Query: relQuery("a")}}}
+		for range MaxDepth {
+			inner := or
+			or = LogicalOr{LogicalAnd{&ParenExpr{Expr: &inner}}}
+		}
+		data, err := AppendBinary(nil, NewPathQuery(true, Child(FilterSelector(NewFilterExpr(or)))))
+		require.NoError(t, err)
+		_, err = DecodeBinary(data, lookup)
+		require.ErrorIs(t, err, ErrBinaryFormat)
+		assert.ErrorContains(t, err, "levels")
+	})
+}
+
+func TestAppendBinaryErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, q := range []*PathQuery{
+		NewPathQuery(true, Child(Selector{Kind: 42})),
+		NewPathQuery(true, Child(FilterSelector(NewFilterExpr(LogicalOr{LogicalAnd{
+			&CompExpr{Left: &LiteralValue{Val: 1}, Op: Equal, Right: &LiteralValue{Val: int64(1)}},
+		}})))),
+	} {
+		_, err := AppendBinary(nil, q)
+		require.ErrorIs(t, err, ErrBinaryFormat)
+		assert.False(t, strings.HasPrefix(err.Error(), "jsonpath"))
+	}
+}
@@ -0,0 +1,28 @@
+package ast
+
+import "reflect"
+
+// Container identifies a map or slice node by the memory holding its members
+// or elements and, for a slice, its length. The zero Container stands for
+// every other node, including empty slices.
+//
+// Descendant segments keep the containers enclosing the node they visit, and
+// skip a node whose Container is among them: such a node encloses itself, and
+// visiting it again would never end.
+type Container struct {
+	ptr uintptr
+	len int
+}
+
+// ContainerOf returns the Container identifying node.
+func ContainerOf(node any) Container {
+	switch n := node.(type) {
+	case []any:
+		if len(n) > 0 {
+			return Container{ptr: reflect.ValueOf(n).Pointer(), len: len(n)}
+		}
+	case map[string]any, map[int]any, map[int64]any:
+		return Container{ptr: reflect.ValueOf(n).Pointer()}
+	}
+	return Container{}
+}
@@ -0,0 +1,39 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerOf(t *testing.T) {
+	t.Parallel()
+
+	list := []any{1.0, 2.0}
+	obj := map[string]any{"a": 1.0}
+	assert.Equal(t, ContainerOf(list), ContainerOf(list))
+	assert.Equal(t, ContainerOf(obj), ContainerOf(any(obj)))
+	assert.NotEqual(t, ContainerOf(list), ContainerOf(list[:1]))
+	assert.NotEqual(t, ContainerOf(obj), ContainerOf(map[string]any{"a": 1.0}))
+	assert.NotEqual(t, Container{}, ContainerOf(map[int]any{}))
+	for _, node := range []any{nil, 1.0, "a", []any{}, map[string]any(nil)} {
+		assert.Equal(t, Container{}, ContainerOf(node), node)
+	}
+}
+
+func TestSegmentApply_Cyclic(t *testing.T) {
+	t.Parallel()
+
+	// obj refers to itself through a member and through an array.
+	obj := map[string]any{"n": 1.0}
+	obj["self"] = obj
+	obj["list"] = []any{obj}
+
+	name := Descendant(NameSelector("n"))
+	assert.Equal(t, []any{1.0}, name.Apply([]any{obj}, &Env{}))
+
+	// The wildcard selects 1.0, obj and the array below obj, and obj again
+	// below the array, without descending into obj a second time.
+	wildcard := Descendant(WildcardSelector())
+	assert.Len(t, wildcard.Apply([]any{obj}, &Env{}), 4)
+}
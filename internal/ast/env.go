@@ -0,0 +1,181 @@
+package ast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrDocumentTooDeep is recorded in [Env.Err] when a descendant segment
+	// goes deeper than [Env.MaxDepth].
+	ErrDocumentTooDeep = errors.New("jsonpath: document nested too deep")
+	// ErrUnknownSelector is recorded in [Env.Err] when a selector of no known
+	// [SelectorKind] is applied, which only a bug can cause.
+	ErrUnknownSelector = errors.New("jsonpath: unknown selector kind")
+)
+
+// cancelCheckInterval is the number of nodes descendant segments visit
+// between checks of [Env.Context].
+const cancelCheckInterval = 1024
+
+// Env carries the state shared by a query and its filter sub-queries during
+// one evaluation.
+type Env struct {
+	// Root is the query argument that $ refers to.
+	Root any
+	// ResolveMember, if non-nil, is consulted by name selectors when the
+	// selected member is absent from an object.
+	ResolveMember func(obj map[string]any, name string) (any, bool)
+	// FoldNames makes name selectors select every member whose name equals
+	// the selected name under Unicode case folding; see [Env.FoldedMembers].
+	FoldNames bool
+	// Convert, if non-nil, maps a node outside the JSON data model to an
+	// equivalent value inside it. It is applied to each node before selectors
+	// inspect it and to the nodes a sub-query selects, so filters compare and
+	// functions receive converted values. It must return values of the JSON
+	// data model unchanged.
+	Convert func(node any) any
+	// Ctx is passed to functions that implement [EvalFunction].
+	Ctx EvalContext
+	// MaxDepth, if positive, is the deepest level below the node it is
+	// applied to at which a descendant segment applies its selectors.
+	MaxDepth int
+	// Context, if non-nil, stops descendant segments and filter selectors
+	// once it is done.
+	Context context.Context
+	// Err records why evaluation stopped: a descendant segment exceeding
+	// MaxDepth, Context found done or a selector of unknown kind. Once it is
+	// set, descendant segments and filter selectors select nothing more, so
+	// the results of the evaluation must be discarded.
+	Err error
+
+	memo     []memoEntry // stacked memo frames of the filters being evaluated
+	memoBase int         // start of the innermost frame in memo
+	visits   int         // nodes visited since Context was last checked
+}
+
+// stopped reports whether a descendant segment must stop before visiting a
+// node depth levels below the node it was applied to, recording the reason
+// in Err the first time.
+func (env *Env) stopped(depth int) bool {
+	if env.Err != nil {
+		return true
+	}
+	if env.MaxDepth > 0 && depth > env.MaxDepth {
+		env.Err = fmt.Errorf("%w: descendant segment of a filter query exceeds the depth limit of %d", ErrDocumentTooDeep, env.MaxDepth)
+		return true
+	}
+	return env.cancelled()
+}
+
+// cancelled reports whether Err is set or, every cancelCheckInterval calls,
+// Context is found done, recording an error that wraps the context's error
+// in Err the first time.
+func (env *Env) cancelled() bool {
+	if env.Err != nil {
+		return true
+	}
+	if env.Context != nil {
+		if env.visits++; env.visits >= cancelCheckInterval {
+			env.visits = 0
+			if err := env.Context.Err(); err != nil {
+				env.Err = fmt.Errorf("jsonpath: evaluation stopped: %w", err)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// memoEntry is the memoized result of a sub-query merged by [NewFilterExpr].
+type memoEntry struct {
+	nodes []any
+	done  bool
+}
+
+// Member returns the value of the member name of obj, falling back to
+// ResolveMember when obj has no such member.
+func (env *Env) Member(obj map[string]any, name string) (any, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	if env.ResolveMember != nil {
+		return env.ResolveMember(obj, name)
+	}
+	return nil, false
+}
+
+// FoldedMembers calls yield with the name and value of each member of obj
+// whose name equals name under Unicode case folding, in map iteration order.
+// If there is none, it falls back to ResolveMember, calling yield with name.
+// It takes time proportional to the number of members of obj.
+func (env *Env) FoldedMembers(obj map[string]any, name string, yield func(key string, v any)) {
+	found := false
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			yield(k, v)
+			found = true
+		}
+	}
+	if found || env.ResolveMember == nil {
+		return
+	}
+	if v, ok := env.ResolveMember(obj, name); ok {
+		yield(name, v)
+	}
+}
+
+// Node returns node as converted by Convert, or node itself if Convert is nil.
+func (env *Env) Node(node any) any {
+	if env.Convert == nil {
+		return node
+	}
+	return env.Convert(node)
+}
+
+// maxPooledScratch is the largest scratch buffer capacity returned to the
+// pool; larger buffers are left to the garbage collector.
+const maxPooledScratch = 64 << 10
+
+var scratchPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 256)
+		return &b
+	},
+}
+
+// EvalContext is per-evaluation state made available to functions that
+// implement [EvalFunction].
+type EvalContext struct {
+	scratch *[]byte
+}
+
+// Scratch returns a reusable byte buffer. The same buffer is returned to
+// every function call within one evaluation, so its contents are only
+// meaningful within a single call: callers should reset it with (*b)[:0]
+// before use, and neither the buffer nor slices of it may be retained or
+// returned after the call. Buffers are pooled across evaluations.
+func (ec *EvalContext) Scratch() *[]byte {
+	if ec.scratch == nil {
+		ec.scratch = scratchPool.Get().(*[]byte)
+	}
+	return ec.scratch
+}
+
+// Release returns pooled resources held by the environment. It must be
+// called once evaluation has finished and no function can observe env.
+func (env *Env) Release() {
+	b := env.Ctx.scratch
+	if b == nil {
+		return
+	}
+	env.Ctx.scratch = nil
+	if cap(*b) > maxPooledScratch {
+		return
+	}
+	*b = (*b)[:0]
+	scratchPool.Put(b)
+}
@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvMember(t *testing.T) {
+	t.Parallel()
+	obj := map[string]any{"a": 1}
+
+	t.Run("without_resolver", func(t *testing.T) {
+		t.Parallel()
+		env := &Env{}
+		v, ok := env.Member(obj, "a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		_, ok = env.Member(obj, "b")
+		assert.False(t, ok)
+	})
+
+	t.Run("resolver_only_on_miss", func(t *testing.T) {
+		t.Parallel()
+		env := &Env{ResolveMember: func(_ map[string]any, name string) (any, bool) {
+			return name + "!", true
+		}}
+		v, _ := env.Member(obj, "a")
+		assert.Equal(t, 1, v)
+		v, ok := env.Member(obj, "b")
+		assert.True(t, ok)
+		assert.Equal(t, "b!", v)
+	})
+}
+
+func TestEnvConvert(t *testing.T) {
+	t.Parallel()
+
+	// Convert unwraps func values, standing in for raw JSON.
+	unwrap := func(node any) any {
+		if f, ok := node.(func() any); ok {
+			return f()
+		}
+		return node
+	}
+	wrap := func(v any) func() any { return func() any { return v } }
+	env := &Env{Convert: unwrap}
+	doc := wrap(map[string]any{
+		"a": wrap([]any{wrap(1.0), 2.0}),
+		"b": []any{1.0, wrap(2.0)},
+	})
+
+	assert.Equal(t, 1.0, (&Env{}).Node(1.0))
+	assert.Equal(t, 1.0, env.Node(wrap(1.0)))
+
+	q := NewPathQuery(true, Child(NameSelector("a")), Child(IndexSelector(0)))
+	assert.Equal(t, []any{1.0}, q.Select(nil, &Env{Root: doc, Convert: unwrap}))
+	assert.Empty(t, q.Select(nil, &Env{Root: doc}))
+
+	q = NewPathQuery(true, Descendant(WildcardSelector()))
+	assert.Len(t, q.Select(nil, &Env{Root: doc, Convert: unwrap}), 6)
+
+	// Deep equality converts nested values.
+	a := NewPathQuery(true, Child(NameSelector("a")))
+	b := NewPathQuery(true, Child(NameSelector("b")))
+	eq := &CompExpr{Left: &QueryValue{Query: a}, Op: Equal, Right: &QueryValue{Query: b}}
+	assert.True(t, eq.Eval(nil, &Env{Root: doc, Convert: unwrap}))
+}
+
+func TestEnvMaxDepth(t *testing.T) {
+	t.Parallel()
+
+	// doc holds 1 three arrays deep.
+	doc := []any{[]any{[]any{1.0}}}
+	q := NewPathQuery(true, Descendant(WildcardSelector()))
+
+	env := &Env{Root: doc, MaxDepth: 3}
+	assert.Len(t, q.Select(nil, env), 3)
+	assert.NoError(t, env.Err)
+
+	env = &Env{Root: doc, MaxDepth: 2}
+	q.Select(nil, env)
+	assert.ErrorIs(t, env.Err, ErrDocumentTooDeep)
+
+	// A filter stops testing nodes once a sub-query has stopped.
+	exists := &ExistExpr{Query: NewPathQuery(false, Descendant(NameSelector("x")))}
+	filter := NewPathQuery(true, Child(FilterSelector(NewFilterExpr(LogicalOr{LogicalAnd{exists}}))))
+	env = &Env{Root: []any{doc, doc}, MaxDepth: 1}
+	assert.Empty(t, filter.Select(nil, env))
+	assert.ErrorIs(t, env.Err, ErrDocumentTooDeep)
+}
+
+func TestEnvContext(t *testing.T) {
+	t.Parallel()
+
+	doc := make([]any, 4*cancelCheckInterval)
+	for i := range doc {
+		doc[i] = []any{float64(i)}
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	// Descendant segments and filter selectors both stop within
+	// cancelCheckInterval nodes. Applied to the root, the wildcard selects
+	// its elements, but not theirs.
+	q := NewPathQuery(true, Descendant(WildcardSelector()))
+	env := &Env{Root: doc, Context: ctx}
+	assert.Less(t, len(q.Select(nil, env)), len(doc)+cancelCheckInterval)
+	assert.ErrorIs(t, env.Err, context.Canceled)
+
+	var tested int
+	filter := NewPathQuery(true, Child(FilterSelector(NewFilterExpr(LogicalOr{LogicalAnd{countExpr{&tested}}}))))
+	env = &Env{Root: doc, Context: ctx}
+	filter.Select(nil, env)
+	assert.Less(t, tested, cancelCheckInterval)
+	assert.ErrorIs(t, env.Err, context.Canceled)
+}
+
+// countExpr is a filter expression that counts the nodes it is evaluated on
+// and is true for all of them.
+type countExpr struct{ n *int }
+
+func (e countExpr) Eval(any, *Env) bool {
+	*e.n++
+	return true
+}
+
+func TestEnvScratch(t *testing.T) {
+	t.Parallel()
+	env := &Env{}
+	b := env.Ctx.Scratch()
+	assert.Same(t, b, env.Ctx.Scratch())
+	*b = append(*b, "data"...)
+
+	env.Release()
+	assert.Nil(t, env.Ctx.scratch)
+	env.Release()
+
+	big := make([]byte, 0, maxPooledScratch+1)
+	env.Ctx.scratch = &big
+	env.Release()
+	assert.Nil(t, env.Ctx.scratch)
+}
@@ -1,13 +1,119 @@
 package ast
 
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
 // FilterExpr represents a filter expression tree (?logical-expr) per RFC 9535 §2.3.5.
 type FilterExpr struct {
 	Or LogicalOr
+	// slots is the number of sub-queries merged by [NewFilterExpr], whose
+	// results are computed at most once per candidate node.
+	slots int
+}
+
+// NewFilterExpr creates a [FilterExpr] for or. Sub-queries that occur more
+// than once in or with the same canonical form, such as @.a.b in
+// @.a.b == 1 && length(@.a.b) > 0, are merged into one [PathQuery] that is
+// evaluated at most once per candidate node. See [LogicalOr.ShareQueries].
+func NewFilterExpr(or LogicalOr) *FilterExpr {
+	f := &FilterExpr{Or: or}
+	for _, q := range or.ShareQueries() {
+		f.slots++
+		q.memoSlot = f.slots
+	}
+	return f
+}
+
+// ShareQueries replaces sub-queries of lo that have the same canonical form
+// with a single shared [PathQuery] and returns the shared queries. @ and $
+// queries never share, since their canonical forms differ. Queries containing
+// filter selectors are left alone, and queries inside nested filter selectors
+// belong to the nested [FilterExpr]. Sharing does not change the meaning of lo
+// or its string form, and is a no-op when no query repeats.
+func (lo LogicalOr) ShareQueries() []*PathQuery {
+	counts := make(map[string]int)
+	lo.walkQueries(func(q *PathQuery) *PathQuery {
+		if key, ok := q.memoKey(); ok {
+			counts[key]++
+		}
+		return q
+	})
+	var shared []*PathQuery
+	byKey := make(map[string]*PathQuery)
+	lo.walkQueries(func(q *PathQuery) *PathQuery {
+		key, ok := q.memoKey()
+		if !ok || counts[key] < 2 {
+			return q
+		}
+		if s, ok := byKey[key]; ok {
+			return s
+		}
+		byKey[key] = q
+		shared = append(shared, q)
+		return q
+	})
+	return shared
 }
 
 // Eval evaluates the filter expression against the current node.
-func (f *FilterExpr) Eval(current, root any) bool {
-	return f.Or.Eval(current, root)
+func (f *FilterExpr) Eval(current any, env *Env) bool {
+	if f.slots == 0 {
+		return f.Or.Eval(current, env)
+	}
+	// Push a frame of memo slots for this candidate; nested filters push
+	// theirs above it while a sub-query runs.
+	base := env.memoBase
+	env.memoBase = len(env.memo)
+	env.memo = append(env.memo, make([]memoEntry, f.slots)...)
+	ok := f.Or.Eval(current, env)
+	clear(env.memo[env.memoBase:])
+	env.memo = env.memo[:env.memoBase]
+	env.memoBase = base
+	return ok
+}
+
+// walkQueries calls visit for each sub-query of lo outside nested filter
+// selectors and replaces the sub-query with the result.
+func (lo LogicalOr) walkQueries(visit func(*PathQuery) *PathQuery) {
+	for i := range lo {
+		for _, expr := range lo[i] {
+			walkBasicQueries(expr, visit)
+		}
+	}
+}
+
+// walkBasicQueries is [LogicalOr.walkQueries] for one basic expression.
+func walkBasicQueries(expr BasicExpr, visit func(*PathQuery) *PathQuery) {
+	switch e := expr.(type) {
+	case *ExistExpr:
+		e.Query = visit(e.Query)
+	case *NonExistExpr:
+		e.Query = visit(e.Query)
+	case *ParenExpr:
+		e.Expr.walkQueries(visit)
+	case *NotParenExpr:
+		e.Expr.walkQueries(visit)
+	case *NegFuncExpr:
+		e.Func.walkQueries(visit)
+	case *FuncExpr:
+		e.walkQueries(visit)
+	case *CompExpr:
+		walkValueQueries(e.Left, visit)
+		walkValueQueries(e.Right, visit)
+	}
+}
+
+// walkValueQueries is [LogicalOr.walkQueries] for one comparison operand.
+func walkValueQueries(v CompValue, visit func(*PathQuery) *PathQuery) {
+	switch v := v.(type) {
+	case *QueryValue:
+		v.Query = visit(v.Query)
+	case *FuncValue:
+		v.Func.walkQueries(visit)
+	}
 }
 
 // LogicalOr is a sequence of LogicalAnd expressions joined by ||.
@@ -15,9 +121,9 @@ func (f *FilterExpr) Eval(current, root any) bool {
 type LogicalOr []LogicalAnd
 
 // Eval returns true if any LogicalAnd expression is true.
-func (lo LogicalOr) Eval(current, root any) bool {
+func (lo LogicalOr) Eval(current any, env *Env) bool {
 	for i := range lo {
-		if lo[i].Eval(current, root) {
+		if lo[i].Eval(current, env) {
 			return true
 		}
 	}
@@ -29,9 +135,9 @@ func (lo LogicalOr) Eval(current, root any) bool {
 type LogicalAnd []BasicExpr
 
 // Eval returns true if all BasicExpr are true.
-func (la LogicalAnd) Eval(current, root any) bool {
+func (la LogicalAnd) Eval(current any, env *Env) bool {
 	for i := range la {
-		if !la[i].Eval(current, root) {
+		if !la[i].Eval(current, env) {
 			return false
 		}
 	}
@@ -40,7 +146,7 @@ func (la LogicalAnd) Eval(current, root any) bool {
 
 // BasicExpr is a filter expression that evaluates to a boolean.
 type BasicExpr interface {
-	Eval(current, root any) bool
+	Eval(current any, env *Env) bool
 }
 
 // ExistExpr tests if a query selects at least one node.
@@ -49,12 +155,12 @@ type ExistExpr struct {
 }
 
 // Eval returns true if the query selects at least one node.
-func (e *ExistExpr) Eval(current, root any) bool {
+func (e *ExistExpr) Eval(current any, env *Env) bool {
 	// Special case: bare @ or $ with no segments always exists
 	if len(e.Query.Segments()) == 0 {
 		return true
 	}
-	nodes := e.Query.Select(current, root)
+	nodes := e.Query.selectMemo(current, env)
 	return len(nodes) > 0
 }
 
@@ -64,12 +170,12 @@ type NonExistExpr struct {
 }
 
 // Eval returns true if the query selects no nodes.
-func (e *NonExistExpr) Eval(current, root any) bool {
+func (e *NonExistExpr) Eval(current any, env *Env) bool {
 	// Special case: bare @ or $ with no segments always exists, so negation is false
 	if len(e.Query.Segments()) == 0 {
 		return false
 	}
-	nodes := e.Query.Select(current, root)
+	nodes := e.Query.selectMemo(current, env)
 	return len(nodes) == 0
 }
 
@@ -79,8 +185,8 @@ type ParenExpr struct {
 }
 
 // Eval evaluates the parenthesized expression.
-func (p *ParenExpr) Eval(current, root any) bool {
-	return p.Expr.Eval(current, root)
+func (p *ParenExpr) Eval(current any, env *Env) bool {
+	return p.Expr.Eval(current, env)
 }
 
 // NotParenExpr is a negated parenthesized logical expression.
@@ -89,8 +195,8 @@ type NotParenExpr struct {
 }
 
 // Eval evaluates the negated parenthesized expression.
-func (n *NotParenExpr) Eval(current, root any) bool {
-	return !n.Expr.Eval(current, root)
+func (n *NotParenExpr) Eval(current any, env *Env) bool {
+	return !n.Expr.Eval(current, env)
 }
 
 // NegFuncExpr is a negated logical function call expression (!match(), !search()).
@@ -99,8 +205,8 @@ type NegFuncExpr struct {
 }
 
 // Eval evaluates the negated function call.
-func (n *NegFuncExpr) Eval(current, root any) bool {
-	return !n.Func.Eval(current, root)
+func (n *NegFuncExpr) Eval(current any, env *Env) bool {
+	return !n.Func.Eval(current, env)
 }
 
 // CompOp is a comparison operator.
@@ -123,21 +229,21 @@ type CompExpr struct {
 }
 
 // Eval evaluates the comparison expression.
-func (c *CompExpr) Eval(current, root any) bool {
-	left := c.Left.Value(current, root)
-	right := c.Right.Value(current, root)
+func (c *CompExpr) Eval(current any, env *Env) bool {
+	left := c.Left.Value(current, env)
+	right := c.Right.Value(current, env)
 
 	switch c.Op {
 	case Equal:
-		return equalTo(left, right)
+		return equalTo(left, right, env)
 	case NotEqual:
-		return !equalTo(left, right)
+		return !equalTo(left, right, env)
 	case Less:
 		return sameType(left, right) && lessThan(left, right)
 	case LessEqual:
-		return sameType(left, right) && (lessThan(left, right) || equalTo(left, right))
+		return sameType(left, right) && (lessThan(left, right) || equalTo(left, right, env))
 	case Greater:
-		return sameType(left, right) && !lessThan(left, right) && !equalTo(left, right)
+		return sameType(left, right) && !lessThan(left, right) && !equalTo(left, right, env)
 	case GreaterEqual:
 		return sameType(left, right) && !lessThan(left, right)
 	}
@@ -146,7 +252,7 @@ func (c *CompExpr) Eval(current, root any) bool {
 
 // CompValue represents a comparable value in a comparison expression.
 type CompValue interface {
-	Value(current, root any) any
+	Value(current any, env *Env) any
 }
 
 // LiteralValue is a literal value (string, number, bool, null).
@@ -155,7 +261,7 @@ type LiteralValue struct {
 }
 
 // Value returns the literal value.
-func (l *LiteralValue) Value(current, root any) any {
+func (l *LiteralValue) Value(current any, env *Env) any {
 	return l.Val
 }
 
@@ -166,8 +272,8 @@ type QueryValue struct {
 
 // Value returns the first value selected by the query, or a special "nothing" sentinel if none.
 // We use a private sentinel type to distinguish "no value" from "null value".
-func (q *QueryValue) Value(current, root any) any {
-	nodes := q.Query.Select(current, root)
+func (q *QueryValue) Value(current any, env *Env) any {
+	nodes := q.Query.selectMemo(current, env)
 	if len(nodes) != 1 {
 		return nothing{}
 	}
@@ -191,8 +297,114 @@ type FuncValue struct {
 }
 
 // Value returns the result of the function call.
-func (f *FuncValue) Value(current, root any) any {
-	return f.Func.Call(current, root)
+func (f *FuncValue) Value(current any, env *Env) any {
+	return f.Func.Call(current, env)
+}
+
+// String returns the operator as written in a comparison, e.g. "<=".
+func (op CompOp) String() string {
+	switch op {
+	case Equal:
+		return "=="
+	case NotEqual:
+		return "!="
+	case Less:
+		return "<"
+	case LessEqual:
+		return "<="
+	case Greater:
+		return ">"
+	case GreaterEqual:
+		return ">="
+	}
+	return "CompOp(" + strconv.Itoa(int(op)) + ")"
+}
+
+// String returns the canonical string representation of f without the
+// leading ?, e.g. @["price"] < 10 && !@["sold"].
+func (f *FilterExpr) String() string {
+	var buf strings.Builder
+	f.Or.writeTo(&buf, canonical)
+	return buf.String()
+}
+
+// writeTo writes lo to buf in format f, with spaces around || and &&.
+func (lo LogicalOr) writeTo(buf *strings.Builder, f format) {
+	for i := range lo {
+		if i > 0 {
+			buf.WriteString(" || ")
+		}
+		for j, expr := range lo[i] {
+			if j > 0 {
+				buf.WriteString(" && ")
+			}
+			writeBasicExpr(buf, expr, f)
+		}
+	}
+}
+
+// writeBasicExpr writes expr to buf in format f.
+func writeBasicExpr(buf *strings.Builder, expr BasicExpr, f format) {
+	switch e := expr.(type) {
+	case *ExistExpr:
+		e.Query.writeTo(buf, f)
+	case *NonExistExpr:
+		buf.WriteByte('!')
+		e.Query.writeTo(buf, f)
+	case *ParenExpr:
+		buf.WriteByte('(')
+		e.Expr.writeTo(buf, f)
+		buf.WriteByte(')')
+	case *NotParenExpr:
+		buf.WriteString("!(")
+		e.Expr.writeTo(buf, f)
+		buf.WriteByte(')')
+	case *NegFuncExpr:
+		buf.WriteByte('!')
+		e.Func.writeTo(buf, f)
+	case *FuncExpr:
+		e.writeTo(buf, f)
+	case *CompExpr:
+		writeCompValue(buf, e.Left, f)
+		buf.WriteByte(' ')
+		buf.WriteString(e.Op.String())
+		buf.WriteByte(' ')
+		writeCompValue(buf, e.Right, f)
+	}
+}
+
+// writeCompValue writes v to buf in format f.
+func writeCompValue(buf *strings.Builder, v CompValue, f format) {
+	switch v := v.(type) {
+	case *LiteralValue:
+		writeLiteral(buf, v.Val)
+	case *QueryValue:
+		v.Query.writeTo(buf, f)
+	case *FuncValue:
+		v.Func.writeTo(buf, f)
+	}
+}
+
+// writeLiteral writes the literal v to buf as it would be written in a filter
+// expression. Strings are written in double quotes, and floats that hold an
+// integer keep a fraction so they parse back as floats.
+func writeLiteral(buf *strings.Builder, v any) {
+	switch v := v.(type) {
+	case string:
+		WriteQuoted(buf, v, '"')
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		buf.WriteString(s)
+		if !strings.ContainsAny(s, ".e") {
+			buf.WriteString(".0")
+		}
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case jsonNull:
+		buf.WriteString("null")
+	}
 }
 
 // sameType returns true if both values have compatible types for ordering comparison.
@@ -249,8 +461,25 @@ func isNumeric(v any) bool {
 	}
 }
 
-// equalTo returns true if a equals b, with numeric type coercion and deep equality.
-func equalTo(a, b any) bool {
+// ValuesEqual reports whether the document values a and b are equal by the
+// rules of the == operator in filter expressions: numbers compare by value
+// whatever their Go type, and arrays and objects compare member by member.
+func ValuesEqual(a, b any) bool {
+	return equalTo(a, b, &Env{})
+}
+
+// Number returns v as a float64 if it is a number, that is a value of a Go
+// integer or floating-point type, as compared by [ValuesEqual].
+func Number(v any) (float64, bool) {
+	if !isNumeric(v) {
+		return 0, false
+	}
+	return toFloat64(v), true
+}
+
+// equalTo returns true if a equals b, with numeric type coercion and deep
+// equality. Nested values are converted by env before they are compared.
+func equalTo(a, b any, env *Env) bool {
 	_, aIsNothing := a.(nothing)
 	_, bIsNothing := b.(nothing)
 	_, aIsJSONNull := a.(jsonNull)
@@ -288,7 +517,7 @@ func equalTo(a, b any) bool {
 			return false
 		}
 		for i := range aArr {
-			if !equalTo(aArr[i], bArr[i]) {
+			if !equalTo(env.Node(aArr[i]), env.Node(bArr[i]), env) {
 				return false
 			}
 		}
@@ -304,7 +533,7 @@ func equalTo(a, b any) bool {
 		}
 		for k, v := range aObj {
 			bv, ok := bObj[k]
-			if !ok || !equalTo(v, bv) {
+			if !ok || !equalTo(env.Node(v), env.Node(bv), env) {
 				return false
 			}
 		}
@@ -316,7 +545,11 @@ func equalTo(a, b any) bool {
 		return false
 	}
 
-	// Direct comparison for other types (string, bool)
+	// Direct comparison for other types (string, bool); values of types ==
+	// cannot compare, such as sparse arrays, compare deeply
+	if t := reflect.TypeOf(a); t == reflect.TypeOf(b) && !t.Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
 	return a == b
 }
 
@@ -0,0 +1,129 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relQuery returns a new relative query selecting the members names in turn.
+func relQuery(names ...string) *PathQuery {
+	segs := make([]Segment, len(names))
+	for i, n := range names {
+		segs[i] = Child(NameSelector(n))
+	}
+	return NewPathQuery(false, segs...)
+}
+
+func TestNewFilterExpr(t *testing.T) {
+	t.Parallel()
+
+	t.Run("merges_repeated_queries", func(t *testing.T) {
+		t.Parallel()
+		exist := &ExistExpr{Query: relQuery("a", "b")}
+		comp := &CompExpr{Left: &QueryValue{Query: relQuery("a", "b")}, Op: Equal, Right: &LiteralValue{Val: 1.0}}
+		other := &ExistExpr{Query: relQuery("c")}
+		f := NewFilterExpr(LogicalOr{{exist, comp}, {&ParenExpr{Expr: &LogicalOr{{other}}}}})
+
+		assert.Equal(t, 1, f.slots)
+		assert.Same(t, exist.Query, comp.Left.(*QueryValue).Query)
+		assert.Equal(t, 1, exist.Query.memoSlot)
+		assert.Zero(t, other.Query.memoSlot)
+	})
+
+	t.Run("root_and_relative_differ", func(t *testing.T) {
+		t.Parallel()
+		rel := &ExistExpr{Query: relQuery("a")}
+		root := &ExistExpr{Query: NewPathQuery(true, Child(NameSelector("a")))}
+		f := NewFilterExpr(LogicalOr{{rel, root}})
+
+		assert.Zero(t, f.slots)
+		assert.NotSame(t, rel.Query, root.Query)
+	})
+
+	t.Run("skips_filter_queries", func(t *testing.T) {
+		t.Parallel()
+		inner := func(name string) *PathQuery {
+			nested := &FilterExpr{Or: LogicalOr{{&ExistExpr{Query: relQuery(name)}}}}
+			return NewPathQuery(false, Child(FilterSelector(nested)))
+		}
+		// Queries with a filter selector are left to the nested filter.
+		a, b := &ExistExpr{Query: inner("x")}, &ExistExpr{Query: inner("y")}
+		f := NewFilterExpr(LogicalOr{{a, b}})
+
+		assert.Zero(t, f.slots)
+		assert.NotSame(t, a.Query, b.Query)
+	})
+}
+
+func TestLogicalOrShareQueries(t *testing.T) {
+	t.Parallel()
+	a, b := relQuery("a"), relQuery("b")
+	or := LogicalOr{{&ExistExpr{Query: a}}, {&NonExistExpr{Query: b}}}
+	assert.Empty(t, or.ShareQueries(), "no repetition")
+	assert.Same(t, a, or[0][0].(*ExistExpr).Query)
+	assert.Same(t, b, or[1][0].(*NonExistExpr).Query)
+
+	// Queries in function arguments, including nested calls, are shared too.
+	fn := &mockFunc{name: "f", resultType: Logical}
+	inner := NewFuncExpr(fn, []ArgType{QueryArg}, relQuery("a"))
+	outer := NewFuncExpr(fn, []ArgType{QueryArg, FunctionArg}, relQuery("a"), inner)
+	or = LogicalOr{{outer, &ExistExpr{Query: relQuery("a")}}}
+	shared := or.ShareQueries()
+	require.Len(t, shared, 1)
+	assert.Same(t, shared[0], outer.Args()[0])
+	assert.Same(t, shared[0], inner.Args()[0])
+	assert.Same(t, shared[0], or[0][1].(*ExistExpr).Query)
+}
+
+func TestFilterExprEval_Memoizes(t *testing.T) {
+	t.Parallel()
+	var misses int
+	env := &Env{ResolveMember: func(map[string]any, string) (any, bool) {
+		misses++
+		return 2.0, true
+	}}
+	// @.v > 1 && @.v < 3 && @.v != 5, where v is computed by the resolver.
+	comp := func(op CompOp, val float64) *CompExpr {
+		return &CompExpr{Left: &QueryValue{Query: relQuery("v")}, Op: op, Right: &LiteralValue{Val: val}}
+	}
+	f := NewFilterExpr(LogicalOr{{comp(Greater, 1), comp(Less, 3), comp(NotEqual, 5)}})
+	require.Equal(t, 1, f.slots)
+
+	for i := range 3 {
+		assert.True(t, f.Eval(map[string]any{}, env))
+		assert.Equal(t, i+1, misses, "one resolution per candidate")
+	}
+	assert.Empty(t, env.memo)
+	assert.Zero(t, env.memoBase)
+}
+
+func TestValuesEqual(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b any
+		want bool
+	}{
+		{1.0, 1, true},
+		{uint8(2), int64(2), true},
+		{"1", 1.0, false},
+		{nil, nil, true},
+		{[]any{1.0, "a"}, []any{1, "a"}, true},
+		{[]any{1.0}, []any{1.0, 2.0}, false},
+		{map[string]any{"a": nil}, map[string]any{"b": nil}, false},
+		{map[string]any{"a": []any{}}, map[string]any{"a": []any{}}, true},
+		{map[int]any{0: "a"}, map[int]any{0: "a"}, true},
+		{map[int]any{0: "a"}, map[int]any{1: "a"}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ValuesEqual(tt.a, tt.b), "%v == %v", tt.a, tt.b)
+	}
+
+	f, ok := Number(int16(-3))
+	assert.True(t, ok)
+	assert.Equal(t, -3.0, f)
+	_, ok = Number("3")
+	assert.False(t, ok)
+}
@@ -84,6 +84,13 @@ type Function interface {
 	Call(args []any) any
 }
 
+// EvalFunction is a [Function] that receives the [EvalContext] of the
+// evaluation calling it. FuncExpr calls CallWithEval instead of Call.
+type EvalFunction interface {
+	Function
+	CallWithEval(ec *EvalContext, args []any) any
+}
+
 // FuncExpr represents a function call in a filter expression per RFC 9535 §2.4.
 type FuncExpr struct {
 	name     string    // function name
@@ -109,15 +116,15 @@ func (fe *FuncExpr) Args() []any { return fe.args }
 // ResultType returns the return type of the underlying function.
 func (fe *FuncExpr) ResultType() FuncType { return fe.fn.ResultType() }
 
-// Call evaluates the function with the given current and root nodes.
+// Call evaluates the function with the given current node and environment.
 // It evaluates argument expressions and passes the results to the underlying function.
-func (fe *FuncExpr) Call(current, root any) any {
+func (fe *FuncExpr) Call(current any, env *Env) any {
 	// Evaluate argument expressions
 	evalArgs := make([]any, len(fe.args))
 	for i, arg := range fe.args {
 		switch a := arg.(type) {
 		case *PathQuery:
-			nodes := a.Select(current, root)
+			nodes := a.selectMemo(current, env)
 			switch {
 			case i < len(fe.argTypes) && fe.argTypes[i] == FilterArg:
 				// Function parameter expects NodesType, pass the node list
@@ -134,45 +141,79 @@ func (fe *FuncExpr) Call(current, root any) any {
 				evalArgs[i] = nodes
 			}
 		case *FuncExpr:
-			evalArgs[i] = a.Call(current, root)
+			evalArgs[i] = a.Call(current, env)
 		case CompValue:
-			evalArgs[i] = a.Value(current, root)
+			evalArgs[i] = a.Value(current, env)
 		default:
 			evalArgs[i] = arg
 		}
 	}
+	if f, ok := fe.fn.(EvalFunction); ok {
+		return f.CallWithEval(&env.Ctx, evalArgs)
+	}
 	return fe.fn.Call(evalArgs)
 }
 
+// walkQueries calls visit for each query argument of fe, including those of
+// nested function calls, and replaces the argument with the result.
+func (fe *FuncExpr) walkQueries(visit func(*PathQuery) *PathQuery) {
+	for i, arg := range fe.args {
+		switch a := arg.(type) {
+		case *PathQuery:
+			fe.args[i] = visit(a)
+		case *FuncExpr:
+			a.walkQueries(visit)
+		case CompValue:
+			walkValueQueries(a, visit)
+		}
+	}
+}
+
 // Eval implements BasicExpr for logical functions.
 // Returns false if the function is not a logical function.
-func (fe *FuncExpr) Eval(current, root any) bool {
+func (fe *FuncExpr) Eval(current any, env *Env) bool {
 	if fe.fn.ResultType() != Logical {
 		return false
 	}
-	result := fe.Call(current, root)
+	result := fe.Call(current, env)
 	if b, ok := result.(bool); ok {
 		return b
 	}
 	return false
 }
 
-// writeTo writes the canonical string representation of fe to buf.
-func (fe *FuncExpr) writeTo(buf *strings.Builder) {
+// writeTo writes fe to buf in format f, with its arguments separated by ", ".
+func (fe *FuncExpr) writeTo(buf *strings.Builder, f format) {
 	buf.WriteString(fe.name)
 	buf.WriteByte('(')
+	for i, arg := range fe.args {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		switch a := arg.(type) {
+		case *PathQuery:
+			a.writeTo(buf, f)
+		case *FuncExpr:
+			a.writeTo(buf, f)
+		case CompValue:
+			writeCompValue(buf, a, f)
+		default:
+			writeLiteral(buf, a)
+		}
+	}
 	buf.WriteByte(')')
 }
 
 // String returns the canonical string representation of fe.
 func (fe *FuncExpr) String() string {
 	var buf strings.Builder
-	fe.writeTo(&buf)
+	fe.writeTo(&buf, canonical)
 	return buf.String()
 }
 
 // Registry holds named [Function] definitions for use during parsing and
-// evaluation. A Registry is safe for concurrent reads after construction.
+// evaluation. Register must not run concurrently with any other method; once
+// registration is complete, Lookup and Len are safe for concurrent use.
 type Registry struct {
 	funcs map[string]Function
 }
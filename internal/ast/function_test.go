@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -131,8 +132,8 @@ func TestFuncExpr(t *testing.T) {
 
 	t.Run("string", func(t *testing.T) {
 		t.Parallel()
-		fe := NewFuncExpr(fn, []ArgType{Literal}, "a")
-		assert.Equal(t, "testfn()", fe.String())
+		fe := NewFuncExpr(fn, []ArgType{QueryArg, Literal, Literal}, NewPathQuery(false, Child(NameSelector("a"))), "b", 1.0)
+		assert.Equal(t, `testfn(@["a"], "b", 1.0)`, fe.String())
 	})
 
 	t.Run("no_args", func(t *testing.T) {
@@ -292,3 +293,27 @@ func TestBuiltinCallReturnsNil(t *testing.T) {
 		assert.Nil(t, fn.Call(nil))
 	}
 }
+
+func TestRegistry_ConcurrentLookup(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry()
+	r.Register(&builtinFunc{name: "custom", resultType: Logical, validate: validateNArgs(0)})
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			for range 100 {
+				for _, name := range []string{"length", "count", "match", "search", "value", "custom"} {
+					fn, ok := r.Lookup(name)
+					if assert.True(t, ok, name) {
+						assert.Equal(t, name, fn.Name())
+					}
+				}
+				_, ok := r.Lookup("missing")
+				assert.False(t, ok)
+				assert.Equal(t, 6, r.Len())
+			}
+		})
+	}
+	wg.Wait()
+}
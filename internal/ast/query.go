@@ -7,6 +7,7 @@ import "strings"
 type PathQuery struct {
 	segments []Segment
 	root     bool
+	memoSlot int // 1-based memo slot assigned by [NewFilterExpr], or 0
 }
 
 // NewPathQuery creates a [PathQuery]. When root is true it indicates a
@@ -50,42 +51,107 @@ func (q *PathQuery) Singular() *SingularQuery {
 	return &SingularQuery{selectors: sels, relative: !q.root}
 }
 
-// writeTo writes the canonical string representation of q to buf.
-func (q *PathQuery) writeTo(buf *strings.Builder) {
+// format selects how writeTo methods render a query.
+type format uint8
+
+const (
+	// canonical writes every segment in brackets, as by [PathQuery.String].
+	canonical format = iota
+	// shorthand writes lone names in dot notation, as by [PathQuery.Shorthand].
+	shorthand
+	// redacted is canonical but writes filter selectors as a bare ?, as by
+	// [PathQuery.Redacted].
+	redacted
+)
+
+// writeTo writes q to buf in format f.
+func (q *PathQuery) writeTo(buf *strings.Builder, f format) {
 	if q.root {
 		buf.WriteByte('$')
 	} else {
 		buf.WriteByte('@')
 	}
 	for i := range q.segments {
-		q.segments[i].writeTo(buf)
+		q.segments[i].writeTo(buf, f)
 	}
 }
 
 // String returns the canonical string representation of the query,
-// e.g. $["a"][0] or @["name"].
+// e.g. $["a"][0] or @["name"][?@["price"] < 10].
 func (q *PathQuery) String() string {
 	var buf strings.Builder
-	q.writeTo(&buf)
+	q.writeTo(&buf, canonical)
 	return buf.String()
 }
 
-// Select evaluates the query against the given current and root nodes.
-// For root queries ($), it evaluates against root. For relative queries (@),
+// Shorthand is like [PathQuery.String] but writes lone name selectors in
+// dot notation where the name allows it, e.g. $.store..book[0].
+func (q *PathQuery) Shorthand() string {
+	var buf strings.Builder
+	q.writeTo(&buf, shorthand)
+	return buf.String()
+}
+
+// Redacted is like [PathQuery.String] but writes filter selectors as a bare
+// ?, leaving out the literals of their expressions. The result does not parse
+// if q has a filter selector.
+func (q *PathQuery) Redacted() string {
+	var buf strings.Builder
+	q.writeTo(&buf, redacted)
+	return buf.String()
+}
+
+// Select evaluates the query against the given current node and environment.
+// For root queries ($), it evaluates against env.Root. For relative queries (@),
 // it evaluates against current.
-func (q *PathQuery) Select(current, root any) []any {
-	start := root
+func (q *PathQuery) Select(current any, env *Env) []any {
+	start := env.Root
 	if !q.root {
 		start = current
 	}
 
 	result := []any{start}
 	for i := range q.segments {
-		result = q.segments[i].Apply(result, root)
+		result = q.segments[i].Apply(result, env)
+	}
+	if env.Convert != nil {
+		for i, v := range result {
+			result[i] = env.Convert(v)
+		}
 	}
 	return result
 }
 
+// memoKey returns the canonical form of q, under which [NewFilterExpr] merges
+// equal sub-queries. It reports false if q contains a filter selector, whose
+// own sub-queries are merged by the nested [FilterExpr] instead.
+func (q *PathQuery) memoKey() (string, bool) {
+	for i := range q.segments {
+		for _, sel := range q.segments[i].Selectors() {
+			if sel.Kind == Filter {
+				return "", false
+			}
+		}
+	}
+	return q.String(), true
+}
+
+// selectMemo is [PathQuery.Select] for sub-queries of a filter expression. A
+// query merged by [NewFilterExpr] is evaluated once per candidate node and its
+// result reused by later references.
+func (q *PathQuery) selectMemo(current any, env *Env) []any {
+	i := env.memoBase + q.memoSlot - 1
+	if q.memoSlot == 0 || i >= len(env.memo) {
+		return q.Select(current, env)
+	}
+	if m := env.memo[i]; m.done {
+		return m.nodes
+	}
+	nodes := q.Select(current, env)
+	env.memo[i] = memoEntry{nodes: nodes, done: true}
+	return nodes
+}
+
 // SingularQuery is a JSONPath query that is guaranteed to select at most one
 // node. It is composed of a flat list of name/index selectors extracted from
 // singular segments. Per RFC 9535, singular queries can be used as comparison
@@ -116,7 +182,7 @@ func (sq *SingularQuery) writeTo(buf *strings.Builder) {
 	}
 	for i := range sq.selectors {
 		buf.WriteByte('[')
-		sq.selectors[i].writeTo(buf)
+		sq.selectors[i].writeTo(buf, canonical)
 		buf.WriteByte(']')
 	}
 }
@@ -1,23 +1,115 @@
 package ast
 
-import "strings"
+import (
+	"slices"
+	"strings"
+
+	"github.com/agentable/jsonpath/internal/lexer"
+)
 
 // Segment represents a child or descendant segment as defined in
 // RFC 9535 §1.4.2. A segment holds one or more selectors.
 type Segment struct {
 	selectors  []Selector
 	descendant bool
+	union      *unionIndex // nil unless the segment is a large name or index union
 }
 
 // Child creates a child [Segment] that applies selectors to direct children.
 func Child(sel ...Selector) Segment {
-	return Segment{selectors: sel}
+	return Segment{selectors: sel, union: newUnionIndex(sel)}
 }
 
 // Descendant creates a descendant [Segment] that applies selectors recursively
 // to all descendants.
 func Descendant(sel ...Selector) Segment {
-	return Segment{selectors: sel, descendant: true}
+	return Segment{selectors: sel, descendant: true, union: newUnionIndex(sel)}
+}
+
+// unionIndexMin is the smallest union of name or index selectors that is
+// indexed by [newUnionIndex].
+const unionIndexMin = 16
+
+// unionIndex maps the arguments of a segment made only of name selectors, or
+// only of index selectors, to their positions in the segment.
+type unionIndex struct {
+	names   map[string][]int
+	indexes map[int64][]int
+}
+
+// newUnionIndex indexes sel if it is a union of at least unionIndexMin name
+// selectors or index selectors, and returns nil otherwise.
+func newUnionIndex(sel []Selector) *unionIndex {
+	if len(sel) < unionIndexMin {
+		return nil
+	}
+	kind := sel[0].Kind
+	if kind != Name && kind != Index {
+		return nil
+	}
+	u := &unionIndex{}
+	if kind == Name {
+		u.names = make(map[string][]int, len(sel))
+	} else {
+		u.indexes = make(map[int64][]int, len(sel))
+	}
+	for i := range sel {
+		switch {
+		case sel[i].Kind != kind:
+			return nil
+		case kind == Name:
+			u.names[sel[i].Name] = append(u.names[sel[i].Name], i)
+		default:
+			u.indexes[sel[i].Index] = append(u.indexes[sel[i].Index], i)
+		}
+	}
+	return u
+}
+
+// Candidates returns the positions, in ascending order, of the selectors of a
+// large name or index union that select a node from node. It reports false
+// when s is not such a union or when applying every selector in turn is
+// cheaper, in which case the caller must do so. Name unions are not narrowed
+// when env resolves missing members or folds names, nor index unions applied to sparse
+// arrays.
+func (s *Segment) Candidates(node any, env *Env) ([]int, bool) {
+	u := s.union
+	if u == nil {
+		return nil, false
+	}
+	var positions []int
+	switch n := node.(type) {
+	case map[string]any:
+		if u.names == nil {
+			return nil, true
+		}
+		if env.ResolveMember != nil || env.FoldNames || len(n) >= len(s.selectors) {
+			return nil, false
+		}
+		for k := range n {
+			positions = append(positions, u.names[k]...)
+		}
+	case []any:
+		if u.indexes == nil {
+			return nil, true
+		}
+		if len(n) >= len(s.selectors) {
+			return nil, false
+		}
+		for i := range n {
+			positions = append(positions, u.indexes[int64(i)]...)
+			positions = append(positions, u.indexes[int64(i-len(n))]...)
+		}
+	case map[int]any, map[int64]any:
+		if u.indexes == nil {
+			return nil, true
+		}
+		return nil, false
+	default:
+		return nil, true
+	}
+	slices.Sort(positions)
+	return positions, true
 }
 
 // Selectors returns the segment's selectors.
@@ -36,18 +128,40 @@ func (s *Segment) IsSingular() bool {
 	return s.selectors[0].IsSingular()
 }
 
-// writeTo writes the canonical string representation of the segment to buf.
-// Child segments format as [<selectors>]; descendant segments as ..[<selectors>].
-func (s *Segment) writeTo(buf *strings.Builder) {
+// Equal reports whether s and o are the same kind of segment with equal
+// selectors in the same order. See [Selector.Equal] for selector equality.
+func (s *Segment) Equal(o *Segment) bool {
+	if s.descendant != o.descendant || len(s.selectors) != len(o.selectors) {
+		return false
+	}
+	for i := range s.selectors {
+		if !s.selectors[i].Equal(&o.selectors[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTo writes the segment to buf in format f. Child segments format as
+// [<selectors>] and descendant segments as ..[<selectors>], or as .name and
+// ..name in shorthand format if they hold a lone name that can be written so.
+func (s *Segment) writeTo(buf *strings.Builder, f format) {
 	if s.descendant {
 		buf.WriteString("..")
 	}
+	if f == shorthand && len(s.selectors) == 1 && s.selectors[0].Kind == Name && lexer.IsMemberName(s.selectors[0].Name) {
+		if !s.descendant {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(s.selectors[0].Name)
+		return
+	}
 	buf.WriteByte('[')
 	for i := range s.selectors {
 		if i > 0 {
 			buf.WriteByte(',')
 		}
-		s.selectors[i].writeTo(buf)
+		s.selectors[i].writeTo(buf, f)
 	}
 	buf.WriteByte(']')
 }
@@ -55,12 +169,12 @@ func (s *Segment) writeTo(buf *strings.Builder) {
 // String returns the canonical string representation of the segment.
 func (s *Segment) String() string {
 	var buf strings.Builder
-	s.writeTo(&buf)
+	s.writeTo(&buf, canonical)
 	return buf.String()
 }
 
 // Apply applies the segment to a list of nodes and returns the result.
-func (s *Segment) Apply(nodes []any, root any) []any {
+func (s *Segment) Apply(nodes []any, env *Env) []any {
 	if len(nodes) == 0 {
 		return nodes
 	}
@@ -68,38 +182,64 @@ func (s *Segment) Apply(nodes []any, root any) []any {
 	result := make([]any, 0, len(nodes))
 	if s.descendant {
 		for _, node := range nodes {
-			result = appendDescendant(result, s.selectors, node, root)
+			result = s.appendDescendant(result, node, env, nil)
 		}
 	} else {
 		for _, node := range nodes {
-			result = appendSelectors(result, s.selectors, node, root)
+			result = s.appendSelectors(result, node, env)
 		}
 	}
 	return result
 }
 
-// appendSelectors applies selectors to a single node and appends results.
-func appendSelectors(out []any, selectors []Selector, node, root any) []any {
-	for i := range selectors {
-		out = selectors[i].Apply(out, node, root)
+// appendSelectors applies the segment's selectors to a single node and
+// appends results.
+func (s *Segment) appendSelectors(out []any, node any, env *Env) []any {
+	node = env.Node(node)
+	if positions, ok := s.Candidates(node, env); ok {
+		for _, i := range positions {
+			out = s.selectors[i].Apply(out, node, env)
+		}
+		return out
+	}
+	for i := range s.selectors {
+		out = s.selectors[i].Apply(out, node, env)
 	}
 	return out
 }
 
-// appendDescendant recursively applies selectors to node and all descendants.
-func appendDescendant(out []any, selectors []Selector, node, root any) []any {
+// appendDescendant recursively applies the segment's selectors to node and
+// all descendants. ancestors holds the containers enclosing node below the
+// node the segment was applied to; a node among them is skipped. The walk
+// stops, recording why in env.Err, below env.MaxDepth or once env.Context is
+// done.
+func (s *Segment) appendDescendant(out []any, node any, env *Env, ancestors []Container) []any {
+	if env.stopped(len(ancestors)) {
+		return out
+	}
+	node = env.Node(node)
+	if id := ContainerOf(node); id != (Container{}) {
+		if slices.Contains(ancestors, id) {
+			return out
+		}
+		ancestors = append(ancestors, id)
+	}
 	// Apply selectors to current node
-	out = appendSelectors(out, selectors, node, root)
+	out = s.appendSelectors(out, node, env)
 
 	// Recurse into children
 	switch n := node.(type) {
 	case map[string]any:
 		for _, v := range n {
-			out = appendDescendant(out, selectors, v, root)
+			out = s.appendDescendant(out, v, env, ancestors)
 		}
 	case []any:
 		for _, v := range n {
-			out = appendDescendant(out, selectors, v, root)
+			out = s.appendDescendant(out, v, env, ancestors)
+		}
+	default:
+		for _, e := range SparseEntries(node) {
+			out = s.appendDescendant(out, e.Value, env, ancestors)
 		}
 	}
 	return out
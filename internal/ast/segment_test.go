@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"slices"
 	"strings"
 	"testing"
 
@@ -179,6 +180,70 @@ func TestSegmentWriteTo(t *testing.T) {
 	// Verify writeTo produces the same result as String.
 	seg := Child(NameSelector("test"), IndexSelector(2))
 	var buf strings.Builder
-	seg.writeTo(&buf)
+	seg.writeTo(&buf, canonical)
 	assert.Equal(t, seg.String(), buf.String())
 }
+
+func TestSegmentCandidates(t *testing.T) {
+	t.Parallel()
+
+	indexes := make([]Selector, 0, unionIndexMin+3)
+	for i := range unionIndexMin {
+		indexes = append(indexes, IndexSelector(int64(100+i)))
+	}
+	indexes = append(indexes, IndexSelector(2), IndexSelector(-1), IndexSelector(2))
+	names := make([]Selector, 0, unionIndexMin+2)
+	for i := range unionIndexMin {
+		names = append(names, NameSelector(strings.Repeat("x", i+2)))
+	}
+	names = append(names, NameSelector("b"), NameSelector("a"))
+
+	t.Run("small_unions_not_indexed", func(t *testing.T) {
+		t.Parallel()
+		s := Child(IndexSelector(0), IndexSelector(1))
+		_, ok := s.Candidates([]any{1, 2}, &Env{})
+		assert.False(t, ok)
+	})
+
+	t.Run("mixed_unions_not_indexed", func(t *testing.T) {
+		t.Parallel()
+		s := Child(append(slices.Clone(indexes), NameSelector("a"))...)
+		_, ok := s.Candidates([]any{1, 2}, &Env{})
+		assert.False(t, ok)
+	})
+
+	t.Run("index_union", func(t *testing.T) {
+		t.Parallel()
+		s := Child(indexes...)
+		arr := []any{"a", "b", "c"}
+		positions, ok := s.Candidates(arr, &Env{})
+		assert.True(t, ok)
+		assert.Equal(t, []int{unionIndexMin, unionIndexMin + 1, unionIndexMin + 2}, positions)
+		assert.Equal(t, []any{"c", "c", "c"}, s.Apply([]any{arr}, &Env{}))
+
+		positions, ok = s.Candidates(map[string]any{"a": 1}, &Env{})
+		assert.True(t, ok)
+		assert.Empty(t, positions)
+
+		_, ok = s.Candidates(make([]any, 200), &Env{})
+		assert.False(t, ok, "large arrays apply every selector")
+	})
+
+	t.Run("name_union", func(t *testing.T) {
+		t.Parallel()
+		s := Descendant(names...)
+		obj := map[string]any{"a": 1, "b": 2, "c": 3}
+		positions, ok := s.Candidates(obj, &Env{})
+		assert.True(t, ok)
+		assert.Equal(t, []int{unionIndexMin, unionIndexMin + 1}, positions)
+		assert.Equal(t, []any{2, 1}, s.Apply([]any{obj}, &Env{}))
+
+		positions, ok = s.Candidates([]any{obj}, &Env{})
+		assert.True(t, ok)
+		assert.Empty(t, positions)
+
+		resolve := &Env{ResolveMember: func(map[string]any, string) (any, bool) { return nil, false }}
+		_, ok = s.Candidates(obj, resolve)
+		assert.False(t, ok, "resolvers must see every missing name")
+	})
+}
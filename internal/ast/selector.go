@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"fmt"
+	"iter"
 	"strconv"
 	"strings"
 )
@@ -16,6 +18,24 @@ const (
 	Filter                       // filter selector
 )
 
+// String returns the lowercase name of k, e.g. "wildcard".
+func (k SelectorKind) String() string {
+	switch k {
+	case Name:
+		return "name"
+	case Index:
+		return "index"
+	case Slice:
+		return "slice"
+	case Wildcard:
+		return "wildcard"
+	case Filter:
+		return "filter"
+	default:
+		return fmt.Sprintf("SelectorKind(%d)", k)
+	}
+}
+
 // Selector is a tagged union representing one of the five RFC 9535 selector
 // types. Using a concrete struct (instead of an interface) keeps selector
 // slices contiguous in memory for cache efficiency.
@@ -57,8 +77,11 @@ func WildcardSelector() Selector {
 	return Selector{Kind: Wildcard}
 }
 
-// FilterSelector returns a filter Selector.
+// FilterSelector returns a filter Selector. It panics if expr is nil.
 func FilterSelector(expr *FilterExpr) Selector {
+	if expr == nil {
+		panic("ast: FilterSelector called with nil expression")
+	}
 	return Selector{Kind: Filter, Filter: expr}
 }
 
@@ -68,11 +91,11 @@ func (s *Selector) IsSingular() bool {
 	return s.Kind == Name || s.Kind == Index
 }
 
-// writeTo writes the canonical string representation of s to buf.
-func (s *Selector) writeTo(buf *strings.Builder) {
+// writeTo writes s to buf in format f.
+func (s *Selector) writeTo(buf *strings.Builder, f format) {
 	switch s.Kind {
 	case Name:
-		buf.WriteString(strconv.Quote(s.Name))
+		WriteQuoted(buf, s.Name, '"')
 	case Index:
 		buf.WriteString(strconv.FormatInt(s.Index, 10))
 	case Slice:
@@ -80,29 +103,96 @@ func (s *Selector) writeTo(buf *strings.Builder) {
 	case Wildcard:
 		buf.WriteByte('*')
 	case Filter:
-		buf.WriteString("?")
-		// Full filter expression serialization will be added with filter support.
+		buf.WriteByte('?')
+		if f != redacted {
+			s.Filter.Or.writeTo(buf, f)
+		}
 	}
 }
 
+// Equal reports whether s and o select the same nodes by construction: name,
+// index and slice selectors compare their arguments and wildcards are equal to
+// each other. Filter selectors are equal only if they share one [FilterExpr].
+func (s *Selector) Equal(o *Selector) bool {
+	if s.Kind != o.Kind {
+		return false
+	}
+	switch s.Kind {
+	case Name:
+		return s.Name == o.Name
+	case Index:
+		return s.Index == o.Index
+	case Slice:
+		return s.Slice == o.Slice
+	case Wildcard:
+		return true
+	case Filter:
+		return s.Filter == o.Filter
+	default:
+		return false
+	}
+}
+
+// WriteQuoted writes str to buf as a string literal delimited by quote,
+// escaping it as RFC 9535 §2.7 prescribes for normalized paths so the result
+// parses back to str. Bytes that are not valid UTF-8 cannot be represented and
+// are written as U+FFFD.
+func WriteQuoted(buf *strings.Builder, str string, quote byte) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte(quote)
+	for _, r := range str {
+		switch r {
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case rune(quote):
+			buf.WriteByte('\\')
+			buf.WriteByte(quote)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte(quote)
+}
+
 // String returns the canonical string representation of s.
 func (s *Selector) String() string {
 	var buf strings.Builder
-	s.writeTo(&buf)
+	s.writeTo(&buf, canonical)
 	return buf.String()
 }
 
 // Apply applies the selector to a node and appends matching results to out.
-func (s *Selector) Apply(out []any, node, root any) []any {
+// A selector of unknown kind selects nothing and records [ErrUnknownSelector]
+// in env.Err.
+func (s *Selector) Apply(out []any, node any, env *Env) []any {
 	switch s.Kind {
 	case Name:
 		if m, ok := node.(map[string]any); ok {
-			if v, ok := m[s.Name]; ok {
+			if env.FoldNames {
+				env.FoldedMembers(m, s.Name, func(_ string, v any) { out = append(out, v) })
+			} else if v, ok := env.Member(m, s.Name); ok {
 				out = append(out, v)
 			}
 		}
 	case Index:
 		if arr, ok := node.([]any); ok {
+			// Compare in int64 before indexing: s.Index may not fit in an int.
 			idx := s.Index
 			if idx < 0 {
 				idx += int64(len(arr))
@@ -110,6 +200,8 @@ func (s *Selector) Apply(out []any, node, root any) []any {
 			if idx >= 0 && idx < int64(len(arr)) {
 				out = append(out, arr[idx])
 			}
+		} else if v, ok := SparseIndex(node, s.Index); ok {
+			out = append(out, v)
 		}
 	case Slice:
 		if arr, ok := node.([]any); ok {
@@ -123,21 +215,46 @@ func (s *Selector) Apply(out []any, node, root any) []any {
 			}
 		case []any:
 			out = append(out, n...)
+		default:
+			for _, e := range SparseEntries(node) {
+				out = append(out, e.Value)
+			}
 		}
 	case Filter:
+		// Each candidate may run sub-queries, so check for cancellation
+		// before testing it.
 		switch n := node.(type) {
 		case map[string]any:
 			for _, v := range n {
-				if s.Filter.Eval(v, root) {
+				if env.cancelled() {
+					break
+				}
+				if s.Filter.Eval(v, env) {
 					out = append(out, v)
 				}
 			}
 		case []any:
 			for _, v := range n {
-				if s.Filter.Eval(v, root) {
+				if env.cancelled() {
+					break
+				}
+				if s.Filter.Eval(v, env) {
 					out = append(out, v)
 				}
 			}
+		default:
+			for _, e := range SparseEntries(node) {
+				if env.cancelled() {
+					break
+				}
+				if s.Filter.Eval(e.Value, env) {
+					out = append(out, e.Value)
+				}
+			}
+		}
+	default:
+		if env.Err == nil {
+			env.Err = fmt.Errorf("%w %d", ErrUnknownSelector, s.Kind)
 		}
 	}
 	return out
@@ -145,95 +262,78 @@ func (s *Selector) Apply(out []any, node, root any) []any {
 
 // applySlice applies a slice selector to an array.
 func (s *Selector) applySlice(out []any, arr []any) []any {
-	length := int64(len(arr))
-	if length == 0 {
-		return out
+	for i := range s.Slice.Indices(len(arr)) {
+		out = append(out, arr[i])
 	}
+	return out
+}
 
-	// Normalize start, end, step
-	start := s.Slice.Start
-	end := s.Slice.End
-	step := s.Slice.Step
-
-	if !s.Slice.HasStep {
-		step = 1
+// Bounds returns the normalized bounds and step of the slice applied to an
+// array of the given length, per RFC 9535 §2.3.4.2.2. With a positive step
+// the selected indexes run from lower up to but excluding upper; with a
+// negative step they run from upper down to but excluding lower. A zero step
+// selects nothing.
+func (a SliceArgs) Bounds(length int) (lower, upper, step int64) {
+	n := int64(length)
+	step = 1
+	if a.HasStep {
+		step = a.Step
+	}
+	normalize := func(i int64) int64 {
+		if i >= 0 {
+			return i
+		}
+		return n + i
 	}
 
-	// Set defaults based on step direction
 	switch {
 	case step > 0:
-		if !s.Slice.HasStart {
-			start = 0
+		start, end := int64(0), n
+		if a.HasStart {
+			start = normalize(a.Start)
 		}
-		if !s.Slice.HasEnd {
-			end = length
+		if a.HasEnd {
+			end = normalize(a.End)
 		}
+		return min(max(start, 0), n), min(max(end, 0), n), step
 	case step < 0:
-		if !s.Slice.HasStart {
-			start = length - 1
+		start, end := n-1, -n-1
+		if a.HasStart {
+			start = normalize(a.Start)
 		}
-		if !s.Slice.HasEnd {
-			end = -length - 1
+		if a.HasEnd {
+			end = normalize(a.End)
 		}
+		return min(max(end, -1), n-1), min(max(start, -1), n-1), step
 	default:
-		// step == 0
-		return out
-	}
-
-	// Handle negative indices
-	if start < 0 {
-		start += length
-	}
-	if end < 0 {
-		end += length
-	}
-
-	// Clamp to array bounds
-	if step > 0 {
-		if start < 0 {
-			start = 0
-		}
-		if start > length {
-			start = length
-		}
-		if end < 0 {
-			end = 0
-		}
-		if end > length {
-			end = length
-		}
-	} else {
-		// For negative step, allow end to be -1 (before first element)
-		if start < 0 {
-			start = 0
-		}
-		if start >= length {
-			start = length - 1
-		}
-		if end < -1 {
-			end = -1
-		}
-		if end >= length {
-			end = length - 1
-		}
+		return 0, 0, 0
 	}
+}
 
-	// Iterate based on step direction
-	if step > 0 {
-		for i := start; i < end; i += step {
-			out = append(out, arr[i])
-		}
-	} else {
-		for i := start; i > end; i += step {
-			out = append(out, arr[i])
+// Indices returns an iterator over the array indexes the slice selects from
+// an array of the given length, in selection order.
+func (a SliceArgs) Indices(length int) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		lower, upper, step := a.Bounds(length)
+		switch {
+		case step > 0:
+			for i := lower; i < upper; i += step {
+				if !yield(int(i)) || step >= upper-i {
+					return
+				}
+			}
+		case step < 0:
+			for i := upper; i > lower; i += step {
+				if !yield(int(i)) || step <= lower-i {
+					return
+				}
+			}
 		}
 	}
-
-	return out
 }
 
 // writeTo writes the canonical slice notation (e.g. "1:5:2") to buf.
-func (a *SliceArgs) writeTo(buf *strings.Builder) {
+func (a SliceArgs) writeTo(buf *strings.Builder) {
 	if a.HasStart {
 		buf.WriteString(strconv.FormatInt(a.Start, 10))
 	}
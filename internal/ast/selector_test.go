@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"math"
+	"slices"
 	"strings"
 	"testing"
 
@@ -216,6 +218,35 @@ func TestSelectorString(t *testing.T) {
 	}
 }
 
+func TestWriteQuoted(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		in    string
+		quote byte
+		want  string
+	}{
+		{"plain_double", "abc", '"', `"abc"`},
+		{"plain_single", "abc", '\'', `'abc'`},
+		{"own_quote_escaped", `a"b'c`, '"', `"a\"b'c"`},
+		{"other_quote_kept", `a"b'c`, '\'', `'a"b\'c'`},
+		{"named_escapes", "\b\f\n\r\t\\", '"', `"\b\f\n\r\t\\"`},
+		{"nul", "\x00", '"', `"\u0000"`},
+		{"unit_separator", "\x1f", '"', `"\u001f"`},
+		{"del_unescaped", "\x7f", '"', "\"\x7f\""},
+		{"non_ascii", "日本", '"', `"日本"`},
+		{"invalid_utf8", "a\xffb", '"', "\"a\uFFFDb\""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var buf strings.Builder
+			WriteQuoted(&buf, tc.in, tc.quote)
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
+
 func TestSelectorWriteTo(t *testing.T) {
 	t.Parallel()
 
@@ -229,7 +260,7 @@ func TestSelectorWriteTo(t *testing.T) {
 	}
 	for _, sel := range selectors {
 		var buf strings.Builder
-		sel.writeTo(&buf)
+		sel.writeTo(&buf, canonical)
 		assert.Equal(t, sel.String(), buf.String())
 	}
 }
@@ -302,3 +333,147 @@ func TestSelectorKindValues(t *testing.T) {
 	assert.Equal(t, SelectorKind(3), Wildcard)
 	assert.Equal(t, SelectorKind(4), Filter)
 }
+
+func TestSliceArgsIndices(t *testing.T) {
+	t.Parallel()
+
+	// The first five cases are the RFC 9535 §2.3.4.3 examples over
+	// ["a", "b", "c", "d", "e", "f", "g"].
+	for _, tc := range []struct {
+		name         string
+		args         SliceArgs
+		length       int
+		lower, upper int64
+		want         []int
+	}{
+		{"rfc_1_3", SliceArgs{Start: 1, End: 3, HasStart: true, HasEnd: true}, 7, 1, 3, []int{1, 2}},
+		{"rfc_5_", SliceArgs{Start: 5, HasStart: true}, 7, 5, 7, []int{5, 6}},
+		{"rfc_1_5_2", SliceArgs{Start: 1, End: 5, Step: 2, HasStart: true, HasEnd: true, HasStep: true}, 7, 1, 5, []int{1, 3}},
+		{"rfc_5_1_-2", SliceArgs{Start: 5, End: 1, Step: -2, HasStart: true, HasEnd: true, HasStep: true}, 7, 1, 5, []int{5, 3}},
+		{"rfc_reverse", SliceArgs{Step: -1, HasStep: true}, 7, -1, 6, []int{6, 5, 4, 3, 2, 1, 0}},
+		{"negative_bounds", SliceArgs{Start: -2, End: -1, HasStart: true, HasEnd: true}, 5, 3, 4, []int{3}},
+		{"clamped", SliceArgs{Start: -10, End: 10, HasStart: true, HasEnd: true}, 3, 0, 3, []int{0, 1, 2}},
+		{"negative_step_start_before_array", SliceArgs{Start: -10, Step: -1, HasStart: true, HasStep: true}, 3, -1, -1, nil},
+		{"negative_step_start_after_array", SliceArgs{Start: 10, Step: -1, HasStart: true, HasStep: true}, 3, -1, 2, []int{2, 1, 0}},
+		{"zero_step", SliceArgs{Step: 0, HasStep: true}, 3, 0, 0, nil},
+		{"empty_array", SliceArgs{}, 0, 0, 0, nil},
+		{"empty_array_reverse", SliceArgs{Step: -1, HasStep: true}, 0, -1, -1, nil},
+		{"max_step", SliceArgs{Start: 1, Step: math.MaxInt64, HasStart: true, HasStep: true}, 3, 1, 3, []int{1}},
+		{"min_step", SliceArgs{Start: 1, Step: math.MinInt64, HasStart: true, HasStep: true}, 3, -1, 1, []int{1}},
+		{"extreme_bounds", SliceArgs{Start: math.MinInt64, End: math.MaxInt64, HasStart: true, HasEnd: true}, 2, 0, 2, []int{0, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			lower, upper, _ := tc.args.Bounds(tc.length)
+			assert.Equal(t, tc.lower, lower, "lower")
+			assert.Equal(t, tc.upper, upper, "upper")
+			assert.Equal(t, tc.want, slices.Collect(tc.args.Indices(tc.length)))
+
+			arr := make([]any, tc.length)
+			for i := range arr {
+				arr[i] = i
+			}
+			var want []any
+			for _, i := range tc.want {
+				want = append(want, i)
+			}
+			sel := SliceSelector(tc.args)
+			assert.Equal(t, want, sel.Apply(nil, arr, &Env{}))
+		})
+	}
+}
+
+func TestSelectorEqual(t *testing.T) {
+	t.Parallel()
+
+	filter := &FilterExpr{}
+	slice := SliceArgs{Start: 1, HasStart: true}
+	for _, tc := range []struct {
+		name string
+		a, b Selector
+		want bool
+	}{
+		{"same_name", NameSelector("a"), NameSelector("a"), true},
+		{"different_name", NameSelector("a"), NameSelector("b"), false},
+		{"same_index", IndexSelector(-1), IndexSelector(-1), true},
+		{"different_index", IndexSelector(0), IndexSelector(1), false},
+		{"same_slice", SliceSelector(slice), SliceSelector(slice), true},
+		{"explicit_default", SliceSelector(SliceArgs{}), SliceSelector(SliceArgs{Step: 1, HasStep: true}), false},
+		{"wildcards", WildcardSelector(), WildcardSelector(), true},
+		{"shared_filter", FilterSelector(filter), FilterSelector(filter), true},
+		{"distinct_filters", FilterSelector(filter), FilterSelector(&FilterExpr{}), false},
+		{"kind_mismatch", IndexSelector(0), NameSelector("0"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, tc.a.Equal(&tc.b))
+			assert.Equal(t, tc.want, tc.b.Equal(&tc.a))
+
+			segA, segB := Child(tc.a), Child(tc.b)
+			assert.Equal(t, tc.want, segA.Equal(&segB))
+			desc := Descendant(tc.b)
+			assert.False(t, segA.Equal(&desc))
+		})
+	}
+}
+
+func TestSelectorInvalid(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil_filter", func(t *testing.T) {
+		t.Parallel()
+		assert.PanicsWithValue(t, "ast: FilterSelector called with nil expression", func() {
+			FilterSelector(nil)
+		})
+	})
+
+	t.Run("unknown_kind", func(t *testing.T) {
+		t.Parallel()
+		sel := Selector{Kind: 42}
+		env := &Env{}
+		assert.Empty(t, sel.Apply(nil, []any{1}, env))
+		assert.ErrorIs(t, env.Err, ErrUnknownSelector)
+		assert.EqualError(t, env.Err, "jsonpath: unknown selector kind 42")
+	})
+}
+
+func TestSelectorApplyIndex(t *testing.T) {
+	t.Parallel()
+
+	arr := []any{"a", "b", "c"}
+	for _, tc := range []struct {
+		name  string
+		index int64
+		want  []any
+	}{
+		{"first", 0, []any{"a"}},
+		{"last", 2, []any{"c"}},
+		{"past_end", 3, nil},
+		{"negative_last", -1, []any{"c"}},
+		{"negative_first", -3, []any{"a"}},
+		{"negative_before_start", -4, nil},
+		{"max_safe", 1<<53 - 1, nil},
+		{"min_safe", -(1<<53 - 1), nil},
+		{"max_int32_plus_one", math.MaxInt32 + 1, nil},
+		{"max_uint32_plus_one", math.MaxUint32 + 1, nil},
+		{"min_int32_minus_one", math.MinInt32 - 1, nil},
+		{"max_int64", math.MaxInt64, nil},
+		{"min_int64", math.MinInt64, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			sel := IndexSelector(tc.index)
+			assert.Equal(t, tc.want, sel.Apply(nil, arr, &Env{}))
+			// Keys of sparse arrays are looked up literally, so an index that
+			// does not fit in an int selects nothing rather than a truncated key.
+			sparse := map[int]any{0: "a", -1: "z", 1: "one"}
+			v, ok := SparseIndex(sparse, tc.index)
+			want, wantOK := sparse[int(tc.index)]
+			if int64(int(tc.index)) != tc.index {
+				want, wantOK = nil, false
+			}
+			assert.Equal(t, wantOK, ok)
+			assert.Equal(t, want, v)
+		})
+	}
+}
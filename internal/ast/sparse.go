@@ -0,0 +1,60 @@
+package ast
+
+import (
+	"cmp"
+	"slices"
+)
+
+// SparseEntry is one element of a sparse array.
+type SparseEntry struct {
+	Index int64
+	Value any
+}
+
+// SparseEntries returns the elements of node sorted by index if node is a
+// sparse array, that is a map[int]any or map[int64]any. It returns nil for
+// any other value.
+//
+// Sparse arrays are an extension beyond the JSON data model: index selectors
+// look up their keys literally, wildcard and filter selectors visit their
+// elements in key order, and name and slice selectors select nothing.
+func SparseEntries(node any) []SparseEntry {
+	var entries []SparseEntry
+	switch n := node.(type) {
+	case map[int]any:
+		entries = make([]SparseEntry, 0, len(n))
+		for k, v := range n {
+			entries = append(entries, SparseEntry{Index: int64(k), Value: v})
+		}
+	case map[int64]any:
+		entries = make([]SparseEntry, 0, len(n))
+		for k, v := range n {
+			entries = append(entries, SparseEntry{Index: k, Value: v})
+		}
+	default:
+		return nil
+	}
+	slices.SortFunc(entries, func(a, b SparseEntry) int {
+		return cmp.Compare(a.Index, b.Index)
+	})
+	return entries
+}
+
+// SparseIndex returns the element of the sparse array node stored under idx.
+// Negative indexes are keys like any other and do not count from the end. It
+// reports false if node is not a sparse array or has no such element.
+func SparseIndex(node any, idx int64) (any, bool) {
+	switch n := node.(type) {
+	case map[int]any:
+		if int64(int(idx)) != idx {
+			return nil, false
+		}
+		v, ok := n[int(idx)]
+		return v, ok
+	case map[int64]any:
+		v, ok := n[idx]
+		return v, ok
+	default:
+		return nil, false
+	}
+}
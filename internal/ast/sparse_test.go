@@ -0,0 +1,46 @@
+package ast
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparseEntries(t *testing.T) {
+	t.Parallel()
+	want := []SparseEntry{{-2, "a"}, {0, "b"}, {9, "c"}}
+	assert.Equal(t, want, SparseEntries(map[int]any{9: "c", -2: "a", 0: "b"}))
+	assert.Equal(t, want, SparseEntries(map[int64]any{9: "c", -2: "a", 0: "b"}))
+	assert.Empty(t, SparseEntries(map[int]any{}))
+	assert.Nil(t, SparseEntries([]any{"a"}))
+	assert.Nil(t, SparseEntries(map[string]any{"0": "a"}))
+	assert.Nil(t, SparseEntries(map[int]string{0: "a"}))
+}
+
+func TestSparseIndex(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		node   any
+		idx    int64
+		want   any
+		wantOK bool
+	}{
+		{"int_hit", map[int]any{3: "x"}, 3, "x", true},
+		{"int_negative", map[int]any{-1: "x"}, -1, "x", true},
+		{"int_miss", map[int]any{3: "x"}, 4, nil, false},
+		{"int64_hit", map[int64]any{math.MaxInt64: "x"}, math.MaxInt64, "x", true},
+		{"int64_miss", map[int64]any{3: "x"}, -1, nil, false},
+		{"array", []any{"x"}, 0, nil, false},
+		{"nil", nil, 0, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := SparseIndex(tt.node, tt.idx)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -106,25 +106,61 @@ type Token struct {
 func (t Token) Val(src string) string { return src[t.Start:t.End] }
 
 // ErrSyntax is the sentinel error returned by [Token.Err] for invalid tokens.
-var ErrSyntax = errors.New("jsonpath")
+var ErrSyntax = errors.New("jsonpath: lexical error")
+
+// ErrEscape is the sentinel error returned by [Token.Err] for strings with a
+// malformed escape sequence. It matches [ErrSyntax] too.
+var ErrEscape error = escapeError{}
+
+// escapeError is the type of [ErrEscape].
+type escapeError struct{}
+
+func (escapeError) Error() string { return "jsonpath: invalid escape sequence" }
+
+// Is reports whether target is [ErrSyntax].
+func (escapeError) Is(target error) bool { return target == ErrSyntax }
+
+// msgEscape is the message of [Invalid] tokens for malformed escape sequences.
+const msgEscape = "invalid escape sequence"
 
 // Err returns a parse error for [Invalid] tokens and nil for all others.
 func (t Token) Err() error {
 	if t.Kind != Invalid {
 		return nil
 	}
-	return fmt.Errorf("%w: %s at position %d", ErrSyntax, t.Value, t.Start)
+	return fmt.Errorf("%w: %s at position %d", t.Sentinel(), t.Value, t.Start)
+}
+
+// Sentinel returns the sentinel error classifying an [Invalid] token,
+// [ErrEscape] or [ErrSyntax], and nil for all other tokens.
+func (t Token) Sentinel() error {
+	switch {
+	case t.Kind != Invalid:
+		return nil
+	case t.Value == msgEscape:
+		return ErrEscape
+	default:
+		return ErrSyntax
+	}
 }
 
 // Lexer tokenizes an RFC 9535 JSONPath expression. Create with [New] and
 // call [Lexer.Scan] repeatedly to get tokens.
 type Lexer struct {
 	src     string // source input
-	r       rune   // current rune; -1 means EOF
+	r       rune   // current rune; -1 means EOF, badRune invalid UTF-8
 	rPos    int    // byte offset of current rune
 	nextPos int    // byte offset after current rune
+
+	// NameChar, if set, reports whether r may follow the first character of
+	// a member name besides the characters RFC 9535 allows.
+	NameChar func(r rune) bool
 }
 
+// badRune stands in for a byte that does not start a valid UTF-8 encoding.
+// It lies outside the Unicode range, so no character class accepts it.
+const badRune = utf8.MaxRune + 1
+
 // New creates a Lexer for src.
 func New(src string) *Lexer {
 	l := &Lexer{src: src, r: -1}
@@ -141,7 +177,7 @@ func (l *Lexer) next() rune {
 		l.rPos = l.nextPos
 		r, w := rune(l.src[l.nextPos]), 1
 		if r >= utf8.RuneSelf {
-			r, w = utf8.DecodeRuneInString(l.src[l.nextPos:])
+			r, w = decodeRune(l.src[l.nextPos:])
 		}
 		l.nextPos += w
 		l.r = r
@@ -157,13 +193,23 @@ func (l *Lexer) peek() rune {
 	if l.nextPos < len(l.src) {
 		r := rune(l.src[l.nextPos])
 		if r >= utf8.RuneSelf {
-			r, _ = utf8.DecodeRuneInString(l.src[l.nextPos:])
+			r, _ = decodeRune(l.src[l.nextPos:])
 		}
 		return r
 	}
 	return -1
 }
 
+// decodeRune decodes the first rune of s, reporting invalid UTF-8 as
+// badRune.
+func decodeRune(s string) (rune, int) {
+	r, w := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && w == 1 {
+		return badRune, 1
+	}
+	return r, w
+}
+
 // errToken creates an [Invalid] token and halts the lexer.
 func (l *Lexer) errToken(start int, msg string) Token {
 	l.r = -1 // halt further scanning
@@ -290,6 +336,10 @@ func (l *Lexer) Scan() Token {
 		if isNameFirst(l.r) {
 			return l.scanIdent()
 		}
+		if l.r == badRune {
+			l.next()
+			return l.errToken(start, "invalid UTF-8")
+		}
 		ch := l.r
 		l.next()
 		return l.errToken(start, fmt.Sprintf("unexpected character %q", ch))
@@ -300,7 +350,7 @@ func (l *Lexer) Scan() Token {
 // l.r must be a valid name-first character on entry.
 func (l *Lexer) scanIdent() Token {
 	start := l.rPos
-	for isNameChar(l.r) {
+	for isNameChar(l.r) || l.NameChar != nil && l.r >= 0 && l.r != badRune && l.NameChar(l.r) {
 		l.next()
 	}
 	raw := l.src[start:l.rPos]
@@ -381,20 +431,35 @@ func (l *Lexer) scanString() Token {
 	quote := l.r
 	l.next() // consume opening quote
 
+	// Until the first escape, the value is the source between the quotes;
+	// from then on it is built in buf.
 	var buf strings.Builder
+	escaped := false
 
 	for l.r >= 0 {
 		switch {
 		case l.r == quote:
+			value := l.src[start+1 : l.rPos]
+			if escaped {
+				value = buf.String()
+			}
 			l.next() // consume closing quote
-			return Token{Kind: String, Start: start, End: l.rPos, Value: buf.String()}
+			return Token{Kind: String, Start: start, End: l.rPos, Value: value}
 		case l.r == '\\':
+			if !escaped {
+				buf.WriteString(l.src[start+1 : l.rPos])
+				escaped = true
+			}
 			if !l.scanEscape(quote, &buf) {
-				return l.errToken(start, "invalid escape sequence")
+				return l.errToken(start, msgEscape)
 			}
 		case isUnescaped(l.r, quote):
-			buf.WriteRune(l.r)
+			if escaped {
+				buf.WriteRune(l.r)
+			}
 			l.next()
+		case l.r == badRune:
+			return l.errToken(start, "invalid UTF-8 in string")
 		default:
 			return l.errToken(start, fmt.Sprintf("invalid character %U in string", l.r))
 		}
@@ -537,6 +602,20 @@ func isNameChar(r rune) bool {
 	return isNameFirst(r) || isDigit(r)
 }
 
+// IsMemberName reports whether s can be written as a member name shorthand,
+// as in .name, per RFC 9535 §2.5.1.1.
+func IsMemberName(s string) bool {
+	if s == "" || !utf8.ValidString(s) {
+		return false
+	}
+	for i, r := range s {
+		if i == 0 && !isNameFirst(r) || !isNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
 // isUnescaped reports whether r is an unescaped character valid in a string
 // with the given quote character, per RFC 9535 §2.3.1.
 func isUnescaped(r, quote rune) bool {
@@ -328,6 +328,8 @@ func TestInvalidStrings(t *testing.T) {
 		{"invalid_surrogate_low", `"\uD834\uED1E"`},
 		{"lone_high_surrogate", `"\uD834 "`},
 		{"lone_low_surrogate", `"\uDC00"`},
+		{"invalid_utf8", "'a\xffb'"},
+		{"truncated_utf8", "'\xe2\x82'"},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -528,6 +530,13 @@ func TestTokenErr(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "bad character")
 	assert.Contains(t, err.Error(), "position 5")
+	assert.Equal(t, ErrSyntax, tok.Sentinel())
+
+	tok = New(`"\x"`).Scan()
+	assert.Equal(t, ErrEscape, tok.Sentinel())
+	require.ErrorIs(t, tok.Err(), ErrEscape)
+	require.ErrorIs(t, tok.Err(), ErrSyntax)
+	assert.Nil(t, Token{Kind: Dollar}.Sentinel())
 }
 
 func TestPeek(t *testing.T) {
@@ -550,6 +559,35 @@ func TestUnexpectedCharacter(t *testing.T) {
 	require.Error(t, tok.Err())
 }
 
+func TestInvalidUTF8(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		start int
+	}{
+		{"bare_byte", "\xff", 0},
+		{"after_ident", "ab\xff", 2},
+		{"inside_string", "'a\xff'", 0},
+		{"surrogate_encoding", "\xed\xa0\x80", 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			l := New(tc.input)
+			tok := l.Scan()
+			for tok.Kind != Invalid && tok.Kind != EOF {
+				tok = l.Scan()
+			}
+			assert.Equal(t, Invalid, tok.Kind)
+			assert.Equal(t, tc.start, tok.Start)
+			assert.ErrorIs(t, tok.Err(), ErrSyntax)
+			assert.Contains(t, tok.Value, "UTF-8")
+		})
+	}
+}
+
 func TestZeroCopyVal(t *testing.T) {
 	t.Parallel()
 	// Verify Val returns a substring of the original source (no allocation).
@@ -564,6 +602,25 @@ func TestZeroCopyVal(t *testing.T) {
 	assert.Equal(t, src[2:5], val)
 }
 
+func TestZeroCopyStringValue(t *testing.T) {
+	// Strings without escapes take their value from the source.
+	src := `$["title"]`
+	allocs := testing.AllocsPerRun(100, func() {
+		l := Lexer{src: src, r: -1}
+		l.next()
+		for l.Scan().Kind != EOF {
+		}
+	})
+	assert.Zero(t, allocs)
+
+	l := New(src)
+	l.Scan()
+	l.Scan()
+	tok := l.Scan()
+	assert.Equal(t, "title", tok.Value)
+	assert.Equal(t, src[tok.Start+1:tok.End-1], tok.Value)
+}
+
 // scanAll returns all non-EOF tokens from input.
 func scanAll(input string) []Token {
 	l := New(input)
@@ -609,6 +666,11 @@ func TestStringEscapeEdgeCases(t *testing.T) {
 		{"unicode_space", `"\u0020"`, " "},
 		{"unicode_max_bmp", `"\uFFFF"`, "\uFFFF"},
 		{"multiple_unicode", `"\u0041\u0042\u0043"`, "ABC"},
+		{"escape_after_multibyte", `"café\n日本"`, "café\n日本"},
+		{"escaped_quote_inside", `'it\'s'`, "it's"},
+		{"plain", `"title"`, "title"},
+		{"plain_multibyte", `'日本'`, "日本"},
+		{"empty", `""`, ""},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -949,6 +1011,17 @@ func TestIdentifierEdgeCases(t *testing.T) {
 	}
 }
 
+func TestIsMemberName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"a", "_", "a1", "café", "日本", "true", "\U0001F600"} {
+		assert.True(t, IsMemberName(name), name)
+	}
+	for _, name := range []string{"", "1a", "a-b", "a b", "a.b", "\x7f", "\xff", "a\xff"} {
+		assert.False(t, IsMemberName(name), name)
+	}
+}
+
 // TestNumberFollowedByDot tests numbers followed by dots.
 func TestNumberFollowedByDot(t *testing.T) {
 	t.Parallel()
@@ -1057,3 +1130,38 @@ func TestExponentEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func FuzzLexer(f *testing.F) {
+	for _, s := range []string{
+		"$", "$.a..b[*]", "$['a\\u0041\\n']", `$["😀"]`, "$[?@.a <= -1.5e3 && !@.b]",
+		"$[1:-2:3]", "$[?match(@, 'x')]", "'unterminated", "$\xff", "$[?@ == 'a\\", "true false null",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		l := New(src)
+		end := 0
+		// Every token but EOF consumes input, so len(src)+1 scans suffice.
+		for range len(src) + 2 {
+			tok := l.Scan()
+			if tok.Start < end || tok.End < tok.Start || tok.End > len(src) {
+				t.Fatalf("token %v [%d:%d] out of order after offset %d in %q", tok.Kind, tok.Start, tok.End, end, src)
+			}
+			end = tok.End
+			switch tok.Kind {
+			case EOF, Invalid:
+				if tok.Kind == Invalid && tok.Err() == nil {
+					t.Fatalf("invalid token without error in %q", src)
+				}
+				if next := l.Scan(); next.Kind != EOF {
+					t.Fatalf("scan after %v returned %v in %q", tok.Kind, next.Kind, src)
+				}
+				return
+			}
+			if tok.End == tok.Start {
+				t.Fatalf("empty %v token at %d in %q", tok.Kind, tok.Start, src)
+			}
+		}
+		t.Fatalf("scan did not terminate on %q", src)
+	})
+}
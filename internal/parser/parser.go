@@ -18,44 +18,118 @@ var (
 	// ErrParsePosition is returned when a parse error occurs at a specific position.
 	ErrParsePosition = errors.New("parse error at position")
 	// ErrUnknownFunction is returned when an unknown function is referenced.
-	ErrUnknownFunction = errors.New("unknown function")
-	// ErrInvalidFunction is returned when a function is invalid.
+	ErrUnknownFunction = ast.ErrUnknownFunction
+	// ErrInvalidFunction is returned when a function rejects the arguments of
+	// a call, or a registered function does not implement [ast.Function].
 	ErrInvalidFunction = errors.New("invalid function")
+	// ErrInvalidIndex is returned for a malformed or out-of-range index.
+	ErrInvalidIndex = errors.New("invalid index")
+	// ErrInvalidSlice is returned for a malformed or out-of-range slice
+	// argument.
+	ErrInvalidSlice = errors.New("invalid slice")
+	// ErrTooManySelectors is returned when a bracketed selection has more
+	// selectors than [Parser.MaxSelectors] allows.
+	ErrTooManySelectors = errors.New("jsonpath: too many selectors in segment")
+	// ErrTooDeep is returned when parentheses, filters and function calls are
+	// nested more than [MaxDepth] levels deep.
+	ErrTooDeep = errors.New("jsonpath: expression nested too deeply")
 )
 
+// Error describes a parse error at a byte offset of the source. Its fields
+// let callers render their own diagnostics.
+type Error struct {
+	Pos      int      // byte offset of the offending token; len(src) at end of input
+	Msg      string   // what went wrong, without the position
+	Expected []string // tokens that would have been accepted at Pos, if known
+	Err      error    // sentinel classifying the error, such as ErrParsePosition
+}
+
+// Error returns the message, position and sentinel of e.
+func (e *Error) Error() string {
+	if errors.Is(e.Err, ErrParseEnd) {
+		return e.Msg + ": " + ErrParseEnd.Error()
+	}
+	return fmt.Sprintf("%s at position %d: %v", e.Msg, e.Pos, e.Err)
+}
+
+// Unwrap returns the sentinel of e.
+func (e *Error) Unwrap() error { return e.Err }
+
+// MaxIndex is the largest magnitude of indexes and slice arguments RFC 9535
+// allows, 2^53 - 1.
+const MaxIndex = 9007199254740991
+
+// MaxDepth is the deepest nesting of parenthesized expressions, filter
+// selectors and function calls the parser accepts. See [ast.MaxDepth].
+const MaxDepth = ast.MaxDepth
+
 // Parser parses JSONPath expressions into AST nodes.
 type Parser struct {
 	src    string
-	tokens []lexer.Token
-	pos    int
+	lex    *lexer.Lexer
+	tok    lexer.Token    // next token, returned by peek
+	prev   lexer.Token    // last token consumed, returned by previous
+	lexErr *Error         // error for the first invalid token scanned
+	script *Error         // error for the first script expression, in Legacy mode
 	funcs  map[string]any // function registry for extensions
+	depth  int            // current nesting level, bounded by MaxNesting
+
+	// MaxSelectors limits the number of selectors in one bracketed
+	// selection, including those in filter queries. Zero means no limit.
+	MaxSelectors int
+
+	// MaxNesting limits the nesting of parenthesized expressions, filter
+	// selectors and function calls. Zero, or a value above [MaxDepth], means
+	// [MaxDepth].
+	MaxNesting int
+
+	// LenientWhitespace accepts blank space before and after the query,
+	// which RFC 9535 forbids. Positions stay relative to the source.
+	LenientWhitespace bool
+
+	// ImplicitRoot accepts queries that leave out the leading $, unless Root
+	// is [lexer.At]: one starting with a member name is read as if it started
+	// with "$.", and one starting with ".", ".." or "[" as if it started
+	// with "$".
+	ImplicitRoot bool
+
+	// Legacy accepts script expressions of JSONPath before RFC 9535 that
+	// have an RFC 9535 equivalent: (@.length-N) is read as the index -N.
+	// Other script expressions are rejected as such.
+	Legacy bool
+
+	// NameChar, if set, accepts more characters in member name shorthands.
+	// See [lexer.Lexer.NameChar].
+	NameChar func(r rune) bool
+
+	// Root is the identifier queries must start with, [lexer.Dollar] or
+	// [lexer.At]. Zero accepts either. Queries inside filters always accept
+	// either.
+	Root lexer.Kind
+
+	// Recover makes Parse continue after an invalid selector and report
+	// every error it finds, joined with [errors.Join], instead of the first.
+	Recover bool
+	errs    []error // errors recovered from so far
 }
 
-// New creates a new Parser for the given source string.
-func New(src string, funcs map[string]any) (*Parser, error) {
-	lex := lexer.New(src)
-	// Pre-allocate tokens slice with estimated capacity based on source length
-	// Typical JSONPath expressions have ~1 token per 3-4 characters
-	tokens := make([]lexer.Token, 0, len(src)/3+1)
-	for {
-		tok := lex.Scan()
-		tokens = append(tokens, tok)
-		if tok.Kind == lexer.EOF || tok.Kind == lexer.Invalid {
-			break
-		}
+// New creates a new Parser for the given source string. Tokens are scanned
+// as Parse needs them; invalid tokens are reported by Parse.
+func New(src string, funcs map[string]any) *Parser {
+	return &Parser{
+		src:   src,
+		lex:   lexer.New(src),
+		funcs: funcs,
 	}
+}
 
-	// Check for lexer errors
-	if len(tokens) > 0 && tokens[len(tokens)-1].Kind == lexer.Invalid {
-		return nil, fmt.Errorf("%w: lexer error", tokens[len(tokens)-1].Err())
+// scan reads the next token into p.tok, recording the error for an invalid
+// token. The lexer returns [lexer.EOF] after an invalid token.
+func (p *Parser) scan() {
+	p.tok = p.lex.Scan()
+	if p.tok.Kind == lexer.Invalid && p.lexErr == nil {
+		p.lexErr = &Error{Pos: p.tok.Start, Msg: p.tok.Value, Err: p.tok.Sentinel()}
 	}
-
-	return &Parser{
-		src:    src,
-		tokens: tokens,
-		pos:    0,
-		funcs:  funcs,
-	}, nil
 }
 
 // isBlankSpace reports whether b is RFC 9535 blank space (SP / HTAB / LF / CR).
@@ -63,23 +137,90 @@ func isBlankSpace(b byte) bool {
 	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
 }
 
-// Parse parses a JSONPath query and returns the AST.
+// Parse parses a JSONPath query and returns the AST. With [Parser.Recover]
+// set, the error joins every error found.
 func (p *Parser) Parse() (*ast.PathQuery, error) {
+	query, errs := p.parseErrors()
+	switch len(errs) {
+	case 0:
+		return query, nil
+	case 1:
+		return nil, errs[0]
+	default:
+		return nil, errors.Join(errs...)
+	}
+}
+
+// ParseAll is [Parser.Parse] with [Parser.Recover] set, returning every
+// error found in order of position rather than joining them.
+func (p *Parser) ParseAll() (*ast.PathQuery, []error) {
+	p.Recover = true
+	return p.parseErrors()
+}
+
+// parseErrors parses the query, returning either the AST or the errors found.
+func (p *Parser) parseErrors() (*ast.PathQuery, []error) {
+	p.lex.NameChar = p.NameChar
+	p.scan()
+	query, err := p.parse()
+	if err != nil {
+		p.errs = append(p.errs, err)
+	}
+	if len(p.errs) > 0 {
+		// An invalid token is reported in preference to any parse error,
+		// even one before it.
+		for p.tok.Kind != lexer.EOF && p.tok.Kind != lexer.Invalid {
+			p.scan()
+		}
+	}
+	// A script expression confuses the lexer, so its error is reported in
+	// preference to invalid tokens within or after it.
+	if p.lexErr != nil && (p.script == nil || p.lexErr.Pos < p.script.Pos) {
+		return nil, []error{p.lexErr}
+	}
+	if len(p.errs) > 0 {
+		return nil, p.errs
+	}
+	return query, nil
+}
+
+func (p *Parser) parse() (*ast.PathQuery, error) {
 	// RFC 9535 requires no leading/trailing whitespace
-	if len(p.src) > 0 && isBlankSpace(p.src[0]) {
-		return nil, fmt.Errorf("leading whitespace not allowed: %w", ErrParsePosition)
+	if !p.LenientWhitespace && len(p.src) > 0 && isBlankSpace(p.src[0]) {
+		return nil, &Error{Pos: 0, Msg: "leading whitespace not allowed", Err: ErrParsePosition}
 	}
-	if len(p.src) > 0 && isBlankSpace(p.src[len(p.src)-1]) {
-		return nil, fmt.Errorf("trailing whitespace not allowed: %w", ErrParsePosition)
+	if !p.LenientWhitespace && len(p.src) > 0 && isBlankSpace(p.src[len(p.src)-1]) {
+		return nil, &Error{Pos: len(p.src) - 1, Msg: "trailing whitespace not allowed", Err: ErrParsePosition}
 	}
 
 	// jsonpath-query = root-identifier segments
+	if p.ImplicitRoot && p.Root != lexer.At {
+		switch {
+		case p.check(lexer.Ident) || p.check(lexer.True) || p.check(lexer.False) || p.check(lexer.Null):
+			name := ast.Child(ast.NameSelector(p.advance().Val(p.src)))
+			return p.parseRest(true, name)
+		case p.check(lexer.Dot) || p.check(lexer.DotDot) || p.check(lexer.LeftBracket):
+			return p.parseRest(true)
+		}
+	}
+	if p.Root != lexer.Invalid && !p.check(p.Root) && (p.check(lexer.Dollar) || p.check(lexer.At)) {
+		// The other identifier: the rest of the query may still be checked.
+		err := p.rootError()
+		if !p.recoverable(err) {
+			return nil, err
+		}
+		p.errs = append(p.errs, err)
+	}
 	if !p.match(lexer.Dollar) && !p.match(lexer.At) {
-		return nil, p.error("expected $ or @")
+		return nil, p.rootError()
 	}
 
-	isRoot := p.previous().Kind == lexer.Dollar
+	return p.parseRest(p.previous().Kind == lexer.Dollar)
+}
 
+// parseRest parses the segments following the root identifier of a query,
+// after the given leading segments, if any.
+func (p *Parser) parseRest(isRoot bool, leading ...ast.Segment) (*ast.PathQuery, error) {
 	segments, err := p.parseSegments()
 	if err != nil {
 		return nil, err
@@ -89,6 +230,9 @@ func (p *Parser) Parse() (*ast.PathQuery, error) {
 		return nil, p.error("unexpected token after path")
 	}
 
+	if len(leading) > 0 {
+		segments = append(leading, segments...)
+	}
 	return ast.NewPathQuery(isRoot, segments...), nil
 }
 
@@ -102,7 +246,10 @@ func (p *Parser) parseSegments() ([]ast.Segment, error) {
 			// descendant segment
 			sel, err := p.parseDescendantSegment()
 			if err != nil {
-				return nil, err
+				if !p.recoverName(err) {
+					return nil, err
+				}
+				continue
 			}
 			segments = append(segments, sel)
 		case p.match(lexer.LeftBracket):
@@ -116,7 +263,10 @@ func (p *Parser) parseSegments() ([]ast.Segment, error) {
 			// dot-child segment
 			sel, err := p.parseDotChild()
 			if err != nil {
-				return nil, err
+				if !p.recoverName(err) {
+					return nil, err
+				}
+				continue
 			}
 			segments = append(segments, ast.Child(sel))
 		default:
@@ -151,7 +301,7 @@ func (p *Parser) parseDescendantSegment() (ast.Segment, error) {
 		name := p.advance().Val(p.src)
 		return ast.Descendant(ast.NameSelector(name)), nil
 	default:
-		return ast.Segment{}, p.error("expected [, *, or identifier after ..")
+		return ast.Segment{}, p.error("expected [, *, or identifier after ..", "[", "*", "identifier")
 	}
 }
 
@@ -174,7 +324,7 @@ func (p *Parser) parseDotChild() (ast.Selector, error) {
 		name := p.advance().Val(p.src)
 		return ast.NameSelector(name), nil
 	}
-	return ast.Selector{}, p.error("expected * or identifier after .")
+	return ast.Selector{}, p.error("expected * or identifier after .", "*", "identifier")
 }
 
 // parseBracketedSelection parses selectors inside brackets.
@@ -182,22 +332,94 @@ func (p *Parser) parseBracketedSelection() ([]ast.Selector, error) {
 	var selectors []ast.Selector
 
 	for {
+		if p.MaxSelectors > 0 && len(selectors) == p.MaxSelectors {
+			return nil, &Error{Pos: p.peek().Start, Msg: fmt.Sprintf("more than %d", p.MaxSelectors), Err: ErrTooManySelectors}
+		}
 		sel, err := p.parseSelector()
-		if err != nil {
+		if err == nil {
+			selectors = append(selectors, sel)
+			if p.match(lexer.Comma) {
+				continue
+			}
+			if p.match(lexer.RightBracket) {
+				return selectors, nil
+			}
+			err = p.error("expected ] or ,", "]", ",")
+		}
+		if !p.recoverSelector(err) {
 			return nil, err
 		}
-		selectors = append(selectors, sel)
-
 		if !p.match(lexer.Comma) {
-			break
+			p.advance() // the ] recoverSelector stopped at
+			return selectors, nil
 		}
 	}
+}
+
+// rootError reports that the query does not start with the identifier
+// [Parser.Root] requires.
+func (p *Parser) rootError() error {
+	switch p.Root {
+	case lexer.Dollar:
+		if p.check(lexer.At) {
+			return p.error("@ is only allowed in filter expressions; expected $", "$")
+		}
+		return p.error("expected $", "$")
+	case lexer.At:
+		return p.error("expected @ to start a relative query", "@")
+	default:
+		return p.error("expected $ or @", "$", "@")
+	}
+}
+
+// recoverable reports whether parsing may continue after err: whether
+// [Parser.Recover] is set and err is not a limit being exceeded.
+func (p *Parser) recoverable(err error) bool {
+	return p.Recover && !errors.Is(err, ErrTooDeep) && !errors.Is(err, ErrTooManySelectors)
+}
 
-	if !p.match(lexer.RightBracket) {
-		return nil, p.error("expected ] or ,")
+// recoverSelector records err for an invalid selector and skips to the , or
+// ] ending it, outside any brackets and parentheses opened after the token
+// in error. It reports false, leaving err to the caller, if err is not
+// recoverable or the selection is never closed.
+func (p *Parser) recoverSelector(err error) bool {
+	if !p.recoverable(err) {
+		return false
+	}
+	nesting := 0
+	for {
+		switch p.tok.Kind {
+		case lexer.EOF, lexer.Invalid:
+			return false
+		case lexer.LeftBracket, lexer.LeftParen:
+			nesting++
+		case lexer.RightParen:
+			nesting = max(nesting-1, 0)
+		case lexer.RightBracket, lexer.Comma:
+			if nesting == 0 {
+				p.errs = append(p.errs, err)
+				return true
+			}
+			if p.tok.Kind == lexer.RightBracket {
+				nesting--
+			}
+		}
+		p.advance()
 	}
+}
 
-	return selectors, nil
+// recoverName records err for an invalid dot or descendant segment and skips
+// the token meant to follow the dots, unless it starts the next segment. It
+// reports false, leaving err to the caller, if err is not recoverable.
+func (p *Parser) recoverName(err error) bool {
+	if !p.recoverable(err) {
+		return false
+	}
+	p.errs = append(p.errs, err)
+	if !p.check(lexer.LeftBracket) && !p.check(lexer.Dot) && !p.check(lexer.DotDot) {
+		p.advance()
+	}
+	return true
 }
 
 // parseSelector parses a single selector.
@@ -232,7 +454,29 @@ func (p *Parser) parseSelector() (ast.Selector, error) {
 		return p.parseSlice(0, false)
 	}
 
-	return ast.Selector{}, p.error("expected selector")
+	if p.Legacy && p.check(lexer.LeftParen) {
+		return p.parseScript()
+	}
+
+	return ast.Selector{}, p.error("expected selector", "*", "?", "string", "integer", ":")
+}
+
+// parseScript parses a script expression in [Parser.Legacy] mode. Only
+// (@.length-N), selecting the N-th last element, is supported.
+func (p *Parser) parseScript() (ast.Selector, error) {
+	open := p.advance()
+	if p.match(lexer.At) && p.match(lexer.Dot) && p.check(lexer.Ident) &&
+		p.advance().Val(p.src) == "length" && p.check(lexer.Int) {
+		n, err := strconv.ParseInt(p.advance().Val(p.src), 10, 64)
+		if err == nil && n < 0 && n >= -MaxIndex && p.match(lexer.RightParen) {
+			return ast.IndexSelector(n), nil
+		}
+	}
+	err := &Error{Pos: open.Start, Msg: "script expressions not supported", Err: ErrParsePosition}
+	if p.script == nil {
+		p.script = err
+	}
+	return ast.Selector{}, err
 }
 
 // parseFilterExpr parses a filter expression: logical-or-expr
@@ -241,11 +485,32 @@ func (p *Parser) parseFilterExpr() (*ast.FilterExpr, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ast.FilterExpr{Or: or}, nil
+	return ast.NewFilterExpr(or), nil
 }
 
+// enter increments the nesting level, failing beyond [Parser.MaxNesting].
+// Callers that succeed must call leave when done.
+func (p *Parser) enter() error {
+	limit := MaxDepth
+	if p.MaxNesting > 0 {
+		limit = min(p.MaxNesting, MaxDepth)
+	}
+	if p.depth == limit {
+		return &Error{Pos: p.peek().Start, Msg: fmt.Sprintf("more than %d levels", limit), Err: ErrTooDeep}
+	}
+	p.depth++
+	return nil
+}
+
+// leave decrements the nesting level.
+func (p *Parser) leave() { p.depth-- }
+
 // parseLogicalOr parses: logical-and-expr *( "||" logical-and-expr )
 func (p *Parser) parseLogicalOr() (ast.LogicalOr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	var ands []ast.LogicalAnd
 
 	and, err := p.parseLogicalAnd()
@@ -296,7 +561,7 @@ func (p *Parser) parseBasicExpr() (ast.BasicExpr, error) {
 				return nil, err
 			}
 			if !p.match(lexer.RightParen) {
-				return nil, p.error("expected )")
+				return nil, p.error("expected )", ")")
 			}
 			return &ast.NotParenExpr{Expr: &or}, nil
 		}
@@ -330,7 +595,7 @@ func (p *Parser) parseBasicExpr() (ast.BasicExpr, error) {
 			return nil, err
 		}
 		if !p.match(lexer.RightParen) {
-			return nil, p.error("expected )")
+			return nil, p.error("expected )", ")")
 		}
 		return &ast.ParenExpr{Expr: &or}, nil
 	}
@@ -427,7 +692,7 @@ func (p *Parser) parseComparisonFromLiteral() (ast.BasicExpr, error) {
 	}
 
 	if !p.checkCompOp() {
-		return nil, p.error("expected comparison operator")
+		return nil, p.error("expected comparison operator", "==", "!=", "<", "<=", ">", ">=")
 	}
 
 	op := p.parseCompOp()
@@ -445,6 +710,10 @@ func (p *Parser) parseComparisonFromLiteral() (ast.BasicExpr, error) {
 
 // parseFunctionExpr parses a function call
 func (p *Parser) parseFunctionExpr() (ast.BasicExpr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	nameToken := p.advance()
 	name := nameToken.Val(p.src)
 
@@ -457,7 +726,7 @@ func (p *Parser) parseFunctionExpr() (ast.BasicExpr, error) {
 	}
 
 	if !p.match(lexer.LeftParen) {
-		return nil, p.error("expected ( after function name")
+		return nil, p.error("expected ( after function name", "(")
 	}
 
 	// Parse arguments
@@ -477,18 +746,18 @@ func (p *Parser) parseFunctionExpr() (ast.BasicExpr, error) {
 	}
 
 	if !p.match(lexer.RightParen) {
-		return nil, p.error("expected )")
+		return nil, p.error("expected )", ")")
 	}
 
 	// Look up function in registry
 	fn, ok := p.funcs[name]
 	if !ok {
-		return nil, fmt.Errorf("%s: %w", name, ErrUnknownFunction)
+		return nil, &Error{Pos: nameToken.Start, Msg: name, Err: ErrUnknownFunction}
 	}
 
 	funcObj, ok := fn.(ast.Function)
 	if !ok {
-		return nil, fmt.Errorf("%s: %w", name, ErrInvalidFunction)
+		return nil, &Error{Pos: nameToken.Start, Msg: name, Err: ErrInvalidFunction}
 	}
 
 	// Determine argument types for validation
@@ -512,7 +781,7 @@ func (p *Parser) parseFunctionExpr() (ast.BasicExpr, error) {
 
 	// Validate argument types
 	if err := funcObj.Validate(argTypes); err != nil {
-		return nil, fmt.Errorf("%s: %w", name, err)
+		return nil, &Error{Pos: nameToken.Start, Msg: name, Err: fmt.Errorf("%w: %w", ErrInvalidFunction, err)}
 	}
 
 	// Resolve QueryArg: determine if the function expects Nodes or Value for
@@ -556,7 +825,7 @@ func (p *Parser) parseFunctionArg() (any, error) {
 // parseFilterQuery parses a query starting with @ or $
 func (p *Parser) parseFilterQuery() (*ast.PathQuery, error) {
 	if !p.match(lexer.Dollar) && !p.match(lexer.At) {
-		return nil, p.error("expected $ or @")
+		return nil, p.error("expected $ or @", "$", "@")
 	}
 
 	isRoot := p.previous().Kind == lexer.Dollar
@@ -615,10 +884,15 @@ func (p *Parser) parseLiteralValue() (any, error) {
 		return p.previous().Value, nil
 	}
 	if p.match(lexer.Int) {
-		return strconv.ParseInt(p.previous().Val(p.src), 10, 64)
+		if n, err := strconv.ParseInt(p.previous().Val(p.src), 10, 64); err == nil {
+			return n, nil
+		}
+		// An integer beyond int64 is taken as the nearest float64, as a
+		// JSON number of that size decodes.
+		return p.parseNumber(p.previous())
 	}
 	if p.match(lexer.Number) {
-		return strconv.ParseFloat(p.previous().Val(p.src), 64)
+		return p.parseNumber(p.previous())
 	}
 	if p.match(lexer.True) {
 		return true, nil
@@ -629,7 +903,17 @@ func (p *Parser) parseLiteralValue() (any, error) {
 	if p.match(lexer.Null) {
 		return ast.JSONNull(), nil
 	}
-	return nil, p.error("expected literal value")
+	return nil, p.error("expected literal value", "string", "number", "true", "false", "null")
+}
+
+// parseNumber parses tok, a number literal, as a float64, rejecting one
+// beyond the float64 range.
+func (p *Parser) parseNumber(tok lexer.Token) (float64, error) {
+	f, err := strconv.ParseFloat(tok.Val(p.src), 64)
+	if err != nil {
+		return 0, &Error{Pos: tok.Start, Msg: "invalid number literal", Err: ErrParsePosition}
+	}
+	return f, nil
 }
 
 // checkCompOp checks if the current token is a comparison operator
@@ -665,20 +949,13 @@ func (p *Parser) parseCompOp() ast.CompOp {
 // parseIndexOrSlice parses an index or slice selector starting with an integer.
 func (p *Parser) parseIndexOrSlice() (ast.Selector, error) {
 	startTok := p.advance()
-	start, err := strconv.ParseInt(startTok.Val(p.src), 10, 64)
-	if err != nil {
-		return ast.Selector{}, fmt.Errorf("%w: invalid integer", err)
+	kind := ErrInvalidIndex
+	if p.check(lexer.Colon) {
+		kind = ErrInvalidSlice
 	}
-
-	// RFC 9535: -0 is not allowed as an index
-	if start == 0 && startTok.Val(p.src)[0] == '-' {
-		return ast.Selector{}, p.error("-0 is not allowed")
-	}
-
-	// RFC 9535: index values must be in [-(2^53-1), 2^53-1]
-	const maxIndex = 9007199254740991 // 2^53 - 1
-	if start < -maxIndex || start > maxIndex {
-		return ast.Selector{}, p.error("index out of range")
+	start, err := p.parseInt(startTok, kind)
+	if err != nil {
+		return ast.Selector{}, err
 	}
 
 	if p.match(lexer.Colon) {
@@ -688,10 +965,25 @@ func (p *Parser) parseIndexOrSlice() (ast.Selector, error) {
 	return ast.IndexSelector(start), nil
 }
 
+// parseInt parses tok, an index or slice argument, reporting errors
+// classified by kind.
+func (p *Parser) parseInt(tok lexer.Token, kind error) (int64, error) {
+	n, err := strconv.ParseInt(tok.Val(p.src), 10, 64)
+	switch {
+	case err != nil:
+		return 0, &Error{Pos: tok.Start, Msg: "invalid integer", Err: kind}
+	case n == 0 && tok.Val(p.src)[0] == '-':
+		// RFC 9535: -0 is not allowed
+		return 0, &Error{Pos: tok.Start, Msg: "-0 is not allowed", Err: kind}
+	case n < -MaxIndex || n > MaxIndex:
+		// RFC 9535: index values must be in [-(2^53-1), 2^53-1]
+		return 0, &Error{Pos: tok.Start, Msg: "index out of range", Err: kind}
+	}
+	return n, nil
+}
+
 // parseSlice parses a slice selector.
 func (p *Parser) parseSlice(start int64, hasStart bool) (ast.Selector, error) {
-	const maxIndex = 9007199254740991 // 2^53 - 1
-
 	args := ast.SliceArgs{
 		Start:    start,
 		HasStart: hasStart,
@@ -699,18 +991,9 @@ func (p *Parser) parseSlice(start int64, hasStart bool) (ast.Selector, error) {
 
 	// Parse end
 	if p.check(lexer.Int) {
-		endTok := p.advance()
-		end, err := strconv.ParseInt(endTok.Val(p.src), 10, 64)
+		end, err := p.parseInt(p.advance(), ErrInvalidSlice)
 		if err != nil {
-			return ast.Selector{}, fmt.Errorf("%w: invalid integer", err)
-		}
-		// RFC 9535: -0 is not allowed
-		if end == 0 && endTok.Val(p.src)[0] == '-' {
-			return ast.Selector{}, p.error("-0 is not allowed")
-		}
-		// RFC 9535: index values must be in [-(2^53-1), 2^53-1]
-		if end < -maxIndex || end > maxIndex {
-			return ast.Selector{}, p.error("index out of range")
+			return ast.Selector{}, err
 		}
 		args.End = end
 		args.HasEnd = true
@@ -719,18 +1002,9 @@ func (p *Parser) parseSlice(start int64, hasStart bool) (ast.Selector, error) {
 	// Parse step
 	if p.match(lexer.Colon) {
 		if p.check(lexer.Int) {
-			stepTok := p.advance()
-			step, err := strconv.ParseInt(stepTok.Val(p.src), 10, 64)
+			step, err := p.parseInt(p.advance(), ErrInvalidSlice)
 			if err != nil {
-				return ast.Selector{}, fmt.Errorf("%w: invalid integer", err)
-			}
-			// RFC 9535: -0 is not allowed
-			if step == 0 && stepTok.Val(p.src)[0] == '-' {
-				return ast.Selector{}, p.error("-0 is not allowed")
-			}
-			// RFC 9535: index values must be in [-(2^53-1), 2^53-1]
-			if step < -maxIndex || step > maxIndex {
-				return ast.Selector{}, p.error("index out of range")
+				return ast.Selector{}, err
 			}
 			args.Step = step
 			args.HasStep = true
@@ -759,33 +1033,32 @@ func (p *Parser) check(kind lexer.Kind) bool {
 
 func (p *Parser) advance() lexer.Token {
 	if !p.isAtEnd() {
-		p.pos++
+		p.prev = p.tok
+		p.scan()
 	}
-	return p.previous()
+	return p.prev
 }
 
 func (p *Parser) isAtEnd() bool {
-	return p.pos >= len(p.tokens) || p.peek().Kind == lexer.EOF
+	return p.tok.Kind == lexer.EOF
 }
 
 func (p *Parser) peek() lexer.Token {
-	if p.pos < len(p.tokens) {
-		return p.tokens[p.pos]
-	}
-	return lexer.Token{Kind: lexer.EOF}
+	return p.tok
 }
 
+// previous returns the last token consumed, or an [lexer.Invalid] token
+// before the first.
 func (p *Parser) previous() lexer.Token {
-	if p.pos > 0 && p.pos <= len(p.tokens) {
-		return p.tokens[p.pos-1]
-	}
-	return lexer.Token{Kind: lexer.Invalid}
+	return p.prev
 }
 
-func (p *Parser) error(msg string) error {
+// error reports msg at the next token, listing the tokens that would have
+// been accepted there, if known.
+func (p *Parser) error(msg string, expected ...string) error {
 	tok := p.peek()
 	if tok.Kind == lexer.EOF {
-		return fmt.Errorf("%s: %w", msg, ErrParseEnd)
+		return &Error{Pos: len(p.src), Msg: msg, Expected: expected, Err: ErrParseEnd}
 	}
-	return fmt.Errorf("%s at position %d: %w", msg, tok.Start, ErrParsePosition)
+	return &Error{Pos: tok.Start, Msg: msg, Expected: expected, Err: ErrParsePosition}
 }
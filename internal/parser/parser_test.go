@@ -1,9 +1,13 @@
 package parser
 
 import (
+	"errors"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/agentable/jsonpath/internal/lexer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -40,8 +44,7 @@ func TestParseRootIdentifier(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -108,8 +111,7 @@ func TestParseNameSelector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -176,8 +178,7 @@ func TestParseIndexSelector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -287,8 +288,7 @@ func TestParseSliceSelector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -335,8 +335,7 @@ func TestParseWildcardSelector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -375,8 +374,7 @@ func TestParseFilterSelector(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -395,6 +393,21 @@ func TestParseFilterSelector(t *testing.T) {
 	}
 }
 
+// TestParseNumberLiterals tests that integer literals beyond int64 become
+// float64 and that numbers beyond float64 are rejected.
+func TestParseNumberLiterals(t *testing.T) {
+	q, err := New("$[?@.a == 99999999999999999999]", nil).Parse()
+	require.NoError(t, err)
+	assert.Equal(t, `$[?@["a"] == 1e+20]`, q.String())
+
+	_, err = New("$[?@.a == 1e999]", nil).Parse()
+	var pe *Error
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, 10, pe.Pos)
+	assert.Equal(t, "invalid number literal", pe.Msg)
+	require.ErrorIs(t, err, ErrParsePosition)
+}
+
 // TestParseDescendantSegment tests parsing of descendant (..) segments.
 func TestParseDescendantSegment(t *testing.T) {
 	tests := []struct {
@@ -430,8 +443,7 @@ func TestParseDescendantSegment(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -484,8 +496,7 @@ func TestParseMixedSelectors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -570,8 +581,7 @@ func TestParseSingularQuery(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			require.NoError(t, err)
@@ -636,14 +646,82 @@ func TestParseErrors(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			if err != nil {
-				// Lexer error
-				return
+			_, err := New(tt.input, nil).Parse()
+			assert.Error(t, err, "expected parse error for input: %s", tt.input)
+		})
+	}
+}
+
+// TestParseRecover tests that Recover reports an error for each invalid
+// selector, and that exceeded limits still stop parsing.
+func TestParseRecover(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		max       int
+		positions []int
+	}{
+		{"empty brackets", "$[][0]", 0, []int{2}},
+		{"skips nested brackets", "$[?@[1 2] == 1, 'a' 'b']", 0, []int{7, 20}},
+		{"skips to comma", "$[:x, 1 1, 2]", 0, []int{3, 8}},
+		{"descendant", "$..[?@ ==] ..1", 0, []int{9, 13}},
+		{"unclosed", "$[1 2", 0, []int{4}},
+		{"too many selectors", "$[0 0, 1, 2]", 2, []int{4, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.input, nil)
+			p.MaxSelectors = tt.max
+			_, errs := p.ParseAll()
+			require.NotEmpty(t, errs)
+
+			var positions []int
+			for _, err := range errs {
+				var pe *Error
+				require.ErrorAs(t, err, &pe)
+				positions = append(positions, pe.Pos)
+			}
+			assert.Equal(t, tt.positions, positions)
+
+			p = New(tt.input, nil)
+			p.MaxSelectors = tt.max
+			p.Recover = true
+			_, err := p.Parse()
+			if len(errs) > 1 {
+				assert.Equal(t, errors.Join(errs...), err, "with Recover, Parse joins the errors")
 			}
 
+			p = New(tt.input, nil)
+			p.MaxSelectors = tt.max
 			_, err = p.Parse()
-			assert.Error(t, err, "expected parse error for input: %s", tt.input)
+			assert.Equal(t, errs[0], err, "without Recover, Parse returns the first error only")
+		})
+	}
+}
+
+// TestParseLexicalErrors tests that an invalid token is reported in
+// preference to parse errors, even ones before it.
+func TestParseLexicalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		pos   int
+	}{
+		{"first token", "#", 0},
+		{"after valid path", "$.a#", 3},
+		{"after parse error", "$.a] #", 5},
+		{"after unclosed filter", "$[?(@.a == 1 #", 13},
+		{"after leading whitespace", " $.a#", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.input, nil)
+			p.Recover = true
+			_, err := p.Parse()
+			require.ErrorIs(t, err, lexer.ErrSyntax)
+			var pe *Error
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, tt.pos, pe.Pos)
 		})
 	}
 }
@@ -699,8 +777,7 @@ func TestParseStringRepresentation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			require.NoError(t, err)
@@ -736,8 +813,7 @@ func TestParseSegmentTypes(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			require.NoError(t, err)
@@ -795,8 +871,7 @@ func TestParseSelectorIsSingular(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			require.NoError(t, err)
@@ -863,8 +938,7 @@ func TestParseComplexPaths(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, err := New(tt.input, nil)
-			require.NoError(t, err)
+			p := New(tt.input, nil)
 
 			query, err := p.Parse()
 			if tt.wantErr {
@@ -881,3 +955,168 @@ func TestParseComplexPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestParseMaxSelectors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		src     string
+		max     int
+		wantErr bool
+	}{
+		{"unlimited", "$[0,1,2,3]", 0, false},
+		{"at_limit", "$[0,1,2]", 3, false},
+		{"over_limit", "$[0,1,2,3]", 3, true},
+		{"names_over_limit", "$['a','b']", 1, true},
+		{"dot_child_unaffected", "$.a.b.c", 1, false},
+		{"filter_query_over_limit", "$[?@[0,1]]", 1, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := New(tc.src, nil)
+			p.MaxSelectors = tc.max
+			_, err := p.Parse()
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrTooManySelectors)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// filterQueries returns the queries of the comparisons and existence tests
+// in the top-level conjunctions of the filter selected by src.
+func filterQueries(t *testing.T, src string) (*ast.PathQuery, []*ast.PathQuery) {
+	t.Helper()
+	p := New(src, nil)
+	query, err := p.Parse()
+	require.NoError(t, err)
+
+	var queries []*ast.PathQuery
+	for _, and := range query.Segments()[0].Selectors()[0].Filter.Or {
+		for _, expr := range and {
+			switch e := expr.(type) {
+			case *ast.ExistExpr:
+				queries = append(queries, e.Query)
+			case *ast.NonExistExpr:
+				queries = append(queries, e.Query)
+			case *ast.CompExpr:
+				for _, v := range []ast.CompValue{e.Left, e.Right} {
+					if qv, ok := v.(*ast.QueryValue); ok {
+						queries = append(queries, qv.Query)
+					}
+				}
+			}
+		}
+	}
+	return query, queries
+}
+
+func TestParseFilterSharedQueries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		src  string
+		// groups[i] is the group of the i-th query; equal groups share a node.
+		groups []int
+	}{
+		{"no_repetition", "$[?@.a == 1 && @.b]", []int{0, 1}},
+		{"repeated_comparison", "$[?@.a == 1 && @.a != 2]", []int{0, 0}},
+		{"comparison_and_existence", "$[?@.a.b && @.a.b == 1 || !@.a.b]", []int{0, 0, 0}},
+		{"canonical_forms", "$[?@.a == 1 && @['a'] != 2 && @[\"a\"]]", []int{0, 0, 0}},
+		{"canonical_strings", "$[?@['\\u0041'] && @.A && @['a\\'b'] == @[\"a'b\"]]", []int{0, 0, 1, 1}},
+		{"relative_and_root", "$[?@.a == $.a && $.a && @.a]", []int{0, 1, 1, 0}},
+		{"both_sides", "$[?@.a == @.a]", []int{0, 0}},
+		{"different_indexes", "$[?@[0] == @[-1]]", []int{0, 1}},
+		{"nested_filters_not_shared", "$[?@[?@.x] && @[?@.y]]", []int{0, 1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			query, queries := filterQueries(t, tc.src)
+			require.Len(t, queries, len(tc.groups))
+			for i := range queries {
+				for j := range queries {
+					if tc.groups[i] == tc.groups[j] {
+						assert.Same(t, queries[i], queries[j], "queries %d and %d", i, j)
+					} else {
+						assert.NotSame(t, queries[i], queries[j], "queries %d and %d", i, j)
+					}
+				}
+			}
+			// Sharing does not change the string form.
+			again, _ := filterQueries(t, query.String())
+			assert.Equal(t, query.String(), again.String())
+		})
+	}
+}
+
+func TestParseMaxDepth(t *testing.T) {
+	t.Parallel()
+
+	nest := func(open, inner, close string, n int) string {
+		return strings.Repeat(open, n) + inner + strings.Repeat(close, n)
+	}
+	tests := []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		// The filter itself is the first level.
+		{"parens_at_limit", "$[?" + nest("(", "@", ")", MaxDepth-1) + "]", false},
+		{"parens_over_limit", "$[?" + nest("(", "@", ")", MaxDepth) + "]", true},
+		{"filters_at_limit", "$" + nest("[?@", "", "]", MaxDepth), false},
+		{"filters_over_limit", "$" + nest("[?@", "", "]", MaxDepth+1), true},
+		{"negations_over_limit", "$[?" + nest("!(", "@", ")", MaxDepth) + "]", true},
+		{"functions_over_limit", "$[?" + nest("length(", "@", ")", MaxDepth) + " > 0]", true},
+		{"deep_crash_regression", "$[?" + nest("(", "@", ")", 1_000_000) + "]", true},
+		{"siblings_do_not_accumulate", "$[?" + strings.Repeat("(@) && ", 2*MaxDepth) + "@]", false},
+	}
+	length, ok := ast.NewRegistry().Lookup("length")
+	require.True(t, ok)
+	funcs := map[string]any{"length": length}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			p := New(tc.src, funcs)
+			_, err := p.Parse()
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrTooDeep)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func BenchmarkParse_LongSelection(b *testing.B) {
+	var src strings.Builder
+	src.WriteString("$[")
+	for i := range 1000 {
+		if i > 0 {
+			src.WriteString(", ")
+		}
+		src.WriteString(strconv.Itoa(i))
+	}
+	src.WriteString("]")
+	expr := src.String()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := New(expr, nil).Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse_QuotedNames(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := New(`$["aaaa"]["bbbb"]["cccc"]`, nil).Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-json-experiment/json"
+)
+
+// SelectInto decodes the nodes p matches in input into dest, which must be a
+// non-nil pointer. If dest points to a slice other than []byte, every match is
+// decoded into it in the order of [Path.Select], leaving it empty if nothing
+// matches. Otherwise exactly one node must match, as for [Path.SelectOne], and
+// it is decoded into the value dest points to.
+//
+// The nodes are marshaled and unmarshaled with
+// github.com/go-json-experiment/json, as [QueryJSON] does, so struct fields
+// follow its rules and tags. Errors wrap [ErrNoMatch] or [ErrMultipleMatches]
+// when the number of matches does not suit a single value, [ErrUnmarshal]
+// when dest is not a pointer or the nodes do not decode into it, and are
+// those of [Path.SelectE] when evaluation aborts.
+func (p *Path) SelectInto(input, dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("%w: SelectInto destination must be a non-nil pointer, got %T", ErrUnmarshal, dest)
+	}
+
+	var matched any
+	if t := rv.Elem().Type(); t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		nodes, _, err := p.SelectE(input)
+		if err != nil {
+			return err
+		}
+		if nodes == nil {
+			nodes = NodeList{}
+		}
+		matched = []any(nodes)
+	} else {
+		v, err := p.SelectOne(input)
+		if err != nil {
+			return err
+		}
+		matched = v
+	}
+
+	data, err := json.Marshal(matched, decodeOptions)
+	if err != nil {
+		return errors.Join(ErrUnmarshal, err)
+	}
+	if err := json.Unmarshal(data, dest, decodeOptions); err != nil {
+		return errors.Join(ErrUnmarshal, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package jsonpath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath_SelectInto(t *testing.T) {
+	t.Parallel()
+
+	type book struct {
+		Title string  `json:"title"`
+		Price float64 `json:"price"`
+	}
+	input := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"title": "Sayings of the Century", "price": 8.95},
+				map[string]any{"title": "Sword of Honour", "price": 12.99},
+			},
+			"name": "corner",
+			"blob": "aGk=",
+		},
+	}
+
+	t.Run("struct", func(t *testing.T) {
+		t.Parallel()
+		var got book
+		require.NoError(t, MustParse("$.store.book[?@.price < 10]").SelectInto(input, &got))
+		assert.Equal(t, book{Title: "Sayings of the Century", Price: 8.95}, got)
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		t.Parallel()
+		var got []book
+		require.NoError(t, MustParse("$.store.book[*]").SelectInto(input, &got))
+		assert.Equal(t, []book{{"Sayings of the Century", 8.95}, {"Sword of Honour", 12.99}}, got)
+
+		var titles []string
+		require.NoError(t, MustParse("$..title").SelectInto(input, &titles))
+		assert.Equal(t, []string{"Sayings of the Century", "Sword of Honour"}, titles)
+	})
+
+	t.Run("slice_without_matches", func(t *testing.T) {
+		t.Parallel()
+		titles := []string{"stale"}
+		require.NoError(t, MustParse("$.missing[*]").SelectInto(input, &titles))
+		assert.Empty(t, titles)
+	})
+
+	t.Run("scalar", func(t *testing.T) {
+		t.Parallel()
+		var name string
+		require.NoError(t, MustParse("$.store.name").SelectInto(input, &name))
+		assert.Equal(t, "corner", name)
+
+		// []byte is a single value, decoded from base64.
+		var blob []byte
+		require.NoError(t, MustParse("$.store.blob").SelectInto(input, &blob))
+		assert.Equal(t, []byte("hi"), blob)
+
+		var v any
+		require.NoError(t, MustParse("$.store.book[1].price").SelectInto(input, &v))
+		assert.Equal(t, 12.99, v)
+	})
+
+	t.Run("no_match", func(t *testing.T) {
+		t.Parallel()
+		var got book
+		err := MustParse("$.store.book[5]").SelectInto(input, &got)
+		require.ErrorIs(t, err, ErrNoMatch)
+		assert.NotErrorIs(t, err, ErrUnmarshal)
+	})
+
+	t.Run("multiple_matches", func(t *testing.T) {
+		t.Parallel()
+		var got book
+		err := MustParse("$.store.book[*]").SelectInto(input, &got)
+		require.ErrorIs(t, err, ErrMultipleMatches)
+		assert.NotErrorIs(t, err, ErrUnmarshal)
+	})
+
+	t.Run("decode_failure", func(t *testing.T) {
+		t.Parallel()
+		var price string
+		err := MustParse("$.store.book[0].price").SelectInto(input, &price)
+		require.ErrorIs(t, err, ErrUnmarshal)
+
+		var prices []int
+		err = MustParse("$..title").SelectInto(input, &prices)
+		require.ErrorIs(t, err, ErrUnmarshal)
+
+		var v any
+		err = MustParse("$.f").SelectInto(map[string]any{"f": func() {}}, &v)
+		require.ErrorIs(t, err, ErrUnmarshal)
+	})
+
+	t.Run("invalid_destination", func(t *testing.T) {
+		t.Parallel()
+		var got book
+		for _, dest := range []any{nil, got, (*book)(nil)} {
+			err := MustParse("$.store.book[0]").SelectInto(input, dest)
+			require.ErrorIs(t, err, ErrUnmarshal)
+		}
+	})
+
+	t.Run("evaluation_error", func(t *testing.T) {
+		t.Parallel()
+		var got []any
+		err := NewParser(WithMaxIntermediateNodes(1)).MustParse("$..*").SelectInto(input, &got)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+	})
+}
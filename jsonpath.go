@@ -1,47 +1,317 @@
 package jsonpath
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/agentable/jsonpath/internal/lexer"
 	"github.com/go-json-experiment/json"
 )
 
-// Path is a compiled RFC 9535 JSONPath query. Safe for concurrent use.
+// Path is a compiled RFC 9535 JSONPath query. A Path is immutable once
+// compiled and safe for concurrent use; each evaluation keeps its own state,
+// and only the input documents and registered functions are shared.
 type Path struct {
 	query *ast.PathQuery
+	opts  evalOptions
 }
 
 // Select returns all nodes matched by p in input.
 // input must be the result of json.Unmarshal (any / []any / map[string]any)
-// or a value produced by github.com/go-json-experiment/json.
+// or a value produced by github.com/go-json-experiment/json. A nil input is
+// the JSON null: $ selects it and every other selector selects nothing.
+//
+// Nodes are returned in document order, which is guaranteed: each segment
+// processes its input nodes in turn, and every node derived from an earlier
+// input node precedes every node derived from a later one. For one input node,
+// the selectors of a segment apply left to right, so $[1,0] yields element 1
+// before element 0, and a selector visiting several array elements (wildcard,
+// slice, filter) yields them by increasing index, or in step order for a
+// slice. Object members have no defined order. [WithReverseOrder] produces
+// exactly the reverse sequence.
+//
+// A descendant segment such as ..a or ..* applies its selectors to the node
+// itself and then to every array element and object member below it, so on a
+// scalar root or an empty container it selects nothing, and on a container of
+// scalars it behaves like the matching child segment. [Path.SelectLocated] and
+// filter sub-queries follow the same rules.
+//
+// Documents are treated as trees even when they are not: a map or slice
+// reachable under several keys is visited once per location, so its nodes are
+// selected once per location, each with its own path in [Path.SelectLocated].
+// Use [LocatedNodeList.Deduplicate] to drop repeated paths, not repeated values.
+// Descendant segments skip a map or slice found inside itself, so evaluation
+// ends on cyclic documents; the cycle's entry is still selected as a child.
+//
+// As an extension beyond the JSON data model, a map[int]any or map[int64]any
+// is treated as a sparse array: index selectors look up the key as is, without
+// counting negative indexes from the end; wildcard, filter and descendant
+// segments visit the elements in key order; name and slice selectors select
+// nothing. Located paths address sparse elements with [IndexElement], whose
+// renderings mark negative keys as invalid.
 func (p *Path) Select(input any) NodeList {
+	res, _, _ := p.selectLogged(context.Background(), "Select", nil, input, input)
+	return res
+}
+
+// SelectE is like [Path.Select] but also reports statistics about the
+// evaluation and the error that aborted it, if any. Evaluation aborts with
+// [ErrTooManyNodes] when a node list exceeds the limit set by
+// [WithMaxIntermediateNodes]; [Path.Select] returns nil in that case.
+func (p *Path) SelectE(input any) (NodeList, SelectStats, error) {
+	return p.selectLogged(context.Background(), "SelectE", nil, input, input)
+}
+
+// SelectContext is like [Path.Select] but stops evaluating when ctx is done,
+// returning an error that wraps ctx.Err(). The context is checked before each
+// segment is applied and periodically while nodes are visited, by filter
+// sub-queries too, so a large document is abandoned soon after cancellation.
+// It also returns the errors documented on [Path.SelectE].
+func (p *Path) SelectContext(ctx context.Context, input any) (NodeList, error) {
+	res, _, err := p.selectLogged(ctx, "SelectContext", nil, input, input)
+	return res, err
+}
+
+// SelectAppend is like [Path.Select] but appends the matches to dst, growing
+// it as needed, and returns the extended list. Passing the result of a
+// previous call as dst[:0] reuses its backing array, so evaluating a path
+// against many documents in a loop need not allocate a list per document.
+// If evaluation aborts, dst is returned unchanged, though its spare capacity
+// may have been written to.
+func (p *Path) SelectAppend(dst NodeList, input any) NodeList {
+	res, _, _ := p.selectLogged(context.Background(), "SelectAppend", dst, input, input)
+	return res
+}
+
+// selectLogged evaluates p against current until ctx is done, resolving $
+// against root, appending the matches to dst and logging the evaluation as
+// method if p was compiled by a [Parser] with [WithLogger].
+func (p *Path) selectLogged(ctx context.Context, method string, dst NodeList, current, root any) (NodeList, SelectStats, error) {
+	if !p.opts.logging() {
+		return p.selectNodes(ctx, dst, current, root)
+	}
+	start := time.Now()
+	res, stats, err := p.selectNodes(ctx, dst, current, root)
+	p.logSelect(ctx, method, current, len(res)-len(dst), stats, err, start)
+	return res, stats, err
+}
+
+// selectNodes evaluates p against current until ctx is done, resolving $
+// against root, and appends the matches to dst. The final segment writes
+// into dst directly; on error dst is returned as is.
+func (p *Path) selectNodes(ctx context.Context, dst NodeList, current, root any) (NodeList, SelectStats, error) {
 	if p.query == nil {
-		return nil
+		return dst, SelectStats{}, nil
+	}
+	if p.query.IsRoot() {
+		current = root
 	}
-	res := []any{input}
+	e := p.opts.newEvaluator(root)
+	defer e.release()
+	e.watch(ctx)
+	// The start list stays on the stack, so a single-segment query allocates
+	// nothing beyond the growth of dst.
+	start := [1]any{current}
+	nodes, out := start[:], []any(dst)
+	stats := SelectStats{PeakNodes: 1}
 	segments := p.query.Segments()
+	last := len(segments) - 1
+	if last < 0 {
+		out = append(out, current)
+	}
 	for i := range segments {
-		res = applySegment(&segments[i], res, input)
+		if e.cancelled(len(nodes)) {
+			break
+		}
+		n := 0
+		switch {
+		case i < last:
+			nodes = e.applySegment(&segments[i], nodes)
+			n = len(nodes)
+		case e.maxResults > 0:
+			out = e.applyFinal(out, segments[i:], nodes)
+			n = len(out) - len(dst)
+		default:
+			out = e.appendSegment(out, &segments[i], nodes)
+			n = len(out) - len(dst)
+		}
+		if e.err != nil {
+			break
+		}
+		stats.PeakNodes = max(stats.PeakNodes, n)
 	}
-	return NodeList(res)
+	if e.stopped(stats.PeakNodes) {
+		stats.PeakNodes = e.peak
+		return dst, stats, e.err
+	}
+	if out == nil {
+		// No matches is an empty list, not nil.
+		out = []any{}
+	}
+	if e.env.Convert != nil && !p.opts.rawResults {
+		for i := len(dst); i < len(out); i++ {
+			out[i] = e.env.Convert(out[i])
+		}
+	}
+	return NodeList(out), stats, nil
 }
 
-// SelectLocated returns matched nodes paired with their normalized paths.
+// SelectFrom evaluates the relative path p, compiled with
+// [Parser.ParseRelative], against current, resolving $ in its filter
+// expressions against root, so that a fragment such as @.status.phase can be
+// applied to a node of a larger document. A $-rooted p is evaluated against
+// root, as by [Path.Select]. The results are those of Select: SelectFrom(v, v)
+// is Select(v).
+func (p *Path) SelectFrom(current, root any) NodeList {
+	res, _, _ := p.selectLogged(context.Background(), "SelectFrom", nil, current, root)
+	return res
+}
+
+// SelectLocated returns matched nodes paired with their normalized paths, in
+// the same order as [Path.Select].
 func (p *Path) SelectLocated(input any) LocatedNodeList {
+	res, _, _ := p.selectLocatedLogged(context.Background(), "SelectLocated", nil, input)
+	return res
+}
+
+// SelectLocatedE is the located variant of [Path.SelectE].
+func (p *Path) SelectLocatedE(input any) (LocatedNodeList, SelectStats, error) {
+	return p.selectLocatedLogged(context.Background(), "SelectLocatedE", nil, input)
+}
+
+// SelectPaths returns the normalized path string of every node p matches in
+// input, in the order of [Path.SelectLocated], for callers that only need
+// the locations. The strings are those [NormalizedPath.String] returns,
+// rendered into one shared buffer as [LocatedNodeList.PathStrings] does. It
+// returns the errors of [Path.SelectLocatedE], and nil if p matches nothing.
+func (p *Path) SelectPaths(input any) ([]string, error) {
+	nodes, _, err := p.selectLocatedLogged(context.Background(), "SelectPaths", nil, input)
+	if err != nil {
+		return nil, err
+	}
+	return nodes.PathStrings(), nil
+}
+
+// SelectLocatedContext is the located variant of [Path.SelectContext].
+func (p *Path) SelectLocatedContext(ctx context.Context, input any) (LocatedNodeList, error) {
+	res, _, err := p.selectLocatedLogged(ctx, "SelectLocatedContext", nil, input)
+	return res, err
+}
+
+// SelectLocatedAppend is the located variant of [Path.SelectAppend]. Only the
+// list is reused: each match is still a new [LocatedNode] with its own path.
+func (p *Path) SelectLocatedAppend(dst LocatedNodeList, input any) LocatedNodeList {
+	res, _, _ := p.selectLocatedLogged(context.Background(), "SelectLocatedAppend", dst, input)
+	return res
+}
+
+// selectLocatedLogged is [Path.selectLogged] for located evaluation.
+func (p *Path) selectLocatedLogged(ctx context.Context, method string, dst LocatedNodeList, input any) (LocatedNodeList, SelectStats, error) {
+	if !p.opts.logging() {
+		return p.selectLocated(ctx, dst, input, input, nil)
+	}
+	start := time.Now()
+	res, stats, err := p.selectLocated(ctx, dst, input, input, nil)
+	p.logSelect(ctx, method, input, len(res)-len(dst), stats, err, start)
+	return res, stats, err
+}
+
+// selectLocated evaluates p against current until ctx is done, resolving $
+// in filters against root, and appends the matches to dst with every path
+// prefixed with prefix. On error dst is returned as is.
+func (p *Path) selectLocated(ctx context.Context, dst LocatedNodeList, current, root any, prefix NormalizedPath) (LocatedNodeList, SelectStats, error) {
 	if p.query == nil {
-		return nil
+		return dst, SelectStats{}, nil
 	}
-	res := []*LocatedNode{{Value: input, Path: nil}}
+	e := p.opts.newEvaluator(root)
+	defer e.release()
+	e.watch(ctx)
+	nodes, out := []*LocatedNode{{Value: current, Path: slices.Clone(prefix)}}, []*LocatedNode(dst)
+	stats := SelectStats{PeakNodes: 1}
 	segments := p.query.Segments()
+	last := len(segments) - 1
+	if last < 0 {
+		out = append(out, nodes[0])
+	}
 	for i := range segments {
-		res = applySegmentLocated(&segments[i], res, input)
+		if e.cancelled(len(nodes)) {
+			break
+		}
+		n := 0
+		switch {
+		case i < last:
+			nodes = e.applySegmentLocated(&segments[i], nodes)
+			n = len(nodes)
+		case e.maxResults > 0:
+			out = e.applyFinalLocated(out, segments[i:], nodes)
+			n = len(out) - len(dst)
+		default:
+			out = e.appendSegmentLocated(out, &segments[i], nodes)
+			n = len(out) - len(dst)
+		}
+		if e.err != nil {
+			break
+		}
+		stats.PeakNodes = max(stats.PeakNodes, n)
+	}
+	if e.stopped(stats.PeakNodes) {
+		stats.PeakNodes = e.peak
+		return dst, stats, e.err
+	}
+	if out == nil {
+		out = []*LocatedNode{}
+	}
+	if e.env.Convert != nil && !p.opts.rawResults {
+		for _, n := range out[len(dst):] {
+			n.Value = e.env.Convert(n.Value)
+		}
+	}
+	return LocatedNodeList(out), stats, nil
+}
+
+// Rebase returns the part of p that follows prefix as a relative (@) path,
+// for reuse against subtrees already selected by prefix, for example with
+// [LocatedNodeList.Query]. The segments of prefix must equal the leading
+// segments of p: names, indexes and slices must have equal arguments and
+// wildcards must be wildcards in both; filter selectors never match. Both
+// paths must be rooted alike. Rebase returns [ErrPrefixMismatch] otherwise.
+// In the result, $ in filters refers to the value the path is applied to.
+func (p *Path) Rebase(prefix *Path) (*Path, error) {
+	if !p.hasPrefix(prefix) {
+		return nil, fmt.Errorf("%w: %s is not a prefix of %s", ErrPrefixMismatch, prefix, p)
 	}
-	return LocatedNodeList(res)
+	rest := p.query.Segments()[len(prefix.query.Segments()):]
+	return &Path{query: ast.NewPathQuery(false, rest[:len(rest):len(rest)]...), opts: p.opts}, nil
 }
 
-// String returns the canonical string representation of p.
+// hasPrefix reports whether the segments of prefix lead the segments of p.
+func (p *Path) hasPrefix(prefix *Path) bool {
+	if p.query == nil || prefix.query == nil || p.query.IsRoot() != prefix.query.IsRoot() {
+		return false
+	}
+	segments := p.query.Segments()
+	head := prefix.query.Segments()
+	if len(head) > len(segments) {
+		return false
+	}
+	for i := range head {
+		if !head[i].Equal(&segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the canonical string representation of p: every segment in
+// brackets, with names in double quotes escaped as RFC 9535 prescribes for
+// normalized paths, so that parsing it again yields an equivalent path. Filter
+// expressions are written with single spaces around their operators and
+// string literals in double quotes, as in $["a"][?@["b"] == "x" || !@["c"]].
 func (p *Path) String() string {
 	if p.query == nil {
 		return ""
@@ -49,14 +319,89 @@ func (p *Path) String() string {
 	return p.query.String()
 }
 
+// Shorthand is like [Path.String] but writes a segment holding a single name
+// selector as .name, or ..name for a descendant segment, when the name is a
+// valid member name shorthand, as in $.store..book[0]. Other names keep the
+// bracket notation, so the result parses like that of String.
+func (p *Path) Shorthand() string {
+	if p.query == nil {
+		return ""
+	}
+	return p.query.Shorthand()
+}
+
+// Normalized returns the RFC 9535 normalized path of the location p selects,
+// such as $['store']['book'][0], written as [NormalizedPath.String] writes
+// it, so it can be compared with the paths of [Path.SelectLocated] or used as
+// a cache key. It reports false unless p is a $-rooted singular query without
+// negative indexes, the only kind whose location does not depend on the
+// document.
+func (p *Path) Normalized() (string, bool) {
+	if p.query == nil || !p.query.IsRoot() || !p.query.IsSingular() {
+		return "", false
+	}
+	var buf strings.Builder
+	buf.WriteByte('$')
+	for _, seg := range p.query.Segments() {
+		sel := seg.Selectors()[0]
+		switch {
+		case sel.Kind == ast.Name:
+			NameElement(sel.Name).writeNormalizedTo(&buf)
+		case sel.Index < 0:
+			return "", false
+		default:
+			IndexElement(sel.Index).writeNormalizedTo(&buf)
+		}
+	}
+	return buf.String(), true
+}
+
+// Redacted returns a representation of p that is safe to log: the canonical
+// form with every filter selector written as a bare ?, so it holds no literal
+// from a filter expression. Name, index and slice arguments are kept, since
+// they describe the shape of the query rather than the data it matches.
+func (p *Path) Redacted() string {
+	if p.query == nil {
+		return ""
+	}
+	return p.query.Redacted()
+}
+
 // MarshalText implements encoding.TextMarshaler.
 func (p *Path) MarshalText() ([]byte, error) {
 	return []byte(p.String()), nil
 }
 
-// UnmarshalText implements encoding.TextUnmarshaler.
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts relative
+// paths as well, as [Path.MarshalText] encodes them.
 func (p *Path) UnmarshalText(text []byte) error {
-	path, err := Parse(string(text))
+	path, err := defaultParser.parse(string(text), lexer.Invalid)
+	if err != nil {
+		return newParseError(string(text), err)
+	}
+	*p = *path
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding is a
+// compact, versioned form of the compiled query, including filter expressions,
+// that [Parser.ParseBinary] decodes without parsing the expression again.
+// Functions are encoded by name and resolved when decoding; evaluation
+// settings such as [WithReverseOrder] are not encoded.
+func (p *Path) MarshalBinary() ([]byte, error) {
+	data, err := ast.AppendBinary(nil, p.query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBinaryPath, err)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. Like
+// [Path.UnmarshalText] it uses a default [Parser], which knows only the
+// built-in functions; use [Parser.ParseBinary] to decode paths calling
+// extension functions.
+func (p *Path) UnmarshalBinary(data []byte) error {
+	path, err := defaultParser.ParseBinary(data)
 	if err != nil {
 		return err
 	}
@@ -64,10 +409,14 @@ func (p *Path) UnmarshalText(text []byte) error {
 	return nil
 }
 
-// Parse compiles a JSONPath expression. Returns ErrPathParse on failure.
+// defaultParser compiles the paths of the package-level functions. It knows
+// only the built-in functions.
+var defaultParser = NewParser()
+
+// Parse compiles a JSONPath expression with the default [Parser]. See
+// [Parser.Parse] for the errors it returns.
 func Parse(expr string) (*Path, error) {
-	p := NewParser()
-	return p.Parse(expr)
+	return defaultParser.Parse(expr)
 }
 
 // MustParse compiles a JSONPath expression. Panics on failure.
@@ -79,17 +428,64 @@ func MustParse(expr string) *Path {
 	return path
 }
 
+// ParseRelative compiles a relative JSONPath expression, starting with @,
+// with the default [Parser]. See [Parser.ParseRelative].
+func ParseRelative(expr string) (*Path, error) {
+	return defaultParser.ParseRelative(expr)
+}
+
+// MustParseRelative compiles a relative JSONPath expression. Panics on
+// failure.
+func MustParseRelative(expr string) *Path {
+	path, err := ParseRelative(expr)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
 // Valid reports whether expr is a syntactically valid JSONPath expression.
+// Use [ValidateExpr] to learn why it is not.
 func Valid(expr string) bool {
-	_, err := Parse(expr)
-	return err == nil
+	return ValidateExpr(expr) == nil
+}
+
+// ValidateExpr returns nil if expr is a valid JSONPath expression, and
+// otherwise the error [Parse] returns for it, which wraps a [*ParseError]
+// locating the problem. It checks expr without compiling a [Path].
+func ValidateExpr(expr string) error {
+	if _, err := defaultParser.parseQuery(expr, lexer.Dollar); err != nil {
+		return newParseError(expr, err)
+	}
+	return nil
+}
+
+// Query compiles expr with the default [Parser], which knows only the
+// built-in functions, and evaluates it against input. It returns an error
+// wrapping [ErrPathParse] if expr is invalid. Compile expressions used more
+// than once with [Parse] instead.
+func Query(expr string, input any) (NodeList, error) {
+	path, err := defaultParser.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return path.Select(input), nil
+}
+
+// QueryLocated is the located variant of [Query].
+func QueryLocated(expr string, input any) (LocatedNodeList, error) {
+	path, err := defaultParser.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return path.SelectLocated(input), nil
 }
 
 // QueryJSON unmarshals src and evaluates path against it.
 // Uses github.com/go-json-experiment/json for unmarshaling.
 func QueryJSON(src []byte, path *Path) (NodeList, error) {
 	var v any
-	if err := json.Unmarshal(src, &v, json.DefaultOptionsV2()); err != nil {
+	if err := json.Unmarshal(src, &v, decodeOptions); err != nil {
 		return nil, errors.Join(ErrUnmarshal, err)
 	}
 	return path.Select(v), nil
@@ -98,7 +494,7 @@ func QueryJSON(src []byte, path *Path) (NodeList, error) {
 // QueryJSONLocated is the located variant of QueryJSON.
 func QueryJSONLocated(src []byte, path *Path) (LocatedNodeList, error) {
 	var v any
-	if err := json.Unmarshal(src, &v, json.DefaultOptionsV2()); err != nil {
+	if err := json.Unmarshal(src, &v, decodeOptions); err != nil {
 		return nil, errors.Join(ErrUnmarshal, err)
 	}
 	return path.SelectLocated(v), nil
@@ -107,61 +503,284 @@ func QueryJSONLocated(src []byte, path *Path) (LocatedNodeList, error) {
 // extendPath creates a new path by appending elem to path.
 // The original path is not modified.
 func extendPath(path NormalizedPath, elem PathElement) NormalizedPath {
-	return append(slices.Clone(path), elem)
+	out := make(NormalizedPath, len(path)+1)
+	copy(out, path)
+	out[len(path)] = elem
+	return out
+}
+
+// evaluator applies the segments of a compiled query to one input document.
+// Its results follow the order documented on [Path.Select]; changes to the
+// evaluation strategy must keep that order.
+type evaluator struct {
+	env        ast.Env // root and hooks shared with filter sub-queries
+	reverse    bool    // produce nodes in reverse document order
+	maxNodes   int     // largest node list allowed, or 0 for no limit
+	maxResults int     // largest result, or 0 for no limit
+	maxDepth   int     // deepest level a descendant segment visits, or 0 for no limit
+	peak       int     // size of the node list that exceeded maxNodes
+	err        error   // set when evaluation aborts
+
+	ctx    context.Context // checked for cancellation, or nil if it cannot be
+	visits int             // calls to over since ctx was last checked
+
+	// ancestors holds one container per level from the node the current
+	// descendant segment was applied to down to the node it visits.
+	ancestors []ast.Container
+
+	// names holds name elements of located paths for reuse, so that the
+	// paths of nodes at the same member name share one element. See
+	// nameElement.
+	names *nameCache
+}
+
+// nameCache is a direct-mapped cache of name elements: each name has one
+// slot, picked from its length and end bytes, which holds the element made
+// for the name most recently looked up there.
+type nameCache [32]struct {
+	name string
+	elem PathElement
+}
+
+// nameElement returns name as a path element. Storing a string in an
+// interface allocates, so the elements made for located paths are cached and
+// handed out again for equal names: the paths of every node $.items[*].name
+// matches share their "items" and "name" elements. The cache is small and
+// checked with one string comparison, so names that miss it, as the many
+// distinct keys of a large object do, cost little more than before.
+func (e *evaluator) nameElement(name string) PathElement {
+	if e.names == nil {
+		e.names = new(nameCache)
+	}
+	h := len(name)
+	if h > 0 {
+		h = h*31 + int(name[0])
+		h = h*31 + int(name[len(name)-1])
+	}
+	slot := &e.names[h%len(e.names)]
+	if slot.elem == nil || slot.name != name {
+		slot.name, slot.elem = name, NameElement(name)
+	}
+	return slot.elem
+}
+
+// cancelCheckInterval is the number of nodes visited between checks of the
+// evaluator's context.
+const cancelCheckInterval = 1024
+
+// watch makes the evaluator stop once ctx is done. Contexts that can never
+// be cancelled, such as [context.Background], are not watched.
+func (e *evaluator) watch(ctx context.Context) {
+	if ctx.Done() != nil {
+		e.ctx = ctx
+		e.env.Context = ctx
+	}
+}
+
+// stopped reports whether evaluation has been stopped. A filter sub-query
+// that stopped records its error in the environment, which stopped takes
+// over the first time it finds it. n is the size of the current node list.
+func (e *evaluator) stopped(n int) bool {
+	if e.err == nil && e.env.Err != nil {
+		e.peak = n
+		e.err = e.env.Err
+	}
+	return e.err != nil
+}
+
+// cancelled reports whether evaluation must stop, recording an error that
+// wraps the context's error the first time it is found done. n is the size
+// of the current node list.
+func (e *evaluator) cancelled(n int) bool {
+	if e.stopped(n) {
+		return true
+	}
+	if e.ctx == nil {
+		return false
+	}
+	e.visits = 0
+	if err := e.ctx.Err(); err != nil {
+		e.peak = n
+		e.err = fmt.Errorf("jsonpath: evaluation stopped: %w", err)
+		return true
+	}
+	return false
+}
+
+// over reports whether evaluation must stop, recording an error the first
+// time a node list of n nodes exceeds the limit, a descendant segment goes
+// deeper than allowed or, every cancelCheckInterval calls, the evaluator's
+// context is found done.
+func (e *evaluator) over(n int) bool {
+	if e.stopped(n) {
+		return true
+	}
+	if e.maxNodes > 0 && n > e.maxNodes {
+		e.peak = n
+		e.err = fmt.Errorf("%w: %d nodes exceed the limit of %d", ErrTooManyNodes, n, e.maxNodes)
+		return true
+	}
+	if e.maxDepth > 0 && len(e.ancestors) > e.maxDepth {
+		e.peak = n
+		e.err = fmt.Errorf("%w: descendant segment exceeds the depth limit of %d", ErrDocumentTooDeep, e.maxDepth)
+		return true
+	}
+	if e.ctx != nil {
+		if e.visits++; e.visits >= cancelCheckInterval {
+			return e.cancelled(n)
+		}
+	}
+	return false
 }
 
 // applySegment applies a segment to a list of nodes, returning the new node list.
-func applySegment(seg *ast.Segment, nodes []any, root any) []any {
+func (e *evaluator) applySegment(seg *ast.Segment, nodes []any) []any {
 	if len(nodes) == 0 {
 		return nodes
 	}
-	out := make([]any, 0, len(nodes))
+	return e.appendSegment(make([]any, 0, len(nodes)), seg, nodes)
+}
+
+// appendSegment appends to out the nodes a segment selects from a list of
+// nodes. Only the appended nodes count towards the node limit.
+func (e *evaluator) appendSegment(out []any, seg *ast.Segment, nodes []any) []any {
+	base := len(out)
 	if seg.IsDescendant() {
 		for _, n := range nodes {
-			out = appendDescendant(out, seg, n, root)
+			if out = e.appendDescendant(out, seg, n); e.over(len(out) - base) {
+				return out
+			}
 		}
 	} else {
 		for _, n := range nodes {
-			out = appendSelectors(out, seg.Selectors(), n, root)
+			if out = e.appendSelectors(out, seg, n); e.over(len(out) - base) {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// applyFinal appends to out the nodes the final segment of a query selects
+// from a list of nodes, one match at a time, stopping once maxResults nodes
+// have been appended.
+func (e *evaluator) applyFinal(out []any, segments []ast.Segment, nodes []any) []any {
+	base := len(out)
+	out = slices.Grow(out, min(len(nodes), e.maxResults))
+	for _, n := range nodes {
+		if !e.walk(segments, n, func(v any) bool {
+			out = append(out, v)
+			return !e.over(len(out)-base) && len(out)-base < e.maxResults
+		}) {
+			break
 		}
 	}
 	return out
 }
 
 // appendDescendant recursively applies selectors to node and all its descendants.
-func appendDescendant(out []any, seg *ast.Segment, node, root any) []any {
-	// Apply selectors to the current node
-	out = appendSelectors(out, seg.Selectors(), node, root)
+// In reverse order the children are visited last-to-first and the node's own
+// matches follow those of its descendants, mirroring the forward order exactly.
+func (e *evaluator) appendDescendant(out []any, seg *ast.Segment, node any) []any {
+	if e.over(len(out)) {
+		return out
+	}
+	node = e.env.Node(node)
+	if !e.enter(node) {
+		return out
+	}
+	if !e.reverse {
+		out = e.appendSelectors(out, seg, node)
+	}
 
 	// Recurse into children
 	switch v := node.(type) {
 	case map[string]any:
 		for _, child := range v {
-			out = appendDescendant(out, seg, child, root)
+			out = e.appendDescendant(out, seg, child)
 		}
 	case []any:
-		for _, child := range v {
-			out = appendDescendant(out, seg, child, root)
+		if e.reverse {
+			for i := len(v) - 1; i >= 0; i-- {
+				out = e.appendDescendant(out, seg, v[i])
+			}
+		} else {
+			for _, child := range v {
+				out = e.appendDescendant(out, seg, child)
+			}
 		}
+	default:
+		for _, entry := range e.sparseEntries(node) {
+			out = e.appendDescendant(out, seg, entry.Value)
+		}
+	}
+
+	if e.reverse {
+		out = e.appendSelectors(out, seg, node)
 	}
+	e.leave()
 	return out
 }
 
-// appendSelectors applies a list of selectors to node, appending matches to out.
-func appendSelectors(out []any, selectors []ast.Selector, node, root any) []any {
+// ancestorsCap is the number of levels a descendant segment descends before
+// the evaluator grows its ancestor stack.
+const ancestorsCap = 16
+
+// enter records node as the parent of the nodes a descendant segment visits
+// next. It reports false, recording nothing, if node is already one of their
+// ancestors: the document is cyclic, and node must not be visited again.
+func (e *evaluator) enter(node any) bool {
+	id := ast.ContainerOf(node)
+	if id != (ast.Container{}) && slices.Contains(e.ancestors, id) {
+		return false
+	}
+	if e.ancestors == nil {
+		e.ancestors = make([]ast.Container, 0, ancestorsCap)
+	}
+	e.ancestors = append(e.ancestors, id)
+	return true
+}
+
+// leave undoes the matching call to enter.
+func (e *evaluator) leave() {
+	e.ancestors = e.ancestors[:len(e.ancestors)-1]
+}
+
+// appendSelectors applies the selectors of seg to node, appending matches to
+// out. Large name and index unions only visit the selectors that match.
+func (e *evaluator) appendSelectors(out []any, seg *ast.Segment, node any) []any {
+	node = e.env.Node(node)
+	selectors := seg.Selectors()
+	if positions, ok := seg.Candidates(node, &e.env); ok {
+		if e.reverse {
+			slices.Reverse(positions)
+		}
+		for _, i := range positions {
+			out = e.appendSelector(out, &selectors[i], node)
+		}
+		return out
+	}
+	if e.reverse {
+		for i := len(selectors) - 1; i >= 0; i-- {
+			out = e.appendSelector(out, &selectors[i], node)
+		}
+		return out
+	}
 	for i := range selectors {
-		out = appendSelector(out, &selectors[i], node, root)
+		out = e.appendSelector(out, &selectors[i], node)
 	}
 	return out
 }
 
 // appendSelector applies a single selector to node, appending matches to out.
 // Uses a switch on SelectorKind to keep the hot path in the instruction cache.
-func appendSelector(out []any, sel *ast.Selector, node, root any) []any {
+func (e *evaluator) appendSelector(out []any, sel *ast.Selector, node any) []any {
 	switch sel.Kind {
 	case ast.Name:
 		if m, ok := node.(map[string]any); ok {
-			if v, ok := m[sel.Name]; ok {
+			if e.env.FoldNames {
+				e.env.FoldedMembers(m, sel.Name, func(_ string, v any) { out = append(out, v) })
+			} else if v, ok := e.env.Member(m, sel.Name); ok {
 				out = append(out, v)
 			}
 		}
@@ -171,10 +790,19 @@ func appendSelector(out []any, sel *ast.Selector, node, root any) []any {
 			if idx >= 0 && idx < len(arr) {
 				out = append(out, arr[idx])
 			}
+		} else if v, ok := ast.SparseIndex(node, sel.Index); ok {
+			out = append(out, v)
 		}
 	case ast.Slice:
 		if arr, ok := node.([]any); ok {
-			out = appendSlice(out, arr, sel.Slice)
+			if e.reverse {
+				indices := slices.Collect(sel.Slice.Indices(len(arr)))
+				for i := len(indices) - 1; i >= 0; i-- {
+					out = append(out, arr[indices[i]])
+				}
+			} else {
+				out = appendSlice(out, arr, sel.Slice)
+			}
 		}
 	case ast.Wildcard:
 		switch v := node.(type) {
@@ -183,30 +811,69 @@ func appendSelector(out []any, sel *ast.Selector, node, root any) []any {
 				out = append(out, val)
 			}
 		case []any:
-			out = append(out, v...)
+			if e.reverse {
+				for i := len(v) - 1; i >= 0; i-- {
+					out = append(out, v[i])
+				}
+			} else {
+				out = append(out, v...)
+			}
+		default:
+			for _, entry := range e.sparseEntries(node) {
+				out = append(out, entry.Value)
+			}
 		}
 	case ast.Filter:
 		switch v := node.(type) {
 		case map[string]any:
 			for _, val := range v {
-				if sel.Filter.Eval(val, root) {
+				if sel.Filter.Eval(val, &e.env) {
 					out = append(out, val)
 				}
 			}
 		case []any:
-			for _, val := range v {
-				if sel.Filter.Eval(val, root) {
-					out = append(out, val)
+			if e.reverse {
+				for i := len(v) - 1; i >= 0; i-- {
+					if sel.Filter.Eval(v[i], &e.env) {
+						out = append(out, v[i])
+					}
+				}
+			} else {
+				for _, val := range v {
+					if sel.Filter.Eval(val, &e.env) {
+						out = append(out, val)
+					}
+				}
+			}
+		default:
+			for _, entry := range e.sparseEntries(node) {
+				if sel.Filter.Eval(entry.Value, &e.env) {
+					out = append(out, entry.Value)
 				}
 			}
 		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("%w %d", ErrUnknownSelector, sel.Kind)
+		}
 	}
 	return out
 }
 
+// sparseEntries returns the elements of node in visiting order if node is a
+// sparse array, and nil otherwise. See [ast.SparseEntries].
+func (e *evaluator) sparseEntries(node any) []ast.SparseEntry {
+	entries := ast.SparseEntries(node)
+	if e.reverse {
+		slices.Reverse(entries)
+	}
+	return entries
+}
+
 // normalizeIndex converts a possibly-negative index to a non-negative index.
 // Negative indices count from the end of the array.
-// Returns -1 if the index is out of bounds.
+// Returns -1 if the index is out of bounds. The bounds are checked in int64, so
+// no index is truncated where int is 32 bits.
 func normalizeIndex(idx int64, length int) int {
 	if idx < 0 {
 		idx += int64(length)
@@ -217,152 +884,145 @@ func normalizeIndex(idx int64, length int) int {
 	return int(idx)
 }
 
-// sliceIndices calculates the indices to select for a slice operation.
-// Returns a slice of indices in the order they should be selected.
-func sliceIndices(args ast.SliceArgs, length int) []int {
-	if length == 0 {
-		return nil
-	}
-
-	step := int64(1)
-	if args.HasStep {
-		step = args.Step
-	}
-	if step == 0 {
-		return nil
-	}
-
-	var start, end int64
-	if step > 0 {
-		start = 0
-		if args.HasStart {
-			start = args.Start
-		}
-		end = int64(length)
-		if args.HasEnd {
-			end = args.End
-		}
-	} else {
-		start = int64(length - 1)
-		if args.HasStart {
-			start = args.Start
-		}
-		end = -int64(length) - 1
-		if args.HasEnd {
-			end = args.End
-		}
-	}
-
-	start, end = normalizeSliceBounds(start, end, step, length)
-
-	var indices []int
-	if step > 0 {
-		for i := start; i < end; i += step {
-			if i >= 0 && i < int64(length) {
-				indices = append(indices, int(i))
-			}
-		}
-	} else {
-		for i := start; i > end; i += step {
-			if i >= 0 && i < int64(length) {
-				indices = append(indices, int(i))
-			}
-		}
-	}
-	return indices
-}
-
 // appendSlice applies a slice selector to an array, appending selected elements to out.
 func appendSlice(out []any, arr []any, args ast.SliceArgs) []any {
-	for _, idx := range sliceIndices(args, len(arr)) {
+	for idx := range args.Indices(len(arr)) {
 		out = append(out, arr[idx])
 	}
 	return out
 }
 
-// normalizeSliceBounds normalizes start and end indices for slice operations
-// according to RFC 9535 §2.3.4. Handles negative indices and out-of-bounds
-// values based on the step direction.
-func normalizeSliceBounds(start, end, step int64, length int) (int64, int64) {
-	// Normalize start
-	if start < 0 {
-		start += int64(length)
-		if start < 0 {
-			if step > 0 {
-				start = 0
-			}
-		}
-	} else if start >= int64(length) {
-		if step < 0 {
-			start = int64(length - 1)
-		}
-	}
-
-	// Normalize end
-	if end < 0 {
-		end += int64(length)
-		if end < 0 && step < 0 {
-			end = -1
-		}
-	} else if end > int64(length) {
-		end = int64(length)
-	}
-
-	return start, end
-}
-
 // applySegmentLocated applies a segment to a list of located nodes, returning the new located node list.
-func applySegmentLocated(seg *ast.Segment, nodes []*LocatedNode, root any) []*LocatedNode {
+func (e *evaluator) applySegmentLocated(seg *ast.Segment, nodes []*LocatedNode) []*LocatedNode {
 	if len(nodes) == 0 {
 		return nodes
 	}
-	out := make([]*LocatedNode, 0, len(nodes))
+	return e.appendSegmentLocated(make([]*LocatedNode, 0, len(nodes)), seg, nodes)
+}
+
+// appendSegmentLocated is the located variant of appendSegment.
+func (e *evaluator) appendSegmentLocated(out []*LocatedNode, seg *ast.Segment, nodes []*LocatedNode) []*LocatedNode {
+	base := len(out)
 	if seg.IsDescendant() {
+		var path NormalizedPath
 		for _, n := range nodes {
-			out = appendDescendantLocated(out, seg, n.Value, n.Path, root)
+			path = append(path[:0], n.Path...)
+			if out = e.appendDescendantLocated(out, seg, n.Value, &path, len(n.Path)); e.over(len(out) - base) {
+				return out
+			}
 		}
 	} else {
 		for _, n := range nodes {
-			out = appendSelectorsLocated(out, seg.Selectors(), n.Value, n.Path, root)
+			if out = e.appendSelectorsLocated(out, seg, n.Value, n.Path); e.over(len(out) - base) {
+				return out
+			}
 		}
 	}
 	return out
 }
 
-// appendDescendantLocated recursively applies selectors to node and all its descendants.
-func appendDescendantLocated(out []*LocatedNode, seg *ast.Segment, node any, path NormalizedPath, root any) []*LocatedNode {
-	// Apply selectors to the current node
-	out = appendSelectorsLocated(out, seg.Selectors(), node, path, root)
+// applyFinalLocated is the located variant of applyFinal.
+func (e *evaluator) applyFinalLocated(out []*LocatedNode, segments []ast.Segment, nodes []*LocatedNode) []*LocatedNode {
+	base := len(out)
+	out = slices.Grow(out, min(len(nodes), e.maxResults))
+	for _, n := range nodes {
+		if !e.walkLocated(segments, n.Value, n.Path, func(v *LocatedNode) bool {
+			out = append(out, v)
+			return !e.over(len(out)-base) && len(out)-base < e.maxResults
+		}) {
+			break
+		}
+	}
+	return out
+}
+
+// appendDescendantLocated recursively applies selectors to node and all its
+// descendants. The path of node is (*path)[:depth]: the nodes visited share
+// one buffer that grows as the walk descends, so a node's path is copied out
+// of it only when a selector matches, rather than at every level.
+func (e *evaluator) appendDescendantLocated(out []*LocatedNode, seg *ast.Segment, node any, path *NormalizedPath, depth int) []*LocatedNode {
+	if e.over(len(out)) {
+		return out
+	}
+	node = e.env.Node(node)
+	if !e.enter(node) {
+		return out
+	}
+	if !e.reverse {
+		out = e.appendSelectorsLocated(out, seg, node, (*path)[:depth])
+	}
 
 	// Recurse into children
 	switch v := node.(type) {
 	case map[string]any:
 		for key, child := range v {
-			out = appendDescendantLocated(out, seg, child, extendPath(path, NameElement(key)), root)
+			*path = append((*path)[:depth], e.nameElement(key))
+			out = e.appendDescendantLocated(out, seg, child, path, depth+1)
 		}
 	case []any:
-		for idx, child := range v {
-			out = appendDescendantLocated(out, seg, child, extendPath(path, IndexElement(idx)), root)
+		if e.reverse {
+			for idx := len(v) - 1; idx >= 0; idx-- {
+				*path = append((*path)[:depth], IndexElement(idx))
+				out = e.appendDescendantLocated(out, seg, v[idx], path, depth+1)
+			}
+		} else {
+			for idx, child := range v {
+				*path = append((*path)[:depth], IndexElement(idx))
+				out = e.appendDescendantLocated(out, seg, child, path, depth+1)
+			}
+		}
+	default:
+		for _, entry := range e.sparseEntries(node) {
+			*path = append((*path)[:depth], IndexElement(entry.Index))
+			out = e.appendDescendantLocated(out, seg, entry.Value, path, depth+1)
 		}
 	}
+
+	if e.reverse {
+		out = e.appendSelectorsLocated(out, seg, node, (*path)[:depth])
+	}
+	e.leave()
 	return out
 }
 
-// appendSelectorsLocated applies a list of selectors to node, appending matches to out.
-func appendSelectorsLocated(out []*LocatedNode, selectors []ast.Selector, node any, path NormalizedPath, root any) []*LocatedNode {
+// appendSelectorsLocated applies the selectors of seg to node, appending
+// matches to out. The matches get paths of their own; path itself is not
+// kept, so it may be a buffer the caller reuses.
+func (e *evaluator) appendSelectorsLocated(out []*LocatedNode, seg *ast.Segment, node any, path NormalizedPath) []*LocatedNode {
+	node = e.env.Node(node)
+	selectors := seg.Selectors()
+	if positions, ok := seg.Candidates(node, &e.env); ok {
+		if e.reverse {
+			slices.Reverse(positions)
+		}
+		for _, i := range positions {
+			out = e.appendSelectorLocated(out, &selectors[i], node, path)
+		}
+		return out
+	}
+	if e.reverse {
+		for i := len(selectors) - 1; i >= 0; i-- {
+			out = e.appendSelectorLocated(out, &selectors[i], node, path)
+		}
+		return out
+	}
 	for i := range selectors {
-		out = appendSelectorLocated(out, &selectors[i], node, path, root)
+		out = e.appendSelectorLocated(out, &selectors[i], node, path)
 	}
 	return out
 }
 
 // appendSelectorLocated applies a single selector to node, appending matches to out.
-func appendSelectorLocated(out []*LocatedNode, sel *ast.Selector, node any, path NormalizedPath, root any) []*LocatedNode {
+func (e *evaluator) appendSelectorLocated(out []*LocatedNode, sel *ast.Selector, node any, path NormalizedPath) []*LocatedNode {
 	switch sel.Kind {
 	case ast.Name:
 		if m, ok := node.(map[string]any); ok {
-			if v, ok := m[sel.Name]; ok {
-				out = append(out, &LocatedNode{Value: v, Path: extendPath(path, NameElement(sel.Name))})
+			if e.env.FoldNames {
+				e.env.FoldedMembers(m, sel.Name, func(key string, v any) {
+					out = append(out, &LocatedNode{Value: v, Path: extendPath(path, e.nameElement(key))})
+				})
+			} else if v, ok := e.env.Member(m, sel.Name); ok {
+				out = append(out, &LocatedNode{Value: v, Path: extendPath(path, e.nameElement(sel.Name))})
 			}
 		}
 	case ast.Index:
@@ -371,36 +1031,73 @@ func appendSelectorLocated(out []*LocatedNode, sel *ast.Selector, node any, path
 			if idx >= 0 && idx < len(arr) {
 				out = append(out, &LocatedNode{Value: arr[idx], Path: extendPath(path, IndexElement(idx))})
 			}
+		} else if v, ok := ast.SparseIndex(node, sel.Index); ok {
+			out = append(out, &LocatedNode{Value: v, Path: extendPath(path, IndexElement(sel.Index))})
 		}
 	case ast.Slice:
 		if arr, ok := node.([]any); ok {
-			out = appendSliceLocated(out, arr, path, sel.Slice)
+			if e.reverse {
+				indices := slices.Collect(sel.Slice.Indices(len(arr)))
+				for i := len(indices) - 1; i >= 0; i-- {
+					out = append(out, &LocatedNode{Value: arr[indices[i]], Path: extendPath(path, IndexElement(indices[i]))})
+				}
+			} else {
+				out = appendSliceLocated(out, arr, path, sel.Slice)
+			}
 		}
 	case ast.Wildcard:
 		switch v := node.(type) {
 		case map[string]any:
 			for key, val := range v {
-				out = append(out, &LocatedNode{Value: val, Path: extendPath(path, NameElement(key))})
+				out = append(out, &LocatedNode{Value: val, Path: extendPath(path, e.nameElement(key))})
 			}
 		case []any:
-			for idx, val := range v {
-				out = append(out, &LocatedNode{Value: val, Path: extendPath(path, IndexElement(idx))})
+			if e.reverse {
+				for idx := len(v) - 1; idx >= 0; idx-- {
+					out = append(out, &LocatedNode{Value: v[idx], Path: extendPath(path, IndexElement(idx))})
+				}
+			} else {
+				for idx, val := range v {
+					out = append(out, &LocatedNode{Value: val, Path: extendPath(path, IndexElement(idx))})
+				}
+			}
+		default:
+			for _, entry := range e.sparseEntries(node) {
+				out = append(out, &LocatedNode{Value: entry.Value, Path: extendPath(path, IndexElement(entry.Index))})
 			}
 		}
 	case ast.Filter:
 		switch v := node.(type) {
 		case map[string]any:
 			for key, val := range v {
-				if sel.Filter.Eval(val, root) {
-					out = append(out, &LocatedNode{Value: val, Path: extendPath(path, NameElement(key))})
+				if sel.Filter.Eval(val, &e.env) {
+					out = append(out, &LocatedNode{Value: val, Path: extendPath(path, e.nameElement(key))})
 				}
 			}
 		case []any:
-			for idx, val := range v {
-				if sel.Filter.Eval(val, root) {
-					out = append(out, &LocatedNode{Value: val, Path: extendPath(path, IndexElement(idx))})
+			if e.reverse {
+				for idx := len(v) - 1; idx >= 0; idx-- {
+					if sel.Filter.Eval(v[idx], &e.env) {
+						out = append(out, &LocatedNode{Value: v[idx], Path: extendPath(path, IndexElement(idx))})
+					}
+				}
+			} else {
+				for idx, val := range v {
+					if sel.Filter.Eval(val, &e.env) {
+						out = append(out, &LocatedNode{Value: val, Path: extendPath(path, IndexElement(idx))})
+					}
 				}
 			}
+		default:
+			for _, entry := range e.sparseEntries(node) {
+				if sel.Filter.Eval(entry.Value, &e.env) {
+					out = append(out, &LocatedNode{Value: entry.Value, Path: extendPath(path, IndexElement(entry.Index))})
+				}
+			}
+		}
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("%w %d", ErrUnknownSelector, sel.Kind)
 		}
 	}
 	return out
@@ -408,7 +1105,7 @@ func appendSelectorLocated(out []*LocatedNode, sel *ast.Selector, node any, path
 
 // appendSliceLocated applies a slice selector to an array, appending selected elements with paths to out.
 func appendSliceLocated(out []*LocatedNode, arr []any, path NormalizedPath, args ast.SliceArgs) []*LocatedNode {
-	for _, idx := range sliceIndices(args, len(arr)) {
+	for idx := range args.Indices(len(arr)) {
 		out = append(out, &LocatedNode{Value: arr[idx], Path: extendPath(path, IndexElement(idx))})
 	}
 	return out
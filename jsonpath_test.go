@@ -1,9 +1,18 @@
 package jsonpath
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
 	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/agentable/jsonpath/internal/ast"
 	"github.com/stretchr/testify/assert"
@@ -346,6 +355,53 @@ func TestPath_Select_DescendantWildcard(t *testing.T) {
 	}, []any(got))
 }
 
+func TestPath_Select_CyclicDescendant(t *testing.T) {
+	// child refers back to the root, and list contains itself.
+	child := map[string]any{"b": 1.0}
+	root := map[string]any{"a": child}
+	child["up"] = root
+	list := []any{2.0, nil}
+	list[1] = list
+	root["list"] = list
+
+	tests := []struct {
+		expr  string
+		paths []string
+	}{
+		{expr: "$..b", paths: []string{"$['a']['b']"}},
+		{expr: "$..[0]", paths: []string{"$['list'][0]"}},
+		{expr: "$.a..b", paths: []string{"$['a']['b']"}},
+		{expr: "$..up..b", paths: []string{"$['a']['up']['a']['b']"}},
+		{expr: "$[?@..b]", paths: []string{"$['a']"}},
+		{expr: "$..*", paths: []string{
+			"$['a']", "$['a']['b']", "$['a']['up']", "$['list']", "$['list'][0]", "$['list'][1]",
+		}},
+	}
+	for _, tt := range tests {
+		for _, p := range []*Parser{NewParser(), NewParser(WithReverseOrder())} {
+			path := p.MustParse(tt.expr)
+			var paths []string
+			for _, n := range path.SelectLocated(root) {
+				paths = append(paths, n.Path.String())
+			}
+			assert.ElementsMatch(t, tt.paths, paths, tt.expr)
+			assert.Len(t, path.Select(root), len(tt.paths), tt.expr)
+			assert.Equal(t, len(tt.paths), path.Count(root), tt.expr)
+		}
+	}
+
+	// A container reached under several keys without enclosing itself is
+	// still visited once per location.
+	shared := map[string]any{"x": 1.0}
+	got := MustParse("$..x").Select(map[string]any{"p": shared, "q": []any{shared, shared}})
+	assert.Equal(t, NodeList{1.0, 1.0, 1.0}, got)
+
+	// A sub-slice is a different node from the slice it was cut from.
+	outer := []any{3.0, nil}
+	outer[1] = outer[:1]
+	assert.Equal(t, NodeList{3.0, 3.0}, MustParse("$..[0]").Select(outer))
+}
+
 func TestPath_Select_NilQuery(t *testing.T) {
 	path := &Path{query: nil}
 	got := path.Select(map[string]any{"a": 1})
@@ -465,6 +521,21 @@ func BenchmarkSelect_NameSelector(b *testing.B) {
 	}
 }
 
+func BenchmarkSelectAppend_NameSelector(b *testing.B) {
+	input := map[string]any{
+		"a": 1,
+		"b": 2,
+		"c": 3,
+	}
+	path := MustParse("$.b")
+	var buf NodeList
+
+	b.ReportAllocs()
+	for b.Loop() {
+		buf = path.SelectAppend(buf[:0], input)
+	}
+}
+
 func BenchmarkSelect_IndexSelector(b *testing.B) {
 	input := []any{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
 	seg := ast.Child(ast.IndexSelector(5))
@@ -767,11 +838,7 @@ func TestPath_SelectLocated_DescendantSelector(t *testing.T) {
 	path := &Path{query: query}
 	got := path.SelectLocated(input)
 
-	// Build a map of path -> value for easier comparison
-	pathMap := make(map[string]any)
-	for _, node := range got {
-		pathMap[node.Path.String()] = node.Value
-	}
+	pathMap := got.ToMap()
 
 	assert.Len(t, pathMap, 4)
 	assert.Equal(t, 1, pathMap["$['a']"])
@@ -839,6 +906,173 @@ func TestPath_SelectLocated_NilQuery(t *testing.T) {
 	assert.Nil(t, got)
 }
 
+func TestPath_SelectContext(t *testing.T) {
+	input := map[string]any{"a": []any{1.0, 2.0, map[string]any{"b": "x"}}}
+
+	t.Run("live", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		path := MustParse("$..b")
+		got, err := path.SelectContext(ctx, input)
+		require.NoError(t, err)
+		assert.Equal(t, path.Select(input), got)
+
+		located, err := path.SelectLocatedContext(ctx, input)
+		require.NoError(t, err)
+		assert.Equal(t, path.SelectLocated(input), located)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		got, err := MustParse("$.a[0]").SelectContext(ctx, input)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, got)
+
+		located, err := MustParse("$.a[0]").SelectLocatedContext(ctx, input)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, located)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err := MustParse("$..*").SelectContext(ctx, input)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("during_descendant", func(t *testing.T) {
+		// stop cancels the context the first time the filter runs and counts
+		// the nodes it is evaluated on.
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		var calls int
+		stop := newTestFunc("stop", FuncLogical)
+		stop.validateFn = func([]ArgType) error { return nil }
+		stop.callFn = func([]any) any {
+			calls++
+			cancel()
+			return true
+		}
+		p := NewParser(WithFunctions(stop))
+
+		const n = 10 * cancelCheckInterval
+		doc := make([]any, n)
+		for i := range doc {
+			doc[i] = []any{float64(i)}
+		}
+		path := p.MustParse("$..[?stop(@)]")
+
+		got, err := path.SelectContext(ctx, doc)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, got)
+		// The filter ran on every element of the root but on the element of
+		// only some of the nested arrays.
+		assert.Less(t, calls, 2*n)
+
+		calls = 0
+		located, err := path.SelectLocatedContext(ctx, doc)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, located)
+		assert.Zero(t, calls)
+	})
+
+	t.Run("during_filter_sub_query", func(t *testing.T) {
+		// The root filter tests one node, whose sub-query alone visits the
+		// whole document.
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		var calls int
+		stop := newTestFunc("stop", FuncLogical)
+		stop.validateFn = func([]ArgType) error { return nil }
+		stop.callFn = func([]any) any {
+			calls++
+			cancel()
+			return true
+		}
+		p := NewParser(WithFunctions(stop))
+
+		const n = 10 * cancelCheckInterval
+		inner := make([]any, n)
+		for i := range inner {
+			inner[i] = []any{float64(i)}
+		}
+		doc := []any{inner}
+		path := p.MustParse("$[?@..[?stop(@)]]")
+
+		got, err := path.SelectContext(ctx, doc)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, got)
+		assert.Less(t, calls, n)
+	})
+}
+
+func TestPath_SelectAppend(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{"a": []any{1, 2, 3}, "b": "x"}
+
+	t.Run("appends", func(t *testing.T) {
+		t.Parallel()
+		dst := NodeList{"kept"}
+		got := MustParse("$.a[*]").SelectAppend(dst, input)
+		assert.Equal(t, NodeList{"kept", 1, 2, 3}, got)
+		assert.Equal(t, NodeList{"kept"}, dst)
+
+		got = MustParse("$").SelectAppend(got, "root")
+		assert.Equal(t, NodeList{"kept", 1, 2, 3, "root"}, got)
+		assert.Equal(t, NodeList{}, MustParse("$.missing").SelectAppend(nil, input))
+	})
+
+	t.Run("reuses_buffer", func(t *testing.T) {
+		t.Parallel()
+		path := MustParse("$.a[?@ > 1]")
+		buf := make(NodeList, 0, 8)
+		for range 3 {
+			buf = path.SelectAppend(buf[:0], input)
+			assert.Equal(t, NodeList{2, 3}, buf)
+			assert.Equal(t, 8, cap(buf))
+		}
+	})
+
+	t.Run("limits_count_appended_nodes", func(t *testing.T) {
+		t.Parallel()
+		dst := NodeList{0, 0, 0}
+		p := NewParser(WithMaxIntermediateNodes(3)).MustParse("$.a[*]")
+		assert.Equal(t, NodeList{0, 0, 0, 1, 2, 3}, p.SelectAppend(dst, input))
+
+		p = NewParser(WithMaxResults(2)).MustParse("$.a[*]")
+		assert.Equal(t, NodeList{0, 0, 0, 1, 2}, p.SelectAppend(dst, input))
+	})
+
+	t.Run("error_returns_dst", func(t *testing.T) {
+		t.Parallel()
+		dst := NodeList{"kept"}
+		p := NewParser(WithMaxIntermediateNodes(2)).MustParse("$.a[*]")
+		assert.Equal(t, dst, p.SelectAppend(dst, input))
+	})
+
+	t.Run("converts_appended_nodes_only", func(t *testing.T) {
+		t.Parallel()
+		p := NewParser(WithEncodingJSONValues()).MustParse("$.n")
+		got := p.SelectAppend(NodeList{[]int{7}}, map[string]any{"n": []int{8}})
+		assert.Equal(t, NodeList{[]int{7}, []any{8}}, got)
+	})
+
+	t.Run("located", func(t *testing.T) {
+		t.Parallel()
+		dst := MustParse("$.b").SelectLocated(input)
+		got := MustParse("$.a[1,2]").SelectLocatedAppend(dst, input)
+		assert.Equal(t, []string{"/b", "/a/1", "/a/2"}, got.Pointers())
+		assert.Equal(t, []any{"x", 2, 3}, slices.Collect(got.Values()))
+		assert.Len(t, dst, 1)
+
+		p := NewParser(WithMaxIntermediateNodes(1)).MustParse("$.a[*]")
+		assert.Equal(t, dst, p.SelectLocatedAppend(dst, input))
+		assert.Equal(t, LocatedNodeList{}, MustParse("$.missing").SelectLocatedAppend(nil, input))
+	})
+}
+
 func TestLocatedNodeList_Methods(t *testing.T) {
 	list := LocatedNodeList{
 		{Value: 1, Path: NormalizedPath{NameElement("a")}},
@@ -869,6 +1103,302 @@ func TestLocatedNodeList_Methods(t *testing.T) {
 		}
 		assert.Equal(t, []*LocatedNode(list), nodes)
 	})
+
+	t.Run("Enumerate", func(t *testing.T) {
+		var got []string
+		for i, n := range list.Enumerate() {
+			got = append(got, fmt.Sprintf("%d:%s=%v", i, n.Path, n.Value))
+		}
+		assert.Equal(t, []string{"0:$['a']=1", "1:$['b']=2", "2:$[0]=3"}, got)
+	})
+
+	t.Run("Enumerate_break", func(t *testing.T) {
+		var indexes []int
+		for i := range list.Enumerate() {
+			if i == 1 {
+				break
+			}
+			indexes = append(indexes, i)
+		}
+		assert.Equal(t, []int{0}, indexes)
+	})
+}
+
+func TestLocatedNodeList_Pointers(t *testing.T) {
+	doc := map[string]any{
+		"a/b": []any{"x", map[string]any{"~": 1.0}},
+		"c":   []any{},
+	}
+	located := MustParse("$..*").SelectLocated(doc)
+	located.Sort()
+
+	got := located.Pointers()
+	require.Len(t, got, len(located))
+	for i, n := range located {
+		assert.Equal(t, n.Path.Pointer(), got[i])
+	}
+	assert.Equal(t, []string{"/a~1b", "/a~1b/0", "/a~1b/1", "/a~1b/1/~0", "/c"}, got)
+
+	assert.Nil(t, LocatedNodeList(nil).Pointers())
+	assert.Equal(t, []string{""}, MustParse("$").SelectLocated(doc).Pointers())
+}
+
+func TestLocatedNodeList_PathStrings(t *testing.T) {
+	doc := map[string]any{
+		"a'b": []any{"x", map[string]any{"\n\u000b\\": 1.0}},
+		"c":   []any{},
+	}
+	located := MustParse("$..*").SelectLocated(doc)
+	located.Sort()
+
+	got := located.PathStrings()
+	require.Len(t, got, len(located))
+	for i, n := range located {
+		assert.Equal(t, n.Path.String(), got[i])
+	}
+	assert.Equal(t, []string{`$['a\'b']`, `$['a\'b'][0]`, `$['a\'b'][1]`, `$['a\'b'][1]['\n\u000b\\']`, "$['c']"}, got)
+
+	assert.Nil(t, LocatedNodeList(nil).PathStrings())
+	assert.Equal(t, []string{"$"}, MustParse("$").SelectLocated(doc).PathStrings())
+}
+
+func TestPath_SelectPaths_CTS(t *testing.T) {
+	data, err := os.ReadFile("compliance/testdata/cts.json")
+	require.NoError(t, err)
+	var suite struct {
+		Tests []struct {
+			Name        string   `json:"name"`
+			Selector    string   `json:"selector"`
+			Document    any      `json:"document"`
+			ResultPaths []string `json:"result_paths"`
+			Invalid     bool     `json:"invalid_selector"`
+		} `json:"tests"`
+	}
+	require.NoError(t, json.Unmarshal(data, &suite))
+
+	for _, tc := range suite.Tests {
+		if tc.Invalid {
+			continue
+		}
+		t.Run(tc.Name, func(t *testing.T) {
+			p := MustParse(tc.Selector)
+			got, err := p.SelectPaths(tc.Document)
+			require.NoError(t, err)
+
+			// Tests with one expected order have result_paths.
+			if len(tc.ResultPaths) > 0 {
+				assert.Equal(t, tc.ResultPaths, got)
+			} else if tc.ResultPaths != nil {
+				assert.Empty(t, got)
+			}
+
+			// Object members come in map order, so compare sorted lists.
+			var want []string
+			for path := range p.SelectLocated(tc.Document).Paths() {
+				want = append(want, path.String())
+			}
+			slices.Sort(want)
+			slices.Sort(got)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	var p Path
+	got, err := p.SelectPaths(map[string]any{})
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+	got, err = MustParse("$.missing").SelectPaths(map[string]any{})
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestNodeList_Enumerate(t *testing.T) {
+	list := MustParse("$[*]").Select([]any{"a", "b", "c"})
+
+	var indexes []int
+	var values []any
+	for i, v := range list.Enumerate() {
+		indexes = append(indexes, i)
+		values = append(values, v)
+	}
+	assert.Equal(t, []int{0, 1, 2}, indexes)
+	assert.Equal(t, []any{"a", "b", "c"}, values)
+
+	for range NodeList(nil).Enumerate() {
+		t.Fatal("empty list yielded a node")
+	}
+}
+
+func TestNodeList_FirstLastOne(t *testing.T) {
+	t.Parallel()
+
+	input := []any{"a", "b", "c"}
+	for _, tt := range []struct {
+		expr        string
+		first, last any
+		oneErr      error
+	}{
+		{expr: "$[5]", oneErr: ErrNoMatch},
+		{expr: "$[1]", first: "b", last: "b"},
+		{expr: "$[*]", first: "a", last: "c", oneErr: ErrMultipleMatches},
+	} {
+		nodes := MustParse(tt.expr).Select(input)
+		located := MustParse(tt.expr).SelectLocated(input)
+
+		first, ok := nodes.First()
+		assert.Equal(t, tt.first != nil, ok, tt.expr)
+		assert.Equal(t, tt.first, first, tt.expr)
+		last, ok := nodes.Last()
+		assert.Equal(t, tt.last != nil, ok, tt.expr)
+		assert.Equal(t, tt.last, last, tt.expr)
+
+		firstLocated, ok := located.First()
+		assert.Equal(t, tt.first != nil, ok, tt.expr)
+		lastLocated, _ := located.Last()
+		if ok {
+			assert.Equal(t, tt.first, firstLocated.Value, tt.expr)
+			assert.Equal(t, tt.last, lastLocated.Value, tt.expr)
+		} else {
+			assert.Nil(t, firstLocated, tt.expr)
+			assert.Nil(t, lastLocated, tt.expr)
+		}
+
+		one, err := nodes.One()
+		oneLocated, errLocated := located.One()
+		if tt.oneErr != nil {
+			require.ErrorIs(t, err, tt.oneErr, tt.expr)
+			require.ErrorIs(t, errLocated, tt.oneErr, tt.expr)
+			assert.Nil(t, one)
+			assert.Nil(t, oneLocated)
+			continue
+		}
+		require.NoError(t, err, tt.expr)
+		require.NoError(t, errLocated, tt.expr)
+		assert.Equal(t, "b", one)
+		assert.Equal(t, "$[1]", oneLocated.Path.String())
+	}
+}
+
+func TestNodeList_Deduplicate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		list NodeList
+		want NodeList
+	}{
+		{name: "empty", list: NodeList{}, want: NodeList{}},
+		{name: "single", list: NodeList{1.0}, want: NodeList{1.0}},
+		{name: "strings", list: NodeList{"b", "a", "b", "c", "a"}, want: NodeList{"b", "a", "c"}},
+		{name: "numbers_across_types", list: NodeList{1.0, 1, int64(1), uint8(2), 2.0, -0.0, 0}, want: NodeList{1.0, uint8(2), -0.0}},
+		{name: "scalars_of_different_kinds", list: NodeList{"1", 1.0, true, nil, nil, false, true}, want: NodeList{"1", 1.0, true, nil, false}},
+		{
+			name: "arrays_and_objects",
+			list: NodeList{
+				[]any{1.0, map[string]any{"a": "x"}},
+				map[string]any{"a": []any{1.0}},
+				[]any{1, map[string]any{"a": "x"}},
+				map[string]any{"a": []any{int64(1)}},
+				map[string]any{"a": []any{1.0}, "b": nil},
+				[]any{},
+			},
+			want: NodeList{
+				[]any{1.0, map[string]any{"a": "x"}},
+				map[string]any{"a": []any{1.0}},
+				map[string]any{"a": []any{1.0}, "b": nil},
+				[]any{},
+			},
+		},
+		{name: "sparse_arrays", list: NodeList{map[int]any{0: "a"}, map[int]any{0: "a"}, map[int]any{1: "a"}}, want: NodeList{map[int]any{0: "a"}, map[int]any{1: "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, tt.list.Deduplicate())
+		})
+	}
+
+	t.Run("nan", func(t *testing.T) {
+		t.Parallel()
+		// NaN equals nothing, not even itself, as in filter comparisons.
+		assert.Len(t, NodeList{math.NaN(), math.NaN()}.Deduplicate(), 2)
+	})
+
+	t.Run("from_select", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"book": []any{
+			map[string]any{"price": 8.95}, map[string]any{"price": 12.99}, map[string]any{"price": 8.95},
+		}}
+		assert.Equal(t, NodeList{8.95, 12.99}, MustParse("$..price").Select(doc).Deduplicate())
+	})
+
+	t.Run("clears_tail", func(t *testing.T) {
+		t.Parallel()
+		list := NodeList{"a", "a", "b", "a"}
+		got := list.Deduplicate()
+		assert.Equal(t, NodeList{"a", "b"}, got)
+		assert.Equal(t, NodeList{"a", "b", nil, nil}, list)
+		assert.Equal(t, len(got), cap(got))
+	})
+}
+
+func TestNodeList_Typed(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"authors": []any{"Nigel Rees", "Evelyn Waugh"},
+		"prices":  []any{8.95, 12.99, 8.0},
+		"counts":  []any{1.0, -2.0, 3, int64(4), uint8(5)},
+		"flags":   []any{true, false},
+	}
+
+	strs, err := MustParse("$.authors[*]").Select(doc).Strings()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Nigel Rees", "Evelyn Waugh"}, strs)
+
+	floats, err := MustParse("$.prices[*]").Select(doc).Floats()
+	require.NoError(t, err)
+	assert.Equal(t, []float64{8.95, 12.99, 8}, floats)
+
+	floats, err = MustParse("$.counts[*]").Select(doc).Floats()
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, -2, 3, 4, 5}, floats)
+
+	ints, err := MustParse("$.counts[*]").Select(doc).Ints()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, -2, 3, 4, 5}, ints)
+
+	bools, err := MustParse("$.flags[*]").Select(doc).Bools()
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, bools)
+
+	empty, err := NodeList(nil).Strings()
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	tests := []struct {
+		name string
+		conv func(NodeList) error
+		list NodeList
+		msg  string
+	}{
+		{"string", func(l NodeList) error { _, err := l.Strings(); return err }, NodeList{"a", 1.5}, "node 1 is float64 1.5, not a string"},
+		{"float", func(l NodeList) error { _, err := l.Floats(); return err }, NodeList{1.0, "2"}, "node 1 is string, not a number"},
+		{"float_nil", func(l NodeList) error { _, err := l.Floats(); return err }, NodeList{nil}, "node 0 is <nil>, not a number"},
+		{"fractional", func(l NodeList) error { _, err := l.Ints(); return err }, NodeList{1.0, 8.95}, "node 1 is float64 8.95, not an int"},
+		{"int_overflow", func(l NodeList) error { _, err := l.Ints(); return err }, NodeList{1e300}, "node 0 is float64 1e+300, not an int"},
+		{"uint_overflow", func(l NodeList) error { _, err := l.Ints(); return err }, NodeList{uint64(1 << 63)}, "node 0 is uint64, not an int"},
+		{"int_object", func(l NodeList) error { _, err := l.Ints(); return err }, NodeList{map[string]any{}}, "node 0 is map[string]interface {}, not an int"},
+		{"bool", func(l NodeList) error { _, err := l.Bools(); return err }, NodeList{"true"}, "node 0 is string, not a bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.conv(tt.list)
+			require.ErrorIs(t, err, ErrNodeType)
+			assert.Contains(t, err.Error(), tt.msg)
+		})
+	}
 }
 
 func TestLocatedNodeList_Deduplicate(t *testing.T) {
@@ -962,7 +1492,16 @@ func TestLocatedNodeList_Deduplicate(t *testing.T) {
 			t.Parallel()
 			a := assert.New(t)
 
-			got := tc.list.Deduplicate()
+			// Deduplicated leaves the list as it was.
+			before := slices.Clone(tc.list)
+			got := tc.list.Deduplicated()
+			a.Equal(before, tc.list)
+			a.Equal(tc.exp, got)
+			if len(got) > 0 {
+				a.NotSame(&tc.list[0], &got[0])
+			}
+
+			got = tc.list.Deduplicate()
 			a.Equal(len(tc.exp), len(got))
 			for i := range tc.exp {
 				a.Equal(tc.exp[i].Value, got[i].Value)
@@ -972,6 +1511,59 @@ func TestLocatedNodeList_Deduplicate(t *testing.T) {
 	}
 }
 
+func TestLocatedNodeList_Clone(t *testing.T) {
+	t.Parallel()
+
+	obj := map[string]any{"k": 1.0}
+	list := MustParse("$..*").SelectLocated(map[string]any{"a": []any{obj}})
+	clone := list.Clone()
+	assert.Equal(t, list, clone)
+	for i := range list {
+		assert.NotSame(t, list[i], clone[i])
+	}
+
+	// Paths are copied, values are shared.
+	clone[1].Path[0] = NameElement("b")
+	assert.Equal(t, "$['a'][0]", list[1].Path.String())
+	clone[1].Value.(map[string]any)["k"] = 2.0
+	assert.Equal(t, 2.0, obj["k"])
+
+	assert.Nil(t, LocatedNodeList(nil).Clone())
+	assert.Equal(t, LocatedNodeList{nil}, LocatedNodeList{nil}.Clone())
+}
+
+func TestLocatedNodeList_ToMap(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{"a/b": []any{"x", "y"}, "c~": true}
+	list := MustParse("$..*").SelectLocated(input)
+	list.Sort()
+
+	assert.Equal(t, map[string]any{
+		"$['a/b']":    []any{"x", "y"},
+		"$['a/b'][0]": "x",
+		"$['a/b'][1]": "y",
+		"$['c~']":     true,
+	}, list.ToMap())
+	assert.Equal(t, map[string]any{
+		"/a~1b":   []any{"x", "y"},
+		"/a~1b/0": "x",
+		"/a~1b/1": "y",
+		"/c~0":    true,
+	}, list.ToPointerMap())
+
+	// The last node at a path wins.
+	dup := LocatedNodeList{
+		{Path: NormalizedPath{IndexElement(0)}, Value: 1},
+		{Path: NormalizedPath{IndexElement(0)}, Value: 2},
+	}
+	assert.Equal(t, map[string]any{"$[0]": 2}, dup.ToMap())
+	assert.Equal(t, map[string]any{"/0": 2}, dup.ToPointerMap())
+
+	assert.Empty(t, LocatedNodeList(nil).ToMap())
+	assert.Empty(t, LocatedNodeList(nil).ToPointerMap())
+}
+
 func TestLocatedNodeList_Sort(t *testing.T) {
 	t.Parallel()
 
@@ -1093,6 +1685,110 @@ func TestLocatedNodeList_Sort(t *testing.T) {
 	}
 }
 
+func TestLocatedNodeList_Sort_Stable(t *testing.T) {
+	t.Parallel()
+
+	list := MustParse("$[1,0,0,1]").SelectLocated([]any{"x", "y"})
+	for i, n := range list {
+		n.Value = i
+	}
+	list.Sort()
+	assert.Equal(t, []any{1, 2, 0, 3}, slices.Collect(list.Values()))
+
+	// Enough equal paths that an unstable sort would reorder them.
+	list = make(LocatedNodeList, 100)
+	for i := range list {
+		list[i] = &LocatedNode{Value: i, Path: NormalizedPath{IndexElement(i % 3)}}
+	}
+	list.Sort()
+	for i := 1; i < len(list); i++ {
+		prev, cur := list[i-1], list[i]
+		if prev.Path.Compare(cur.Path) == 0 {
+			assert.Less(t, prev.Value, cur.Value)
+		}
+	}
+}
+
+func TestLocatedNodeList_SortFunc(t *testing.T) {
+	t.Parallel()
+
+	list := MustParse("$..*").SelectLocated(map[string]any{"a": []any{3, 1}, "b": 2})
+
+	t.Run("reverse_path", func(t *testing.T) {
+		t.Parallel()
+		l := list.Clone()
+		l.SortFunc(func(a, b *LocatedNode) int { return b.Path.Compare(a.Path) })
+		assert.Equal(t, []string{"/b", "/a/1", "/a/0", "/a"}, l.Pointers())
+	})
+
+	t.Run("by_depth", func(t *testing.T) {
+		t.Parallel()
+		l := list.Clone()
+		l.Sort()
+		l.SortFunc(func(a, b *LocatedNode) int { return len(a.Path) - len(b.Path) })
+		// Stable, so path order is kept within each depth.
+		assert.Equal(t, []string{"/a", "/b", "/a/0", "/a/1"}, l.Pointers())
+	})
+
+	t.Run("by_value", func(t *testing.T) {
+		t.Parallel()
+		var l LocatedNodeList
+		for _, n := range list {
+			if _, ok := n.Value.(int); ok {
+				l = append(l, n)
+			}
+		}
+		l.SortFunc(func(a, b *LocatedNode) int { return a.Value.(int) - b.Value.(int) })
+		assert.Equal(t, []any{1, 2, 3}, slices.Collect(l.Values()))
+	})
+}
+
+func TestSelectLocated_DescendantPaths(t *testing.T) {
+	t.Parallel()
+
+	var input any = map[string]any{"leaf": 0, "sparse": map[int]any{3: "s"}}
+	for i := range 40 {
+		input = map[string]any{"next": input, "leaf": i + 1, "list": []any{i, []any{i}}}
+	}
+
+	for _, expr := range []string{"$..leaf", "$..*", "$..list[*]", "$.next..next..leaf", "$..[?@ == 3]", "$..sparse[3]"} {
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+			got := MustParse(expr).SelectLocated(input)
+			require.NotEmpty(t, got)
+			want := got.Clone()
+
+			for i, n := range got {
+				// Every path leads to its value.
+				v, ok := n.Path.Resolve(input)
+				require.True(t, ok, n.Path.String())
+				assertSameNode(t, n.Value, v)
+
+				// No path shares elements with another.
+				last := len(n.Path) - 1
+				n.Path[last] = NameElement("changed")
+				for j, m := range got {
+					if j != i && !slices.Equal(want[j].Path, m.Path) {
+						t.Fatalf("changing %s changed %s", want[i].Path, want[j].Path)
+					}
+				}
+				n.Path[last] = want[i].Path[last]
+			}
+
+			// Walking the nodes one at a time finds the same paths. Members
+			// come in map order, so compare sorted lists.
+			want.Sort()
+			walked := NewParser(WithMaxResults(1 << 20)).MustParse(expr).SelectLocated(input)
+			walked.Sort()
+			assert.Equal(t, want, walked)
+			reversed := NewParser(WithReverseOrder()).MustParse(expr).SelectLocated(input)
+			reversed.Sort()
+			assert.Equal(t, want, reversed)
+			assert.Contains(t, want, MustParse(expr).SelectFirstLocated(input))
+		})
+	}
+}
+
 func BenchmarkSelectLocated_NameSelector(b *testing.B) {
 	input := map[string]any{
 		"a": 1,
@@ -1109,6 +1805,116 @@ func BenchmarkSelectLocated_NameSelector(b *testing.B) {
 	}
 }
 
+func BenchmarkLocatedNodeList_Deduplicated(b *testing.B) {
+	input := make([]any, 2000)
+	for i := range input {
+		input[i] = map[string]any{"id": i, "name": "n", "tags": []any{"a", "b", "c"}}
+	}
+	// Every node is selected twice.
+	located := MustParse("$..*").SelectLocated(input)
+	located = append(located, MustParse("$..*").SelectLocated(input)...)
+
+	for b.Loop() {
+		_ = located.Deduplicated()
+	}
+}
+
+func BenchmarkLocatedNodeList_Pointers(b *testing.B) {
+	input := make([]any, 200)
+	for i := range input {
+		input[i] = map[string]any{"id": i, "tags": []any{"a", "b"}}
+	}
+	located := MustParse("$..*").SelectLocated(input)
+
+	b.Run("Pointer", func(b *testing.B) {
+		for b.Loop() {
+			out := make([]string, len(located))
+			for i, n := range located {
+				out[i] = n.Path.Pointer()
+			}
+		}
+	})
+	b.Run("Pointers", func(b *testing.B) {
+		for b.Loop() {
+			_ = located.Pointers()
+		}
+	})
+}
+
+func TestSelectLocated_NameElements(t *testing.T) {
+	t.Parallel()
+
+	// axb and ayb share a name cache slot.
+	doc := map[string]any{"axb": map[string]any{"ayb": 1}, "ayb": map[string]any{"axb": 2}}
+	got := MustParse("$..*").SelectLocated(doc)
+	got.Sort()
+	assert.Equal(t, []string{"$['axb']", "$['axb']['ayb']", "$['ayb']", "$['ayb']['axb']"}, got.PathStrings())
+	for _, n := range got {
+		v, ok := n.Path.Resolve(doc)
+		require.True(t, ok)
+		assertSameNode(t, n.Value, v)
+	}
+}
+
+func TestSelectLocated_NameElements_Allocs(t *testing.T) {
+	input := func(n int) any {
+		items := make([]any, n)
+		for i := range items {
+			items[i] = map[string]any{"name": "n"}
+		}
+		return map[string]any{"items": items}
+	}
+	small, large := input(100), input(200)
+	path := MustParse("$.items[*].name")
+	perItem := (testing.AllocsPerRun(20, func() { _ = path.SelectLocated(large) }) -
+		testing.AllocsPerRun(20, func() { _ = path.SelectLocated(small) })) / 100
+
+	// Each item costs a node and a path for $.items[i] and for
+	// $.items[i].name, and nothing for the names.
+	assert.InDelta(t, 4, perItem, 0.1)
+}
+
+func BenchmarkSelectLocated_NameElements(b *testing.B) {
+	items := make([]any, 10_000)
+	for i := range items {
+		items[i] = map[string]any{"name": "n", "id": i}
+	}
+	input := map[string]any{"items": items}
+
+	for _, expr := range []string{"$.items[*].name", "$.items[*].*", "$..name"} {
+		path := MustParse(expr)
+		nodes := len(path.SelectLocated(input))
+		b.Run(expr, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			for b.Loop() {
+				_ = path.SelectLocated(input)
+			}
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N*nodes), "B/node")
+			b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N*nodes), "allocs/node")
+		})
+	}
+}
+
+func BenchmarkSelectLocated_DeepDocument(b *testing.B) {
+	// A chain 64 levels deep, with a leaf and a short array at every level.
+	var input any = map[string]any{"leaf": 0}
+	for i := range 64 {
+		input = map[string]any{"next": input, "leaf": i, "list": []any{i, i}}
+	}
+
+	for _, expr := range []string{"$..leaf", "$..*", "$..list[0]", "$.next.next..leaf"} {
+		path := MustParse(expr)
+		b.Run(expr, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				_ = path.SelectLocated(input)
+			}
+		})
+	}
+}
+
 func BenchmarkSelectLocated_ComplexPath(b *testing.B) {
 	input := map[string]any{
 		"store": map[string]any{
@@ -1201,21 +2007,72 @@ func TestQueryJSON(t *testing.T) {
 	}
 }
 
-func TestQueryJSONLocated(t *testing.T) {
+func TestQuery(t *testing.T) {
+	input := map[string]any{"a": []any{1.0, 2.0, map[string]any{"b": "x"}}}
 	tests := []struct {
-		name    string
-		json    string
-		path    string
-		want    []*LocatedNode
-		wantErr bool
+		name string
+		expr string
+		want NodeList
+		path string
 	}{
-		{
-			name: "simple name selector",
-			json: `{"a": 1, "b": 2}`,
-			path: "$.a",
-			want: []*LocatedNode{
-				{Value: float64(1), Path: NormalizedPath{NameElement("a")}},
-			},
+		{name: "index", expr: "$.a[1]", want: NodeList{2.0}, path: "$['a'][1]"},
+		{name: "filter", expr: "$.a[?@.b == 'x'].b", want: NodeList{"x"}, path: "$['a'][2]['b']"},
+		{name: "function", expr: "$[?length(@) == 3]", want: NodeList{input["a"]}, path: "$['a']"},
+		{name: "empty_result", expr: "$.missing", want: NodeList{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Query(tt.expr, input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			located, err := QueryLocated(tt.expr, input)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.want), len(located))
+			if tt.path != "" {
+				assert.Equal(t, tt.path, located[0].Path.String())
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "a", "$[", "$.a[?@ ==]", "$[?unknown(@)]"} {
+		t.Run("invalid/"+expr, func(t *testing.T) {
+			got, err := Query(expr, input)
+			require.ErrorIs(t, err, ErrPathParse)
+			assert.Nil(t, got)
+			located, err := QueryLocated(expr, input)
+			require.ErrorIs(t, err, ErrPathParse)
+			assert.Nil(t, located)
+		})
+	}
+}
+
+func TestParser_BuiltinFuncsShared(t *testing.T) {
+	// Parsers without extension functions share one built-in registry.
+	assert.Equal(t, reflect.ValueOf(builtinFuncs).Pointer(), reflect.ValueOf(NewParser().funcs()).Pointer())
+
+	// Registering a function never writes to the shared registry.
+	funcs := NewParser(WithFunctions(newUpperFunc())).funcs()
+	assert.Contains(t, funcs, "upper")
+	assert.Contains(t, funcs, "length")
+	assert.NotContains(t, builtinFuncs, "upper")
+}
+
+func TestQueryJSONLocated(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		path    string
+		want    []*LocatedNode
+		wantErr bool
+	}{
+		{
+			name: "simple name selector",
+			json: `{"a": 1, "b": 2}`,
+			path: "$.a",
+			want: []*LocatedNode{
+				{Value: float64(1), Path: NormalizedPath{NameElement("a")}},
+			},
 		},
 		{
 			name: "array index selector",
@@ -1777,6 +2634,16 @@ func TestValid(t *testing.T) {
 			expr:  "store.book",
 			valid: false,
 		},
+		{
+			name:  "invalid relative root",
+			expr:  "@.a",
+			valid: false,
+		},
+		{
+			name:  "valid relative query in filter",
+			expr:  "$[?@.a]",
+			valid: true,
+		},
 		{
 			name:  "invalid syntax",
 			expr:  "$[",
@@ -1802,6 +2669,45 @@ func TestValid(t *testing.T) {
 	}
 }
 
+func TestValidateExpr(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		pos  int
+		msg  string
+	}{
+		{name: "valid simple path", expr: "$.store.book"},
+		{name: "valid array index", expr: "$[0]"},
+		{name: "valid wildcard", expr: "$[*]"},
+		{name: "valid slice", expr: "$[0:5:2]"},
+		{name: "valid descendant", expr: "$..book"},
+		{name: "invalid missing root", expr: "store.book", pos: 0, msg: "expected $"},
+		{name: "invalid relative root", expr: "@.a", pos: 0, msg: "@ is only allowed in filter expressions; expected $"},
+		{name: "valid relative query in filter", expr: "$[?@.a]"},
+		{name: "invalid syntax", expr: "$[", pos: 2, msg: "expected selector"},
+		{name: "invalid empty", expr: "", pos: 0, msg: "expected $"},
+		{name: "valid complex path", expr: "$.store.book[*].author"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateExpr(tt.expr)
+			assert.Equal(t, err == nil, Valid(tt.expr))
+			if tt.msg == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrPathParse)
+			var pe *ParseError
+			require.ErrorAs(t, err, &pe)
+			assert.Equal(t, tt.pos, pe.Pos)
+			assert.Equal(t, tt.msg, pe.Msg)
+			_, parseErr := Parse(tt.expr)
+			assert.Equal(t, parseErr.Error(), err.Error())
+		})
+	}
+}
+
 func TestQueryJSON_ErrUnmarshal(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1859,3 +2765,914 @@ func TestQueryJSONLocated_ErrUnmarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestWithReverseOrder(t *testing.T) {
+	input := []any{
+		[]any{1, 2, 3},
+		map[string]any{"a": []any{4, 5}},
+		[]any{[]any{6}, 7},
+		8,
+	}
+	forward := NewParser()
+	backward := NewParser(WithReverseOrder())
+
+	for _, expr := range []string{
+		"$",
+		"$[*]",
+		"$[0][*]",
+		"$[0,2,0]",
+		"$[1:3]",
+		"$[::-1]",
+		"$[-1:0:-2]",
+		"$..*",
+		"$..[0]",
+		"$..a[*]",
+		"$[?@[0]]",
+		"$[*][*]",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			want := forward.MustParse(expr).Select(input)
+			slices.Reverse(want)
+			got := backward.MustParse(expr).Select(input)
+			assert.Equal(t, want, got)
+
+			wantLocated := forward.MustParse(expr).SelectLocated(input)
+			slices.Reverse(wantLocated)
+			gotLocated := backward.MustParse(expr).SelectLocated(input)
+			assert.Equal(t, wantLocated, gotLocated)
+		})
+	}
+}
+
+func TestWithReverseOrder_Slices(t *testing.T) {
+	input := []any{0, 1, 2, 3, 4}
+	p := NewParser(WithReverseOrder())
+
+	tests := []struct {
+		expr string
+		want []any
+	}{
+		{"$[1:4]", []any{3, 2, 1}},
+		{"$[::2]", []any{4, 2, 0}},
+		{"$[::-1]", []any{0, 1, 2, 3, 4}},
+		{"$[3:0:-2]", []any{1, 3}},
+		{"$[0,1,1:3]", []any{2, 1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			assert.Equal(t, tt.want, []any(p.MustParse(tt.expr).Select(input)))
+		})
+	}
+}
+
+func TestLocatedNodeList_Query(t *testing.T) {
+	input := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"title": "A", "price": 8.95},
+				map[string]any{"title": "B", "price": 12.99, "isbn": "x"},
+				map[string]any{"title": "C"},
+			},
+		},
+		"limit": 10.0,
+	}
+	books := MustParse("$.store.book[*]").SelectLocated(input)
+	require.Len(t, books, 3)
+
+	t.Run("prefixes paths", func(t *testing.T) {
+		got, err := books.Query(MustParseRelative("@.price"))
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, 8.95, got[0].Value)
+		assert.Equal(t, "$['store']['book'][0]['price']", got[0].Path.String())
+		assert.Equal(t, 12.99, got[1].Value)
+		assert.Equal(t, "$['store']['book'][1]['price']", got[1].Path.String())
+	})
+
+	t.Run("bare current node", func(t *testing.T) {
+		got, err := books.Query(MustParseRelative("@"))
+		require.NoError(t, err)
+		assert.Equal(t, books, got)
+		got[0].Path[0] = NameElement("changed")
+		assert.Equal(t, NameElement("store"), books[0].Path[0], "result paths must not alias the input")
+	})
+
+	t.Run("filter root is node value", func(t *testing.T) {
+		got, err := books.Query(MustParseRelative("@[?$.isbn]"))
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		for _, n := range got {
+			assert.Equal(t, "$['store']['book'][1]", n.Path[:3].String())
+		}
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		got, err := LocatedNodeList(nil).Query(MustParseRelative("@.a"))
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("rooted query", func(t *testing.T) {
+		_, err := books.Query(MustParse("$.price"))
+		require.ErrorIs(t, err, ErrRootedQuery)
+	})
+
+	t.Run("rooted query as relative", func(t *testing.T) {
+		got, err := books.QueryAsRelative(MustParse("$.price"))
+		require.NoError(t, err)
+		want, err := books.Query(MustParseRelative("@.price"))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		got, err = books.QueryAsRelative(MustParse("$[?@ == $.title]"))
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		assert.Equal(t, "$['store']['book'][2]['title']", got[2].Path.String())
+
+		got, err = books.QueryAsRelative(MustParseRelative("@.title"))
+		require.NoError(t, err)
+		assert.Len(t, got, 3)
+	})
+}
+
+func TestLocatedNode_Select(t *testing.T) {
+	input := map[string]any{
+		"it's/~": map[string]any{
+			"a b": []any{1.0, map[string]any{"\n": 2.0}},
+		},
+	}
+	located := MustParse("$[\"it's/~\"]").SelectLocated(input)
+	require.Len(t, located, 1)
+	node := located[0]
+
+	got, err := node.Select(MustParseRelative("@..*"))
+	require.NoError(t, err)
+	var paths, pointers []string
+	for _, n := range got {
+		paths = append(paths, n.Path.String())
+		pointers = append(pointers, n.Path.Pointer())
+	}
+	assert.Equal(t, []string{
+		`$['it\'s/~']['a b']`,
+		`$['it\'s/~']['a b'][0]`,
+		`$['it\'s/~']['a b'][1]`,
+		`$['it\'s/~']['a b'][1]['\n']`,
+	}, paths)
+	assert.Equal(t, []string{"/it's~1~0/a b", "/it's~1~0/a b/0", "/it's~1~0/a b/1", "/it's~1~0/a b/1/\n"}, pointers)
+
+	// Absolute paths resolve against the original document.
+	for _, n := range got {
+		direct := MustParse(n.Path.String()).Select(input)
+		require.Len(t, direct, 1)
+		assert.Equal(t, n.Value, direct[0])
+	}
+
+	values, err := node.SelectValues(MustParseRelative("@..[?@ > 0]"))
+	require.NoError(t, err)
+	assert.Equal(t, NodeList{1.0, 2.0}, values)
+	values, err = node.SelectValues(MustParseRelative("@[?$['a b']]"))
+	require.NoError(t, err)
+	assert.Equal(t, NodeList{[]any{1.0, map[string]any{"\n": 2.0}}}, values)
+
+	got[0].Path[0] = NameElement("changed")
+	assert.Equal(t, NameElement("it's/~"), node.Path[0], "result paths must not alias the node")
+
+	t.Run("rooted query", func(t *testing.T) {
+		located, err := node.Select(MustParse("$.x"))
+		require.ErrorIs(t, err, ErrRootedQuery)
+		assert.Nil(t, located)
+		values, err := node.SelectValues(MustParse("$"))
+		require.ErrorIs(t, err, ErrRootedQuery)
+		assert.Nil(t, values)
+	})
+
+	t.Run("too many nodes", func(t *testing.T) {
+		p, err := NewParser(WithMaxIntermediateNodes(1)).ParseRelative("@..*")
+		require.NoError(t, err)
+		_, err = node.Select(p)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+		_, err = node.SelectValues(p)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+	})
+}
+
+func TestWithMemberResolver(t *testing.T) {
+	var calls []string
+	resolve := func(obj map[string]any, name string) (any, bool) {
+		calls = append(calls, name)
+		if name != "size" {
+			return nil, false
+		}
+		return float64(len(obj)), true
+	}
+	p := NewParser(WithMemberResolver(resolve))
+	input := map[string]any{
+		"items": []any{
+			map[string]any{"a": 1.0},
+			map[string]any{"a": 1.0, "b": 2.0, "size": "real"},
+			map[string]any{"a": 1.0, "b": 2.0, "c": 3.0},
+		},
+	}
+
+	t.Run("name selector", func(t *testing.T) {
+		calls = nil
+		got := p.MustParse("$.items[*].size").Select(input)
+		assert.Equal(t, NodeList{1.0, "real", 3.0}, got)
+		assert.Equal(t, []string{"size", "size"}, calls, "existing members must not reach the resolver")
+	})
+
+	t.Run("located path uses requested name", func(t *testing.T) {
+		got := p.MustParse("$.items[0].size").SelectLocated(input)
+		require.Len(t, got, 1)
+		assert.Equal(t, "$['items'][0]['size']", got[0].Path.String())
+	})
+
+	t.Run("filter query", func(t *testing.T) {
+		got := p.MustParse("$.items[?@.size > 2]").Select(input)
+		require.Len(t, got, 1)
+		assert.Equal(t, input["items"].([]any)[2], got[0])
+	})
+
+	t.Run("unresolved name", func(t *testing.T) {
+		assert.Empty(t, p.MustParse("$.items[*].missing").Select(input))
+	})
+
+	t.Run("not enumerated", func(t *testing.T) {
+		assert.Len(t, p.MustParse("$.items[0].*").Select(input), 1)
+	})
+
+	t.Run("default parser", func(t *testing.T) {
+		assert.Equal(t, NodeList{"real"}, MustParse("$.items[*].size").Select(input))
+	})
+}
+
+func TestWithCaseInsensitiveNames(t *testing.T) {
+	p := NewParser(WithCaseInsensitiveNames())
+	input := map[string]any{
+		"headers": map[string]any{"Content-Type": "a", "content-type": "b", "Accept": "c"},
+		"items": []any{
+			map[string]any{"ID": 1.0},
+			map[string]any{"id": 2.0},
+			map[string]any{"Id": 3.0, "iD": 4.0},
+		},
+	}
+
+	t.Run("name selector", func(t *testing.T) {
+		got := p.MustParse("$.headers['CONTENT-TYPE']").Select(input)
+		assert.ElementsMatch(t, NodeList{"a", "b"}, got)
+		assert.Equal(t, NodeList{"c"}, p.MustParse("$.headers.accept").Select(input))
+		assert.Empty(t, MustParse("$.headers.accept").Select(input))
+	})
+
+	t.Run("located path uses actual key", func(t *testing.T) {
+		got := p.MustParse("$.headers['content-type']").SelectLocated(input)
+		var paths []string
+		for _, n := range got {
+			paths = append(paths, n.Path.String())
+		}
+		assert.ElementsMatch(t, []string{"$['headers']['Content-Type']", "$['headers']['content-type']"}, paths)
+	})
+
+	t.Run("singular query", func(t *testing.T) {
+		path := p.MustParse("$.headers['content-type']")
+		assert.Equal(t, 2, path.Count(input))
+		assert.True(t, path.Exists(input))
+		_, err := path.SelectOne(input)
+		require.ErrorIs(t, err, ErrMultipleMatches)
+		v, err := p.MustParse("$.HEADERS.ACCEPT").SelectOne(input)
+		require.NoError(t, err)
+		assert.Equal(t, "c", v)
+	})
+
+	t.Run("union and descendants", func(t *testing.T) {
+		assert.Equal(t, NodeList{1.0, 2.0}, p.MustParse("$.items[0,1].id").Select(input))
+		assert.ElementsMatch(t, NodeList{1.0, 2.0, 3.0, 4.0}, p.MustParse("$..id").Select(input))
+	})
+
+	t.Run("filter query", func(t *testing.T) {
+		got := p.MustParse("$.items[?@.id > 1]").Select(input)
+		assert.Equal(t, NodeList{input["items"].([]any)[1]}, got)
+		assert.Len(t, p.MustParse("$.items[?@.id]").Select(input), 3)
+	})
+
+	t.Run("resolver fallback", func(t *testing.T) {
+		resolve := func(obj map[string]any, name string) (any, bool) { return name, true }
+		p := NewParser(WithCaseInsensitiveNames(), WithMemberResolver(resolve))
+		assert.Equal(t, NodeList{"c"}, p.MustParse("$.headers.ACCEPT").Select(input))
+		got := p.MustParse("$.headers.missing").SelectLocated(input)
+		require.Len(t, got, 1)
+		assert.Equal(t, "$['headers']['missing']", got[0].Path.String())
+	})
+}
+
+func TestSelect_NilDocument(t *testing.T) {
+	tests := []struct {
+		expr string
+		want NodeList
+	}{
+		{"$", NodeList{nil}},
+		{"$.a", NodeList{}},
+		{"$[0]", NodeList{}},
+		{"$[*]", NodeList{}},
+		{"$[0:2]", NodeList{}},
+		{"$..*", NodeList{}},
+		{"$..a", NodeList{}},
+		{"$[?@ == null]", NodeList{}},
+		{"$[?$ == null]", NodeList{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p := MustParse(tt.expr)
+			assert.Equal(t, tt.want, p.Select(nil))
+
+			located := p.SelectLocated(nil)
+			require.Len(t, located, len(tt.want))
+			for i, n := range located {
+				assert.Nil(t, n.Value)
+				assert.Equal(t, "$", n.Path.String(), "node %d", i)
+				assert.Empty(t, n.Path.Pointer())
+			}
+
+			got, err := QueryJSON([]byte("null"), p)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			gotLocated, err := QueryJSONLocated([]byte("null"), p)
+			require.NoError(t, err)
+			assert.Equal(t, located, gotLocated)
+		})
+	}
+}
+
+func TestSelect_NilRootInFilter(t *testing.T) {
+	// $ inside a filter refers to the nil root of a refined query.
+	nodes := MustParse("$.a").SelectLocated(map[string]any{"a": []any{nil, 1.0}})
+	require.Len(t, nodes, 1)
+
+	got, err := nodes.Query(MustParseRelative("@[?@ == null]"))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Nil(t, got[0].Value)
+	assert.Equal(t, "$['a'][0]", got[0].Path.String())
+
+	nulls := MustParse("$[0]").SelectLocated([]any{nil})
+	got, err = nulls.Query(MustParseRelative("@[?$ == null]"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	exists := MustParse("$[?$.x == null]").Select([]any{nil, 2.0})
+	assert.Empty(t, exists, "$.x selects nothing, which is not null")
+}
+
+func TestSelectLocated_ExoticKeys(t *testing.T) {
+	keys := []string{
+		"\x00",
+		"a\x00b",
+		"\x01\x10\x1f",
+		"\x7f",
+		"'\"\\",
+		"\b\f\n\r\t",
+		"/~01",
+		" é😀",
+		"",
+	}
+	doc := make(map[string]any, len(keys))
+	for i, k := range keys {
+		doc[k] = map[string]any{k: float64(i)}
+	}
+
+	decodePointer := func(ptr string) []string {
+		var tokens []string
+		for tok := range strings.SplitSeq(ptr, "/") {
+			tok = strings.ReplaceAll(tok, "~1", "/")
+			tokens = append(tokens, strings.ReplaceAll(tok, "~0", "~"))
+		}
+		return tokens[1:]
+	}
+
+	located := MustParse("$.*.*").SelectLocated(doc)
+	require.Len(t, located, len(keys))
+	for _, n := range located {
+		key := string(n.Path[0].(NameElement))
+		t.Run(strconv.Quote(key), func(t *testing.T) {
+			assert.Equal(t, n.Path[0], n.Path[1])
+
+			// The normalized path parses back and selects the same node.
+			text, err := n.Path.MarshalText()
+			require.NoError(t, err)
+			p, err := Parse(string(text))
+			require.NoError(t, err)
+			assert.Equal(t, NodeList{n.Value}, p.Select(doc))
+			assert.Equal(t, text, []byte(n.Path.String()))
+
+			// The path's own rendering also parses back.
+			again, err := Parse(p.String())
+			require.NoError(t, err)
+			assert.Equal(t, NodeList{n.Value}, again.Select(doc))
+
+			assert.Equal(t, []string{key, key}, decodePointer(n.Path.Pointer()))
+		})
+	}
+}
+
+func TestSelectLocated_InvalidUTF8Key(t *testing.T) {
+	key := "a\xffb"
+	doc := map[string]any{key: 1.0}
+
+	located := MustParse("$.*").SelectLocated(doc)
+	require.Len(t, located, 1)
+	assert.Equal(t, NameElement(key), located[0].Path[0])
+	assert.Equal(t, "/"+key, located[0].Path.Pointer())
+
+	_, err := located[0].Path.MarshalText()
+	require.ErrorIs(t, err, ErrInvalidPath)
+
+	_, err = Parse("$['" + key + "']")
+	require.ErrorIs(t, err, ErrLex)
+	_, err = Parse("$." + key)
+	require.ErrorIs(t, err, ErrLex)
+}
+
+// mustParseAny parses expr with MustParseRelative if it starts with @, and
+// with MustParse otherwise.
+func mustParseAny(expr string) *Path {
+	if strings.HasPrefix(expr, "@") {
+		return MustParseRelative(expr)
+	}
+	return MustParse(expr)
+}
+
+func TestPath_Rebase(t *testing.T) {
+	input := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"price": 8.95, "tags": []any{"a"}},
+				map[string]any{"price": 12.99},
+			},
+			"limit": 10.0,
+		},
+	}
+
+	tests := []struct {
+		path   string
+		prefix string
+		want   string
+	}{
+		{"$.store.book[*].price", "$.store.book", `@[*]["price"]`},
+		{"$.store.book[*].price", "$", `@["store"]["book"][*]["price"]`},
+		{"$.store.book[*].price", "$.store.book[*].price", "@"},
+		{"$..book[0:1].tags", "$..book[0:1]", `@["tags"]`},
+		{"$['a','b'][1]", "$['a','b']", "@[1]"},
+		{"@.a.b", "@.a", `@["b"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" from "+tt.prefix, func(t *testing.T) {
+			got, err := mustParseAny(tt.path).Rebase(mustParseAny(tt.prefix))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+			assert.False(t, got.query.IsRoot())
+		})
+	}
+
+	t.Run("evaluates against subtrees", func(t *testing.T) {
+		full := MustParse("$.store.book[*].price")
+		prefix := MustParse("$.store.book")
+		rest, err := full.Rebase(prefix)
+		require.NoError(t, err)
+
+		got, err := prefix.SelectLocated(input).Query(rest)
+		require.NoError(t, err)
+		assert.Equal(t, full.SelectLocated(input), got)
+
+		book := input["store"].(map[string]any)["book"]
+		assert.Equal(t, full.Select(input), rest.Select(book))
+	})
+
+	t.Run("keeps options", func(t *testing.T) {
+		p := NewParser(WithReverseOrder())
+		rest, err := p.MustParse("$.a[*]").Rebase(MustParse("$.a"))
+		require.NoError(t, err)
+		assert.Equal(t, NodeList{2.0, 1.0}, rest.Select([]any{1.0, 2.0}))
+	})
+
+	for _, tt := range []struct {
+		path   string
+		prefix string
+	}{
+		{"$.store.book", "$.store.book[*]"},
+		{"$.store.book", "$.store.bike"},
+		{"$.store.book[*]", "$.store.book[0]"},
+		{"$.store.book[0]", "$.store.book[*]"},
+		{"$..book", "$.book"},
+		{"$['a','b']", "$['b','a']"},
+		{"$[1:2]", "$[1:3]"},
+		{"$[?@.a].b", "$[?@.a]"},
+		{"@.a.b", "$.a"},
+		{"$.a.b", "@.a"},
+	} {
+		t.Run("mismatch "+tt.path+" from "+tt.prefix, func(t *testing.T) {
+			_, err := mustParseAny(tt.path).Rebase(mustParseAny(tt.prefix))
+			require.ErrorIs(t, err, ErrPrefixMismatch)
+		})
+	}
+}
+
+func TestSelect_LargeUnions(t *testing.T) {
+	arr := []any{"a", "b", "c", "d"}
+	obj := map[string]any{"k1": 1.0, "k2": 2.0, "k3": 3.0}
+
+	// Unions large enough to be indexed, with duplicates, negative indexes
+	// and out-of-range arguments interleaved.
+	indexes := []string{"3", "-4", "1", "3"}
+	names := []string{"'k3'", "'k1'", "'k3'"}
+	for i := range 40 {
+		indexes = append(indexes, strconv.Itoa(100+i))
+		names = append(names, fmt.Sprintf("'missing%d'", i))
+	}
+	indexes = append(indexes, "-1", "0")
+	names = append(names, "'k2'")
+	indexExpr := "$[" + strings.Join(indexes, ",") + "]"
+	nameExpr := "$[" + strings.Join(names, ",") + "]"
+
+	tests := []struct {
+		expr  string
+		input any
+		want  NodeList
+		paths []string
+	}{
+		{indexExpr, arr, NodeList{"d", "a", "b", "d", "d", "a"}, []string{"$[3]", "$[0]", "$[1]", "$[3]", "$[3]", "$[0]"}},
+		{nameExpr, obj, NodeList{3.0, 1.0, 3.0, 2.0}, []string{"$['k3']", "$['k1']", "$['k3']", "$['k2']"}},
+		{indexExpr, obj, NodeList{}, nil},
+		{nameExpr, arr, NodeList{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%T", tt.input), func(t *testing.T) {
+			p := MustParse(tt.expr)
+			assert.Equal(t, tt.want, p.Select(tt.input))
+
+			var paths []string
+			for path := range p.SelectLocated(tt.input).Paths() {
+				paths = append(paths, path.String())
+			}
+			assert.Equal(t, tt.paths, paths)
+
+			reversed := NewParser(WithReverseOrder()).MustParse(tt.expr).Select(tt.input)
+			slices.Reverse(reversed)
+			assert.Equal(t, tt.want, reversed)
+
+			// Filter sub-queries use the same lookup.
+			sub := MustParse(fmt.Sprintf("$[?count(@%s) == %d]", tt.expr[1:], len(tt.want)))
+			assert.Len(t, sub.Select([]any{tt.input}), 1)
+		})
+	}
+
+	t.Run("member resolver", func(t *testing.T) {
+		p := NewParser(WithMemberResolver(func(_ map[string]any, name string) (any, bool) {
+			return name, name == "missing7"
+		}))
+		assert.Equal(t, NodeList{3.0, 1.0, 3.0, "missing7", 2.0}, p.MustParse(nameExpr).Select(obj))
+	})
+}
+
+func largeUnion(n int, format func(i int) string) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = format(i)
+	}
+	return "$..[" + strings.Join(parts, ",") + "]"
+}
+
+func BenchmarkSelect_LargeIndexUnion(b *testing.B) {
+	input := make([]any, 100)
+	for i := range input {
+		input[i] = []any{i, map[string]any{"a": i}}
+	}
+	path := MustParse(largeUnion(10000, func(i int) string { return strconv.Itoa(i * 7) }))
+
+	b.ResetTimer()
+	for b.Loop() {
+		_ = path.Select(input)
+	}
+}
+
+func BenchmarkSelect_LargeNameUnion(b *testing.B) {
+	input := make([]any, 100)
+	for i := range input {
+		input[i] = map[string]any{"k0": i, "x": map[string]any{"k9999": i}}
+	}
+	path := MustParse(largeUnion(10000, func(i int) string { return fmt.Sprintf("'k%d'", i) }))
+
+	b.ResetTimer()
+	for b.Loop() {
+		_ = path.Select(input)
+	}
+}
+
+func TestSelect_UnknownSelectorKind(t *testing.T) {
+	query := ast.NewPathQuery(true, ast.Child(ast.Selector{Kind: 42}))
+	p := &Path{query: query}
+
+	res, _, err := p.SelectE([]any{1})
+	require.ErrorIs(t, err, ErrUnknownSelector)
+	assert.EqualError(t, err, "jsonpath: unknown selector kind 42")
+	assert.Nil(t, res)
+	assert.Nil(t, p.Select([]any{1}))
+
+	located, _, err := p.SelectLocatedE([]any{1})
+	require.ErrorIs(t, err, ErrUnknownSelector)
+	assert.Nil(t, located)
+	assert.Nil(t, p.SelectLocated([]any{1}))
+
+	// In a filter sub-query too.
+	filter := ast.NewFilterExpr(ast.LogicalOr{ast.LogicalAnd{&ast.ExistExpr{Query: query}}})
+	p = &Path{query: ast.NewPathQuery(true, ast.Child(ast.FilterSelector(filter)))}
+	_, _, err = p.SelectE([]any{1})
+	require.ErrorIs(t, err, ErrUnknownSelector)
+}
+
+func TestSelect_SparseArrays(t *testing.T) {
+	sparse := map[int]any{7: "h", -1: "z", 2: map[string]any{"a": 1.0}}
+	sparse64 := map[int64]any{7: "h", -1: "z", 2: map[string]any{"a": 1.0}}
+
+	tests := []struct {
+		expr  string
+		want  NodeList
+		paths []string
+	}{
+		{"$[7]", NodeList{"h"}, []string{"$[7]"}},
+		{"$[-1]", NodeList{"z"}, []string{"$[%!index(-1)]"}},
+		{"$[0]", NodeList{}, nil},
+		{"$[7,2,7]", NodeList{"h", map[string]any{"a": 1.0}, "h"}, []string{"$[7]", "$[2]", "$[7]"}},
+		{"$[*]", NodeList{"z", map[string]any{"a": 1.0}, "h"}, []string{"$[%!index(-1)]", "$[2]", "$[7]"}},
+		{"$[?@ == 'h' || @ == 'z']", NodeList{"z", "h"}, []string{"$[%!index(-1)]", "$[7]"}},
+		{"$[?@.a]", NodeList{map[string]any{"a": 1.0}}, []string{"$[2]"}},
+		{"$..a", NodeList{1.0}, []string{"$[2]['a']"}},
+		{"$..*", NodeList{"z", map[string]any{"a": 1.0}, "h", 1.0}, []string{"$[%!index(-1)]", "$[2]", "$[7]", "$[2]['a']"}},
+		{"$['7']", NodeList{}, nil},
+		{"$[0:10]", NodeList{}, nil},
+	}
+	for _, input := range []any{sparse, sparse64} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%T/%s", input, tt.expr), func(t *testing.T) {
+				p := MustParse(tt.expr)
+				assert.Equal(t, tt.want, p.Select(input))
+
+				var paths []string
+				for path := range p.SelectLocated(input).Paths() {
+					paths = append(paths, path.String())
+				}
+				assert.Equal(t, tt.paths, paths)
+
+				reversed := NewParser(WithReverseOrder()).MustParse(tt.expr).Select(input)
+				slices.Reverse(reversed)
+				assert.Equal(t, tt.want, reversed)
+			})
+		}
+	}
+
+	t.Run("filter sub-queries", func(t *testing.T) {
+		docs := []any{
+			map[string]any{"id": "a", "tags": map[int]any{3: "x"}},
+			map[string]any{"id": "b", "tags": map[int64]any{1: "y", 3: "z"}},
+			map[string]any{"id": "c", "tags": []any{"x"}},
+		}
+		p := MustParse("$[?@.tags[3]].id")
+		assert.Equal(t, NodeList{"a", "b"}, p.Select(docs))
+		p = MustParse("$[?count(@.tags[*]) == 2].id")
+		assert.Equal(t, NodeList{"b"}, p.Select(docs))
+		p = MustParse("$[?@.tags[3] == 'z'].id")
+		assert.Equal(t, NodeList{"b"}, p.Select(docs))
+	})
+
+	t.Run("large index union", func(t *testing.T) {
+		p := MustParse(largeUnion(40, strconv.Itoa))
+		assert.Equal(t, NodeList{map[string]any{"a": 1.0}, "h"}, p.Select(sparse))
+	})
+}
+
+func TestSelect_DescendantEdgeCases(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		input any
+		want  NodeList
+		paths []string
+	}{
+		{"scalar_root_name", "$..a", 42.0, NodeList{}, nil},
+		{"scalar_root_wildcard", "$..*", "str", NodeList{}, nil},
+		{"scalar_root_index", "$..[0]", true, NodeList{}, nil},
+		{"null_root", "$..*", nil, NodeList{}, nil},
+		{"empty_object", "$..*", map[string]any{}, NodeList{}, nil},
+		{"empty_array", "$..*", []any{}, NodeList{}, nil},
+		{"empty_object_name", "$..a", map[string]any{}, NodeList{}, nil},
+		{"nested_empty", "$..*", []any{[]any{}, map[string]any{}}, NodeList{[]any{}, map[string]any{}}, []string{"$[0]", "$[1]"}},
+		{"scalar_children_wildcard", "$..*", []any{1.0, "x", nil}, NodeList{1.0, "x", nil}, []string{"$[0]", "$[1]", "$[2]"}},
+		{"scalar_children_index", "$..[1]", []any{1.0, "x", nil}, NodeList{"x"}, []string{"$[1]"}},
+		{"scalar_child_name", "$..a", map[string]any{"a": 1.0}, NodeList{1.0}, []string{"$['a']"}},
+		{"scalar_children_filter", "$..[?@ > 1]", []any{1.0, 2.0, 3.0}, NodeList{2.0, 3.0}, []string{"$[1]", "$[2]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := MustParse(tt.expr)
+			assert.Equal(t, tt.want, p.Select(tt.input))
+
+			var paths []string
+			for path := range p.SelectLocated(tt.input).Paths() {
+				paths = append(paths, path.String())
+			}
+			assert.Equal(t, tt.paths, paths)
+
+			// Filter sub-queries run on the ast engine and must agree.
+			sub := MustParse(fmt.Sprintf("$[?count(@%s) == %d]", tt.expr[1:], len(tt.want)))
+			assert.Len(t, sub.Select([]any{tt.input}), 1)
+		})
+	}
+}
+
+func TestSelect_RepeatedFilterSubQueries(t *testing.T) {
+	input := []any{
+		map[string]any{"id": 1.0, "a": map[string]any{"b": 1.0}},
+		map[string]any{"id": 2.0, "a": map[string]any{"b": "x"}},
+		map[string]any{"id": 3.0, "a": map[string]any{"b": nil}},
+		map[string]any{"id": 4.0, "a": map[string]any{}},
+		map[string]any{"id": 5.0, "a": 1.0, "b": []any{map[string]any{"a": 2.0}}},
+		map[string]any{"id": 6.0, "a": 1.0, "b": []any{map[string]any{"a": 1.0}}},
+	}
+	tests := []struct {
+		expr string
+		want NodeList
+	}{
+		// Without repetition.
+		{"$[?@.a.b == 1].id", NodeList{1.0}},
+		{"$[?length(@.a.b) > 0].id", NodeList{2.0}},
+		// With repetition in comparisons, existence tests and function arguments.
+		{"$[?@.a.b == 1 && @.a.b != null].id", NodeList{1.0}},
+		{"$[?@.a.b != null && length(@.a.b) > 0].id", NodeList{2.0}},
+		{"$[?@.a.b && !@.a.b].id", NodeList{}},
+		{"$[?@.a.b || @.a.b == 'x'].id", NodeList{1.0, 2.0, 3.0}},
+		{"$[?!@.a.b && count(@.a.b) == 0].id", NodeList{4.0, 5.0, 6.0}},
+		{"$[?(@.a.b == 1 || @.a.b == 'x') && value(@.a.b) != 'x'].id", NodeList{1.0}},
+		// The nested @.a refers to a different node than the outer ones.
+		{"$[?@.a == 1 && @.b[?@.a == 2] && @.a != 2].id", NodeList{5.0}},
+		{"$[?@.a == 1 && @.b[?@.a == 1 && @.a != 2]].id", NodeList{6.0}},
+		// Rooted queries are merged separately from relative ones.
+		{"$[?$[0].id == @.id && $[0].id == 1].id", NodeList{1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p := MustParse(tt.expr)
+			assert.Equal(t, tt.want, p.Select(input))
+			assert.Len(t, p.SelectLocated(input), len(tt.want))
+		})
+	}
+}
+
+func BenchmarkSelect_RepeatedFilterSubQuery(b *testing.B) {
+	input := make([]any, 1000)
+	for i := range input {
+		input[i] = map[string]any{"a": map[string]any{"b": float64(i % 3)}}
+	}
+	path := MustParse("$[?@.a.b == 1 && @.a.b != null && length(@.a.b) > 0]")
+
+	b.ResetTimer()
+	for b.Loop() {
+		_ = path.Select(input)
+	}
+}
+
+func TestSelect_AliasedContainers(t *testing.T) {
+	shared := map[string]any{"x": 1.0}
+	list := []any{shared}
+	input := map[string]any{"a": shared, "b": shared, "c": list, "d": list}
+
+	t.Run("visited once per location", func(t *testing.T) {
+		assert.Equal(t, NodeList{1.0, 1.0, 1.0, 1.0}, MustParse("$..x").Select(input))
+
+		located := MustParse("$..x").SelectLocated(input)
+		located.Sort()
+		var paths []string
+		for p := range located.Paths() {
+			paths = append(paths, p.String())
+		}
+		assert.Equal(t, []string{
+			"$['a']['x']",
+			"$['b']['x']",
+			"$['c'][0]['x']",
+			"$['d'][0]['x']",
+		}, paths)
+	})
+
+	t.Run("deduplicate keeps every location", func(t *testing.T) {
+		located := MustParse("$..x").SelectLocated(input)
+		assert.Len(t, located.Deduplicate(), 4)
+	})
+
+	t.Run("paths resolve to the shared value", func(t *testing.T) {
+		for n := range MustParse("$..[?@.x]").SelectLocated(input).All() {
+			got := MustParse(n.Path.String()).Select(input)
+			require.Len(t, got, 1)
+			assert.Equal(t, shared, got[0])
+		}
+	})
+}
+
+func TestSelectLocated_DocumentOrder(t *testing.T) {
+	input := map[string]any{"store": []any{
+		map[string]any{"items": []any{1, 2, 3}, "tags": []any{"a", "b"}},
+		map[string]any{"items": []any{}, "tags": []any{"c"}},
+		map[string]any{"items": []any{4, 5}, "tags": []any{}},
+	}}
+
+	tests := []struct {
+		expr      string
+		want      []string
+		unordered bool // members of one object have no defined order
+	}{
+		{expr: "$.store[*].items[*]", want: []string{
+			"$['store'][0]['items'][0]", "$['store'][0]['items'][1]", "$['store'][0]['items'][2]",
+			"$['store'][2]['items'][0]", "$['store'][2]['items'][1]",
+		}},
+		{expr: "$.store[?@.items[0]]['tags','items'][*]", want: []string{
+			"$['store'][0]['tags'][0]", "$['store'][0]['tags'][1]",
+			"$['store'][0]['items'][0]", "$['store'][0]['items'][1]", "$['store'][0]['items'][2]",
+			"$['store'][2]['items'][0]", "$['store'][2]['items'][1]",
+		}},
+		{expr: "$.store[2,0].items[1,0]", want: []string{
+			"$['store'][2]['items'][1]", "$['store'][2]['items'][0]",
+			"$['store'][0]['items'][1]", "$['store'][0]['items'][0]",
+		}},
+		{expr: "$.store[::-1].tags[0]", want: []string{
+			"$['store'][1]['tags'][0]", "$['store'][0]['tags'][0]",
+		}},
+		{expr: "$.store[?@.tags[0]].items[-1:,0]", want: []string{
+			"$['store'][0]['items'][2]", "$['store'][0]['items'][0]",
+		}},
+		{expr: "$..items[0:2]", want: []string{
+			"$['store'][0]['items'][0]", "$['store'][0]['items'][1]",
+			"$['store'][2]['items'][0]", "$['store'][2]['items'][1]",
+		}},
+		{expr: "$.store[*].*[?@ == 'b' || @ == 2 || @ == 5]", want: []string{
+			"$['store'][0]['items'][1]", "$['store'][0]['tags'][1]", "$['store'][2]['items'][1]",
+		}, unordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p := MustParse(tt.expr)
+			located := p.SelectLocated(input)
+			got := make([]string, 0, len(located))
+			for path := range located.Paths() {
+				got = append(got, path.String())
+			}
+			values := make([]any, 0, len(located))
+			for v := range located.Values() {
+				values = append(values, v)
+			}
+			if tt.unordered {
+				slices.Sort(got)
+			}
+			assert.Equal(t, tt.want, got)
+			if !tt.unordered {
+				assert.Equal(t, values, []any(p.Select(input)))
+
+				reversed := NewParser(WithReverseOrder()).MustParse(tt.expr).SelectLocated(input)
+				slices.Reverse(reversed)
+				assert.Equal(t, located, reversed)
+			}
+		})
+	}
+}
+
+func TestSelect_ExtremeIndexes(t *testing.T) {
+	// The top-level engine applies index selectors in Path.Select; filter
+	// sub-queries apply them with ast.Selector.Apply. Both must agree.
+	input := []any{[]any{1, 2, 3}}
+	for _, idx := range []string{
+		"0", "2", "3", "-1", "-3", "-4",
+		"2147483647", "2147483648", "-2147483649", "4294967296",
+		"9007199254740991", "-9007199254740991",
+	} {
+		t.Run(idx, func(t *testing.T) {
+			direct := MustParse("$[0][" + idx + "]").Select(input)
+			located := MustParse("$[0][" + idx + "]").SelectLocated(input)
+			require.Len(t, located, len(direct))
+			exists := MustParse("$[?@[" + idx + "]]").Select(input)
+			if len(direct) == 0 {
+				assert.Empty(t, exists)
+				return
+			}
+			require.Len(t, direct, 1)
+			assert.Equal(t, NodeList{input[0]}, exists)
+			byValue := MustParse(fmt.Sprintf("$[?@[%s] == %v]", idx, direct[0])).Select(input)
+			assert.Equal(t, NodeList{input[0]}, byValue)
+		})
+	}
+
+	t.Run("negative_index_in_filter", func(t *testing.T) {
+		data := []any{[]any{1, 2, 3}, []any{3}, []any{}, "abc", map[string]any{"-1": 3}}
+		var got []string
+		for p := range MustParse("$[?@[-1] == 3]").SelectLocated(data).Paths() {
+			got = append(got, p.String())
+		}
+		assert.Equal(t, []string{"$[0]", "$[1]"}, got)
+	})
+}
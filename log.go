@@ -0,0 +1,57 @@
+package jsonpath
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// logging reports whether evaluations must be measured and logged.
+func (o evalOptions) logging() bool {
+	return o.logger != nil && o.logger.Enabled(context.Background(), o.logLevel)
+}
+
+// logSelect logs one evaluation of p against input that started at start and
+// produced matches nodes, or failed with err.
+func (p *Path) logSelect(ctx context.Context, method string, input any, matches int, stats SelectStats, err error, start time.Time) {
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("query", p.Redacted()),
+		slog.String("size", sizeClass(input)),
+		slog.Int("matches", matches),
+		slog.Int("peak_nodes", stats.PeakNodes),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	p.opts.logger.LogAttrs(ctx, p.opts.logLevel, "jsonpath: query evaluated", attrs...)
+}
+
+// sizeClass classifies input by the number of its top-level members or
+// elements, without walking the document.
+func sizeClass(input any) string {
+	var n int
+	switch v := input.(type) {
+	case map[string]any:
+		n = len(v)
+	case []any:
+		n = len(v)
+	case map[int]any:
+		n = len(v)
+	case map[int64]any:
+		n = len(v)
+	default:
+		return "scalar"
+	}
+	switch {
+	case n == 0:
+		return "empty"
+	case n < 16:
+		return "small"
+	case n < 1024:
+		return "medium"
+	default:
+		return "large"
+	}
+}
@@ -0,0 +1,55 @@
+package jsonpath
+
+import (
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/agentable/jsonpath/internal/ast"
+)
+
+// Members returns an iterator over the members of the object obj in sorted
+// key order, comparing keys bytewise like [NormalizedPath.Compare], so the
+// members come in the order [LocatedNodeList.Sort] puts their paths in. It
+// yields nothing if obj is not a map[string]any. The keys are sorted when
+// iteration starts; changes to obj during iteration are not reflected.
+func Members(obj any) iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		m, ok := obj.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			v, ok := m[k]
+			if ok && !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Elements returns an iterator over the elements of the array arr in
+// ascending index order. Besides []any it accepts the sparse arrays described
+// on [Path.Select], yielding their keys as indexes in the order the evaluator
+// visits them; keys that do not fit in an int are skipped. It yields nothing
+// for any other value.
+func Elements(arr any) iter.Seq2[int, any] {
+	return func(yield func(int, any) bool) {
+		if s, ok := arr.([]any); ok {
+			for i, v := range s {
+				if !yield(i, v) {
+					return
+				}
+			}
+			return
+		}
+		for _, e := range ast.SparseEntries(arr) {
+			if int64(int(e.Index)) != e.Index {
+				continue
+			}
+			if !yield(int(e.Index), e.Value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package jsonpath
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembers(t *testing.T) {
+	t.Parallel()
+
+	obj := map[string]any{"b": 2, "a": 1, "B": 3, "é": 4, "": 5, "aa": 6}
+	var keys []string
+	var values []any
+	for k, v := range Members(obj) {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	assert.Equal(t, []string{"", "B", "a", "aa", "b", "é"}, keys)
+	assert.Equal(t, []any{5, 3, 1, 6, 2, 4}, values)
+
+	// Members agrees with the order LocatedNodeList.Sort defines.
+	located := MustParse("$.*").SelectLocated(obj)
+	located.Sort()
+	var sorted []string
+	for p := range located.Paths() {
+		sorted = append(sorted, string(p[0].(NameElement)))
+	}
+	assert.Equal(t, keys, sorted)
+
+	for k := range Members(obj) {
+		if k == "a" {
+			break
+		}
+	}
+	for _, v := range []any{nil, "x", []any{1}, map[int]any{1: 1}} {
+		assert.Empty(t, maps.Collect(Members(v)))
+	}
+}
+
+func TestElements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		arr   any
+		index []int
+		value []any
+	}{
+		{"slice", []any{"a", "b", "c"}, []int{0, 1, 2}, []any{"a", "b", "c"}},
+		{"empty", []any{}, nil, nil},
+		{"sparse", map[int]any{7: "x", -1: "y", 2: "z"}, []int{-1, 2, 7}, []any{"y", "z", "x"}},
+		{"sparse_int64", map[int64]any{3: "a", 1: "b"}, []int{1, 3}, []any{"b", "a"}},
+		{"object", map[string]any{"a": 1}, nil, nil},
+		{"scalar", 1.0, nil, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var index []int
+			var value []any
+			for i, v := range Elements(tc.arr) {
+				index = append(index, i)
+				value = append(value, v)
+			}
+			assert.Equal(t, tc.index, index)
+			assert.Equal(t, tc.value, value)
+			if len(tc.value) > 0 {
+				// Elements agrees with the order of a wildcard selection.
+				assert.Equal(t, tc.value, []any(MustParse("$[*]").Select(tc.arr)))
+			}
+		})
+	}
+}
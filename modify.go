@@ -0,0 +1,253 @@
+package jsonpath
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/agentable/jsonpath/internal/ast"
+)
+
+// Set assigns value at every location p matches in input, writing it into
+// the object or array that holds each matched node, and returns the number
+// of locations written. Paths only match existing members and elements, so
+// Set replaces values but never adds any. A location p selects more than
+// once is written once, and so is a member or element of an object or array
+// that input holds at several locations, through the first of its paths. All locations receive value itself, not a copy, and
+// nothing else in input is copied or changed. Every location is found before
+// any is written, so writing one does not change which others are written:
+// for $..* the members of a replaced object are still set, in the object now
+// detached from input.
+//
+// Set returns [ErrRootNode], writing nothing, if p selects input itself,
+// which has no parent to hold value, and [ErrNodeType] if a matched node is
+// not held by a map[string]any, []any, or sparse map[int]any or
+// map[int64]any of input, for example because its parent was converted by
+// [WithEncodingJSONValues]. It also returns the errors of
+// [Path.SelectLocatedE].
+func (p *Path) Set(input, value any) (int, error) {
+	return p.mutate("Set", input, func(any) (any, bool) {
+		return value, true
+	})
+}
+
+// Append appends value to every array p matches in input, storing the grown
+// array in the object or array that holds it, and returns the number of
+// arrays appended to. Matches that are not a []any are skipped. A location p
+// selects more than once is appended to once, and arrays nested in other
+// matched arrays are appended to first, so both changes are kept. Append
+// returns the errors documented on [Path.Set].
+func (p *Path) Append(input, value any) (int, error) {
+	return p.mutate("Append", input, func(v any) (any, bool) {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, false
+		}
+		return append(arr, value), true
+	})
+}
+
+// InsertAt is like [Path.Append] but inserts value before the element at
+// index of every array p matches. A negative index counts from the end of
+// the array, so -1 inserts before the last element, and an index equal to
+// the length of the array appends to it. Arrays index is out of range for
+// are skipped along with matches that are not a []any.
+func (p *Path) InsertAt(input any, index int, value any) (int, error) {
+	return p.mutate("InsertAt", input, func(v any) (any, bool) {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, false
+		}
+		i := index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i > len(arr) {
+			return nil, false
+		}
+		return slices.Insert(arr, i, value), true
+	})
+}
+
+// Transform replaces the value at every location p matches in input with
+// the value fn returns for it, storing it in the object or array that holds
+// the location, and returns the number of values replaced. A value fn returns
+// unchanged, the same map or slice or a scalar equal to the old one, is not
+// stored or counted. fn is called once per location [Path.Set] would write,
+// for descendants before their ancestors, so it sees an ancestor with its
+// matched descendants already replaced. If fn returns an error, Transform
+// stops and returns it with the number of values replaced so far, which keep
+// their new values. Transform otherwise returns the errors documented on
+// [Path.Set].
+func (p *Path) Transform(input any, fn func(old any) (any, error)) (int, error) {
+	return p.mutateLocated("Transform", input, func(_ NormalizedPath, old any) (any, bool, error) {
+		v, err := fn(old)
+		return v, err == nil && !unchanged(old, v), err
+	})
+}
+
+// TransformLocated is like [Path.Transform] but also passes fn the
+// normalized path of each location.
+func (p *Path) TransformLocated(input any, fn func(path NormalizedPath, old any) (any, error)) (int, error) {
+	return p.mutateLocated("TransformLocated", input, func(path NormalizedPath, old any) (any, bool, error) {
+		v, err := fn(path, old)
+		return v, err == nil && !unchanged(old, v), err
+	})
+}
+
+// unchanged reports whether v is old itself: the same non-empty map or
+// slice, or an equal comparable value.
+func unchanged(old, v any) bool {
+	if c := ast.ContainerOf(old); c != (ast.Container{}) {
+		return c == ast.ContainerOf(v)
+	}
+	if reflect.TypeOf(old) != reflect.TypeOf(v) {
+		return false
+	}
+	return old == nil || reflect.ValueOf(old).Comparable() && old == v
+}
+
+// mutate is the visitor behind the methods that modify a document. It calls
+// fn with the value at each location p matches in input, descendants before
+// their ancestors, and stores the value fn returns at the location when fn
+// reports true. It returns the number of values stored. Every location is
+// found before fn is first called.
+func (p *Path) mutate(method string, input any, fn func(v any) (any, bool)) (int, error) {
+	return p.mutateLocated(method, input, func(_ NormalizedPath, v any) (any, bool, error) {
+		v, ok := fn(v)
+		return v, ok, nil
+	})
+}
+
+// mutateLocated is like mutate but also passes fn the path of each location,
+// and stops at the first error fn returns.
+func (p *Path) mutateLocated(method string, input any, fn func(path NormalizedPath, v any) (any, bool, error)) (int, error) {
+	slots, err := p.slots(method, input)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range slices.Backward(slots) {
+		old, _ := s.get()
+		v, ok, err := fn(s.path, old)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			s.set(v)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// slot is a location in a document: the member or element elem of the
+// object or array parent, at path.
+type slot struct {
+	parent any
+	elem   PathElement
+	path   NormalizedPath
+}
+
+// slots returns the slot of each node p matches in input, sorted by path
+// with repeated locations dropped, logging the evaluation as method. A slot
+// therefore follows the slots of its ancestors. A member or element reached
+// through more than one path, because input holds its object or array at
+// several locations, is kept at the first of them only.
+func (p *Path) slots(method string, input any) ([]slot, error) {
+	nodes, _, err := p.selectLocatedLogged(context.Background(), method, nil, input)
+	if err != nil {
+		return nil, err
+	}
+	nodes.Sort()
+	nodes = slices.CompactFunc(nodes, func(a, b *LocatedNode) bool {
+		return a.Path.Compare(b.Path) == 0
+	})
+	type slotKey struct {
+		parent ast.Container
+		elem   PathElement
+	}
+	seen := make(map[slotKey]bool, len(nodes))
+	slots := make([]slot, 0, len(nodes))
+	for _, n := range nodes {
+		elem, ok := n.Path.Last()
+		if !ok {
+			return nil, fmt.Errorf("%w: %s selects it", ErrRootNode, p)
+		}
+		parent, ok := n.Path.Parent().Resolve(input)
+		s := slot{parent: parent, elem: elem, path: n.Path}
+		if !ok || !s.valid() {
+			return nil, fmt.Errorf("%w: %s is not held by an object or array of the document", ErrNodeType, n.Path)
+		}
+		key := slotKey{ast.ContainerOf(parent), elem}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		slots = append(slots, s)
+	}
+	return slots, nil
+}
+
+// valid reports whether s.parent is a container that s.elem can address.
+func (s slot) valid() bool {
+	switch parent := s.parent.(type) {
+	case map[string]any:
+		_, ok := s.elem.(NameElement)
+		return ok
+	case []any:
+		i, ok := s.elem.(IndexElement)
+		return ok && i >= 0 && i < IndexElement(len(parent))
+	case map[int]any:
+		i, ok := s.elem.(IndexElement)
+		return ok && int64(int(i)) == int64(i)
+	case map[int64]any:
+		_, ok := s.elem.(IndexElement)
+		return ok
+	default:
+		return false
+	}
+}
+
+// get returns the value at s, which must be valid, and whether there is one.
+func (s slot) get() (any, bool) {
+	switch parent := s.parent.(type) {
+	case map[string]any:
+		v, ok := parent[string(s.elem.(NameElement))]
+		return v, ok
+	case []any:
+		return parent[s.elem.(IndexElement)], true
+	case map[int]any:
+		v, ok := parent[int(s.elem.(IndexElement))]
+		return v, ok
+	case map[int64]any:
+		v, ok := parent[int64(s.elem.(IndexElement))]
+		return v, ok
+	default:
+		return nil, false
+	}
+}
+
+// lookup is like get but reports false, rather than requiring it, if s is
+// not valid.
+func (s slot) lookup() (any, bool) {
+	if !s.valid() {
+		return nil, false
+	}
+	return s.get()
+}
+
+// set writes v at s, which must be valid.
+func (s slot) set(v any) {
+	switch parent := s.parent.(type) {
+	case map[string]any:
+		parent[string(s.elem.(NameElement))] = v
+	case []any:
+		parent[s.elem.(IndexElement)] = v
+	case map[int]any:
+		parent[int(s.elem.(IndexElement))] = v
+	case map[int64]any:
+		parent[int64(s.elem.(IndexElement))] = v
+	}
+}
@@ -0,0 +1,445 @@
+package jsonpath
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath_Set(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		input any
+		value any
+		count int
+		exp   any
+	}{
+		{
+			name:  "name",
+			path:  "$.a",
+			input: map[string]any{"a": 1, "b": 2},
+			value: "x",
+			count: 1,
+			exp:   map[string]any{"a": "x", "b": 2},
+		},
+		{
+			name:  "new_member",
+			path:  "$['new']",
+			input: map[string]any{"a": 1},
+			value: true,
+			count: 0,
+			exp:   map[string]any{"a": 1},
+		},
+		{
+			name:  "object_wildcard",
+			path:  "$.o.*",
+			input: map[string]any{"o": map[string]any{"x": 1, "y": 2}, "n": 3},
+			value: 0,
+			count: 2,
+			exp:   map[string]any{"o": map[string]any{"x": 0, "y": 0}, "n": 3},
+		},
+		{
+			name:  "slice",
+			path:  "$.a[1:4:2]",
+			input: map[string]any{"a": []any{0, 1, 2, 3, 4}},
+			value: nil,
+			count: 2,
+			exp:   map[string]any{"a": []any{0, nil, 2, nil, 4}},
+		},
+		{
+			name:  "negative_index",
+			path:  "$[-1]",
+			input: []any{"a", "b"},
+			value: "z",
+			count: 1,
+			exp:   []any{"a", "z"},
+		},
+		{
+			name:  "filter",
+			path:  "$.books[?@.price > 10].sale",
+			input: map[string]any{"books": []any{map[string]any{"price": 5, "sale": false}, map[string]any{"price": 15, "sale": false}}},
+			value: true,
+			count: 1,
+			exp:   map[string]any{"books": []any{map[string]any{"price": 5, "sale": false}, map[string]any{"price": 15, "sale": true}}},
+		},
+		{
+			name:  "repeated_location",
+			path:  "$[0,0,-2]",
+			input: []any{1, 2},
+			value: 9,
+			count: 1,
+			exp:   []any{9, 2},
+		},
+		{
+			name:  "descendants",
+			path:  "$..id",
+			input: map[string]any{"id": 1, "c": []any{map[string]any{"id": 2}}},
+			value: 0,
+			count: 2,
+			exp:   map[string]any{"id": 0, "c": []any{map[string]any{"id": 0}}},
+		},
+		{
+			name:  "sparse_array",
+			path:  "$[*]",
+			input: map[int]any{3: "a", 7: "b"},
+			value: "",
+			count: 2,
+			exp:   map[int]any{3: "", 7: ""},
+		},
+		{
+			name:  "no_match",
+			path:  "$.missing[*]",
+			input: map[string]any{"a": []any{1}},
+			value: 0,
+			count: 0,
+			exp:   map[string]any{"a": []any{1}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			n, err := MustParse(tc.path).Set(tc.input, tc.value)
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, n)
+			assert.Equal(t, tc.exp, tc.input)
+		})
+	}
+
+	t.Run("untouched_branches_not_copied", func(t *testing.T) {
+		t.Parallel()
+		kept := map[string]any{"k": []any{1, 2}}
+		arr := []any{0, kept}
+		doc := map[string]any{"arr": arr, "kept": kept}
+		n, err := MustParse("$.arr[0]").Set(doc, "x")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		// The slice was written in place, so arr sees the change too.
+		assert.Equal(t, "x", arr[0])
+		assert.Equal(t, reflect.ValueOf(arr).Pointer(), reflect.ValueOf(doc["arr"]).Pointer())
+		assert.Equal(t, reflect.ValueOf(kept).Pointer(), reflect.ValueOf(doc["kept"]).Pointer())
+		assert.Equal(t, reflect.ValueOf(kept).Pointer(), reflect.ValueOf(arr[1]).Pointer())
+	})
+
+	t.Run("value_is_shared", func(t *testing.T) {
+		t.Parallel()
+		doc := []any{1, 2}
+		value := map[string]any{}
+		_, err := MustParse("$[*]").Set(doc, value)
+		require.NoError(t, err)
+		value["k"] = true
+		assert.Equal(t, []any{map[string]any{"k": true}, map[string]any{"k": true}}, doc)
+	})
+
+	t.Run("aliased", func(t *testing.T) {
+		t.Parallel()
+		shared := map[string]any{"x": 1}
+		doc := map[string]any{"a": shared, "b": shared}
+		n, err := MustParse("$..x").Set(doc, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, map[string]any{"x": 2}, shared)
+	})
+
+	t.Run("replaced_ancestor", func(t *testing.T) {
+		t.Parallel()
+		inner := map[string]any{"b": 1}
+		doc := map[string]any{"a": inner}
+		n, err := MustParse("$..*").Set(doc, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, map[string]any{"a": 0}, doc)
+		assert.Equal(t, map[string]any{"b": 0}, inner)
+	})
+
+	t.Run("root", func(t *testing.T) {
+		t.Parallel()
+		doc := []any{1}
+		n, err := MustParse("$").Set(doc, 0)
+		require.ErrorIs(t, err, ErrRootNode)
+		assert.Zero(t, n)
+		assert.Equal(t, []any{1}, doc)
+	})
+
+	t.Run("converted_parent", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"a": 1, "s": []int{1, 2}}
+		n, err := NewParser(WithEncodingJSONValues()).MustParse("$['a','s'][*]").Set(doc, 0)
+		require.ErrorIs(t, err, ErrNodeType)
+		assert.Zero(t, n)
+		assert.Equal(t, map[string]any{"a": 1, "s": []int{1, 2}}, doc)
+	})
+
+	t.Run("evaluation_error", func(t *testing.T) {
+		t.Parallel()
+		doc := []any{1, 2, 3}
+		_, err := NewParser(WithMaxIntermediateNodes(2)).MustParse("$[*]").Set(doc, 0)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+		assert.Equal(t, []any{1, 2, 3}, doc)
+	})
+}
+
+func TestPath_Append(t *testing.T) {
+	t.Parallel()
+
+	t.Run("grows_array_in_parent", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"spec": map[string]any{"containers": []any{"web"}}}
+		n, err := MustParse("$.spec.containers").Append(doc, "sidecar")
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, map[string]any{"spec": map[string]any{"containers": []any{"web", "sidecar"}}}, doc)
+	})
+
+	t.Run("skips_non_arrays", func(t *testing.T) {
+		t.Parallel()
+		doc := []any{[]any{}, "s", map[string]any{}, []any{1}, map[int]any{0: 1}}
+		n, err := MustParse("$[*]").Append(doc, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []any{[]any{0}, "s", map[string]any{}, []any{1, 0}, map[int]any{0: 1}}, doc)
+	})
+
+	t.Run("nested_arrays", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"a": []any{[]any{1}}}
+		n, err := MustParse("$..*").Append(doc, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, map[string]any{"a": []any{[]any{1, 0}, 0}}, doc)
+	})
+
+	t.Run("aliased", func(t *testing.T) {
+		t.Parallel()
+		shared := map[string]any{"arr": []any{1}}
+		doc := []any{shared, shared}
+		n, err := MustParse("$[*].arr").Append(doc, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, map[string]any{"arr": []any{1, 2}}, shared)
+	})
+
+	t.Run("repeated_location", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"a": []any{}}
+		n, err := MustParse("$['a','a']").Append(doc, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, map[string]any{"a": []any{1}}, doc)
+	})
+
+	t.Run("root", func(t *testing.T) {
+		t.Parallel()
+		doc := []any{1}
+		_, err := MustParse("$").Append(doc, 2)
+		require.ErrorIs(t, err, ErrRootNode)
+	})
+}
+
+func TestPath_InsertAt(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name  string
+		index int
+		count int
+		exp   []any
+	}{
+		{name: "front", index: 0, count: 1, exp: []any{"x", "a", "b", "c"}},
+		{name: "middle", index: 1, count: 1, exp: []any{"a", "x", "b", "c"}},
+		{name: "end", index: 3, count: 1, exp: []any{"a", "b", "c", "x"}},
+		{name: "negative", index: -1, count: 1, exp: []any{"a", "b", "x", "c"}},
+		{name: "negative_front", index: -3, count: 1, exp: []any{"x", "a", "b", "c"}},
+		{name: "past_end", index: 4, count: 0, exp: []any{"a", "b", "c"}},
+		{name: "before_front", index: -4, count: 0, exp: []any{"a", "b", "c"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			doc := map[string]any{"arr": []any{"a", "b", "c"}, "s": "str"}
+			n, err := MustParse("$['arr','s']").InsertAt(doc, tc.index, "x")
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, n)
+			assert.Equal(t, map[string]any{"arr": tc.exp, "s": "str"}, doc)
+		})
+	}
+}
+
+func TestPath_Transform(t *testing.T) {
+	t.Parallel()
+
+	redact := func(any) (any, error) { return "***", nil }
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		fn    func(old any) (any, error)
+		count int
+		exp   any
+	}{
+		{
+			name:  "descendants",
+			path:  "$..password",
+			fn:    redact,
+			count: 2,
+			exp: map[string]any{
+				"password": "***",
+				"users":    []any{map[string]any{"name": "a", "password": "***"}, map[string]any{"name": "b"}},
+			},
+		},
+		{
+			name:  "wildcard",
+			path:  "$.users[*].name",
+			fn:    func(old any) (any, error) { return strings.ToUpper(old.(string)), nil },
+			count: 2,
+			exp: map[string]any{
+				"password": "p0",
+				"users":    []any{map[string]any{"name": "A", "password": "p1"}, map[string]any{"name": "B"}},
+			},
+		},
+		{
+			name:  "filter",
+			path:  "$.users[?@.password]",
+			fn:    func(any) (any, error) { return nil, nil },
+			count: 1,
+			exp: map[string]any{
+				"password": "p0",
+				"users":    []any{nil, map[string]any{"name": "b"}},
+			},
+		},
+		{
+			name:  "same_value_is_no_op",
+			path:  "$..*",
+			fn:    func(old any) (any, error) { return old, nil },
+			count: 0,
+			exp: map[string]any{
+				"password": "p0",
+				"users":    []any{map[string]any{"name": "a", "password": "p1"}, map[string]any{"name": "b"}},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			doc := map[string]any{
+				"password": "p0",
+				"users":    []any{map[string]any{"name": "a", "password": "p1"}, map[string]any{"name": "b"}},
+			}
+			n, err := MustParse(tc.path).Transform(doc, tc.fn)
+			require.NoError(t, err)
+			assert.Equal(t, tc.count, n)
+			assert.Equal(t, tc.exp, doc)
+		})
+	}
+
+	t.Run("descendants_first", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"a": []any{1.0, []any{2.0}}}
+		var seen []any
+		n, err := MustParse("$..*").Transform(doc, func(old any) (any, error) {
+			seen = append(seen, old)
+			if f, ok := old.(float64); ok {
+				return f * 10, nil
+			}
+			return old, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, map[string]any{"a": []any{10.0, []any{20.0}}}, doc)
+		assert.Equal(t, []any{2.0, []any{20.0}, 1.0, []any{10.0, []any{20.0}}}, seen)
+	})
+
+	t.Run("aliased", func(t *testing.T) {
+		t.Parallel()
+		shared := map[string]any{"x": 1.0}
+		doc := map[string]any{"a": shared, "b": shared}
+		var calls int
+		n, err := MustParse("$..x").Transform(doc, func(old any) (any, error) {
+			calls++
+			return old.(float64) + 1, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, map[string]any{"x": 2.0}, shared)
+	})
+
+	t.Run("error_stops", func(t *testing.T) {
+		t.Parallel()
+		errStop := errors.New("stop")
+		doc := []any{1, 2, 3}
+		n, err := MustParse("$[*]").Transform(doc, func(old any) (any, error) {
+			if old == 2 {
+				return nil, errStop
+			}
+			return 0, nil
+		})
+		require.ErrorIs(t, err, errStop)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []any{1, 2, 0}, doc)
+	})
+
+	t.Run("root", func(t *testing.T) {
+		t.Parallel()
+		_, err := MustParse("$").Transform(map[string]any{}, redact)
+		require.ErrorIs(t, err, ErrRootNode)
+	})
+}
+
+func TestPath_TransformLocated(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{"a": map[string]any{"password": "x"}, "b": []any{map[string]any{"password": "y"}}}
+	var changed []string
+	n, err := MustParse("$..password").TransformLocated(doc, func(path NormalizedPath, _ any) (any, error) {
+		changed = append(changed, path.String())
+		return "***", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"$['b'][0]['password']", "$['a']['password']"}, changed)
+	assert.Equal(t, map[string]any{"a": map[string]any{"password": "***"}, "b": []any{map[string]any{"password": "***"}}}, doc)
+
+	t.Run("aliased", func(t *testing.T) {
+		t.Parallel()
+		shared := map[string]any{"password": "x"}
+		doc := map[string]any{"b": shared, "a": shared}
+		var changed []string
+		_, err := MustParse("$..password").TransformLocated(doc, func(path NormalizedPath, _ any) (any, error) {
+			changed = append(changed, path.String())
+			return "***", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"$['a']['password']"}, changed)
+	})
+}
+
+func TestUnchanged(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]any{"k": 1}
+	s := []any{1, 2}
+	for _, tc := range []struct {
+		old, v any
+		exp    bool
+	}{
+		{nil, nil, true},
+		{1.0, 1.0, true},
+		{"s", "s", true},
+		{m, m, true},
+		{s, s, true},
+		{1, 1.0, false},
+		{nil, 0, false},
+		{m, map[string]any{"k": 1}, false},
+		{s, s[:1], false},
+		{s, []any{1, 2}, false},
+		{[]int{1}, []int{1}, false},
+		{[]any{}, []any{}, false},
+	} {
+		assert.Equal(t, tc.exp, unchanged(tc.old, tc.v), "%v, %v", tc.old, tc.v)
+	}
+}
@@ -1,42 +1,48 @@
 package jsonpath
 
 import (
+	"cmp"
 	"fmt"
+	"log/slog"
 	"maps"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/agentable/jsonpath/functions"
 	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/agentable/jsonpath/internal/lexer"
 	"github.com/agentable/jsonpath/internal/parser"
 )
 
 // FuncType describes the type of a function extension's return value as
 // defined by RFC 9535 §2.4.1.
-type FuncType uint8
+type FuncType = ast.FuncType
 
 const (
 	// FuncLogical indicates the function returns a logical (bool) value.
-	FuncLogical FuncType = iota
+	FuncLogical = ast.Logical
 	// FuncValue indicates the function returns a single JSON value.
-	FuncValue
+	FuncValue = ast.Value
 	// FuncNodes indicates the function returns a node list.
-	FuncNodes
+	FuncNodes = ast.Nodes
 )
 
 // ArgType describes the type of a function argument expression for
 // parse-time validation.
-type ArgType uint8
+type ArgType = ast.ArgType
 
 const (
 	// ArgLiteral is a literal JSON value argument.
-	ArgLiteral ArgType = iota
+	ArgLiteral = ast.Literal
 	// ArgSingularQuery is a singular query argument (e.g. @.name or $.name).
-	ArgSingularQuery
+	ArgSingularQuery = ast.QueryArg
 	// ArgFilterQuery is a filter query argument producing a node list.
-	ArgFilterQuery
+	ArgFilterQuery = ast.FilterArg
 	// ArgLogicalExpr is a logical expression argument.
-	ArgLogicalExpr
+	ArgLogicalExpr = ast.LogicalArg
 	// ArgFunctionExpr is a nested function call argument.
-	ArgFunctionExpr
+	ArgFunctionExpr = ast.FunctionArg
 )
 
 // Function defines an extension function that can be registered with a
@@ -54,12 +60,99 @@ type Function interface {
 	Call(args []any) any
 }
 
+// EvalFunction is a [Function] that also receives the [EvalContext] of the
+// evaluation calling it. When a function implements EvalFunction,
+// CallWithEval is called instead of Call.
+type EvalFunction interface {
+	Function
+	// CallWithEval evaluates the function with access to ec.
+	CallWithEval(ec *EvalContext, args []any) any
+}
+
+// EvalContext is the per-evaluation state passed to an [EvalFunction]. It
+// lives for one call of a [Path] method such as [Path.Select] and is never
+// shared between concurrent evaluations.
+type EvalContext = ast.EvalContext
+
 // Option configures a [Parser].
 type Option func(*parserOptions)
 
 // parserOptions holds configuration for a [Parser].
 type parserOptions struct {
-	functions map[string]Function
+	functions    map[string]Function
+	sharedFuncs  bool // functions is shared with another Parser; copy before writing
+	maxExprLen   int
+	maxSelectors int
+	maxNesting   int
+	lenientSpace bool
+	implicitRoot bool
+	legacy       bool
+	nameChar     func(rune) bool
+	cacheSize    int
+	eval         evalOptions
+}
+
+// addFunction registers fn, first copying the function map if it is shared
+// with the Parser this one was cloned from.
+func (o *parserOptions) addFunction(fn Function) {
+	if o.sharedFuncs {
+		o.functions = maps.Clone(o.functions)
+		o.sharedFuncs = false
+	}
+	o.functions[fn.Name()] = fn
+}
+
+// evalOptions holds the evaluation settings a [Parser] stores in each [Path]
+// it compiles.
+type evalOptions struct {
+	reverse          bool
+	sparseProjection bool
+	foldNames        bool
+	resolveMember    func(obj map[string]any, name string) (any, bool)
+	convert          func(node any) any
+	rawResults       bool
+	logger           *slog.Logger
+	logLevel         slog.Level
+	maxNodes         int
+	maxResults       int
+	maxDepth         int
+}
+
+// evaluator returns an evaluator for one run of a path against root.
+func (o evalOptions) evaluator(root any) evaluator {
+	return evaluator{
+		env:        ast.Env{Root: root, ResolveMember: o.resolveMember, FoldNames: o.foldNames, Convert: o.convert, MaxDepth: o.maxDepth},
+		reverse:    o.reverse,
+		maxNodes:   o.maxNodes,
+		maxResults: o.maxResults,
+		maxDepth:   o.maxDepth,
+	}
+}
+
+var evaluatorPool = sync.Pool{
+	New: func() any { return new(evaluator) },
+}
+
+// newEvaluator is like evaluator but takes the evaluator, and the ancestor
+// stack of its previous run, from a pool. The caller must release it.
+func (o evalOptions) newEvaluator(root any) *evaluator {
+	e := evaluatorPool.Get().(*evaluator)
+	ancestors, names := e.ancestors, e.names
+	*e = o.evaluator(root)
+	e.ancestors, e.names = ancestors[:0], names
+	return e
+}
+
+// release releases the resources held by an evaluator from newEvaluator and
+// returns it to the pool. e must not be used afterwards.
+func (e *evaluator) release() {
+	e.env.Release()
+	// Keep the buffers but not the names, which belong to the document.
+	if e.names != nil {
+		*e.names = nameCache{}
+	}
+	*e = evaluator{ancestors: e.ancestors[:0], names: e.names}
+	evaluatorPool.Put(e)
 }
 
 // WithFunctions registers additional filter functions beyond the RFC 9535
@@ -67,15 +160,260 @@ type parserOptions struct {
 func WithFunctions(fns ...Function) Option {
 	return func(o *parserOptions) {
 		for _, fn := range fns {
-			o.functions[fn.Name()] = fn
+			o.addFunction(fn)
+		}
+	}
+}
+
+// WithReverseOrder makes paths compiled by the [Parser] produce nodes in
+// reverse document order: array elements are visited from the end, the
+// selectors of a segment from last to first, and descendants before the node
+// they descend from. The result is exactly the reverse of the default result,
+// so a slice with a negative step such as [::-1] yields ascending indexes.
+// Object members have no defined order in either mode.
+func WithReverseOrder() Option {
+	return func(o *parserOptions) {
+		o.eval.reverse = true
+	}
+}
+
+// WithMemberResolver installs fn as a fallback for name selectors. When an
+// object has no member with the selected name, fn is called with the object
+// and the name; if it reports ok, the returned value is selected as if it
+// were a member and its normalized path uses the requested name. The resolver
+// also applies inside filter queries, so @.size or $.total may refer to
+// computed members. Existing members never reach fn, and computed members are
+// neither listed by wildcards nor visited by descendant segments. Every miss
+// costs one extra call; fn must be safe for concurrent use if the compiled
+// paths are.
+func WithMemberResolver(fn func(obj map[string]any, name string) (any, bool)) Option {
+	return func(o *parserOptions) {
+		o.eval.resolveMember = fn
+	}
+}
+
+// WithCaseInsensitiveNames makes name selectors of paths compiled by the
+// [Parser] match object members case-insensitively, as [strings.EqualFold]
+// compares them: $['content-type'] selects both "Content-Type" and
+// "content-type" if an object has both, in the undefined order of object
+// members. Located nodes carry the member names found in the document, not the
+// selector's spelling. A [WithMemberResolver] fallback is called only when no
+// member matches. The names apply inside filter queries too, where a
+// singular query such as @.id matching two members compares like one matching
+// none. Instead of a map lookup, each name selector then visits every member
+// of the objects it is applied to.
+func WithCaseInsensitiveNames() Option {
+	return func(o *parserOptions) {
+		o.eval.foldNames = true
+	}
+}
+
+// WithEncodingJSONValues makes paths compiled by the [Parser] accept the
+// values encoding/json and custom unmarshalers commonly leave in a decoded
+// document, converting each node as it is visited:
+//
+//   - a json.RawMessage or [jsontext.Value] is decoded as if by [QueryJSON];
+//     invalid JSON is left as is and selects nothing
+//   - a *any is dereferenced once
+//   - a slice or array other than []byte becomes an []any of its elements
+//   - a map with string keys becomes a map[string]any of its members
+//   - a nil *any, slice or map is null
+//
+// Elements and members are converted in turn when the query reaches them, so
+// only the visited part of the document is decoded, and filters compare and
+// functions receive converted values. Selected nodes are converted themselves,
+// but not the values nested inside them. Nothing is cached: a node visited
+// twice is converted twice, so decode the document up front instead when
+// querying it repeatedly.
+func WithEncodingJSONValues() Option {
+	return func(o *parserOptions) {
+		o.eval.convert = convertV1
+	}
+}
+
+// WithSparseProjection makes [Path.Project] keep matched array elements at
+// their original indexes, filling the positions of unmatched elements before
+// them with null. By default the matched elements of an array are packed, in
+// index order, at its start.
+func WithSparseProjection() Option {
+	return func(o *parserOptions) {
+		o.eval.sparseProjection = true
+	}
+}
+
+// WithLogger makes paths compiled by the [Parser] log one record per call of
+// [Path.Select], [Path.SelectLocated] or their E, Context and Append variants,
+// or [Path.SelectFrom], to logger at level, with the query as rendered by
+// [Path.Redacted], the size class of the input document, the number of
+// matches, [SelectStats.PeakNodes], the duration and the error, if any.
+// Nothing is measured or logged when logger is nil, the default, or has level
+// disabled.
+func WithLogger(logger *slog.Logger, level slog.Level) Option {
+	return func(o *parserOptions) {
+		o.eval.logger = logger
+		o.eval.logLevel = level
+	}
+}
+
+// WithMaxIntermediateNodes limits the number of nodes evaluation may hold in
+// one node list: the nodes a segment selects, and with it the result. A
+// segment such as ..* early in a query can select far more nodes than the
+// query finally returns; the limit bounds the memory this takes on untrusted
+// queries or documents. The count is checked after each node a segment is
+// applied to, so evaluation stops within one node's children of the limit.
+// When it is exceeded, [Path.SelectE] returns [ErrTooManyNodes] and
+// [Path.Select] returns nil. Filter sub-queries are not limited. n <= 0
+// means no limit, the default.
+func WithMaxIntermediateNodes(n int) Option {
+	return func(o *parserOptions) {
+		o.eval.maxNodes = max(n, 0)
+	}
+}
+
+// WithMaxDepth limits how deep a descendant segment such as .. may recurse
+// into the document: its selectors apply to the nodes at most n levels below
+// the node the segment is applied to, and so select nodes at most n+1 levels
+// below it. Descendant traversal recurses once per level,
+// so the limit guards against documents nested deep enough to exhaust the
+// stack. When it is exceeded, [Path.SelectE] returns [ErrDocumentTooDeep] and
+// [Path.Select] returns nil; [Path.Count], [Path.SelectFunc] and the other
+// methods that follow one node at a time stop where the limit was reached.
+// The descendant segments of filter sub-queries, as in $[?@..x], are limited
+// alike, counting from the node the sub-query applies them to. n <= 0 means
+// no limit, the default.
+func WithMaxDepth(n int) Option {
+	return func(o *parserOptions) {
+		o.eval.maxDepth = max(n, 0)
+	}
+}
+
+// WithMaxResults limits the number of nodes [Path.Select], [Path.SelectE],
+// [Path.SelectContext] and [Path.Count] return to the first n in evaluation
+// order, and [Path.SelectLocated] and its variants likewise to the first n
+// located nodes. The earlier segments of a query are evaluated as usual, but
+// the final one stops as soon as n nodes have been selected, so $[*] over a
+// large array visits only its first n elements. Selecting more nodes than the
+// limit is not an error; [Path.SelectFunc] and the iterators are not limited.
+// n <= 0 means no limit, the default.
+func WithMaxResults(n int) Option {
+	return func(o *parserOptions) {
+		o.eval.maxResults = max(n, 0)
+	}
+}
+
+// WithMaxExpressionLength limits the length of expressions in bytes.
+// Longer expressions fail with [ErrExpressionTooLong] before any of them is
+// read. Use it when parsing untrusted input; n <= 0 means no limit, the
+// default.
+func WithMaxExpressionLength(n int) Option {
+	return func(o *parserOptions) {
+		o.maxExprLen = max(n, 0)
+	}
+}
+
+// WithMaxSelectorsPerSegment limits the number of selectors in one bracketed
+// selection such as [0,1,2], including selections inside filter queries.
+// Expressions exceeding n fail to parse with [ErrTooManySelectors]. Use it when
+// parsing untrusted input; n <= 0 means no limit, the default.
+func WithMaxSelectorsPerSegment(n int) Option {
+	return func(o *parserOptions) {
+		o.maxSelectors = max(n, 0)
+	}
+}
+
+// DefaultMaxFilterDepth is how deep filter selectors, parenthesized
+// expressions and function calls may nest unless [WithMaxFilterDepth] says
+// otherwise. Far deeper than hand-written queries go, it bounds the recursion
+// of parsing and evaluating untrusted expressions.
+const DefaultMaxFilterDepth = 128
+
+// WithMaxFilterDepth limits how deep filter selectors, parenthesized
+// expressions and function calls may nest in an expression, each counting as
+// one level. Expressions exceeding n fail to parse with [ErrTooDeep]. n <= 0
+// means [DefaultMaxFilterDepth]. n is capped at 1000, the deepest nesting
+// [Path.MarshalBinary] output may hold. Parsing and evaluation take about 1 KB
+// of stack per level, so 1000 levels take about 1 MB per goroutine.
+func WithMaxFilterDepth(n int) Option {
+	return func(o *parserOptions) {
+		o.maxNesting = max(n, 0)
+	}
+}
+
+// WithLenientWhitespace accepts blank space (spaces, tabs, line feeds and
+// carriage returns) before and after expressions, such as the trailing line
+// feed of a value read from a YAML file. RFC 9535 forbids it, and by default
+// such expressions fail to parse. Positions in errors remain relative to the
+// expression as given.
+func WithLenientWhitespace() Option {
+	return func(o *parserOptions) {
+		o.lenientSpace = true
+	}
+}
+
+// WithImplicitRoot accepts expressions without the leading $, as written by
+// tools predating RFC 9535: "store.book[0]" is read as "$.store.book[0]",
+// and ".store" and "[0]" as "$.store" and "$[0]". [Path.String] includes the
+// $, so it returns a valid RFC 9535 expression. [Parser.ParseRelative] is
+// not affected.
+func WithImplicitRoot() Option {
+	return func(o *parserOptions) {
+		o.implicitRoot = true
+	}
+}
+
+// WithLegacySyntax accepts the script expression (@.length-N) of JSONPath
+// implementations predating RFC 9535, as in "$.store.book[(@.length-1)]",
+// reading it as the index -N. Other script expressions fail to parse with a
+// [*ParseError] saying they are not supported. Filters written in the legacy
+// form [?(...)] need no option: they are valid RFC 9535. [Path.String]
+// renders the index rather than the script expression.
+func WithLegacySyntax() Option {
+	return func(o *parserOptions) {
+		o.legacy = true
+	}
+}
+
+// WithExtendedMemberNames lets member name shorthands such as .x-request-id
+// contain dashes, and any of the runes in extra, after their first
+// character; RFC 9535 allows only letters, digits, underscores and non-ASCII
+// characters. Runes with a meaning in JSONPath syntax, such as '.' and '[',
+// and blank space are ignored. [Path.String] writes every name in brackets,
+// which any RFC 9535 parser reads.
+func WithExtendedMemberNames(extra ...rune) Option {
+	chars := []rune{'-'}
+	for _, r := range extra {
+		if !strings.ContainsRune(syntaxRunes, r) && !slices.Contains(chars, r) {
+			chars = append(chars, r)
 		}
 	}
+	nameChar := func(r rune) bool { return slices.Contains(chars, r) }
+	return func(o *parserOptions) {
+		o.nameChar = nameChar
+	}
+}
+
+// syntaxRunes are the runes [WithExtendedMemberNames] cannot add to member
+// names: those that delimit tokens of JSONPath expressions.
+const syntaxRunes = "$@.[](),:?*!=<>&|'\" \t\n\r"
+
+// WithCache makes [Parser.Parse] and [Parser.MustParse] keep up to size
+// compiled paths in a [Cache] of the Parser's own, so that parsing an
+// expression again returns the same shared [Path]. The cache is keyed by
+// expression only, as the Parser's options cannot change; clones made with
+// [Parser.Clone] get a cache of their own. Invalid expressions are not
+// cached. size <= 0 means no cache, the default.
+func WithCache(size int) Option {
+	return func(o *parserOptions) {
+		o.cacheSize = max(size, 0)
+	}
 }
 
 // Parser parses JSONPath expressions into [Path] values, optionally
-// configured with extension functions.
+// configured with extension functions. A Parser is immutable after
+// [NewParser] returns and safe for concurrent use.
 type Parser struct {
-	opts parserOptions
+	opts  parserOptions
+	cache *Cache // set by WithCache
 }
 
 // NewParser creates a new [Parser] configured by opts.
@@ -88,37 +426,165 @@ func NewParser(opts ...Option) *Parser {
 	for _, o := range opts {
 		o(&p.opts)
 	}
+	p.initCache()
 	return p
 }
 
-// Parse compiles a JSONPath expression. Returns [ErrPathParse] on failure.
-func (p *Parser) Parse(expr string) (*Path, error) {
+// Clone returns a new [Parser] with the configuration of p, including its
+// functions and evaluation settings, with opts applied on top. The function
+// map is only copied once opts register a function, so clones are cheap, and
+// functions registered on the clone never affect p. Paths already compiled by
+// p are unaffected.
+func (p *Parser) Clone(opts ...Option) *Parser {
+	c := &Parser{opts: p.opts}
+	c.opts.sharedFuncs = true
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	c.initCache()
+	return c
+}
+
+// initCache creates the cache of p if its options ask for one.
+func (p *Parser) initCache() {
+	if p.opts.cacheSize > 0 {
+		p.cache = newCache(p, p.opts.cacheSize)
+	}
+}
+
+// funcs returns the functions paths compiled by p may call: the built-ins
+// and, overriding them, the functions registered with [WithFunctions].
+func (p *Parser) funcs() map[string]any {
+	// The internal parser only reads the map, so the built-ins can be shared.
+	if len(p.opts.functions) == 0 {
+		return builtinFuncs
+	}
+
 	// Convert function map to map[string]any for internal parser
 	// Start with built-in functions
-	funcs := make(map[string]any, 5+len(p.opts.functions))
-
-	// Register built-in functions from the functions package
-	registry := newBuiltinRegistry()
-	maps.Copy(funcs, registry)
+	funcs := make(map[string]any, len(builtinFuncs)+len(p.opts.functions))
+	maps.Copy(funcs, builtinFuncs)
 
 	// Add user-provided functions (can override built-ins)
 	for name, fn := range p.opts.functions {
 		funcs[name] = fn
 	}
+	return funcs
+}
+
+// Parse compiles a JSONPath expression. On failure it returns an error
+// wrapping [ErrPathParse] and, unless expr is longer than allowed by
+// [WithMaxExpressionLength], a [*ParseError] locating the problem. As RFC
+// 9535 requires, expr must start with $: @ is only allowed inside filters.
+// Use [Parser.ParseRelative] for relative paths.
+func (p *Parser) Parse(expr string) (*Path, error) {
+	if p.cache != nil {
+		return p.cache.Parse(expr)
+	}
+	return p.compile(expr)
+}
+
+// compile is [Parser.Parse] without the cache.
+func (p *Parser) compile(expr string) (*Path, error) {
+	path, err := p.parse(expr, lexer.Dollar)
+	if err != nil {
+		return nil, newParseError(expr, err)
+	}
+	return path, nil
+}
+
+// ParseAll compiles a JSONPath expression like [Parser.Parse], but does not
+// stop at the first invalid selector: it skips to the next , or ] and goes
+// on, returning every error it finds in order of position. Each error wraps
+// [ErrPathParse] and a [*ParseError]. It returns a nil path if there are any
+// errors.
+func (p *Parser) ParseAll(expr string) (*Path, []error) {
+	internalParser, err := p.newInternalParser(expr, lexer.Dollar)
+	if err != nil {
+		return nil, []error{newParseError(expr, err)}
+	}
+	query, errs := internalParser.ParseAll()
+	if len(errs) == 0 {
+		return &Path{query: query, opts: p.opts.eval}, nil
+	}
+	for i, err := range errs {
+		errs[i] = newParseError(expr, err)
+	}
+	return nil, errs
+}
+
+// ParseRelative compiles a relative JSONPath expression, which starts with @
+// instead of $, for use with [Path.SelectFrom], [LocatedNodeList.Query] and
+// [LocatedNode.Select].
+// It returns errors like [Parser.Parse].
+func (p *Parser) ParseRelative(expr string) (*Path, error) {
+	path, err := p.parse(expr, lexer.At)
+	if err != nil {
+		return nil, newParseError(expr, err)
+	}
+	return path, nil
+}
 
-	internalParser, err := parser.New(expr, funcs)
+// parse compiles expr, which must start with root unless root is zero,
+// returning errors of the internal parser as is.
+func (p *Parser) parse(expr string, root lexer.Kind) (*Path, error) {
+	query, err := p.parseQuery(expr, root)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrPathParse, err)
+		return nil, err
 	}
+	return &Path{query: query, opts: p.opts.eval}, nil
+}
 
-	query, err := internalParser.Parse()
+// parseQuery is [Parser.parse] without the [Path] around the query, for
+// callers that only check expr.
+func (p *Parser) parseQuery(expr string, root lexer.Kind) (*ast.PathQuery, error) {
+	internalParser, err := p.newInternalParser(expr, root)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrPathParse, err)
+		return nil, err
+	}
+	return internalParser.Parse()
+}
+
+// newInternalParser returns an internal parser for expr configured with the
+// options of p, or an error if expr is longer than [WithMaxExpressionLength]
+// allows.
+func (p *Parser) newInternalParser(expr string, root lexer.Kind) (*parser.Parser, error) {
+	if p.opts.maxExprLen > 0 && len(expr) > p.opts.maxExprLen {
+		return nil, fmt.Errorf("%w: %d bytes, more than %d", ErrExpressionTooLong, len(expr), p.opts.maxExprLen)
 	}
+	internalParser := parser.New(expr, p.funcs())
+	internalParser.MaxSelectors = p.opts.maxSelectors
+	internalParser.MaxNesting = cmp.Or(p.opts.maxNesting, DefaultMaxFilterDepth)
+	internalParser.LenientWhitespace = p.opts.lenientSpace
+	internalParser.ImplicitRoot = p.opts.implicitRoot
+	internalParser.Legacy = p.opts.legacy
+	internalParser.NameChar = p.opts.nameChar
+	internalParser.Root = root
+	return internalParser, nil
+}
 
-	return &Path{query: query}, nil
+// ParseBinary decodes a path encoded by [Path.MarshalBinary], resolving the
+// names of the functions it calls against the functions of p, and applies
+// the evaluation settings of p as [Parser.Parse] would. It returns an error
+// wrapping [ErrBinaryPath] if data is malformed, [ErrBinaryVersion] if it was
+// written by an incompatible version of this package, and
+// [ErrUnknownFunction] if it calls a function p does not know.
+func (p *Parser) ParseBinary(data []byte) (*Path, error) {
+	funcs := p.funcs()
+	query, err := ast.DecodeBinary(data, func(name string) (ast.Function, bool) {
+		fn, ok := funcs[name].(ast.Function)
+		return fn, ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBinaryPath, err)
+	}
+	return &Path{query: query, opts: p.opts.eval}, nil
 }
 
+// builtinFuncs holds the RFC 9535 built-in functions, shared read-only by
+// every [Parser].
+var builtinFuncs = newBuiltinRegistry()
+
 // newBuiltinRegistry creates a registry with RFC 9535 built-in functions.
 func newBuiltinRegistry() map[string]any {
 	builtins := []ast.Function{
@@ -1,10 +1,19 @@
 package jsonpath
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/agentable/jsonpath/functions"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -115,3 +124,788 @@ func TestFunction_Interface(t *testing.T) {
 	assert.Error(t, fn.Validate([]ArgType{ArgLiteral, ArgLiteral}))
 	assert.Equal(t, 42, fn.Call([]any{"hello"}))
 }
+
+func TestWithFunctions_Evaluates(t *testing.T) {
+	fn := newTestFunc("twice", FuncValue)
+	fn.validateFn = func(args []ArgType) error {
+		if len(args) != 1 || args[0] == ArgFilterQuery {
+			return errExpectedOneArg
+		}
+		return nil
+	}
+	fn.callFn = func(args []any) any {
+		if f, ok := args[0].(float64); ok {
+			return f * 2
+		}
+		return nil
+	}
+	p := NewParser(WithFunctions(fn))
+
+	path, err := p.Parse("$[?twice(@) == 4]")
+	require.NoError(t, err)
+	assert.Equal(t, NodeList{2.0}, path.Select([]any{1.0, 2.0, 3.0}))
+}
+
+// upperFunc is an EvalFunction that builds its result in the scratch buffer.
+type upperFunc struct {
+	testFunc
+	buffers func(b *[]byte)
+}
+
+func (f *upperFunc) CallWithEval(ec *EvalContext, args []any) any {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil
+	}
+	b := ec.Scratch()
+	*b = (*b)[:0]
+	for i := range len(s) {
+		*b = append(*b, s[i]&^0x20)
+		runtime.Gosched()
+	}
+	if f.buffers != nil {
+		f.buffers(b)
+	}
+	return string(*b)
+}
+
+func newUpperFunc() *upperFunc {
+	fn := &upperFunc{testFunc: *newTestFunc("upper", FuncValue)}
+	fn.validateFn = func(args []ArgType) error {
+		if len(args) != 1 || args[0] == ArgFilterQuery {
+			return errExpectedOneArg
+		}
+		return nil
+	}
+	fn.callFn = func([]any) any { panic("Call used instead of CallWithEval") }
+	return fn
+}
+
+func TestEvalFunction_Scratch(t *testing.T) {
+	input := []any{"abc", "xyz", "ab"}
+
+	t.Run("select", func(t *testing.T) {
+		fn := newUpperFunc()
+		var seen []*[]byte
+		fn.buffers = func(b *[]byte) { seen = append(seen, b) }
+		path := NewParser(WithFunctions(fn)).MustParse("$[?upper(@) == 'XYZ' || upper(@) == 'AB']")
+
+		assert.Equal(t, NodeList{"xyz", "ab"}, path.Select(input))
+		require.NotEmpty(t, seen)
+		for _, b := range seen {
+			assert.Same(t, seen[0], b, "one buffer per evaluation")
+		}
+
+		located := path.SelectLocated(input)
+		require.Len(t, located, 2)
+		assert.Equal(t, "$[2]", located[1].Path.String())
+	})
+
+	t.Run("concurrent selects do not share buffers", func(t *testing.T) {
+		fn := newUpperFunc()
+		path := NewParser(WithFunctions(fn)).MustParse("$[?upper(@) == $[0]]")
+
+		var wg sync.WaitGroup
+		for g := range 16 {
+			wg.Go(func() {
+				word := strings.Repeat(string(rune('a'+g)), 32+g)
+				doc := []any{strings.ToUpper(word), word, word + "x"}
+				for range 50 {
+					assert.Equal(t, NodeList{doc[0], word}, path.Select(doc))
+				}
+			})
+		}
+		wg.Wait()
+	})
+}
+
+func TestQuoteFunc_InExpression(t *testing.T) {
+	p := NewParser(WithFunctions(functions.QuoteFunc{}))
+	input := map[string]any{
+		"needle": "a.c$",
+		"items":  []any{"xa.c$y", "abc", "xa.cy"},
+	}
+
+	quoted := p.MustParse("$.items[?search(@, quote($.needle))]")
+	assert.Equal(t, NodeList{"xa.c$y"}, quoted.Select(input))
+
+	raw := p.MustParse("$.items[?search(@, $.needle)]")
+	assert.Equal(t, NodeList{"abc"}, raw.Select(input), "unquoted, . is a wildcard and $ an anchor")
+}
+
+func TestWithMaxSelectorsPerSegment(t *testing.T) {
+	p := NewParser(WithMaxSelectorsPerSegment(2))
+	_, err := p.Parse("$[0,1]")
+	require.NoError(t, err)
+
+	_, err = p.Parse("$[0,1,2]")
+	require.ErrorIs(t, err, ErrPathParse)
+	require.ErrorIs(t, err, ErrTooManySelectors)
+
+	_, err = NewParser(WithMaxSelectorsPerSegment(-1)).Parse("$[0,1,2]")
+	require.NoError(t, err)
+}
+
+func TestWithMaxExpressionLength(t *testing.T) {
+	p := NewParser(WithMaxExpressionLength(8))
+	_, err := p.Parse("$.abcdef")
+	require.NoError(t, err)
+
+	_, err = p.Parse("$.abcdefg")
+	require.ErrorIs(t, err, ErrPathParse)
+	require.ErrorIs(t, err, ErrExpressionTooLong)
+	assert.False(t, errors.As(err, new(*ParseError)))
+
+	_, errs := p.ParseAll("$.abcdefg[")
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], ErrExpressionTooLong)
+
+	_, err = p.ParseRelative("@.abcdefg")
+	require.ErrorIs(t, err, ErrExpressionTooLong)
+
+	_, err = NewParser(WithMaxExpressionLength(-1)).Parse("$.abcdefg")
+	require.NoError(t, err)
+}
+
+func TestWithLenientWhitespace(t *testing.T) {
+	p := NewParser(WithLenientWhitespace())
+	for _, expr := range []string{"$.a\n", " \t$.a", "\r\n$.a \n"} {
+		path, err := p.Parse(expr)
+		require.NoError(t, err, "%q", expr)
+		assert.Equal(t, `$["a"]`, path.String())
+
+		_, err = Parse(expr)
+		require.ErrorIs(t, err, ErrPathParse, "%q is strictly invalid", expr)
+	}
+
+	_, err := p.Parse("  $.a[0 1]\n")
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, len("  $.a[0 "), pe.Pos)
+
+	_, err = p.Parse("  $.a[\n")
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, len("  $.a[\n"), pe.Pos)
+
+	_, err = p.Parse(" \n")
+	require.ErrorIs(t, err, ErrPathParse)
+}
+
+func TestWithImplicitRoot(t *testing.T) {
+	p := NewParser(WithImplicitRoot())
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"store.book[0].title", `$["store"]["book"][0]["title"]`},
+		{".store.book", `$["store"]["book"]`},
+		{"..book", `$..["book"]`},
+		{"[0]", `$[0]`},
+		{"['a', 'b']", `$["a","b"]`},
+		{"true", `$["true"]`},
+		{"$.store", `$["store"]`},
+	}
+	for _, tt := range tests {
+		path, err := p.Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, path.String(), tt.expr)
+		assert.True(t, path.query.IsRoot(), tt.expr)
+		assert.True(t, Valid(path.String()), tt.expr)
+
+		if !strings.HasPrefix(tt.expr, "$") {
+			assert.False(t, Valid(tt.expr), tt.expr)
+		}
+	}
+
+	doc := map[string]any{"store": map[string]any{"book": []any{"x"}}}
+	assert.Equal(t, NodeList{"x"}, p.MustParse("store.book[0]").Select(doc))
+	assert.Equal(t, NodeList{[]any{"x"}}, p.MustParse("store[?@[0] == 'x']").Select(doc))
+
+	for _, expr := range []string{"@.a", "*.a", "store book", "", "store."} {
+		_, err := p.Parse(expr)
+		require.ErrorIs(t, err, ErrPathParse, expr)
+	}
+	_, err := p.Parse("store.book[0 1]")
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, len("store.book[0 "), pe.Pos)
+
+	_, err = p.ParseRelative("a.b")
+	require.ErrorIs(t, err, ErrPathParse)
+}
+
+func TestWithLegacySyntax(t *testing.T) {
+	p := NewParser(WithLegacySyntax())
+	doc := map[string]any{"book": []any{
+		map[string]any{"price": 8.0},
+		map[string]any{"price": 12.0},
+		map[string]any{"price": 9.0},
+	}}
+
+	last := p.MustParse("$.book[(@.length-1)]")
+	assert.Equal(t, `$["book"][-1]`, last.String())
+	assert.Equal(t, NodeList{map[string]any{"price": 9.0}}, last.Select(doc))
+	assert.Equal(t, `$["book"][0,-2]`, p.MustParse("$.book[0,(@.length-2)]").String())
+
+	cheap := p.MustParse("$..book[?(@.price<10)].price")
+	assert.Equal(t, NodeList{8.0, 9.0}, cheap.Select(doc))
+	assert.Equal(t, cheap.Select(doc), MustParse("$..book[?(@.price<10)].price").Select(doc))
+
+	for _, expr := range []string{
+		"$.book[(@.length-1)]",
+		"$.book[(@.length)]",
+		"$.book[(@.length+1)]",
+		"$.book[(@.length-0)]",
+		"$.book[(@.length - 1)]",
+		"$.book[(@.price*2)]",
+		"$.book[()]",
+		"$.book[(@.length-1]",
+	} {
+		_, err := Parse(expr)
+		require.ErrorIs(t, err, ErrPathParse, expr)
+		var pe *ParseError
+		require.ErrorAs(t, err, &pe, expr)
+		assert.NotEqual(t, "script expressions not supported", pe.Msg, expr)
+
+		if expr == "$.book[(@.length-1)]" {
+			continue
+		}
+		_, err = p.Parse(expr)
+		require.ErrorAs(t, err, &pe, expr)
+		assert.Equal(t, "script expressions not supported", pe.Msg, expr)
+		assert.Equal(t, len("$.book["), pe.Pos, expr)
+	}
+}
+
+func TestWithExtendedMemberNames(t *testing.T) {
+	p := NewParser(WithExtendedMemberNames('/', '.', ' ', '['))
+	doc := map[string]any{"headers": map[string]any{
+		"x-request-id": "abc",
+		"a/b":          1,
+		"x":            2,
+	}}
+
+	id := p.MustParse("$.headers.x-request-id")
+	assert.Equal(t, `$["headers"]["x-request-id"]`, id.String())
+	assert.Equal(t, NodeList{"abc"}, id.Select(doc))
+	assert.True(t, Valid(id.String()))
+	assert.Equal(t, id.Select(doc), MustParse(id.String()).Select(doc))
+
+	assert.Equal(t, NodeList{1}, p.MustParse("$.headers.a/b").Select(doc))
+	implicit := NewParser(WithExtendedMemberNames(), WithImplicitRoot())
+	assert.Equal(t, `$["x-y"]["z"]`, implicit.MustParse("x-y.z").String())
+	list := []any{map[string]any{"a-b": 1.0}, map[string]any{"a-b": -2.0}}
+	assert.Equal(t, NodeList{list[0]}, p.MustParse("$[?@.a-b>=-1]").Select(list))
+	assert.Equal(t, `$..["a-"]`, p.MustParse("$..a-").String())
+
+	for _, expr := range []string{
+		"$.headers.x-request-id",
+		"$.headers.a/b",
+	} {
+		assert.False(t, Valid(expr), expr)
+	}
+	for _, expr := range []string{
+		"$.-a",
+		"$.a b",
+		"$.a[0",
+	} {
+		_, err := p.Parse(expr)
+		require.ErrorIs(t, err, ErrPathParse, expr)
+	}
+	assert.Equal(t, NodeList{2}, p.MustParse("$.headers.x").Select(doc))
+}
+
+func TestWithCache(t *testing.T) {
+	scale := func(factor float64) Function {
+		fn := newTestFunc("scale", FuncValue)
+		fn.validateFn = func(args []ArgType) error {
+			if len(args) != 1 || args[0] == ArgFilterQuery {
+				return errExpectedOneArg
+			}
+			return nil
+		}
+		fn.callFn = func(args []any) any {
+			if f, ok := args[0].(float64); ok {
+				return f * factor
+			}
+			return nil
+		}
+		return fn
+	}
+	const expr = "$[?scale(@) == 4]"
+	doubles := NewParser(WithCache(8), WithFunctions(scale(2)))
+	quadruples := NewParser(WithCache(8), WithFunctions(scale(4)))
+	input := []any{1.0, 2.0}
+
+	a := doubles.MustParse(expr)
+	assert.Same(t, a, doubles.MustParse(expr))
+	assert.Equal(t, NodeList{2.0}, a.Select(input))
+	assert.Equal(t, NodeList{1.0}, quadruples.MustParse(expr).Select(input))
+
+	clone := doubles.Clone(WithFunctions(scale(4)))
+	assert.NotSame(t, a, clone.MustParse(expr))
+	assert.Equal(t, NodeList{1.0}, clone.MustParse(expr).Select(input))
+	assert.Same(t, a, doubles.MustParse(expr))
+
+	_, err := doubles.Parse("$[?unknown(@)]")
+	require.ErrorIs(t, err, ErrUnknownFunction)
+	assert.Equal(t, 1, doubles.cache.Len())
+
+	uncached := NewParser(WithCache(0))
+	assert.Nil(t, uncached.cache)
+	assert.NotSame(t, uncached.MustParse("$.a"), uncached.MustParse("$.a"))
+}
+
+func TestWithCache_Concurrent(t *testing.T) {
+	p := NewParser(WithCache(3))
+	input := map[string]any{"k0": 0, "k1": 1, "k2": 2, "k3": 3, "k4": 4, "k5": 5}
+	var wg sync.WaitGroup
+	for g := range concurrency {
+		wg.Go(func() {
+			for i := range 500 {
+				n := (g + i) % 6
+				path, err := p.Parse(fmt.Sprintf("$.k%d", n))
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, NodeList{n}, path.Select(input))
+				if i%50 == 0 {
+					_, err = p.Parse("$.k[")
+					assert.ErrorIs(t, err, ErrPathParse)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, p.cache.Len(), 3)
+}
+
+func TestWithMaxFilterDepth(t *testing.T) {
+	p := NewParser(WithMaxFilterDepth(3))
+	_, err := p.Parse("$[?((@))]")
+	require.NoError(t, err)
+
+	_, err = p.Parse("$[?((!(@)))]")
+	require.ErrorIs(t, err, ErrPathParse)
+	require.ErrorIs(t, err, ErrTooDeep)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "more than 3 levels", pe.Msg)
+	assert.Equal(t, len("$[?((!("), pe.Pos)
+
+	// Zero and negative values mean the default; the filter selector
+	// counts as one level.
+	nest := func(n int) string {
+		return "$[?" + strings.Repeat("(", n-1) + "@" + strings.Repeat(")", n-1) + "]"
+	}
+	for _, n := range []int{0, -1} {
+		_, err = NewParser(WithMaxFilterDepth(n)).Parse(nest(DefaultMaxFilterDepth))
+		require.NoError(t, err, "WithMaxFilterDepth(%d)", n)
+		_, err = NewParser(WithMaxFilterDepth(n)).Parse(nest(DefaultMaxFilterDepth + 1))
+		require.ErrorIs(t, err, ErrTooDeep, "WithMaxFilterDepth(%d)", n)
+	}
+	_, err = Parse(nest(DefaultMaxFilterDepth + 1))
+	require.ErrorIs(t, err, ErrTooDeep)
+
+	// The limit can be raised up to 1000 levels, and no further.
+	for _, n := range []int{1000, 5000} {
+		_, err = NewParser(WithMaxFilterDepth(n)).Parse(nest(1000))
+		require.NoError(t, err, "WithMaxFilterDepth(%d)", n)
+		_, err = NewParser(WithMaxFilterDepth(n)).Parse(nest(1001))
+		require.ErrorIs(t, err, ErrTooDeep, "WithMaxFilterDepth(%d)", n)
+	}
+}
+
+func TestWithMaxFilterDepth_Negations(t *testing.T) {
+	// Regression test: each !( recurses in the parser, which overflowed the
+	// stack on long chains before nesting was limited.
+	expr := "$[?" + strings.Repeat("!(", 50_000) + "@" + strings.Repeat(")", 50_000) + "]"
+	_, err := NewParser(WithMaxFilterDepth(128)).Parse(expr)
+	require.ErrorIs(t, err, ErrTooDeep)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "more than 128 levels", pe.Msg)
+	assert.Equal(t, len("$[?")+2*128, pe.Pos)
+}
+
+func TestParser_Clone(t *testing.T) {
+	twice := newTestFunc("twice", FuncValue)
+	twice.validateFn = func(args []ArgType) error {
+		if len(args) != 1 || args[0] == ArgFilterQuery {
+			return errExpectedOneArg
+		}
+		return nil
+	}
+	twice.callFn = func(args []any) any {
+		if f, ok := args[0].(float64); ok {
+			return f * 2
+		}
+		return nil
+	}
+	base := NewParser(WithFunctions(twice), WithReverseOrder())
+	before := base.MustParse("$[?twice(@) > 2]")
+
+	t.Run("inherits configuration", func(t *testing.T) {
+		clone := base.Clone()
+		assert.Equal(t, NodeList{3.0, 2.0}, clone.MustParse("$[?twice(@) > 2]").Select([]any{1.0, 2.0, 3.0}))
+	})
+
+	t.Run("shares functions until written", func(t *testing.T) {
+		clone := base.Clone(WithMaxSelectorsPerSegment(1))
+		assert.True(t, clone.opts.sharedFuncs)
+		_, err := clone.Parse("$[0,1]")
+		require.ErrorIs(t, err, ErrTooManySelectors)
+		_, err = base.Parse("$[0,1]")
+		require.NoError(t, err)
+	})
+
+	t.Run("registration does not leak", func(t *testing.T) {
+		clone := base.Clone(WithFunctions(newUpperFunc()))
+		assert.False(t, clone.opts.sharedFuncs)
+		assert.Len(t, clone.opts.functions, 2)
+		assert.Len(t, base.opts.functions, 1)
+
+		_, err := clone.Parse("$[?upper(@) == 'A']")
+		require.NoError(t, err)
+		_, err = base.Parse("$[?upper(@) == 'A']")
+		require.ErrorIs(t, err, ErrPathParse)
+
+		// A clone of a clone copies again rather than writing to its parent.
+		grand := clone.Clone(WithFunctions(newTestFunc("other", FuncLogical)))
+		assert.Len(t, grand.opts.functions, 3)
+		assert.Len(t, clone.opts.functions, 2)
+	})
+
+	t.Run("overrides in clone only", func(t *testing.T) {
+		thrice := newTestFunc("twice", FuncValue)
+		thrice.validateFn = twice.validateFn
+		thrice.callFn = func(args []any) any { return args[0].(float64) * 3 }
+		clone := base.Clone(WithFunctions(thrice))
+
+		input := []any{1.0}
+		assert.Equal(t, NodeList{1.0}, clone.MustParse("$[?twice(@) == 3]").Select(input))
+		assert.Empty(t, base.MustParse("$[?twice(@) == 3]").Select(input))
+	})
+
+	assert.Equal(t, NodeList{3.0, 2.0}, before.Select([]any{1.0, 2.0, 3.0}))
+}
+
+func TestWithLogger(t *testing.T) {
+	input := map[string]any{"items": []any{
+		map[string]any{"secret": "s3cr3t"},
+		map[string]any{"secret": "other"},
+	}}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	p := NewParser(WithLogger(logger, slog.LevelDebug))
+	path := p.MustParse("$.items[?@.secret == 's3cr3t'].secret")
+
+	assert.Len(t, path.Select(input), 1)
+	assert.Len(t, path.SelectLocated(input), 1)
+	assert.NotContains(t, buf.String(), "s3cr3t'")
+
+	var records []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records = append(records, rec)
+	}
+	require.Len(t, records, 2)
+	for i, method := range []string{"Select", "SelectLocated"} {
+		rec := records[i]
+		assert.Equal(t, "DEBUG", rec["level"])
+		assert.Equal(t, method, rec["method"])
+		assert.Equal(t, path.Redacted(), rec["query"])
+		assert.Equal(t, "small", rec["size"])
+		assert.InDelta(t, 1, rec["matches"], 0)
+		assert.Contains(t, rec, "duration")
+	}
+
+	t.Run("disabled_level", func(t *testing.T) {
+		buf.Reset()
+		quiet := NewParser(WithLogger(logger, slog.LevelDebug-1)).MustParse("$.items[*]")
+		assert.Len(t, quiet.Select(input), 2)
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("clone_inherits", func(t *testing.T) {
+		buf.Reset()
+		p.Clone().MustParse("$.missing").Select(input)
+		assert.Contains(t, buf.String(), `"matches":0`)
+	})
+}
+
+func TestSizeClass(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		input any
+		want  string
+	}{
+		{nil, "scalar"},
+		{"x", "scalar"},
+		{[]any{}, "empty"},
+		{map[string]any{"a": 1}, "small"},
+		{make([]any, 16), "medium"},
+		{make([]any, 1024), "large"},
+		{map[int]any{1: 1}, "small"},
+		{map[int64]any{}, "empty"},
+	} {
+		assert.Equal(t, tc.want, sizeClass(tc.input))
+	}
+}
+
+func BenchmarkSelect_Logger(b *testing.B) {
+	input := map[string]any{"store": map[string]any{"book": []any{
+		map[string]any{"price": 10},
+		map[string]any{"price": 20},
+	}}}
+	discard := slog.New(slog.DiscardHandler)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"none", nil},
+		{"level_disabled", []Option{WithLogger(discard, slog.LevelDebug)}},
+		{"discard", []Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), slog.LevelInfo)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			path := NewParser(bc.opts...).MustParse("$.store.book[*].price")
+			for b.Loop() {
+				_ = path.Select(input)
+			}
+		})
+	}
+}
+
+func TestWithMaxIntermediateNodes(t *testing.T) {
+	// A wide document: 100 objects with 100 members each, 10,101 nodes below
+	// the root, of which $..* materializes all before [?] keeps one.
+	wide := make([]any, 100)
+	for i := range wide {
+		row := make(map[string]any, 100)
+		for j := range 100 {
+			row[strconv.Itoa(j)] = float64(i*100 + j)
+		}
+		wide[i] = row
+	}
+	input := map[string]any{"rows": wide}
+	const expr = "$..*[?@ == -1]"
+
+	t.Run("stats_without_limit", func(t *testing.T) {
+		res, stats, err := MustParse(expr).SelectE(input)
+		require.NoError(t, err)
+		assert.Empty(t, res)
+		assert.Equal(t, 1+100+100*100, stats.PeakNodes)
+
+		res, stats, err = MustParse("$.rows[42]['42']").SelectE(input)
+		require.NoError(t, err)
+		assert.Equal(t, NodeList{4242.0}, res)
+		assert.Equal(t, 1, stats.PeakNodes)
+	})
+
+	p := NewParser(WithMaxIntermediateNodes(1000))
+	for _, expr := range []string{expr, "$.rows[*].*", "$..*"} {
+		t.Run("limit_exceeded/"+expr, func(t *testing.T) {
+			path := p.MustParse(expr)
+			res, stats, err := path.SelectE(input)
+			require.ErrorIs(t, err, ErrTooManyNodes)
+			assert.Nil(t, res)
+			assert.Greater(t, stats.PeakNodes, 1000)
+			// The check runs after each node, so evaluation stops within one
+			// row of the limit rather than materializing the whole document.
+			assert.LessOrEqual(t, stats.PeakNodes, 1100)
+			assert.Nil(t, path.Select(input))
+
+			located, stats, err := path.SelectLocatedE(input)
+			require.ErrorIs(t, err, ErrTooManyNodes)
+			assert.Nil(t, located)
+			assert.Greater(t, stats.PeakNodes, 1000)
+			assert.Nil(t, path.SelectLocated(input))
+
+			relative, err := p.ParseRelative("@" + expr[1:])
+			require.NoError(t, err)
+			_, err = LocatedNodeList{{Value: input}}.Query(relative)
+			require.ErrorIs(t, err, ErrTooManyNodes)
+		})
+	}
+
+	t.Run("within_limit", func(t *testing.T) {
+		res, stats, err := p.MustParse("$.rows[1:5].*").SelectE(input)
+		require.NoError(t, err)
+		assert.Len(t, res, 400)
+		assert.Equal(t, 400, stats.PeakNodes)
+
+		rev, _, err := p.Clone(WithReverseOrder()).MustParse("$.rows[1:5].*").SelectE(input)
+		require.NoError(t, err)
+		assert.Len(t, rev, 400)
+	})
+
+	t.Run("reverse_order", func(t *testing.T) {
+		_, _, err := p.Clone(WithReverseOrder()).MustParse(expr).SelectE(input)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+	})
+
+	t.Run("logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+		_, _, err := p.Clone(WithLogger(logger, slog.LevelInfo)).MustParse(expr).SelectE(input)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+		assert.Contains(t, buf.String(), "method=SelectE")
+		assert.Contains(t, buf.String(), "error=")
+		assert.Contains(t, buf.String(), "peak_nodes=")
+	})
+}
+
+func TestWithMaxResults(t *testing.T) {
+	input := map[string]any{
+		"a": []any{1.0, 2.0, 3.0, map[string]any{"b": []any{4.0, 5.0}}},
+		"c": map[string]any{"d": 6.0},
+	}
+	p := NewParser(WithMaxResults(3))
+	for _, expr := range []string{"$.a[*]", "$.a[0,1,2,3]", "$.a[1:]", "$.a..*", "$.a[?@ > 1]", "$.a[*].b[*]", "$.c.d", "$"} {
+		t.Run(expr, func(t *testing.T) {
+			want := MustParse(expr).Select(input)
+			want = want[:min(len(want), 3)]
+			path := p.MustParse(expr)
+			assert.Equal(t, want, path.Select(input))
+			assert.Equal(t, len(want), path.Count(input))
+
+			located := path.SelectLocated(input)
+			assert.Equal(t, MustParse(expr).SelectLocated(input)[:len(want)], located)
+		})
+	}
+
+	t.Run("reverse_order", func(t *testing.T) {
+		rev := p.Clone(WithReverseOrder()).MustParse("$.a[*]")
+		assert.Equal(t, NodeList{map[string]any{"b": []any{4.0, 5.0}}, 3.0, 2.0}, rev.Select(input))
+	})
+
+	t.Run("visits_prefix", func(t *testing.T) {
+		big := make([]any, 1_000_000)
+		for i := range big {
+			big[i] = float64(i)
+		}
+		path := NewParser(WithMaxResults(10)).MustParse("$[*]")
+		// Count the nodes evaluation touches through the conversion hook.
+		var touched int
+		path.opts.convert = func(node any) any {
+			touched++
+			return node
+		}
+		got, stats, err := path.SelectE(big)
+		require.NoError(t, err)
+		assert.Equal(t, NodeList(big[:10]), got)
+		assert.Equal(t, 10, stats.PeakNodes)
+		assert.Less(t, touched, 100)
+
+		touched = 0
+		located := path.SelectLocated(big)
+		assert.Len(t, located, 10)
+		assert.Equal(t, "$[9]", located[9].Path.String())
+		assert.Less(t, touched, 100)
+	})
+
+	t.Run("intermediate_nodes_not_limited", func(t *testing.T) {
+		res, stats, err := p.MustParse("$..*[?@ == 6]").SelectE(input)
+		require.NoError(t, err)
+		assert.Equal(t, NodeList{6.0}, res)
+		assert.Greater(t, stats.PeakNodes, 3)
+	})
+
+	t.Run("with_max_intermediate_nodes", func(t *testing.T) {
+		_, _, err := p.Clone(WithMaxIntermediateNodes(2)).MustParse("$.a[*]").SelectE(input)
+		require.ErrorIs(t, err, ErrTooManyNodes)
+	})
+}
+
+func TestWithMaxDepth(t *testing.T) {
+	// nested returns 1 wrapped in n arrays, so that it lies n levels deep.
+	nested := func(n int) any {
+		var doc any = 1.0
+		for range n {
+			doc = []any{doc}
+		}
+		return doc
+	}
+
+	t.Run("deep_document", func(t *testing.T) {
+		doc := nested(10_000)
+		p := NewParser(WithMaxDepth(100))
+		// Counted one node at a time, evaluation stops at the limit: the
+		// selectors apply to the nodes up to 100 levels deep, whose children
+		// reach one level further.
+		for expr, count := range map[string]int{"$..*": 101, "$..[0]": 101, "$[0]..*": 101, "$..[?@ == 1]": 0} {
+			path := p.MustParse(expr)
+			res, _, err := path.SelectE(doc)
+			require.ErrorIs(t, err, ErrDocumentTooDeep, expr)
+			assert.Nil(t, res)
+			assert.Nil(t, path.Select(doc))
+
+			located, _, err := path.SelectLocatedE(doc)
+			require.ErrorIs(t, err, ErrDocumentTooDeep, expr)
+			assert.Nil(t, located)
+
+			assert.Equal(t, count, path.Count(doc), expr)
+		}
+		assert.False(t, p.MustParse("$..[?@ == 1]").Exists(doc))
+	})
+
+	t.Run("within_limit", func(t *testing.T) {
+		doc := nested(10)
+		p := NewParser(WithMaxDepth(10))
+		for _, expr := range []string{"$..*", "$..[0]..[0]", "$[0]..*"} {
+			want := MustParse(expr).Select(doc)
+			res, _, err := p.MustParse(expr).SelectE(doc)
+			require.NoError(t, err, expr)
+			assert.Equal(t, want, res)
+			assert.Equal(t, len(want), p.MustParse(expr).Count(doc))
+		}
+		assert.True(t, p.MustParse("$..[?@ == 1]").Exists(doc))
+	})
+
+	t.Run("depth_per_segment", func(t *testing.T) {
+		// Below $[0] the document is 9 levels deep, and each descendant
+		// segment counts from the nodes it is applied to.
+		doc := nested(10)
+		p := NewParser(WithMaxDepth(9))
+		_, _, err := p.MustParse("$..*").SelectE(doc)
+		require.ErrorIs(t, err, ErrDocumentTooDeep)
+		for _, expr := range []string{"$[0]..*", "$[0]..[0]..[0]"} {
+			res, _, err := p.MustParse(expr).SelectE(doc)
+			require.NoError(t, err, expr)
+			assert.Equal(t, MustParse(expr).Select(doc), res)
+			assert.Equal(t, len(res), p.MustParse(expr).Count(doc), expr)
+		}
+	})
+
+	t.Run("filter_sub_query", func(t *testing.T) {
+		p := NewParser(WithMaxDepth(100))
+		doc := []any{nested(10_000)}
+		for _, expr := range []string{"$[?@..x]", "$[?count(@..*) > 0]", "$[?value($..[0]) == 1]"} {
+			path := p.MustParse(expr)
+			res, _, err := path.SelectE(doc)
+			require.ErrorIs(t, err, ErrDocumentTooDeep, expr)
+			assert.Nil(t, res)
+
+			located, _, err := path.SelectLocatedE(doc)
+			require.ErrorIs(t, err, ErrDocumentTooDeep, expr)
+			assert.Nil(t, located)
+
+			assert.Zero(t, path.Count(doc), expr)
+		}
+
+		res, _, err := p.MustParse("$[?@..x]").SelectE([]any{nested(100)})
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("reverse_order", func(t *testing.T) {
+		p := NewParser(WithMaxDepth(100), WithReverseOrder())
+		_, _, err := p.MustParse("$..*").SelectE(nested(1000))
+		require.ErrorIs(t, err, ErrDocumentTooDeep)
+		_, _, err = p.MustParse("$..*").SelectLocatedE(nested(1000))
+		require.ErrorIs(t, err, ErrDocumentTooDeep)
+	})
+}
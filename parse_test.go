@@ -2,8 +2,10 @@ package jsonpath
 
 import (
 	"encoding"
+	"slices"
 	"testing"
 
+	"github.com/agentable/jsonpath/internal/ast"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -64,6 +66,16 @@ func TestParse(t *testing.T) {
 			expr:    "",
 			wantErr: true,
 		},
+		{
+			name:    "invalid - relative",
+			expr:    "@['foo']",
+			wantErr: true,
+		},
+		{
+			name:    "relative query in filter",
+			expr:    "$[?@.a == $.b]",
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -95,6 +107,53 @@ func TestMustParse(t *testing.T) {
 	})
 }
 
+func TestParseRelative(t *testing.T) {
+	t.Parallel()
+
+	path, err := ParseRelative("@.items[-1]")
+	require.NoError(t, err)
+	assert.False(t, path.query.IsRoot())
+	assert.Equal(t, `@["items"][-1]`, path.String())
+
+	_, err = ParseRelative("$.items")
+	require.ErrorIs(t, err, ErrPathParse)
+	var pe *ParseError
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, 0, pe.Pos)
+	assert.Equal(t, []string{"@"}, pe.Expected)
+
+	_, err = ParseRelative("@.items[")
+	require.ErrorIs(t, err, ErrPathParse)
+
+	assert.Panics(t, func() { MustParseRelative("$") })
+}
+
+func TestPath_SelectFrom(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"limit": 2.0,
+		"pods": []any{
+			map[string]any{"status": map[string]any{"phase": "Running"}, "restarts": 1.0},
+			map[string]any{"status": map[string]any{"phase": "Failed"}, "restarts": 3.0},
+		},
+	}
+	pod := doc["pods"].([]any)[1]
+
+	phase := MustParseRelative("@.status.phase")
+	assert.Equal(t, NodeList{"Failed"}, phase.SelectFrom(pod, doc))
+	assert.Equal(t, NodeList{pod}, MustParseRelative("@").SelectFrom(pod, doc))
+
+	over := MustParseRelative("@[?@.restarts > $.limit].status.phase")
+	assert.Equal(t, NodeList{"Failed"}, over.SelectFrom(doc["pods"], doc))
+	assert.Empty(t, over.SelectFrom(doc["pods"], map[string]any{"limit": 5.0}))
+
+	rooted := MustParse("$.limit")
+	assert.Equal(t, NodeList{2.0}, rooted.SelectFrom(pod, doc))
+	assert.Equal(t, phase.Select(pod), phase.SelectFrom(pod, pod))
+	assert.Empty(t, phase.SelectFrom(nil, doc))
+}
+
 func TestPath_String(t *testing.T) {
 	tests := []struct {
 		name string
@@ -109,7 +168,7 @@ func TestPath_String(t *testing.T) {
 		{
 			name: "name selector",
 			expr: "$['store']",
-			want: "$[\"store\"]",
+			want: `$["store"]`,
 		},
 		{
 			name: "index selector",
@@ -129,29 +188,178 @@ func TestPath_String(t *testing.T) {
 		{
 			name: "dot notation",
 			expr: "$.store",
-			want: "$[\"store\"]",
+			want: `$["store"]`,
 		},
 		{
 			name: "descendant",
 			expr: "$..book",
-			want: "$..\"book\"",
+			want: `$..["book"]`,
+		},
+		{
+			name: "escapes",
+			expr: `$['a\u0001"b\\\'c\/\t']`,
+			want: `$["a\u0001\"b\\'c/\t"]`,
+		},
+		{
+			name: "non-BMP runes",
+			expr: `$['😀\ud83d\ude00']`,
+			want: `$["😀😀"]`,
+		},
+		{
+			name: "filter comparison",
+			expr: "$.book[?@.price<10]",
+			want: `$["book"][?@["price"] < 10]`,
+		},
+		{
+			name: "filter logical operators",
+			expr: "$[?@.a==1&&@.b!=2||@.c>=3]",
+			want: `$[?@["a"] == 1 && @["b"] != 2 || @["c"] >= 3]`,
+		},
+		{
+			name: "filter negation",
+			expr: "$[?!@.a && !(@.b<=$.max) && !match(@.c, 'x')]",
+			want: `$[?!@["a"] && !(@["b"] <= $["max"]) && !match(@["c"], "x")]`,
+		},
+		{
+			name: "filter nested parens",
+			expr: "$[?((@.a>1 || @.b<2) && (@.c))]",
+			want: `$[?((@["a"] > 1 || @["b"] < 2) && (@["c"]))]`,
+		},
+		{
+			name: "filter functions",
+			expr: "$[?length(@.tags)==count(@.*) && search(value(@..id), '^a.*')]",
+			want: `$[?length(@["tags"]) == count(@[*]) && search(value(@..["id"]), "^a.*")]`,
+		},
+		{
+			name: "filter literals",
+			expr: "$[?@.a==true || @.b==false || @.c==null || 1.5e3<@.d || @.e==-0.0 || @.f==2.50]",
+			want: `$[?@["a"] == true || @["b"] == false || @["c"] == null || 1500.0 < @["d"] || @["e"] == -0.0 || @["f"] == 2.5]`,
+		},
+		{
+			name: "filter escaped strings",
+			expr: `$[?@.s=='it\'s "q" \\ \u0007']`,
+			want: `$[?@["s"] == "it's \"q\" \\ \u0007"]`,
+		},
+		{
+			name: "nested filter",
+			expr: "$[?@[?@.x=='y']]",
+			want: `$[?@[?@["x"] == "y"]]`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			path := MustParse(tt.expr)
-			got := path.String()
-			assert.NotEmpty(t, got)
-			// The canonical form may differ from input, so just verify it's not empty
-			// and can be parsed back
+			got := MustParse(tt.expr).String()
+			assert.Equal(t, tt.want, got)
 			reparsed, err := Parse(got)
 			require.NoError(t, err)
-			assert.NotNil(t, reparsed)
+			assert.Equal(t, got, reparsed.String())
 		})
 	}
 }
 
+func TestPath_String_RoundTrip(t *testing.T) {
+	exprs := append(slices.Clone(fuzzSeeds), ctsSelectors(t)...)
+	// Names as written in single-quoted string literals.
+	for _, name := range []string{
+		`\'`, `"`, `\\`, `\\\'"`, `\u0000`, `\u001f`, `\b\f\n\r\t`, "\u007f",
+		"é", "😀", `\ud83d\ude00`, `\u2028`, `\ufeff`, "a b", "",
+	} {
+		for _, expr := range []string{"$['" + name + "']", "$..['x']['" + name + "',0]"} {
+			require.True(t, Valid(expr), expr)
+			exprs = append(exprs, expr)
+		}
+	}
+	for _, expr := range exprs {
+		p, err := Parse(expr)
+		if err != nil {
+			continue
+		}
+		s := p.String()
+		again, err := Parse(s)
+		require.NoError(t, err, "Parse(%q).String() = %q", expr, s)
+		if !hasFilter(p.query) {
+			assert.True(t, slices.EqualFunc(p.query.Segments(), again.query.Segments(), func(a, b ast.Segment) bool {
+				return a.Equal(&b)
+			}), "Parse(%q).String() = %q reparses as %q", expr, s, again)
+		}
+		assert.Equal(t, s, again.String())
+
+		short, err := Parse(p.Shorthand())
+		require.NoError(t, err, "Parse(%q).Shorthand() = %q", expr, p.Shorthand())
+		assert.Equal(t, s, short.String(), "Parse(%q).Shorthand() = %q", expr, p.Shorthand())
+	}
+}
+
+func TestPath_Normalized(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+		ok   bool
+	}{
+		{"$", "$", true},
+		{"$.store.book[0].title", "$['store']['book'][0]['title']", true},
+		{`$["a'b"]`, `$['a\'b']`, true},
+		{`$['a\\b"c']`, `$['a\\b"c']`, true},
+		{`$['\b\f\n\r\t']`, `$['\b\f\n\r\t']`, true},
+		{`$['\u0000\u000b\u001F\u007f']`, "$['\\u0000\\u000b\\u001f\u007f']", true},
+		{`$['\/é😀']`, `$['/é😀']`, true},
+		{"$[-1]", "", false},
+		{"$.a[-1].b", "", false},
+		{"$[0,1]", "", false},
+		{"$[*]", "", false},
+		{"$[0:1]", "", false},
+		{"$..a", "", false},
+		{"$[?@.a]", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := MustParse(tt.expr).Normalized()
+		assert.Equal(t, tt.ok, ok, tt.expr)
+		assert.Equal(t, tt.want, got, tt.expr)
+	}
+
+	_, ok := MustParseRelative("@.a").Normalized()
+	assert.False(t, ok)
+	_, ok = (&Path{}).Normalized()
+	assert.False(t, ok)
+
+	doc := map[string]any{"a\n'": []any{1, map[string]any{"\u0001": true}}}
+	p := MustParse(`$['a\n\''][1]['\u0001']`)
+	norm, ok := p.Normalized()
+	require.True(t, ok)
+	located := p.SelectLocated(doc)
+	require.Len(t, located, 1)
+	assert.Equal(t, located[0].Path.String(), norm)
+}
+
+func TestPath_Shorthand(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"$", "$"},
+		{"$['store']['book'][0]", "$.store.book[0]"},
+		{"$..book..['price']", "$..book..price"},
+		{"$.café._x1.true", "$.café._x1.true"},
+		{"$['a b']['1a']['a-b']['']", `$["a b"]["1a"]["a-b"][""]`},
+		{"$['a','b'][*]..[*]", `$["a","b"][*]..[*]`},
+		{"$['\\u00e9']", "$.é"},
+		{"$['book'][?@['price'] < $['max'] && length(@['a b']) > 0]", `$.book[?@.price < $.max && length(@["a b"]) > 0]`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, MustParse(tt.expr).Shorthand(), tt.expr)
+	}
+	assert.Equal(t, "@.a[0]", MustParseRelative("@['a'][0]").Shorthand())
+	assert.Empty(t, (&Path{}).Shorthand())
+}
+
+func TestPath_Redacted(t *testing.T) {
+	path := MustParse("$.users[?@.password == 's3cr3t' || match(@.name, 'adm.*')].id")
+	assert.Equal(t, `$["users"][?]["id"]`, path.Redacted())
+	assert.Equal(t, `$["a"][:2]`, MustParse("$.a[:2]").Redacted())
+	assert.Empty(t, (&Path{}).Redacted())
+}
+
 func TestPath_String_NilQuery(t *testing.T) {
 	path := &Path{query: nil}
 	assert.Equal(t, "", path.String())
@@ -190,6 +398,12 @@ func TestPath_UnmarshalText(t *testing.T) {
 		err := p.UnmarshalText([]byte("invalid"))
 		assert.Error(t, err)
 	})
+
+	t.Run("relative expression", func(t *testing.T) {
+		var p Path
+		require.NoError(t, p.UnmarshalText([]byte("@.a")))
+		assert.False(t, p.query.IsRoot())
+	})
 }
 
 func TestPath_MarshalUnmarshal_RoundTrip(t *testing.T) {
@@ -271,3 +485,21 @@ func TestParse_Integration(t *testing.T) {
 		})
 	}
 }
+
+func TestParse_NumberLiterals(t *testing.T) {
+	input := []any{
+		map[string]any{"a": 1e20},
+		map[string]any{"a": 1.0},
+	}
+	path, err := Parse("$[?@.a == 100000000000000000000]")
+	require.NoError(t, err)
+	assert.Equal(t, []any{input[0]}, []any(path.Select(input)))
+
+	for _, expr := range []string{"$[?@.a == 1e999]", "$[?@.a > -1e400]"} {
+		_, err := Parse(expr)
+		require.ErrorIs(t, err, ErrPathParse, expr)
+		var pe *ParseError
+		require.ErrorAs(t, err, &pe, expr)
+		assert.Equal(t, "invalid number literal", pe.Msg, expr)
+	}
+}
@@ -0,0 +1,165 @@
+package jsonpath
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// PatchOp is one RFC 6902 JSON Patch operation. Path is an RFC 6901 JSON
+// Pointer. Value is marshaled for the operations that take one (add, replace
+// and test), even when it is nil, and omitted for all others.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// hasValue reports whether the operation carries a value member.
+func (op PatchOp) hasValue() bool {
+	switch op.Op {
+	case "add", "replace", "test":
+		return true
+	default:
+		return false
+	}
+}
+
+// MarshalJSON implements json.Marshaler, keeping a null value member for
+// operations that take a value.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	if !op.hasValue() {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path}, decodeOptions)
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{op.Op, op.Path, op.Value}, decodeOptions)
+}
+
+// ToPatchTests returns an RFC 6902 test operation for each node in list, in
+// list order, asserting that the document still holds the node's value at the
+// node's location. Values are deep-copied, so the operations keep describing
+// the snapshot when the document is modified afterwards. Applying them
+// before a write to the same document makes the write conditional on the
+// selected values being unchanged.
+func (l LocatedNodeList) ToPatchTests() []PatchOp {
+	if len(l) == 0 {
+		return nil
+	}
+	ops := make([]PatchOp, len(l))
+	for i, ptr := range l.Pointers() {
+		ops[i] = PatchOp{Op: "test", Path: ptr, Value: deepCopy(l[i].Value)}
+	}
+	return ops
+}
+
+// ToReplacePatch returns an RFC 6902 replace operation setting each location
+// in list to newValue, in path order. A location repeated in list or inside
+// another replaced location is left out, as replacing the outer location
+// discards it and the patch would no longer apply. Applied to the document
+// the nodes were selected from, the patch has the effect of [Path.Set]. The
+// operations share newValue rather than copying it, and list itself is not
+// reordered.
+func (l LocatedNodeList) ToReplacePatch(newValue any) []PatchOp {
+	if len(l) == 0 {
+		return nil
+	}
+	nodes := slices.Clone(l)
+	nodes.Sort()
+	nodes = outermost(nodes)
+	ops := make([]PatchOp, len(nodes))
+	for i, ptr := range nodes.Pointers() {
+		ops[i] = PatchOp{Op: "replace", Path: ptr, Value: newValue}
+	}
+	return ops
+}
+
+// ToRemovePatch returns an RFC 6902 remove operation for each location in
+// list, ordered so that the patch stays valid when its operations are
+// applied in turn: locations come in reverse path order, so the later
+// elements of an array are removed before the earlier ones, and a location
+// repeated in list or inside another removed location is left out. Applied to
+// the document the nodes were selected from, the patch has the effect of
+// [Path.Prune]. list itself is not reordered.
+func (l LocatedNodeList) ToRemovePatch() []PatchOp {
+	if len(l) == 0 {
+		return nil
+	}
+	nodes := slices.Clone(l)
+	nodes.Sort()
+	nodes = outermost(nodes)
+	slices.Reverse(nodes)
+	ops := make([]PatchOp, len(nodes))
+	for i, ptr := range nodes.Pointers() {
+		ops[i] = PatchOp{Op: "remove", Path: ptr}
+	}
+	return ops
+}
+
+// deepCopy returns a copy of v that shares no map, slice or raw JSON with it.
+// A map or slice reachable more than once from v, including one holding
+// itself, is copied once and the copy reused, so the copy has the shape of v
+// and copying a cyclic document ends. Values outside the JSON data model are
+// returned as is.
+func deepCopy(v any) any {
+	var copies map[ast.Container]any
+	return copyValue(v, &copies)
+}
+
+// copyValue is [deepCopy] with the copies made so far, keyed by the container
+// they copy, allocated on first use.
+func copyValue(v any, copies *map[ast.Container]any) any {
+	id := ast.ContainerOf(v)
+	if id != (ast.Container{}) {
+		if c, ok := (*copies)[id]; ok {
+			return c
+		}
+		if *copies == nil {
+			*copies = make(map[ast.Container]any)
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		(*copies)[id] = m
+		for k, child := range v {
+			m[k] = copyValue(child, copies)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		if len(v) > 0 {
+			(*copies)[id] = s
+		}
+		for i, child := range v {
+			s[i] = copyValue(child, copies)
+		}
+		return s
+	case map[int]any:
+		m := make(map[int]any, len(v))
+		(*copies)[id] = m
+		for k, child := range v {
+			m[k] = copyValue(child, copies)
+		}
+		return m
+	case map[int64]any:
+		m := make(map[int64]any, len(v))
+		(*copies)[id] = m
+		for k, child := range v {
+			m[k] = copyValue(child, copies)
+		}
+		return m
+	case jsontext.Value:
+		return jsontext.Value(bytes.Clone(v))
+	default:
+		return v
+	}
+}
@@ -0,0 +1,287 @@
+package jsonpath
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/agentable/jsonpath/internal/ast"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyPatch applies the JSON Patch document patch to doc with an RFC 6902
+// implementation independent of this package, and returns the patched
+// document.
+func applyPatch(doc any, patch []byte) (any, error) {
+	ops, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	src, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	out, err := ops.Apply(src)
+	if err != nil {
+		return nil, err
+	}
+	var patched any
+	if err := json.Unmarshal(out, &patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+func TestLocatedNodeList_ToPatchTests(t *testing.T) {
+	src := []byte(`{
+		"store": {
+			"book": [
+				{"title": "A", "price": 8.95, "tags": ["x", "y"]},
+				{"title": "B", "price": 12.99, "isbn": null},
+				{"title": "C", "price": 8.99}
+			],
+			"a/b~c": {"n": 1}
+		}
+	}`)
+	parse := func(t *testing.T) any {
+		t.Helper()
+		var doc any
+		require.NoError(t, json.Unmarshal(src, &doc))
+		return doc
+	}
+
+	for _, expr := range []string{
+		"$",
+		"$..price",
+		"$.store.book[?@.price < 10]",
+		"$.store.book[1].isbn",
+		"$.store['a/b~c']",
+		"$..tags[*]",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			doc := parse(t)
+			located := MustParse(expr).SelectLocated(doc)
+			ops := located.ToPatchTests()
+			require.Len(t, ops, len(located))
+			for i, op := range ops {
+				assert.Equal(t, "test", op.Op)
+				assert.Equal(t, located[i].Path.Pointer(), op.Path)
+			}
+
+			patch, err := json.Marshal(ops)
+			require.NoError(t, err)
+			_, err = applyPatch(parse(t), patch)
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("null_value_kept", func(t *testing.T) {
+		ops := MustParse("$.store.book[1].isbn").SelectLocated(parse(t)).ToPatchTests()
+		patch, err := json.Marshal(ops)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"op":"test","path":"/store/book/1/isbn","value":null}]`, string(patch))
+	})
+
+	t.Run("snapshot_survives_mutation", func(t *testing.T) {
+		doc := parse(t)
+		ops := MustParse("$.store.book[0]").SelectLocated(doc).ToPatchTests()
+		book := doc.(map[string]any)["store"].(map[string]any)["book"].([]any)[0].(map[string]any)
+		book["price"] = 9.95
+		book["tags"].([]any)[0] = "z"
+
+		assert.InDelta(t, 8.95, ops[0].Value.(map[string]any)["price"], 0)
+		assert.Equal(t, []any{"x", "y"}, ops[0].Value.(map[string]any)["tags"])
+		patch, err := json.Marshal(ops)
+		require.NoError(t, err)
+		_, err = applyPatch(doc, patch)
+		require.ErrorIs(t, err, jsonpatch.ErrTestFailed)
+		_, err = applyPatch(parse(t), patch)
+		assert.NoError(t, err)
+	})
+
+	t.Run("cyclic_document", func(t *testing.T) {
+		doc := map[string]any{"x": 1.0}
+		doc["self"] = doc
+		ops := MustParse("$.self").SelectLocated(doc).ToPatchTests()
+		require.Len(t, ops, 1)
+		snap := ops[0].Value.(map[string]any)
+		assert.InDelta(t, 1.0, snap["x"], 0)
+		assert.Equal(t, ast.ContainerOf(snap), ast.ContainerOf(snap["self"]))
+		doc["x"] = 2.0
+		assert.InDelta(t, 1.0, snap["x"], 0)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Nil(t, MustParse("$.missing").SelectLocated(parse(t)).ToPatchTests())
+	})
+}
+
+func TestLocatedNodeList_ToReplacePatch(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`{"a": [1, [2, 3], {"b": 4}], "c~/": {"b": 5}, "d": null}`)
+	parse := func(t *testing.T) any {
+		t.Helper()
+		var doc any
+		require.NoError(t, json.Unmarshal(src, &doc))
+		return doc
+	}
+
+	for _, expr := range []string{
+		"$..b",
+		"$.a[*]",
+		"$.a[2,0,2]",
+		"$..*",
+		"$['c~/']",
+		"$.d",
+		"$.missing",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+			value := map[string]any{"new": true}
+			ops := MustParse(expr).SelectLocated(parse(t)).ToReplacePatch(value)
+			patch, err := json.Marshal(ops)
+			require.NoError(t, err)
+			got, err := applyPatch(parse(t), patch)
+			require.NoError(t, err)
+
+			want := parse(t)
+			_, err = MustParse(expr).Set(want, value)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	t.Run("ops", func(t *testing.T) {
+		t.Parallel()
+		located := MustParse("$.a[1,0]").SelectLocated(parse(t))
+		before := slices.Clone(located)
+		ops := located.ToReplacePatch(nil)
+		assert.Equal(t, before, located)
+		assert.Equal(t, []PatchOp{
+			{Op: "replace", Path: "/a/0"},
+			{Op: "replace", Path: "/a/1"},
+		}, ops)
+		patch, err := json.Marshal(ops)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"op":"replace","path":"/a/0","value":null},{"op":"replace","path":"/a/1","value":null}]`, string(patch))
+
+		ops = MustParse("$..*").SelectLocated(parse(t)).ToReplacePatch(0)
+		assert.Len(t, ops, 3)
+		assert.Nil(t, LocatedNodeList(nil).ToReplacePatch(1))
+	})
+}
+
+func TestLocatedNodeList_ToRemovePatch(t *testing.T) {
+	t.Parallel()
+
+	src := []byte(`{"a": [1, [2, 3, [4]], {"b": 4}, 5], "c~/": {"b": 5}, "d": null}`)
+	parse := func(t *testing.T) any {
+		t.Helper()
+		var doc any
+		require.NoError(t, json.Unmarshal(src, &doc))
+		return doc
+	}
+
+	for _, expr := range []string{
+		"$..b",
+		"$.a[*]",
+		"$.a[0,3,1,0]",
+		"$..[0]",
+		"$..*",
+		"$.a[1][::-1]",
+		"$['c~/']",
+		"$.d",
+		"$.missing",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			t.Parallel()
+			located := MustParse(expr).SelectLocated(parse(t))
+			before := slices.Clone(located)
+			ops := located.ToRemovePatch()
+			assert.Equal(t, before, located)
+
+			patch, err := json.Marshal(ops)
+			require.NoError(t, err)
+			got, err := applyPatch(parse(t), patch)
+			require.NoError(t, err)
+			assert.Equal(t, MustParse(expr).Prune(parse(t)), got)
+		})
+	}
+
+	t.Run("ops", func(t *testing.T) {
+		t.Parallel()
+		ops := MustParse("$.a[0,3,1,0]").SelectLocated(parse(t)).ToRemovePatch()
+		assert.Equal(t, []PatchOp{
+			{Op: "remove", Path: "/a/3"},
+			{Op: "remove", Path: "/a/1"},
+			{Op: "remove", Path: "/a/0"},
+		}, ops)
+		patch, err := json.Marshal(ops)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"op":"remove","path":"/a/3"},{"op":"remove","path":"/a/1"},{"op":"remove","path":"/a/0"}]`, string(patch))
+
+		ops = MustParse("$.a..*").SelectLocated(parse(t)).ToRemovePatch()
+		assert.Equal(t, []PatchOp{
+			{Op: "remove", Path: "/a/3"},
+			{Op: "remove", Path: "/a/2"},
+			{Op: "remove", Path: "/a/1"},
+			{Op: "remove", Path: "/a/0"},
+		}, ops)
+		assert.Nil(t, LocatedNodeList(nil).ToRemovePatch())
+	})
+}
+
+func TestPatchOp_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		op   PatchOp
+		want string
+	}{
+		{PatchOp{Op: "test", Path: "/a", Value: nil}, `{"op":"test","path":"/a","value":null}`},
+		{PatchOp{Op: "replace", Path: "/a", Value: []any{1.0}}, `{"op":"replace","path":"/a","value":[1]}`},
+		{PatchOp{Op: "add", Path: "/a/-", Value: "x"}, `{"op":"add","path":"/a/-","value":"x"}`},
+		{PatchOp{Op: "remove", Path: "/a/0"}, `{"op":"remove","path":"/a/0"}`},
+	} {
+		got, err := json.Marshal(tc.op)
+		require.NoError(t, err)
+		assert.JSONEq(t, tc.want, string(got))
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	t.Parallel()
+
+	orig := map[string]any{
+		"list":   []any{map[string]any{"a": 1.0}},
+		"sparse": map[int]any{1: []any{"x"}},
+		"wide":   map[int64]any{2: map[string]any{}},
+		"raw":    jsontext.Value(`[1]`),
+	}
+	cp := deepCopy(orig).(map[string]any)
+	assert.Equal(t, orig, cp)
+
+	cp["list"].([]any)[0].(map[string]any)["a"] = 2.0
+	cp["sparse"].(map[int]any)[1].([]any)[0] = "y"
+	cp["wide"].(map[int64]any)[2].(map[string]any)["k"] = true
+	cp["raw"].(jsontext.Value)[1] = '2'
+	assert.InDelta(t, 1.0, orig["list"].([]any)[0].(map[string]any)["a"], 0)
+	assert.Equal(t, "x", orig["sparse"].(map[int]any)[1].([]any)[0])
+	assert.Empty(t, orig["wide"].(map[int64]any)[2])
+	assert.Equal(t, jsontext.Value(`[1]`), orig["raw"])
+
+	t.Run("shared_and_cyclic", func(t *testing.T) {
+		shared := []any{1.0}
+		orig := map[string]any{"a": shared, "b": shared}
+		orig["self"] = orig
+		cp := deepCopy(orig).(map[string]any)
+		assert.Equal(t, ast.ContainerOf(cp), ast.ContainerOf(cp["self"]))
+		assert.Equal(t, ast.ContainerOf(cp["a"]), ast.ContainerOf(cp["b"]))
+		assert.NotEqual(t, ast.ContainerOf(orig), ast.ContainerOf(cp))
+		assert.NotEqual(t, ast.ContainerOf(shared), ast.ContainerOf(cp["a"]))
+	})
+}
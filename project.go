@@ -0,0 +1,220 @@
+package jsonpath
+
+import (
+	"context"
+	"slices"
+)
+
+// Project returns a new document holding only the nodes p matches in input,
+// each at its original location, inside copies of the objects and arrays
+// that lead to it. For $.store.book[*].title it returns the book titles as
+// {"store":{"book":[{"title":...},{"title":...}]}}, which suits partial
+// responses and field masks.
+//
+// Matched nodes are deep-copied whole, so a node matched along with some of
+// its descendants, as by $..*, appears once with all its contents, and the
+// result shares no map or slice with input. A map or slice reached more than
+// once within a copied node, as in a cyclic input, is copied once, so the
+// copy keeps the cycle rather than unrolling it. The matched elements of an array
+// are packed in index order unless p was compiled with
+// [WithSparseProjection]; sparse arrays keep their keys. The query $ returns
+// a copy of input. Project returns nil if p matches nothing or evaluation
+// fails, as [Path.SelectLocatedE] reports.
+func (p *Path) Project(input any) any {
+	nodes, _, err := p.selectLocatedLogged(context.Background(), "Project", nil, input)
+	if err != nil || len(nodes) == 0 {
+		return nil
+	}
+	return newMatchTree(input, nodes).project(p.opts.sparseProjection)
+}
+
+// Prune returns a deep copy of input without the nodes p matches in it, the
+// inverse of [Path.Project]: $..internal strips every internal member. The
+// elements of an array that follow a removed one move up to close the gap,
+// and a removed node takes all its descendants with it, whether p matches
+// them or not. Copies keep the cycles of a cyclic input, as [Path.Project]
+// does. input itself is never modified. Prune returns nil if p
+// matches input itself, and, as [Path.Project] does, if evaluation fails.
+func (p *Path) Prune(input any) any {
+	nodes, _, err := p.selectLocatedLogged(context.Background(), "Prune", nil, input)
+	if err != nil {
+		return nil
+	}
+	if len(nodes) == 0 {
+		return deepCopy(input)
+	}
+	return newMatchTree(input, nodes).prune(input)
+}
+
+// matchTree is a node of the tree formed by the paths of a node list: either
+// a matched node, or an object or array holding the trees of those of its
+// members or elements that are or contain matched nodes.
+type matchTree struct {
+	matched bool
+	value   any // the matched node, if matched
+	src     any // the input container, if not matched
+	members map[string]*matchTree
+	indexes []int64 // ascending
+	elems   []*matchTree
+}
+
+// newMatchTree returns the tree of the paths of nodes, which were selected
+// from input, sorting and shortening nodes in the process. Nodes inside
+// other matched nodes are left out.
+func newMatchTree(input any, nodes LocatedNodeList) *matchTree {
+	nodes.Sort()
+	var root matchTree
+	for _, n := range outermost(nodes) {
+		t, src := &root, input
+		for _, elem := range n.Path {
+			t.src = src
+			t = t.child(elem)
+			src, _ = slot{parent: src, elem: elem}.lookup()
+		}
+		t.matched, t.value = true, n.Value
+	}
+	return &root
+}
+
+// outermost removes from nodes, which must be sorted, every node at or
+// inside the location of an earlier one, and returns the shortened list.
+func outermost(nodes LocatedNodeList) LocatedNodeList {
+	out := nodes[:0]
+	var last NormalizedPath
+	for i, n := range nodes {
+		// Sorting puts the descendants of a node right after it.
+		if i > 0 && n.Path.HasPrefix(last) {
+			continue
+		}
+		out = append(out, n)
+		last = n.Path
+	}
+	return out
+}
+
+// child returns the tree of the member or element elem of t, adding it if
+// needed. Elements must be added in ascending index order.
+func (t *matchTree) child(elem PathElement) *matchTree {
+	switch elem := elem.(type) {
+	case NameElement:
+		c := t.members[string(elem)]
+		if c == nil {
+			if t.members == nil {
+				t.members = make(map[string]*matchTree)
+			}
+			c = &matchTree{}
+			t.members[string(elem)] = c
+		}
+		return c
+	case IndexElement:
+		if n := len(t.indexes); n > 0 && t.indexes[n-1] == int64(elem) {
+			return t.elems[n-1]
+		}
+		c := &matchTree{}
+		t.indexes = append(t.indexes, int64(elem))
+		t.elems = append(t.elems, c)
+		return c
+	default:
+		return &matchTree{}
+	}
+}
+
+// at returns the tree of the element at index i of t, or nil if there is
+// none.
+func (t *matchTree) at(i int64) *matchTree {
+	if j, ok := slices.BinarySearch(t.indexes, i); ok {
+		return t.elems[j]
+	}
+	return nil
+}
+
+// project returns a copy of the matched nodes in t laid out as in the
+// input, with array elements at their original indexes if sparse is set.
+func (t *matchTree) project(sparse bool) any {
+	if t.matched {
+		return deepCopy(t.value)
+	}
+	if t.members != nil {
+		m := make(map[string]any, len(t.members))
+		for name, c := range t.members {
+			m[name] = c.project(sparse)
+		}
+		return m
+	}
+	switch t.src.(type) {
+	case map[int]any:
+		m := make(map[int]any, len(t.elems))
+		for i, c := range t.elems {
+			m[int(t.indexes[i])] = c.project(sparse)
+		}
+		return m
+	case map[int64]any:
+		m := make(map[int64]any, len(t.elems))
+		for i, c := range t.elems {
+			m[t.indexes[i]] = c.project(sparse)
+		}
+		return m
+	}
+	if !sparse {
+		arr := make([]any, len(t.elems))
+		for i, c := range t.elems {
+			arr[i] = c.project(sparse)
+		}
+		return arr
+	}
+	arr := make([]any, t.indexes[len(t.indexes)-1]+1)
+	for i, c := range t.elems {
+		arr[t.indexes[i]] = c.project(sparse)
+	}
+	return arr
+}
+
+// prune returns a deep copy of node, whose tree t is, without the matched
+// nodes in t, or nil if t is matched itself.
+func (t *matchTree) prune(node any) any {
+	if t.matched {
+		return nil
+	}
+	switch node := node.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(node))
+		for name, v := range node {
+			if c := t.members[name]; c == nil {
+				m[name] = deepCopy(v)
+			} else if !c.matched {
+				m[name] = c.prune(v)
+			}
+		}
+		return m
+	case []any:
+		arr := make([]any, 0, len(node))
+		for i, v := range node {
+			if c := t.at(int64(i)); c == nil {
+				arr = append(arr, deepCopy(v))
+			} else if !c.matched {
+				arr = append(arr, c.prune(v))
+			}
+		}
+		return arr
+	case map[int]any:
+		return pruneSparse(t, node)
+	case map[int64]any:
+		return pruneSparse(t, node)
+	default:
+		return deepCopy(node)
+	}
+}
+
+// pruneSparse is [matchTree.prune] for a sparse array, which keeps the keys
+// of the elements that remain.
+func pruneSparse[K int | int64](t *matchTree, node map[K]any) map[K]any {
+	m := make(map[K]any, len(node))
+	for k, v := range node {
+		if c := t.at(int64(k)); c == nil {
+			m[k] = deepCopy(v)
+		} else if !c.matched {
+			m[k] = c.prune(v)
+		}
+	}
+	return m
+}
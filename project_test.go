@@ -0,0 +1,276 @@
+package jsonpath
+
+import (
+	"testing"
+
+	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath_Project(t *testing.T) {
+	t.Parallel()
+
+	store := func() map[string]any {
+		return map[string]any{
+			"store": map[string]any{
+				"book": []any{
+					map[string]any{"title": "A", "price": 8.95},
+					map[string]any{"title": "B", "price": 12.99, "isbn": "x"},
+					map[string]any{"title": "C", "price": 22.99, "isbn": "y"},
+				},
+				"bicycle": map[string]any{"color": "red"},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		sparse bool
+		input  any
+		exp    any
+	}{
+		{
+			name:  "skeleton",
+			path:  "$.store.book[*].title",
+			input: store(),
+			exp: map[string]any{"store": map[string]any{"book": []any{
+				map[string]any{"title": "A"},
+				map[string]any{"title": "B"},
+				map[string]any{"title": "C"},
+			}}},
+		},
+		{
+			name:  "packed_indexes",
+			path:  "$.store.book[*].isbn",
+			input: store(),
+			exp: map[string]any{"store": map[string]any{"book": []any{
+				map[string]any{"isbn": "x"},
+				map[string]any{"isbn": "y"},
+			}}},
+		},
+		{
+			name:   "sparse_indexes",
+			path:   "$.store.book[*].isbn",
+			sparse: true,
+			input:  store(),
+			exp: map[string]any{"store": map[string]any{"book": []any{
+				nil,
+				map[string]any{"isbn": "x"},
+				map[string]any{"isbn": "y"},
+			}}},
+		},
+		{
+			name:  "index_order",
+			path:  "$[2,0]",
+			input: []any{"a", "b", "c"},
+			exp:   []any{"a", "c"},
+		},
+		{
+			name:  "several_paths",
+			path:  "$.store['bicycle', 'book'][?@.price < 10]",
+			input: store(),
+			exp: map[string]any{"store": map[string]any{"book": []any{
+				map[string]any{"title": "A", "price": 8.95},
+			}}},
+		},
+		{
+			name:  "container_copied_whole",
+			path:  "$.store.bicycle",
+			input: store(),
+			exp:   map[string]any{"store": map[string]any{"bicycle": map[string]any{"color": "red"}}},
+		},
+		{
+			name:  "overlapping_paths",
+			path:  "$.store..*",
+			input: map[string]any{"store": map[string]any{"a": []any{1, 2}}, "other": true},
+			exp:   map[string]any{"store": map[string]any{"a": []any{1, 2}}},
+		},
+		{
+			name:  "repeated_path",
+			path:  "$[0,0]",
+			input: []any{"a"},
+			exp:   []any{"a"},
+		},
+		{
+			name:  "root",
+			path:  "$",
+			input: map[string]any{"a": []any{1}},
+			exp:   map[string]any{"a": []any{1}},
+		},
+		{
+			name:  "root_and_descendants",
+			path:  "$..[0]",
+			input: []any{[]any{1, 2}, 3},
+			exp:   []any{[]any{1, 2}},
+		},
+		{
+			name:  "sparse_array",
+			path:  "$[*].v",
+			input: map[int]any{4: map[string]any{"v": 1, "w": 2}, 9: map[string]any{"w": 3}},
+			exp:   map[int]any{4: map[string]any{"v": 1}},
+		},
+		{
+			name:  "no_match",
+			path:  "$.missing",
+			input: map[string]any{"a": 1},
+			exp:   nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var opts []Option
+			if tc.sparse {
+				opts = append(opts, WithSparseProjection())
+			}
+			got := NewParser(opts...).MustParse(tc.path).Project(tc.input)
+			assert.Equal(t, tc.exp, got)
+		})
+	}
+
+	t.Run("copies", func(t *testing.T) {
+		t.Parallel()
+		doc := store()
+		got := MustParse("$.store.bicycle").Project(doc).(map[string]any)
+		got["store"].(map[string]any)["bicycle"].(map[string]any)["color"] = "blue"
+		assert.Equal(t, store(), doc)
+	})
+
+	t.Run("evaluation_error", func(t *testing.T) {
+		t.Parallel()
+		p := NewParser(WithMaxIntermediateNodes(1)).MustParse("$.store.book[*]")
+		assert.Nil(t, p.Project(store()))
+	})
+
+	t.Run("cyclic_document", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"x": 1.0}
+		doc["self"] = doc
+		got := MustParse("$.self").Project(doc).(map[string]any)
+		assert.Len(t, got, 1)
+		self := got["self"].(map[string]any)
+		assert.InDelta(t, 1.0, self["x"], 0)
+		assert.Equal(t, ast.ContainerOf(self), ast.ContainerOf(self["self"]))
+		assert.NotEqual(t, ast.ContainerOf(doc), ast.ContainerOf(self))
+	})
+}
+
+func TestPath_Prune(t *testing.T) {
+	t.Parallel()
+
+	doc := func() map[string]any {
+		return map[string]any{
+			"name":     "svc",
+			"internal": map[string]any{"token": "t"},
+			"items": []any{
+				map[string]any{"id": 1, "internal": true},
+				map[string]any{"id": 2},
+				map[string]any{"id": 3, "internal": []any{map[string]any{"internal": 0}}},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		input any
+		exp   any
+	}{
+		{
+			name:  "descendants",
+			path:  "$..internal",
+			input: doc(),
+			exp: map[string]any{
+				"name":  "svc",
+				"items": []any{map[string]any{"id": 1}, map[string]any{"id": 2}, map[string]any{"id": 3}},
+			},
+		},
+		{
+			name:  "array_elements_compact",
+			path:  "$.items[?@.id != 2]",
+			input: doc(),
+			exp: map[string]any{
+				"name":     "svc",
+				"internal": map[string]any{"token": "t"},
+				"items":    []any{map[string]any{"id": 2}},
+			},
+		},
+		{
+			name:  "indexes_out_of_order",
+			path:  "$[3,0,-1,0]",
+			input: []any{0, 1, 2, 3, 4, 5},
+			exp:   []any{1, 2, 4},
+		},
+		{
+			name:  "ancestor_wins",
+			path:  "$..[?@.id == 3]..*",
+			input: map[string]any{"a": []any{map[string]any{"id": 3, "x": []any{1, 2}}}},
+			exp:   map[string]any{"a": []any{map[string]any{}}},
+		},
+		{
+			name:  "nested_matches",
+			path:  "$..[0]",
+			input: []any{[]any{1, 2}, []any{3, []any{4, 5}}},
+			exp:   []any{[]any{[]any{5}}},
+		},
+		{
+			name:  "sparse_array",
+			path:  "$[*].v",
+			input: map[int]any{4: map[string]any{"v": 1, "w": 2}, 9: map[string]any{"w": 3}},
+			exp:   map[int]any{4: map[string]any{"w": 2}, 9: map[string]any{"w": 3}},
+		},
+		{
+			name:  "no_match",
+			path:  "$.missing",
+			input: map[string]any{"a": []any{1}},
+			exp:   map[string]any{"a": []any{1}},
+		},
+		{
+			name:  "root",
+			path:  "$",
+			input: map[string]any{"a": 1},
+			exp:   nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.exp, MustParse(tc.path).Prune(tc.input))
+		})
+	}
+
+	t.Run("source_untouched", func(t *testing.T) {
+		t.Parallel()
+		src := doc()
+		got := MustParse("$..internal").Prune(src).(map[string]any)
+		assert.Equal(t, doc(), src)
+
+		// The copy shares nothing with the source.
+		got["items"].([]any)[1].(map[string]any)["id"] = 20
+		got["name"] = "changed"
+		assert.Equal(t, doc(), src)
+	})
+
+	t.Run("evaluation_error", func(t *testing.T) {
+		t.Parallel()
+		p := NewParser(WithMaxIntermediateNodes(1)).MustParse("$.items[*]")
+		assert.Nil(t, p.Prune(doc()))
+	})
+
+	t.Run("cyclic_document", func(t *testing.T) {
+		t.Parallel()
+		doc := map[string]any{"x": 1.0}
+		doc["self"] = doc
+
+		// Only $.x goes; $.self.x is another location and stays.
+		got := MustParse("$.x").Prune(doc).(map[string]any)
+		assert.Len(t, got, 1)
+		self := got["self"].(map[string]any)
+		assert.InDelta(t, 1.0, self["x"], 0)
+		assert.Equal(t, ast.ContainerOf(self), ast.ContainerOf(self["self"]))
+		assert.Contains(t, doc, "x")
+
+		got = MustParse("$.missing").Prune(doc).(map[string]any)
+		assert.Equal(t, ast.ContainerOf(got), ast.ContainerOf(got["self"]))
+		assert.NotEqual(t, ast.ContainerOf(doc), ast.ContainerOf(got))
+	})
+}
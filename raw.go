@@ -0,0 +1,147 @@
+package jsonpath
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// QueryJSONRaw evaluates path against src and returns each selected value as
+// the raw JSON it was parsed from, preserving number formatting, string
+// escapes, member order and whitespace. Selection follows [QueryJSON]; only
+// the representation of the results differs. Results alias src, so src must
+// not be modified while they are in use. Values that do not appear in src,
+// such as members computed by [WithMemberResolver], are marshaled instead.
+func QueryJSONRaw(src []byte, path *Path) ([]jsontext.Value, error) {
+	located, err := QueryJSONRawLocated(src, path)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]jsontext.Value, len(located))
+	for i, n := range located {
+		out[i] = n.Value.(jsontext.Value)
+	}
+	return out, nil
+}
+
+// QueryJSONRawLocated is the located variant of [QueryJSONRaw]. The Value of
+// each returned node is a [jsontext.Value].
+//
+// src is validated but not decoded. The query walks its raw JSON instead: an
+// object or array is split into the raw JSON of its members or elements when
+// the query first reaches it, and a string, number or literal is decoded only
+// when a filter or function needs its value. The object a
+// [WithMemberResolver] function receives therefore holds raw JSON members.
+func QueryJSONRawLocated(src []byte, path *Path) (LocatedNodeList, error) {
+	root := jsontext.Value(bytes.Trim(src, " \t\r\n"))
+	if !root.IsValid() {
+		// Unmarshal for the error, which says what is wrong and where.
+		var v jsontext.Value
+		return nil, errors.Join(ErrUnmarshal, json.Unmarshal(src, &v, decodeOptions))
+	}
+	d := rawDecoder{convert: path.opts.convert}
+	raw := &Path{query: path.query, opts: path.opts}
+	raw.opts.convert = d.node
+	raw.opts.rawResults = true
+	located := raw.SelectLocated(root)
+	for _, n := range located {
+		if _, ok := n.Value.(jsontext.Value); ok {
+			continue
+		}
+		v, err := json.Marshal(n.Value, decodeOptions)
+		if err != nil {
+			return nil, errors.Join(ErrUnmarshal, err)
+		}
+		n.Value = jsontext.Value(v)
+	}
+	return located, nil
+}
+
+// rawDecoder is the node conversion of [QueryJSONRawLocated]. It presents
+// the raw JSON of a document to the evaluator one level at a time.
+type rawDecoder struct {
+	// convert is the conversion the path was compiled with, applied to
+	// nodes that are not raw JSON, such as computed members.
+	convert func(node any) any
+	// containers holds the split objects and arrays by their first byte,
+	// so a container visited again is split once and keeps its identity.
+	containers map[*byte]any
+}
+
+// node returns the raw JSON node as a map[string]any or []any of the raw JSON
+// of its members or elements if it is an object or array, and as its decoded
+// value otherwise. Invalid JSON is left as is.
+func (d *rawDecoder) node(node any) any {
+	raw, ok := node.(jsontext.Value)
+	if !ok {
+		if d.convert != nil {
+			return d.convert(node)
+		}
+		return node
+	}
+	switch raw.Kind() {
+	case '{', '[':
+		if v, ok := d.containers[&raw[0]]; ok {
+			return v
+		}
+		v, err := splitRaw(raw)
+		if err != nil {
+			return node
+		}
+		if d.containers == nil {
+			d.containers = make(map[*byte]any)
+		}
+		d.containers[&raw[0]] = v
+		return v
+	default:
+		return decodeRaw(raw, node)
+	}
+}
+
+// splitRaw returns the members of the raw JSON object raw as a map[string]any,
+// or the elements of the array raw as an []any, each as the [jsontext.Value]
+// slice of raw it was read from.
+func splitRaw(raw jsontext.Value) (any, error) {
+	dec := jsontext.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.ReadToken()
+	if err != nil {
+		return nil, err
+	}
+	obj := tok.Kind() == '{'
+	var (
+		members  map[string]any
+		elements []any
+	)
+	if obj {
+		members = make(map[string]any)
+	} else {
+		elements = []any{}
+	}
+	for dec.PeekKind() != '}' && dec.PeekKind() != ']' {
+		var name string
+		if obj {
+			tok, err := dec.ReadToken()
+			if err != nil {
+				return nil, err
+			}
+			name = tok.String()
+		}
+		v, err := dec.ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		off := int(dec.InputOffset())
+		child := raw[off-len(v) : off : off]
+		if obj {
+			members[name] = child
+		} else {
+			elements = append(elements, child)
+		}
+	}
+	if obj {
+		return members, nil
+	}
+	return elements, nil
+}
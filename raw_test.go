@@ -0,0 +1,152 @@
+package jsonpath
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryJSONRaw(t *testing.T) {
+	src := []byte(` {
+		"prices": [1.50, 1e3, -0.0, 12345678901234567890],
+		"names": {"z": "A", "a": "tab\there"},
+		"nested": [[{"k": {"b": 2, "a": 1}}]],
+		"a\/b": null
+	}
+`)
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"$.prices[*]", []string{"1.50", "1e3", "-0.0", "12345678901234567890"}},
+		{"$.prices[?@ > 100]", []string{"1e3", "12345678901234567890"}},
+		{"$.names.z", []string{`"A"`}},
+		{"$.names[?@ == 'A']", []string{`"A"`}},
+		{"$.nested[0][0].k", []string{`{"b": 2, "a": 1}`}},
+		{"$..k.a", []string{"1"}},
+		{"$['a/b']", []string{"null"}},
+		{"$.prices[-1]", []string{"12345678901234567890"}},
+		{"$.missing", []string{}},
+		{"$.nested", []string{`[[{"k": {"b": 2, "a": 1}}]]`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := QueryJSONRaw(src, MustParse(tt.expr))
+			require.NoError(t, err)
+			strs := make([]string, len(got))
+			for i, v := range got {
+				strs[i] = string(v)
+			}
+			assert.Equal(t, tt.want, strs)
+		})
+	}
+
+	t.Run("root", func(t *testing.T) {
+		got, err := QueryJSONRaw(src, MustParse("$"))
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, '{', rune(got[0][0]))
+		assert.Equal(t, '}', rune(got[0][len(got[0])-1]))
+		assert.True(t, got[0].IsValid())
+	})
+}
+
+func TestQueryJSONRawLocated(t *testing.T) {
+	src := []byte(`{"a": [10, {"b": 2.50}], "c": "x"}`)
+	got, err := QueryJSONRawLocated(src, MustParse("$..[?@ != 'x']"))
+	require.NoError(t, err)
+	got.Sort()
+
+	want := map[string]string{
+		"$['a']":         `[10, {"b": 2.50}]`,
+		"$['a'][0]":      "10",
+		"$['a'][1]":      `{"b": 2.50}`,
+		"$['a'][1]['b']": "2.50",
+	}
+	require.Len(t, got, len(want))
+	for _, n := range got {
+		raw, ok := n.Value.(jsontext.Value)
+		require.True(t, ok, "%s: %T", n.Path, n.Value)
+		assert.Equal(t, want[n.Path.String()], string(raw), n.Path.String())
+	}
+}
+
+func TestQueryJSONRawLocated_MatchesQueryJSON(t *testing.T) {
+	src := []byte(`{
+		"store": {
+			"book": [
+				{"title": "A", "price": 8.95, "tags": ["x", "y"], "dims": {"w": 1, "h": 2}},
+				{"title": "B", "price": 12.99, "isbn": null, "dims": {"h": 2.0, "w": 1.0}},
+				{"title": "C\u00e9", "price": 8.99, "tags": []}
+			],
+			"bicycle": {"color": "red", "price": 19.95}
+		},
+		"limit": 10
+	}`)
+	for _, expr := range []string{
+		"$..price",
+		"$.store.book[?@.price < $.limit].title",
+		"$.store.book[?@.dims == $.store.book[1].dims].title",
+		"$.store.book[?length(@.tags) > 0]",
+		"$.store.book[?count(@.*) == 4]",
+		"$.store.book[?match(@.title, 'C.')]",
+		"$.store.book[?value(@..w) == 1]",
+		"$.store.book[?@.isbn == null].title",
+		"$..[?@.color]",
+		"$.store.*",
+		"$..*",
+		"$.store.book[::-1]",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			path := MustParse(expr)
+			want, err := QueryJSONLocated(src, path)
+			require.NoError(t, err)
+			got, err := QueryJSONRawLocated(src, path)
+			require.NoError(t, err)
+			want.Sort()
+			got.Sort()
+			require.Equal(t, slices.Collect(want.Paths()), slices.Collect(got.Paths()))
+			for i, n := range got {
+				var v any
+				require.NoError(t, json.Unmarshal(n.Value.(jsontext.Value), &v))
+				assert.Equal(t, want[i].Value, v, n.Path.String())
+			}
+		})
+	}
+}
+
+func TestQueryJSONRaw_ComputedMembers(t *testing.T) {
+	p := NewParser(WithMemberResolver(func(obj map[string]any, name string) (any, bool) {
+		return map[string]any{"n": float64(len(obj))}, name == "size"
+	}))
+	got, err := QueryJSONRaw([]byte(`{"a": 1.0, "b": 2}`), p.MustParse("$['a', 'size']"))
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "1.0", string(got[0]))
+	assert.JSONEq(t, `{"n": 2}`, string(got[1]))
+}
+
+func TestQueryJSONRaw_Errors(t *testing.T) {
+	for _, src := range []string{``, `{`, `{"a": 1} x`, `{"a": 1, "a": 2}`, "\"\xff\""} {
+		_, err := QueryJSONRaw([]byte(src), MustParse("$"))
+		require.ErrorIs(t, err, ErrUnmarshal, "%q", src)
+		_, err = QueryJSONRawLocated([]byte(src), MustParse("$"))
+		require.ErrorIs(t, err, ErrUnmarshal, "%q", src)
+	}
+}
+
+func BenchmarkQueryJSONRaw(b *testing.B) {
+	src := []byte(`{"store": {"book": [` +
+		`{"title": "A", "price": 8.95}, {"title": "B", "price": 12.99}, {"title": "C", "price": 8.99}` +
+		`]}}`)
+	path := MustParse("$.store.book[?@.price < 10].title")
+
+	b.ResetTimer()
+	for b.Loop() {
+		_, _ = QueryJSONRaw(src, path)
+	}
+}
@@ -0,0 +1,26 @@
+package token_test
+
+import (
+	"fmt"
+
+	"github.com/agentable/jsonpath/token"
+)
+
+func ExampleScanner() {
+	src := "$.books[?@.price < 10]"
+	for tok := range token.NewScanner(src).All() {
+		fmt.Printf("%d-%d %s %q\n", tok.Start, tok.End, tok.Kind, tok.Val(src))
+	}
+	// Output:
+	// 0-1 $ "$"
+	// 1-2 . "."
+	// 2-7 identifier "books"
+	// 7-8 [ "["
+	// 8-9 ? "?"
+	// 9-10 @ "@"
+	// 10-11 . "."
+	// 11-16 identifier "price"
+	// 17-18 < "<"
+	// 19-21 integer "10"
+	// 21-22 ] "]"
+}
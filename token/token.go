@@ -0,0 +1,94 @@
+// Package token splits RFC 9535 JSONPath expressions into tokens, as the
+// jsonpath package does before parsing them, for tools such as syntax
+// highlighters and editors.
+//
+// The Start and End byte offsets of a [Token] always delimit its text in
+// the source, so tools can map tokens back to the expression. Blank space
+// between tokens is skipped; it lies between the End of one token and the
+// Start of the next.
+package token
+
+import (
+	"iter"
+
+	"github.com/agentable/jsonpath/internal/lexer"
+)
+
+// Kind identifies the type of a token. Compare kinds with the constants
+// below: their numeric values may change as kinds are added.
+type Kind = lexer.Kind
+
+// Token kinds.
+const (
+	Invalid      = lexer.Invalid      // invalid input; Value holds the error message
+	EOF          = lexer.EOF          // end of input
+	Dollar       = lexer.Dollar       // $
+	At           = lexer.At           // @
+	Dot          = lexer.Dot          // .
+	DotDot       = lexer.DotDot       // ..
+	LeftBracket  = lexer.LeftBracket  // [
+	RightBracket = lexer.RightBracket // ]
+	LeftParen    = lexer.LeftParen    // (
+	RightParen   = lexer.RightParen   // )
+	Star         = lexer.Star         // *
+	Question     = lexer.Question     // ?
+	Comma        = lexer.Comma        // ,
+	Colon        = lexer.Colon        // :
+	Equal        = lexer.Equal        // ==
+	NotEqual     = lexer.NotEqual     // !=
+	Less         = lexer.Less         // <
+	LessEqual    = lexer.LessEqual    // <=
+	Greater      = lexer.Greater      // >
+	GreaterEqual = lexer.GreaterEqual // >=
+	And          = lexer.And          // &&
+	Or           = lexer.Or           // ||
+	Not          = lexer.Not          // !
+	Ident        = lexer.Ident        // member name shorthand or function name
+	Int          = lexer.Int          // integer literal
+	Number       = lexer.Number       // number literal with a fraction or exponent
+	String       = lexer.String       // quoted string; Value holds it unescaped
+	True         = lexer.True         // true
+	False        = lexer.False        // false
+	Null         = lexer.Null         // null
+)
+
+// Token is a token of an expression: its kind, its byte offsets in the
+// source, and for [String] and [Invalid] tokens a value. Use [Token.Val]
+// for the source text of other tokens.
+type Token = lexer.Token
+
+// ErrSyntax is returned by [Token.Err] for [Invalid] tokens.
+var ErrSyntax = lexer.ErrSyntax
+
+// ErrEscape is returned by [Token.Err] for [Invalid] tokens of strings with a
+// malformed escape sequence. It matches [ErrSyntax] too.
+var ErrEscape = lexer.ErrEscape
+
+// Scanner reads the tokens of an expression in order.
+type Scanner struct {
+	lex *lexer.Lexer
+}
+
+// NewScanner returns a Scanner for the tokens of src.
+func NewScanner(src string) *Scanner {
+	return &Scanner{lex: lexer.New(src)}
+}
+
+// Scan returns the next token. An [Invalid] token ends the expression: after
+// it, and after the end of the source, Scan returns [EOF] tokens.
+func (s *Scanner) Scan() Token {
+	return s.lex.Scan()
+}
+
+// All returns an iterator over the remaining tokens, excluding the final
+// [EOF]. An [Invalid] token, if any, is the last.
+func (s *Scanner) All() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for {
+			tok := s.Scan()
+			if tok.Kind == EOF || !yield(tok) || tok.Kind == Invalid {
+				return
+			}
+		}
+	}
+}
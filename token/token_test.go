@@ -0,0 +1,71 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner(t *testing.T) {
+	t.Parallel()
+
+	src := `$.store[?@.price < 10 && @['tag'] == "a\"b"]`
+	type tok struct {
+		kind  Kind
+		text  string
+		value string
+	}
+	want := []tok{
+		{Dollar, "$", ""}, {Dot, ".", ""}, {Ident, "store", ""}, {LeftBracket, "[", ""},
+		{Question, "?", ""}, {At, "@", ""}, {Dot, ".", ""}, {Ident, "price", ""},
+		{Less, "<", ""}, {Int, "10", ""}, {And, "&&", ""}, {At, "@", ""},
+		{LeftBracket, "[", ""}, {String, "'tag'", "tag"}, {RightBracket, "]", ""},
+		{Equal, "==", ""}, {String, `"a\"b"`, `a"b`}, {RightBracket, "]", ""},
+	}
+	var got []tok
+	for tk := range NewScanner(src).All() {
+		got = append(got, tok{tk.Kind, tk.Val(src), tk.Value})
+		assert.NoError(t, tk.Err())
+	}
+	assert.Equal(t, want, got)
+
+	s := NewScanner(src)
+	for range want {
+		s.Scan()
+	}
+	end := s.Scan()
+	assert.Equal(t, EOF, end.Kind)
+	assert.Equal(t, len(src), end.Start)
+}
+
+func TestScanner_Invalid(t *testing.T) {
+	t.Parallel()
+
+	s := NewScanner("$.a # .b")
+	var kinds []Kind
+	var last Token
+	for tok := range s.All() {
+		kinds = append(kinds, tok.Kind)
+		last = tok
+	}
+	assert.Equal(t, []Kind{Dollar, Dot, Ident, Invalid}, kinds)
+	assert.Equal(t, 4, last.Start)
+	require.ErrorIs(t, last.Err(), ErrSyntax)
+	assert.NotErrorIs(t, last.Err(), ErrEscape)
+	assert.Equal(t, EOF, s.Scan().Kind)
+
+	tok := NewScanner(`'\q'`).Scan()
+	require.ErrorIs(t, tok.Err(), ErrEscape)
+	require.ErrorIs(t, tok.Err(), ErrSyntax)
+}
+
+func TestScanner_AllStops(t *testing.T) {
+	t.Parallel()
+
+	s := NewScanner("$.a.b")
+	for range s.All() {
+		break
+	}
+	assert.Equal(t, Dot, s.Scan().Kind)
+}
@@ -2,26 +2,193 @@ package jsonpath
 
 import (
 	"cmp"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/maphash"
 	"iter"
+	"math"
+	"reflect"
 	"slices"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/agentable/jsonpath/internal/ast"
+	"github.com/agentable/jsonpath/internal/lexer"
+	"github.com/agentable/jsonpath/internal/parser"
+	"github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
 )
 
 // Sentinel errors.
 var (
 	// ErrPathParse is returned when a JSONPath expression cannot be parsed.
 	ErrPathParse = errors.New("jsonpath: parse error")
+	// ErrLex is wrapped by [ErrPathParse] errors caused by an invalid token,
+	// such as an unexpected character or a malformed string escape, as
+	// opposed to a well-formed token in an invalid position.
+	ErrLex = lexer.ErrSyntax
+	// ErrExpressionTooLong is wrapped by [ErrPathParse] errors for
+	// expressions longer than the limit set by [WithMaxExpressionLength].
+	ErrExpressionTooLong = errors.New("jsonpath: expression too long")
+	// ErrTooManySelectors is wrapped by [ErrPathParse] errors for
+	// expressions exceeding the limit set by [WithMaxSelectorsPerSegment].
+	ErrTooManySelectors = parser.ErrTooManySelectors
+	// ErrTooDeep is wrapped by [ErrPathParse] errors for expressions whose
+	// parentheses, filters and function calls nest deeper than
+	// [DefaultMaxFilterDepth], or than set by [WithMaxFilterDepth].
+	ErrTooDeep = parser.ErrTooDeep
+	// ErrUnknownFunction is wrapped by errors for expressions and binary
+	// paths calling a function the [Parser] does not know.
+	ErrUnknownFunction = ast.ErrUnknownFunction
+	// ErrInvalidFunction is wrapped by [ErrPathParse] errors for function
+	// calls whose arguments the function rejects in [Function.Validate],
+	// such as length(@, 1); the error of Validate is wrapped too.
+	ErrInvalidFunction = parser.ErrInvalidFunction
+	// ErrInvalidIndex is wrapped by [ErrPathParse] errors for index
+	// selectors that are -0 or outside the range RFC 9535 allows,
+	// ±(2^53-1).
+	ErrInvalidIndex = parser.ErrInvalidIndex
+	// ErrInvalidSlice is wrapped by [ErrPathParse] errors for slice
+	// selectors with an argument that is -0 or out of range, like
+	// [ErrInvalidIndex].
+	ErrInvalidSlice = parser.ErrInvalidSlice
+	// ErrInvalidEscape is wrapped by [ErrPathParse] errors for string
+	// literals with a malformed escape sequence, such as '\q' or an unpaired
+	// surrogate. These errors wrap [ErrLex] too.
+	ErrInvalidEscape = lexer.ErrEscape
+	// ErrBinaryPath is returned when a binary path cannot be encoded or
+	// decoded. See [Path.MarshalBinary].
+	ErrBinaryPath = errors.New("jsonpath: invalid binary path")
+	// ErrBinaryVersion is wrapped by [ErrBinaryPath] errors for binary paths
+	// written in an unsupported version of the format.
+	ErrBinaryVersion = ast.ErrBinaryVersion
+	// ErrTooManyNodes is returned by [Path.SelectE] and its variants when a
+	// node list exceeds the limit set by [WithMaxIntermediateNodes].
+	ErrTooManyNodes = errors.New("jsonpath: too many intermediate nodes")
+	// ErrDocumentTooDeep is returned by [Path.SelectE] and its variants when
+	// a descendant segment, in the query or a filter sub-query, reaches
+	// below the depth set by [WithMaxDepth].
+	ErrDocumentTooDeep = ast.ErrDocumentTooDeep
+	// ErrUnknownSelector is returned by [Path.SelectE] and its variants for a
+	// path holding a selector of no known kind. Paths built by this package
+	// never do, so the error indicates a bug.
+	ErrUnknownSelector = ast.ErrUnknownSelector
+	// ErrNoMatch is returned by [Path.SelectOne] when nothing matches, and
+	// by [NodeList.One] for an empty list.
+	ErrNoMatch = errors.New("jsonpath: no match")
+	// ErrMultipleMatches is returned by [Path.SelectOne] when more than one
+	// node matches, and by [NodeList.One] for a list of several nodes.
+	ErrMultipleMatches = errors.New("jsonpath: multiple matches")
 	// ErrFunction is returned when a JSONPath function call fails.
 	ErrFunction = errors.New("jsonpath: function error")
 	// ErrUnmarshal is returned when JSON unmarshaling fails in QueryJSON functions.
 	ErrUnmarshal = errors.New("jsonpath: unmarshal error")
+	// ErrRootedQuery is returned when a $-rooted query is used where a
+	// relative (@-rooted) query is required.
+	ErrRootedQuery = errors.New("jsonpath: query is not relative")
+	// ErrPrefixMismatch is returned by [Path.Rebase] when a path does not
+	// start with the given prefix.
+	ErrPrefixMismatch = errors.New("jsonpath: path does not start with prefix")
+	// ErrNodeType is returned by [NodeList.Strings] and the other typed
+	// accessors when a node does not have the requested type, and by
+	// [Path.Set] and the other methods that modify a document when a node is
+	// not held by a JSON object or array.
+	ErrNodeType = errors.New("jsonpath: node has the wrong type")
+	// ErrRootNode is returned when a path that modifies a document selects
+	// the document's root, which has no parent to hold a new value.
+	ErrRootNode = errors.New("jsonpath: cannot modify the root node")
+	// ErrInvalidPath is returned when a normalized path cannot be encoded or
+	// parsed.
+	ErrInvalidPath = errors.New("jsonpath: invalid normalized path")
+	// ErrInvalidPointer is returned by [ParsePointer] for a malformed RFC 6901
+	// JSON Pointer.
+	ErrInvalidPointer = errors.New("jsonpath: invalid JSON pointer")
 )
 
+// ParseError describes where and why [Parser.Parse] rejected an expression.
+// Parse returns it wrapped in [ErrPathParse]; retrieve it with [errors.As].
+// Errors that [ErrPathParse] wraps to classify the failure, such as [ErrLex]
+// and [ErrTooDeep], remain reachable through [errors.Is].
+type ParseError struct {
+	Expr     string   // the expression
+	Pos      int      // byte offset of the offending token; len(Expr) at the end
+	Msg      string   // what went wrong, without the position
+	Expected []string // tokens that would have been accepted at Pos, if known
+
+	err error // classifies the failure, returned by Unwrap
+}
+
+// newParseError converts an error of the internal parser for expr.
+func newParseError(expr string, err error) error {
+	var pe *parser.Error
+	if !errors.As(err, &pe) {
+		return fmt.Errorf("%w: %w", ErrPathParse, err)
+	}
+	return fmt.Errorf("%w: %w", ErrPathParse, &ParseError{
+		Expr:     expr,
+		Pos:      pe.Pos,
+		Msg:      pe.Msg,
+		Expected: pe.Expected,
+		err:      pe.Err,
+	})
+}
+
+// Error returns the message and position of e, followed by the kind of
+// failure, if any, and the indented lines of [ParseError.Detail]. The kind is
+// written without the "jsonpath: " prefix, which [ErrPathParse] already
+// supplies.
+func (e *ParseError) Error() string {
+	var buf strings.Builder
+	buf.WriteString(e.Msg)
+	buf.WriteString(" at position ")
+	buf.WriteString(strconv.Itoa(e.Pos))
+	if e.err != nil && !errors.Is(e.err, parser.ErrParsePosition) && !errors.Is(e.err, parser.ErrParseEnd) {
+		buf.WriteString(": ")
+		buf.WriteString(strings.TrimPrefix(e.err.Error(), "jsonpath: "))
+	}
+	for line := range strings.Lines(e.Detail()) {
+		buf.WriteString("\n\t")
+		buf.WriteString(strings.TrimSuffix(line, "\n"))
+	}
+	return buf.String()
+}
+
+// Detail returns the expression on one line and a caret on the next,
+// pointing at the offending token, for display in a terminal or a
+// monospaced text field. Blank space in the expression is shown as spaces,
+// and the caret is aligned by runes rather than bytes, skipping combining
+// marks and other characters that take up no room. At the end of the
+// expression, the caret points just past it.
+func (e *ParseError) Detail() string {
+	pos := min(max(e.Pos, 0), len(e.Expr))
+	var expr, caret strings.Builder
+	expr.Grow(len(e.Expr))
+	for i, r := range e.Expr {
+		switch r {
+		case '\t', '\n', '\r':
+			r = ' '
+		}
+		expr.WriteRune(r)
+		if i < pos && !unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+			caret.WriteByte(' ')
+		}
+	}
+	caret.WriteByte('^')
+	return expr.String() + "\n" + caret.String()
+}
+
+// Unwrap returns the error classifying the failure, if any.
+func (e *ParseError) Unwrap() error { return e.err }
+
 // PathElement is either a Name (string key) or an Index (array index)
 // in a normalized path. Implemented by [NameElement] and [IndexElement].
+// The set is closed: the unexported methods keep other packages from adding
+// a third kind, so code that handles both kinds, for example through
+// [IsName] and [IsIndex], handles every element.
 type PathElement interface {
 	pathElement()
 	// writeNormalizedTo writes the element formatted as a normalized path
@@ -32,7 +199,38 @@ type PathElement interface {
 	writePointerTo(buf *strings.Builder)
 }
 
-// NameElement is a string key in a normalized path.
+// Name returns the [PathElement] for the object member name.
+func Name(name string) PathElement {
+	return NameElement(name)
+}
+
+// Index returns the [PathElement] for the array index i, or an error
+// wrapping [ErrInvalidPath] if i is negative: normalized paths and JSON
+// Pointers count indexes from the start of the array only. Convert the key
+// to an [IndexElement] to address a negative key of a sparse array.
+func Index(i int64) (PathElement, error) {
+	if i < 0 {
+		return nil, fmt.Errorf("%w: index %d is negative", ErrInvalidPath, i)
+	}
+	return IndexElement(i), nil
+}
+
+// IsName returns the name e holds and true if e is a [NameElement], or ""
+// and false otherwise.
+func IsName(e PathElement) (string, bool) {
+	n, ok := e.(NameElement)
+	return string(n), ok
+}
+
+// IsIndex returns the index e holds and true if e is an [IndexElement], or 0
+// and false otherwise. The index is an int64, like [IndexElement].
+func IsIndex(e PathElement) (int64, bool) {
+	i, ok := e.(IndexElement)
+	return int64(i), ok
+}
+
+// NameElement is a string key in a normalized path. [Name] returns one as a
+// [PathElement].
 type NameElement string
 
 func (NameElement) pathElement() {}
@@ -40,62 +238,72 @@ func (NameElement) pathElement() {}
 // writeNormalizedTo writes n to buf as ['name'] with proper escaping per
 // RFC 9535 §2.7.
 func (n NameElement) writeNormalizedTo(buf *strings.Builder) {
-	buf.WriteString("['")
-	for _, r := range string(n) {
-		switch r {
-		case '\b':
-			buf.WriteString(`\b`)
-		case '\f':
-			buf.WriteString(`\f`)
-		case '\n':
-			buf.WriteString(`\n`)
-		case '\r':
-			buf.WriteString(`\r`)
-		case '\t':
-			buf.WriteString(`\t`)
-		case '\'':
-			buf.WriteString(`\'`)
-		case '\\':
-			buf.WriteString(`\\`)
-		case '\x00', '\x01', '\x02', '\x03', '\x04', '\x05', '\x06', '\x07',
-			'\x0b', '\x0e', '\x0f':
-			fmt.Fprintf(buf, `\u000%x`, r)
-		default:
-			buf.WriteRune(r)
-		}
-	}
-	buf.WriteString("']")
+	buf.WriteByte('[')
+	ast.WriteQuoted(buf, string(n), '\'')
+	buf.WriteByte(']')
 }
 
 // writePointerTo writes n to buf as an RFC 6901 JSON Pointer reference token,
 // escaping ~ as ~0 and / as ~1.
 func (n NameElement) writePointerTo(buf *strings.Builder) {
-	s := strings.ReplaceAll(string(n), "~", "~0")
-	s = strings.ReplaceAll(s, "/", "~1")
-	buf.WriteString(s)
+	for i := range len(n) {
+		switch n[i] {
+		case '~':
+			buf.WriteString("~0")
+		case '/':
+			buf.WriteString("~1")
+		default:
+			buf.WriteByte(n[i])
+		}
+	}
 }
 
-// IndexElement is an array index in a normalized path.
-type IndexElement int
+// IndexElement is an array index in a normalized path. It is an int64, as
+// the index selectors of the compiled query are, so indexes above
+// math.MaxInt32, which RFC 9535 permits up to 2^53-1, survive on 32-bit
+// platforms. Indexes of arrays count from the start, so build elements with
+// [Index], which rejects negative indexes, rather than by converting an
+// integer.
+//
+// Only the keys of sparse arrays, which [Path.Select] describes, may be
+// negative. [NormalizedPath.Resolve] and the methods that modify a document
+// look such keys up as is, but no RFC 9535 normalized path or RFC 6901 JSON
+// Pointer can hold one: [NormalizedPath.String] and [NormalizedPath.Pointer]
+// write a negative index as the marker %!index(-1), which does not parse
+// back, and [NormalizedPath.MarshalText] and [NormalizedPath.MarshalJSON]
+// return an error wrapping [ErrInvalidPath].
+type IndexElement int64
 
 func (IndexElement) pathElement() {}
 
-// writeNormalizedTo writes i to buf as [N].
+// writeNormalizedTo writes i to buf as [N], or as [%!index(N)] if i is
+// negative.
 func (i IndexElement) writeNormalizedTo(buf *strings.Builder) {
 	buf.WriteByte('[')
-	buf.WriteString(strconv.Itoa(int(i)))
+	i.writePointerTo(buf)
 	buf.WriteByte(']')
 }
 
-// writePointerTo writes i to buf as its decimal string.
+// writePointerTo writes i to buf as its decimal string, or as %!index(N) if
+// i is negative.
 func (i IndexElement) writePointerTo(buf *strings.Builder) {
-	buf.WriteString(strconv.Itoa(int(i)))
+	var digits [20]byte
+	if i < 0 {
+		buf.WriteString("%!index(")
+		buf.Write(strconv.AppendInt(digits[:0], int64(i), 10))
+		buf.WriteByte(')')
+		return
+	}
+	buf.Write(strconv.AppendInt(digits[:0], int64(i), 10))
 }
 
 // NormalizedPath is a sequence of Name/Index selectors per RFC 9535 §2.7.
 type NormalizedPath []PathElement
 
-// String returns the normalized path string, e.g. $['a'][0].
+// String returns the normalized path string, e.g. $['a'][0]. Bytes of a name
+// that are not valid UTF-8 are written as U+FFFD and negative indexes as the
+// marker %!index(-1), as [IndexElement] describes; use
+// [NormalizedPath.MarshalText] to detect them.
 func (p NormalizedPath) String() string {
 	var buf strings.Builder
 	buf.WriteByte('$')
@@ -105,7 +313,17 @@ func (p NormalizedPath) String() string {
 	return buf.String()
 }
 
-// Pointer returns an RFC 6901 JSON Pointer string, e.g. /a/0.
+// Elements returns an iterator over the index-element pairs of p, from the
+// root down. Each element is a [NameElement] or an [IndexElement], which
+// [IsName] and [IsIndex] tell apart, so other packages can render paths in
+// notations of their own.
+func (p NormalizedPath) Elements() iter.Seq2[int, PathElement] {
+	return slices.All(p)
+}
+
+// Pointer returns an RFC 6901 JSON Pointer string, e.g. /a/0. A negative
+// index, which no pointer can hold, is written as the marker %!index(-1), as
+// [IndexElement] describes.
 func (p NormalizedPath) Pointer() string {
 	var buf strings.Builder
 	for _, e := range p {
@@ -115,45 +333,586 @@ func (p NormalizedPath) Pointer() string {
 	return buf.String()
 }
 
+// RelativeTo returns a Relative JSON Pointer, as defined by
+// draft-handrews-relative-json-pointer, that leads from the node at base to
+// the node at p: the number of levels to go up from base to the deepest
+// location the two paths share, followed by the JSON Pointer from there to
+// p. For base $['a']['b'][1] and p $['a']['c'][0] it returns 2/c/0, and for
+// p equal to base it returns 0. It returns [ErrInvalidPath] if the part of p
+// it writes holds a name that is not valid UTF-8 or a negative index, which
+// a pointer cannot hold.
+func (p NormalizedPath) RelativeTo(base NormalizedPath) (string, error) {
+	common := 0
+	for common < min(len(p), len(base)) && p[common] == base[common] {
+		common++
+	}
+	if err := p.validate(common); err != nil {
+		return "", err
+	}
+	return strconv.Itoa(len(base)-common) + p[common:].Pointer(), nil
+}
+
 // Compare compares p to q and returns -1, 0, or 1. Indexes are always
 // considered less than names.
 func (p NormalizedPath) Compare(q NormalizedPath) int {
-	minLen := min(len(p), len(q))
+	for i := range min(len(p), len(q)) {
+		// Switch on the type of one element and assert the other, which
+		// costs one type check per element rather than three.
+		switch e := p[i].(type) {
+		case IndexElement:
+			f, ok := q[i].(IndexElement)
+			if !ok {
+				return -1 // index < name
+			}
+			if e != f {
+				return cmp.Compare(e, f)
+			}
+		case NameElement:
+			f, ok := q[i].(NameElement)
+			if !ok {
+				return 1 // name > index
+			}
+			if x := strings.Compare(string(e), string(f)); x != 0 {
+				return x
+			}
+		}
+	}
+	return cmp.Compare(len(p), len(q))
+}
 
-	for i := range minLen {
-		v1, isName1 := p[i].(NameElement)
-		v2, isName2 := q[i].(NameElement)
+// Parent returns the path of the node that holds the node at p, or nil if p
+// is empty. Like [NormalizedPath.Truncate], it shares p's elements.
+func (p NormalizedPath) Parent() NormalizedPath {
+	if len(p) == 0 {
+		return nil
+	}
+	return p.Truncate(len(p) - 1)
+}
 
-		if isName1 && isName2 {
-			if x := cmp.Compare(string(v1), string(v2)); x != 0 {
-				return x
+// Last returns the final element of p, the name or index of the node within
+// its parent, and whether p has one.
+func (p NormalizedPath) Last() (PathElement, bool) {
+	if len(p) == 0 {
+		return nil, false
+	}
+	return p[len(p)-1], true
+}
+
+// HasPrefix reports whether p begins with the elements of prefix, that is,
+// whether p is prefix or a location inside it. Elements are equal when they
+// are of the same kind and value, so the name '0' never matches the index 0.
+func (p NormalizedPath) HasPrefix(prefix NormalizedPath) bool {
+	return len(p) >= len(prefix) && slices.Equal(p[:len(prefix)], prefix)
+}
+
+// Truncate returns the first n elements of p, or p itself if it is no longer
+// than n. A negative n is treated as 0. The result shares p's elements
+// without allocating, and its capacity is capped so that appending to it
+// never overwrites p.
+func (p NormalizedPath) Truncate(n int) NormalizedPath {
+	n = max(0, min(n, len(p)))
+	return p[:n:n]
+}
+
+// MarshalText marshals p into its normalized path string. Implements
+// [encoding.TextMarshaler]. It returns [ErrInvalidPath] if a name is not
+// valid UTF-8 or an index is negative, which a normalized path cannot
+// represent.
+func (p NormalizedPath) MarshalText() ([]byte, error) {
+	if err := p.validate(0); err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+// validate returns an error wrapping [ErrInvalidPath] if an element of p
+// from position start on is a name that is not valid UTF-8 or a negative
+// index.
+func (p NormalizedPath) validate(start int) error {
+	for i := start; i < len(p); i++ {
+		switch e := p[i].(type) {
+		case NameElement:
+			if !utf8.ValidString(string(e)) {
+				return fmt.Errorf("%w: element %d: name %q is not valid UTF-8", ErrInvalidPath, i, string(e))
+			}
+		case IndexElement:
+			if e < 0 {
+				return fmt.Errorf("%w: element %d: index %d is negative", ErrInvalidPath, i, e)
 			}
-			continue
 		}
+	}
+	return nil
+}
 
-		if isName1 {
-			return 1 // name > index
+// ToPath returns a singular [Path] selecting the location p names: a query of
+// child segments, each with the name or index selector of one element of p,
+// such as $["store"]["book"][0]. The path is evaluated with default settings,
+// as if returned by [Parse], so it can re-select or modify the node with the
+// methods of [Path]. It returns an error wrapping [ErrInvalidPath] if an
+// index is beyond ±(2^53-1), the range RFC 9535 allows, since the path's
+// string form would not parse.
+func (p NormalizedPath) ToPath() (*Path, error) {
+	segments := make([]ast.Segment, len(p))
+	for i, e := range p {
+		switch e := e.(type) {
+		case NameElement:
+			segments[i] = ast.Child(ast.NameSelector(string(e)))
+		case IndexElement:
+			if e > parser.MaxIndex || e < -parser.MaxIndex {
+				return nil, fmt.Errorf("%w: element %d: index %d is out of range", ErrInvalidPath, i, e)
+			}
+			segments[i] = ast.Child(ast.IndexSelector(int64(e)))
 		}
+	}
+	return &Path{query: ast.NewPathQuery(true, segments...), opts: defaultParser.opts.eval}, nil
+}
 
-		if isName2 {
-			return -1 // index < name
+// UnmarshalText parses text as a normalized path with [ParseNormalizedPath].
+// Implements [encoding.TextUnmarshaler], so p round-trips through
+// [NormalizedPath.MarshalText].
+func (p *NormalizedPath) UnmarshalText(text []byte) error {
+	path, err := ParseNormalizedPath(string(text))
+	if err != nil {
+		return err
+	}
+	*p = path
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding p as a JSON array of its
+// elements, with names as strings and indexes as numbers:
+//
+//	["a",0,"b"]
+//
+// Unlike the string [NormalizedPath.MarshalText] returns, the array needs no
+// parsing to be read in other languages. Like [NormalizedPath.MarshalText]
+// it returns [ErrInvalidPath] if a name is not valid UTF-8 or an index is
+// negative.
+func (p NormalizedPath) MarshalJSON() ([]byte, error) {
+	if err := p.validate(0); err != nil {
+		return nil, err
+	}
+	elems := make([]any, len(p))
+	for i, e := range p {
+		switch e := e.(type) {
+		case NameElement:
+			elems[i] = string(e)
+		case IndexElement:
+			elems[i] = int64(e)
 		}
+	}
+	return json.Marshal(elems, decodeOptions)
+}
 
-		// Both are IndexElement
-		idx1 := p[i].(IndexElement)
-		idx2 := q[i].(IndexElement)
-		if x := cmp.Compare(int(idx1), int(idx2)); x != 0 {
-			return x
+// UnmarshalJSON implements json.Unmarshaler, decoding the array
+// [NormalizedPath.MarshalJSON] encodes: strings become a [NameElement] and
+// non-negative integers an [IndexElement]. Any other element, such as a
+// fractional number, an exponent or an object, returns an error wrapping
+// [ErrInvalidPath]. null decodes to a nil path.
+func (p *NormalizedPath) UnmarshalJSON(data []byte) error {
+	var elems []jsontext.Value
+	if err := json.Unmarshal(data, &elems, decodeOptions); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPath, err)
+	}
+	if elems == nil {
+		*p = nil
+		return nil
+	}
+	path := make(NormalizedPath, len(elems))
+	for i, v := range elems {
+		switch v.Kind() {
+		case '"':
+			var name string
+			if err := json.Unmarshal(v, &name, decodeOptions); err != nil {
+				return fmt.Errorf("%w: element %d: %w", ErrInvalidPath, i, err)
+			}
+			path[i] = NameElement(name)
+		case '0':
+			idx, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil || idx < 0 {
+				return fmt.Errorf("%w: element %d is %s, not a non-negative integer index", ErrInvalidPath, i, v)
+			}
+			path[i] = IndexElement(idx)
+		default:
+			return fmt.Errorf("%w: element %d is %s, not a name or an index", ErrInvalidPath, i, v)
 		}
 	}
+	*p = path
+	return nil
+}
 
-	return cmp.Compare(len(p), len(q))
+// ParseNormalizedPath parses s, a normalized path in the form RFC 9535
+// section 2.7 defines and [NormalizedPath.String] writes, such as
+// $['a'][0]. Anything else, including a name that is not valid UTF-8 or that
+// escapes a character that needs no escape and an index above 2^53-1, the
+// largest RFC 9535 allows, returns an error wrapping [ErrInvalidPath].
+func ParseNormalizedPath(s string) (NormalizedPath, error) {
+	if !strings.HasPrefix(s, "$") {
+		return nil, pathSyntaxError(s, 0, "missing $")
+	}
+	var path NormalizedPath
+	for i := 1; i < len(s); {
+		if s[i] != '[' {
+			return nil, pathSyntaxError(s, i, "expected [")
+		}
+		i++
+		var elem PathElement
+		var err error
+		if i < len(s) && s[i] == '\'' {
+			var name string
+			name, i, err = parseNormalName(s, i+1)
+			elem = NameElement(name)
+		} else {
+			var idx int64
+			idx, i, err = parseNormalIndex(s, i)
+			elem = IndexElement(idx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == len(s) || s[i] != ']' {
+			return nil, pathSyntaxError(s, i, "expected ]")
+		}
+		path = append(path, elem)
+		i++
+	}
+	return path, nil
 }
 
-// MarshalText marshals p into its normalized path string. Implements
-// [encoding.TextMarshaler].
-func (p NormalizedPath) MarshalText() ([]byte, error) {
-	return []byte(p.String()), nil
+// pathSyntaxError returns an error wrapping [ErrInvalidPath] for the
+// normalized path s, which is malformed at byte offset i.
+func pathSyntaxError(s string, i int, msg string) error {
+	return fmt.Errorf("%w: %s at offset %d of %q", ErrInvalidPath, msg, i, s)
+}
+
+// parseNormalIndex parses the index selector of the normalized path s that
+// starts at offset i, returning it and the offset that follows it.
+func parseNormalIndex(s string, i int) (int64, int, error) {
+	start := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == start || s[start] == '0' && i-start > 1 {
+		return 0, 0, pathSyntaxError(s, start, "expected a name or an index")
+	}
+	idx, err := strconv.ParseInt(s[start:i], 10, 64)
+	if err != nil || idx > parser.MaxIndex {
+		return 0, 0, pathSyntaxError(s, start, "index out of range")
+	}
+	return idx, i, nil
+}
+
+// parseNormalName parses the name selector of the normalized path s whose
+// characters start at offset i, after the opening quote, returning the name
+// and the offset of the byte after the closing quote.
+func parseNormalName(s string, i int) (string, int, error) {
+	var buf strings.Builder
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '\'':
+			return buf.String(), i + 1, nil
+		case c == '\\':
+			r, n := normalEscape(s[i:])
+			if n == 0 {
+				return "", 0, pathSyntaxError(s, i, "invalid escape")
+			}
+			buf.WriteByte(r)
+			i += n
+		case c < 0x20:
+			return "", 0, pathSyntaxError(s, i, "unescaped control character")
+		default:
+			r, n := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && n == 1 {
+				return "", 0, pathSyntaxError(s, i, "invalid UTF-8")
+			}
+			buf.WriteString(s[i : i+n])
+			i += n
+		}
+	}
+	return "", 0, pathSyntaxError(s, i, "unterminated name")
+}
+
+// normalEscape decodes the escape sequence at the start of s, returning the
+// byte it stands for and its length, or a length of 0 if it is not one a
+// normalized path may hold: \b, \f, \n, \r, \t, \', \\ or \u00XX, with
+// lowercase hex digits, for any other control character.
+func normalEscape(s string) (byte, int) {
+	if len(s) < 2 {
+		return 0, 0
+	}
+	switch s[1] {
+	case 'b':
+		return '\b', 2
+	case 'f':
+		return '\f', 2
+	case 'n':
+		return '\n', 2
+	case 'r':
+		return '\r', 2
+	case 't':
+		return '\t', 2
+	case '\'', '\\':
+		return s[1], 2
+	case 'u':
+		const hex = "0123456789abcdef"
+		if len(s) < 6 || s[2:4] != "00" {
+			return 0, 0
+		}
+		hi, lo := strings.IndexByte(hex[:2], s[4]), strings.IndexByte(hex, s[5])
+		if hi < 0 || lo < 0 {
+			return 0, 0
+		}
+		switch c := byte(hi<<4 | lo); c {
+		case '\b', '\f', '\n', '\r', '\t':
+			return 0, 0
+		default:
+			return c, 6
+		}
+	default:
+		return 0, 0
+	}
+}
+
+// ParsePointer parses s, an RFC 6901 JSON Pointer such as /a/0, into a
+// normalized path. A reference token that is an array index, 0 or a decimal
+// number without leading zeros, becomes an [IndexElement]; every other token
+// becomes a [NameElement] once ~1 and ~0 are replaced with / and ~. Use
+// [ParsePointerNames] when object keys may look like indexes. A pointer that
+// is neither empty nor starts with /, or that holds a ~ not followed by 0 or
+// 1, returns an error wrapping [ErrInvalidPointer].
+func ParsePointer(s string) (NormalizedPath, error) {
+	return parsePointer(s, false)
+}
+
+// ParsePointerNames is like [ParsePointer] but makes every reference token a
+// [NameElement], for pointers into objects whose keys look like indexes.
+func ParsePointerNames(s string) (NormalizedPath, error) {
+	return parsePointer(s, true)
+}
+
+// parsePointer parses the JSON Pointer s, treating every token as a name if
+// names is set.
+func parsePointer(s string, names bool) (NormalizedPath, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("%w: %q does not start with /", ErrInvalidPointer, s)
+	}
+	path := make(NormalizedPath, 0, strings.Count(s, "/"))
+	for tok := range strings.SplitSeq(s[1:], "/") {
+		if !names {
+			if i, ok := parsePointerIndex(tok); ok {
+				path = append(path, IndexElement(i))
+				continue
+			}
+		}
+		name, ok := unescapePointerToken(tok)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q has an invalid ~ escape in %q", ErrInvalidPointer, s, tok)
+		}
+		path = append(path, NameElement(name))
+	}
+	return path, nil
+}
+
+// Resolve returns the value at p in doc and whether there is one, looking
+// each member and element up directly rather than evaluating a query, so a
+// path stored from [Path.SelectLocated] finds its node again. As in
+// [Path.Select], a map[int]any or map[int64]any is a sparse array. Values are
+// not converted as [WithEncodingJSONValues] does, nor members resolved as
+// with [WithMemberResolver]: doc must be made of maps and slices.
+func (p NormalizedPath) Resolve(doc any) (any, bool) {
+	for _, elem := range p {
+		var ok bool
+		if doc, ok = (slot{parent: doc, elem: elem}).lookup(); !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// ResolvePointer returns the value at the RFC 6901 JSON Pointer pointer in
+// doc and whether there is one, looking it up as [NormalizedPath.Resolve]
+// does. In a reference token, ~1 stands for / and ~0 for ~. An array index
+// must be a decimal number without leading zeros. The index "-", which
+// refers past the last element of an array, finds nothing, as does a
+// malformed pointer.
+func ResolvePointer(pointer string, doc any) (any, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	if pointer[0] != '/' {
+		return nil, false
+	}
+	for tok := range strings.SplitSeq(pointer[1:], "/") {
+		elem, ok := pointerElement(tok, doc)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = (slot{parent: doc, elem: elem}).lookup(); !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// pointerElement returns the element the JSON Pointer reference token tok
+// refers to in node, and whether node is a container tok can refer into.
+func pointerElement(tok string, node any) (PathElement, bool) {
+	switch node.(type) {
+	case map[string]any:
+		name, ok := unescapePointerToken(tok)
+		return NameElement(name), ok
+	case []any, map[int]any, map[int64]any:
+		i, ok := parsePointerIndex(tok)
+		return IndexElement(i), ok
+	default:
+		return nil, false
+	}
+}
+
+// unescapePointerToken replaces ~1 with / and ~0 with ~ in tok, reporting
+// false if tok holds any other ~ sequence.
+func unescapePointerToken(tok string) (string, bool) {
+	if !strings.Contains(tok, "~") {
+		return tok, true
+	}
+	var buf strings.Builder
+	buf.Grow(len(tok))
+	for i := 0; i < len(tok); i++ {
+		if tok[i] != '~' {
+			buf.WriteByte(tok[i])
+			continue
+		}
+		if i++; i == len(tok) {
+			return "", false
+		}
+		switch tok[i] {
+		case '0':
+			buf.WriteByte('~')
+		case '1':
+			buf.WriteByte('/')
+		default:
+			return "", false
+		}
+	}
+	return buf.String(), true
+}
+
+// parsePointerIndex parses tok as an RFC 6901 array index: 0 or a decimal
+// number without leading zeros.
+func parsePointerIndex(tok string) (int64, bool) {
+	if tok == "" || len(tok) > 1 && tok[0] == '0' {
+		return 0, false
+	}
+	for i := range len(tok) {
+		if tok[i] < '0' || tok[i] > '9' {
+			return 0, false
+		}
+	}
+	i, err := strconv.ParseInt(tok, 10, 64)
+	return i, err == nil
+}
+
+// SelectorKind identifies the kind of an RFC 9535 §2.3 selector.
+type SelectorKind uint8
+
+const (
+	// SelectorName is a name selector such as ['a'] or .a.
+	SelectorName SelectorKind = iota
+	// SelectorIndex is an index selector such as [0].
+	SelectorIndex
+	// SelectorSlice is an array slice selector such as [1:5:2].
+	SelectorSlice
+	// SelectorWildcard is the wildcard selector [*] or .*.
+	SelectorWildcard
+	// SelectorFilter is a filter selector such as [?@.a].
+	SelectorFilter
+)
+
+// String returns the lowercase name of k, e.g. "wildcard".
+func (k SelectorKind) String() string {
+	switch k {
+	case SelectorName:
+		return "name"
+	case SelectorIndex:
+		return "index"
+	case SelectorSlice:
+		return "slice"
+	case SelectorWildcard:
+		return "wildcard"
+	case SelectorFilter:
+		return "filter"
+	default:
+		return fmt.Sprintf("SelectorKind(%d)", k)
+	}
+}
+
+// selectorKindOf converts an internal selector kind to its public mirror.
+// It reports false for kinds that have no mirror.
+func selectorKindOf(k ast.SelectorKind) (SelectorKind, bool) {
+	switch k {
+	case ast.Name:
+		return SelectorName, true
+	case ast.Index:
+		return SelectorIndex, true
+	case ast.Slice:
+		return SelectorSlice, true
+	case ast.Wildcard:
+		return SelectorWildcard, true
+	case ast.Filter:
+		return SelectorFilter, true
+	default:
+		return 0, false
+	}
+}
+
+// SegmentKind identifies the kind of an RFC 9535 §2.5 segment.
+type SegmentKind uint8
+
+const (
+	// SegmentChild is a child segment such as ['a'] or .a.
+	SegmentChild SegmentKind = iota
+	// SegmentDescendant is a descendant segment such as ..['a'] or ..a.
+	SegmentDescendant
+)
+
+// String returns the lowercase name of k, e.g. "child".
+func (k SegmentKind) String() string {
+	switch k {
+	case SegmentChild:
+		return "child"
+	case SegmentDescendant:
+		return "descendant"
+	default:
+		return fmt.Sprintf("SegmentKind(%d)", k)
+	}
+}
+
+// segmentKindOf returns the public kind of seg.
+func segmentKindOf(seg *ast.Segment) SegmentKind {
+	if seg.IsDescendant() {
+		return SegmentDescendant
+	}
+	return SegmentChild
+}
+
+// SliceArgs holds the optional start, end and step of an array slice
+// selector such as [1:5:2]. Its Bounds and Indices methods implement the
+// RFC 9535 §2.3.4 slice semantics the engine applies, so arrays can be
+// windowed outside of a query with identical results.
+type SliceArgs = ast.SliceArgs
+
+// SelectStats reports on one evaluation of a [Path], as returned by
+// [Path.SelectE] and [Path.SelectLocatedE].
+type SelectStats struct {
+	// PeakNodes is the length of the longest node list the evaluation held:
+	// the input node, the list produced by each segment and thus the result.
+	// It approximates the memory an evaluation needs beyond the document.
+	// When evaluation aborts with [ErrTooManyNodes] it is the length that
+	// exceeded the limit.
+	PeakNodes int
 }
 
 // LocatedNode pairs a value with the [NormalizedPath] for its location within
@@ -163,6 +922,46 @@ type LocatedNode struct {
 	Path  NormalizedPath
 }
 
+// Select evaluates the relative (@-rooted) path p against the value of n and
+// returns the matches located in the original document: each result path is
+// n.Path followed by the path within n.Value. It is [LocatedNodeList.Query]
+// for a list holding n alone: $ inside filter expressions of p refers to
+// n.Value, and it returns [ErrRootedQuery] if p is $-rooted.
+func (n *LocatedNode) Select(p *Path) (LocatedNodeList, error) {
+	return LocatedNodeList{n}.Query(p)
+}
+
+// SelectValues is like [LocatedNode.Select] but returns only the selected
+// values.
+func (n *LocatedNode) SelectValues(p *Path) (NodeList, error) {
+	if p.query != nil && p.query.IsRoot() {
+		return nil, fmt.Errorf("%w: %s", ErrRootedQuery, p)
+	}
+	res, _, err := p.selectLogged(context.Background(), "Select", nil, n.Value, n.Value)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// MarshalJSON implements json.Marshaler, encoding n as an object holding its
+// normalized path, its RFC 6901 JSON Pointer and its value:
+//
+//	{"path":"$['a'][0]","pointer":"/a/0","value":1}
+//
+// It returns [ErrInvalidPath] if a name in the path is not valid UTF-8.
+func (n LocatedNode) MarshalJSON() ([]byte, error) {
+	path, err := n.Path.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		Path    string `json:"path"`
+		Pointer string `json:"pointer"`
+		Value   any    `json:"value"`
+	}{string(path), n.Path.Pointer(), n.Value}, decodeOptions)
+}
+
 // NodeList is a list of nodes selected by a JSONPath query. Each node
 // represents a single JSON value selected from the JSON query argument.
 type NodeList []any
@@ -172,6 +971,203 @@ func (l NodeList) All() iter.Seq[any] {
 	return slices.Values(l)
 }
 
+// Enumerate returns an iterator over the index-value pairs of the nodes in
+// list, in order.
+func (l NodeList) Enumerate() iter.Seq2[int, any] {
+	return slices.All(l)
+}
+
+// MarshalJSON implements json.Marshaler, encoding list as a JSON array of its
+// nodes, empty if list is nil. Like [QueryJSON] it uses
+// github.com/go-json-experiment/json.
+func (l NodeList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		l = NodeList{}
+	}
+	return json.Marshal([]any(l), decodeOptions)
+}
+
+// First returns the first node in list, reporting false if list is empty.
+func (l NodeList) First() (any, bool) {
+	if len(l) == 0 {
+		return nil, false
+	}
+	return l[0], true
+}
+
+// Last returns the last node in list, reporting false if list is empty.
+func (l NodeList) Last() (any, bool) {
+	if len(l) == 0 {
+		return nil, false
+	}
+	return l[len(l)-1], true
+}
+
+// One returns the only node in list. It returns an error wrapping
+// [ErrNoMatch] if list is empty and [ErrMultipleMatches] if it holds more
+// than one node.
+func (l NodeList) One() (any, error) {
+	if err := checkOneNode(len(l)); err != nil {
+		return nil, err
+	}
+	return l[0], nil
+}
+
+// checkOneNode returns the error of [NodeList.One] for a list of n nodes, or
+// nil if n is 1.
+func checkOneNode(n int) error {
+	switch n {
+	case 0:
+		return fmt.Errorf("%w: list is empty", ErrNoMatch)
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("%w: list has %d nodes", ErrMultipleMatches, n)
+	}
+}
+
+// Deduplicate removes the nodes in list equal to an earlier one by the rules
+// of the == operator in filter expressions: numbers compare by value whatever
+// their Go type, and arrays and objects compare deeply. The first occurrence
+// of each value is kept, in order. Like [LocatedNodeList.Deduplicate] it
+// modifies the contents of list, returning the modified list, which may have
+// a shorter length, and zeroes the elements between the new length and the
+// original length.
+func (l NodeList) Deduplicate() NodeList {
+	if len(l) <= 1 {
+		return l
+	}
+
+	// Scalars are looked up by value, numbers as float64; arrays, objects
+	// and other values are compared with each one kept so far.
+	seen := make(map[any]struct{}, len(l))
+	var kept []any
+	uniq := l[:0]
+	for _, v := range l {
+		var key any
+		switch n := v.(type) {
+		case nil, string, bool:
+			key = n
+		default:
+			if f, ok := ast.Number(v); ok {
+				key = f
+			}
+		}
+		if key != nil || v == nil {
+			if _, exists := seen[key]; exists {
+				continue
+			}
+			seen[key] = struct{}{}
+		} else {
+			if slices.ContainsFunc(kept, func(k any) bool { return ast.ValuesEqual(k, v) }) {
+				continue
+			}
+			kept = append(kept, v)
+		}
+		uniq = append(uniq, v)
+	}
+	clear(l[len(uniq):])
+	return slices.Clip(uniq)
+}
+
+// Strings returns the nodes in list as strings. It returns an error wrapping
+// [ErrNodeType] that names the first node that is not a string.
+func (l NodeList) Strings() ([]string, error) {
+	return convertNodes(l, "a string", func(v any) (string, bool) {
+		s, ok := v.(string)
+		return s, ok
+	})
+}
+
+// Floats returns the nodes in list as float64 values, accepting any Go
+// integer or floating-point number. It returns an error wrapping
+// [ErrNodeType] that names the first node that is not a number.
+func (l NodeList) Floats() ([]float64, error) {
+	return convertNodes(l, "a number", func(v any) (float64, bool) {
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case float32:
+			return float64(n), true
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			return float64(rv.Int()), true
+		case rv.CanUint():
+			return float64(rv.Uint()), true
+		default:
+			return 0, false
+		}
+	})
+}
+
+// Ints returns the nodes in list as ints. Besides Go integers it accepts
+// floating-point numbers without a fractional part, such as the float64
+// values JSON numbers unmarshal to. It returns an error wrapping
+// [ErrNodeType] that names the first node that is not an integer in the
+// range of int.
+func (l NodeList) Ints() ([]int, error) {
+	return convertNodes(l, "an int", func(v any) (int, bool) {
+		switch n := v.(type) {
+		case int:
+			return n, true
+		case float64:
+			return floatToInt(n)
+		case float32:
+			return floatToInt(float64(n))
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.CanInt():
+			i := rv.Int()
+			return int(i), int64(int(i)) == i
+		case rv.CanUint():
+			u := rv.Uint()
+			return int(u), u <= math.MaxInt
+		default:
+			return 0, false
+		}
+	})
+}
+
+// Bools returns the nodes in list as bools. It returns an error wrapping
+// [ErrNodeType] that names the first node that is not a bool.
+func (l NodeList) Bools() ([]bool, error) {
+	return convertNodes(l, "a bool", func(v any) (bool, bool) {
+		b, ok := v.(bool)
+		return b, ok
+	})
+}
+
+// convertNodes converts every node in l with conv, which reports whether it
+// could. what describes the type conv expects in errors.
+func convertNodes[T any](l NodeList, what string, conv func(any) (T, bool)) ([]T, error) {
+	out := make([]T, len(l))
+	for i, v := range l {
+		t, ok := conv(v)
+		if !ok {
+			switch v.(type) {
+			case float64, float32:
+				return nil, fmt.Errorf("%w: node %d is %T %v, not %s", ErrNodeType, i, v, v, what)
+			default:
+				return nil, fmt.Errorf("%w: node %d is %T, not %s", ErrNodeType, i, v, what)
+			}
+		}
+		out[i] = t
+	}
+	return out, nil
+}
+
+// floatToInt converts f to an int if it has no fractional part and is in the
+// range of int.
+func floatToInt(f float64) (int, bool) {
+	if f != math.Trunc(f) || f < math.MinInt || f >= -math.MinInt {
+		return 0, false
+	}
+	return int(f), true
+}
+
 // LocatedNodeList is a list of nodes selected by a JSONPath query, along with
 // their [NormalizedPath] locations.
 type LocatedNodeList []*LocatedNode
@@ -181,6 +1177,47 @@ func (l LocatedNodeList) All() iter.Seq[*LocatedNode] {
 	return slices.Values(l)
 }
 
+// Enumerate returns an iterator over the index-node pairs of the located
+// nodes in list, in order.
+func (l LocatedNodeList) Enumerate() iter.Seq2[int, *LocatedNode] {
+	return slices.All(l)
+}
+
+// MarshalJSON implements json.Marshaler, encoding list as a JSON array of
+// the objects [LocatedNode.MarshalJSON] encodes, empty if list is nil.
+func (l LocatedNodeList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		l = LocatedNodeList{}
+	}
+	return json.Marshal([]*LocatedNode(l), decodeOptions)
+}
+
+// First returns the first located node in list, reporting false if list is
+// empty.
+func (l LocatedNodeList) First() (*LocatedNode, bool) {
+	if len(l) == 0 {
+		return nil, false
+	}
+	return l[0], true
+}
+
+// Last returns the last located node in list, reporting false if list is
+// empty.
+func (l LocatedNodeList) Last() (*LocatedNode, bool) {
+	if len(l) == 0 {
+		return nil, false
+	}
+	return l[len(l)-1], true
+}
+
+// One is the located variant of [NodeList.One].
+func (l LocatedNodeList) One() (*LocatedNode, error) {
+	if err := checkOneNode(len(l)); err != nil {
+		return nil, err
+	}
+	return l[0], nil
+}
+
 // Values returns an iterator over all the node values in list.
 func (l LocatedNodeList) Values() iter.Seq[any] {
 	return func(yield func(any) bool) {
@@ -203,31 +1240,253 @@ func (l LocatedNodeList) Paths() iter.Seq[NormalizedPath] {
 	}
 }
 
+// Pointers returns the RFC 6901 JSON Pointer of each node in list, in list
+// order. It is equivalent to calling [NormalizedPath.Pointer] on every path but
+// encodes all of them into one shared buffer instead of allocating a string
+// per node.
+func (l LocatedNodeList) Pointers() []string {
+	if len(l) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	ends := make([]int, len(l))
+	for i, n := range l {
+		for _, e := range n.Path {
+			buf.WriteByte('/')
+			e.writePointerTo(&buf)
+		}
+		ends[i] = buf.Len()
+	}
+	all := buf.String()
+	out := make([]string, len(l))
+	start := 0
+	for i, end := range ends {
+		out[i] = all[start:end]
+		start = end
+	}
+	return out
+}
+
+// PathStrings returns the normalized path string of each node in list, in
+// list order. Like [LocatedNodeList.Pointers] it is equivalent to calling
+// [NormalizedPath.String] on every path but renders all of them into one
+// shared buffer.
+func (l LocatedNodeList) PathStrings() []string {
+	if len(l) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	ends := make([]int, len(l))
+	for i, n := range l {
+		buf.WriteByte('$')
+		for _, e := range n.Path {
+			e.writeNormalizedTo(&buf)
+		}
+		ends[i] = buf.Len()
+	}
+	all := buf.String()
+	out := make([]string, len(l))
+	start := 0
+	for i, end := range ends {
+		out[i] = all[start:end]
+		start = end
+	}
+	return out
+}
+
+// ToMap returns the node values in list keyed by the string form of their
+// [NormalizedPath]. When list holds several nodes at one path, as it may
+// before [LocatedNodeList.Deduplicate], the value of the last one wins.
+func (l LocatedNodeList) ToMap() map[string]any {
+	m := make(map[string]any, len(l))
+	for _, n := range l {
+		m[n.Path.String()] = n.Value
+	}
+	return m
+}
+
+// ToPointerMap is like [LocatedNodeList.ToMap] but keys the values by the
+// RFC 6901 JSON Pointer of their path, as returned by
+// [LocatedNodeList.Pointers]. The value of the last node at a path wins.
+func (l LocatedNodeList) ToPointerMap() map[string]any {
+	m := make(map[string]any, len(l))
+	for i, ptr := range l.Pointers() {
+		m[ptr] = l[i].Value
+	}
+	return m
+}
+
+// Query evaluates the relative path p, compiled with [ParseRelative],
+// against the value of each node in list and returns the matches in list
+// order. Result paths are prefixed with the path of the node they were
+// selected from, so they remain valid against the original document.
+// Because the original document is not known, $ inside filter expressions of
+// p refers to each node's value. Returns [ErrRootedQuery] if p is $-rooted,
+// since it is unclear whether $ means the original document or each node;
+// use [LocatedNodeList.QueryAsRelative] to treat it as relative. Returns
+// [ErrTooManyNodes] if evaluating p against a node exceeds the limit set by
+// [WithMaxIntermediateNodes].
+func (l LocatedNodeList) Query(p *Path) (LocatedNodeList, error) {
+	if p.query != nil && p.query.IsRoot() {
+		return nil, fmt.Errorf("%w: %s", ErrRootedQuery, p)
+	}
+	return l.QueryAsRelative(p)
+}
+
+// QueryAsRelative is like [LocatedNodeList.Query] but accepts a $-rooted p
+// and treats it as relative: $ refers to the value of each node in list, as
+// @ would, so $.price and @.price select the same nodes.
+func (l LocatedNodeList) QueryAsRelative(p *Path) (LocatedNodeList, error) {
+	var out LocatedNodeList
+	for _, n := range l {
+		var err error
+		if out, _, err = p.selectLocated(context.Background(), out, n.Value, n.Value, n.Path); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
 // Deduplicate deduplicates the nodes in list based on their [NormalizedPath]
-// values, modifying the contents of list. It returns the modified list, which
-// may have a shorter length, and zeroes the elements between the new length
-// and the original length.
+// values, keeping the first node at each path. It is destructive: it modifies
+// the contents of list, returning the modified list, which may have a
+// shorter length, and zeroes the elements between the new length and the
+// original length, so other holders of list see it change. Use
+// [LocatedNodeList.Deduplicated] to leave list untouched, for example when it
+// is shared between goroutines.
 func (l LocatedNodeList) Deduplicate() LocatedNodeList {
 	if len(l) <= 1 {
 		return l
 	}
+	uniq := appendUniquePaths(l[:0], l)
+	clear(l[len(uniq):])
+	return slices.Clip(uniq)
+}
 
-	seen := make(map[string]struct{}, len(l))
-	uniq := l[:0]
+// Deduplicated is like [LocatedNodeList.Deduplicate] but returns the nodes
+// in a new list, leaving list unchanged. The nodes themselves are shared.
+func (l LocatedNodeList) Deduplicated() LocatedNodeList {
+	if len(l) <= 1 {
+		return slices.Clone(l)
+	}
+	return slices.Clip(appendUniquePaths(make(LocatedNodeList, 0, len(l)), l))
+}
+
+// appendUniquePaths appends to dst the first node in l at each path. dst may
+// share the start of l's backing array.
+func appendUniquePaths(dst, l LocatedNodeList) LocatedNodeList {
+	// Nodes are keyed by a hash of their path rather than its string, which
+	// would allocate per node. The nodes kept with the same hash form a
+	// chain, newest first, that is searched for an equal path.
+	base := len(dst)
+	latest := make(map[uint64]int, len(l)) // hash → position after base
+	prev := make([]int, 0, len(l))         // position → previous in chain, or -1
+	var h maphash.Hash
+	h.SetSeed(pathHashSeed)
 	for _, n := range l {
-		p := n.Path.String()
-		if _, exists := seen[p]; !exists {
-			seen[p] = struct{}{}
-			uniq = append(uniq, n)
+		sum := hashPath(&h, n.Path)
+		head, ok := latest[sum]
+		if !ok {
+			head = -1
+		}
+		dup := false
+		for i := head; i >= 0 && !dup; i = prev[i] {
+			dup = slices.Equal(dst[base+i].Path, n.Path)
+		}
+		if !dup {
+			latest[sum] = len(prev)
+			prev = append(prev, head)
+			dst = append(dst, n)
 		}
 	}
-	clear(l[len(uniq):])
-	return slices.Clip(uniq)
+	return dst
 }
 
-// Sort sorts list by the [NormalizedPath] of each node.
+// pathHashSeed seeds the path hashes of appendUniquePaths.
+var pathHashSeed = maphash.MakeSeed()
+
+// hashPath returns the hash h computes over the elements of p. The kind and,
+// for names, the length of each element are hashed along with its value, so
+// that no two different paths feed h the same bytes.
+func hashPath(h *maphash.Hash, p NormalizedPath) uint64 {
+	h.Reset()
+	var buf [9]byte
+	for _, e := range p {
+		switch e := e.(type) {
+		case NameElement:
+			buf[0] = 'n'
+			binary.LittleEndian.PutUint64(buf[1:], uint64(len(e)))
+			h.Write(buf[:])
+			h.WriteString(string(e))
+		case IndexElement:
+			buf[0] = 'i'
+			binary.LittleEndian.PutUint64(buf[1:], uint64(e))
+			h.Write(buf[:])
+		}
+	}
+	return h.Sum64()
+}
+
+// Clone returns a copy of list holding copies of its nodes, each with its own
+// [NormalizedPath], so neither list nor its paths change with the copy.
+// Values are not copied: a map or slice value is shared with list.
+func (l LocatedNodeList) Clone() LocatedNodeList {
+	if l == nil {
+		return nil
+	}
+	out := make(LocatedNodeList, len(l))
+	nodes := make([]LocatedNode, len(l))
+	for i, n := range l {
+		if n == nil {
+			continue
+		}
+		nodes[i] = LocatedNode{Value: n.Value, Path: slices.Clone(n.Path)}
+		out[i] = &nodes[i]
+	}
+	return out
+}
+
+// Sort sorts list by the [NormalizedPath] of each node. The sort is stable:
+// nodes at the same path, such as those selected by $[0,0], keep their
+// selection order.
 func (l LocatedNodeList) Sort() {
-	slices.SortFunc(l, func(a, b *LocatedNode) int {
+	l.SortFunc(func(a, b *LocatedNode) int {
 		return a.Path.Compare(b.Path)
 	})
 }
+
+// SortFunc sorts list in the order defined by cmp, which follows the
+// conventions of [slices.SortFunc]. The sort is stable, so nodes cmp considers
+// equal keep their relative order. Pass a function that negates
+// [NormalizedPath.Compare] to sort by path in reverse.
+func (l LocatedNodeList) SortFunc(cmp func(a, b *LocatedNode) int) {
+	if len(l) <= stableSortMax {
+		slices.SortStableFunc(l, cmp)
+		return
+	}
+	// A stable sort merges in place, making O(n log² n) comparisons, each
+	// of which walks two paths. Breaking ties by position makes an unstable
+	// sort, which needs O(n log n), order the nodes the same way.
+	type entry struct {
+		node *LocatedNode
+		pos  int
+	}
+	entries := make([]entry, len(l))
+	for i, n := range l {
+		entries[i] = entry{n, i}
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		if x := cmp(a.node, b.node); x != 0 {
+			return x
+		}
+		return a.pos - b.pos
+	})
+	for i, e := range entries {
+		l[i] = e.node
+	}
+}
+
+// stableSortMax is the longest list [LocatedNodeList.SortFunc] sorts in
+// place. slices.SortStableFunc insertion-sorts lists this short, which is
+// cheaper than allocating positions for them.
+const stableSortMax = 20
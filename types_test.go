@@ -1,9 +1,19 @@
 package jsonpath
 
 import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/agentable/jsonpath/internal/ast"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNameElement_Normalized(t *testing.T) {
@@ -51,6 +61,18 @@ func TestNameElement_Normalized(t *testing.T) {
 			norm: `['\u0001\u0002\u0003\u0004\u0005\u0006\u0007\u000e\u000f']`,
 			ptr:  "\u0001\u0002\u0003\u0004\u0005\u0006\u0007\u000e\u000F",
 		},
+		{
+			name: "escape_high_control_chars",
+			elem: NameElement("\u0010\u001B\u001f"),
+			norm: `['\u0010\u001b\u001f']`,
+			ptr:  "\u0010\u001B\u001f",
+		},
+		{
+			name: "no_escape_del_and_separators",
+			elem: NameElement("\u007f\u2028\"é"),
+			norm: "['\u007f\u2028\"é']",
+			ptr:  "\u007f\u2028\"é",
+		},
 		{
 			name: "escape_pointer_chars",
 			elem: NameElement("this / ~that"),
@@ -106,6 +128,157 @@ func TestIndexElement_Normalized(t *testing.T) {
 	}
 }
 
+func TestIndexElement_Large(t *testing.T) {
+	t.Parallel()
+
+	const big = math.MaxInt32 + 1
+	const huge = 1<<53 - 1
+	doc := map[string]any{
+		"sparse": map[int64]any{big: "big", huge: "huge", 1: "one"},
+	}
+
+	got := MustParse("$.sparse[*]").SelectLocated(doc)
+	got.Sort()
+	require.Len(t, got, 3)
+	assert.Equal(t, NormalizedPath{NameElement("sparse"), IndexElement(1)}, got[0].Path)
+	assert.Equal(t, NormalizedPath{NameElement("sparse"), IndexElement(big)}, got[1].Path)
+	assert.Equal(t, NormalizedPath{NameElement("sparse"), IndexElement(huge)}, got[2].Path)
+	assert.Equal(t, "$['sparse'][2147483648]", got[1].Path.String())
+	assert.Equal(t, "/sparse/9007199254740991", got[2].Path.Pointer())
+
+	located := MustParse("$.sparse[9007199254740991]").SelectLocated(doc)
+	require.Len(t, located, 1)
+	assert.Equal(t, IndexElement(huge), located[0].Path[1])
+
+	assert.Equal(t, -1, NormalizedPath{IndexElement(big)}.Compare(NormalizedPath{IndexElement(huge)}))
+	assert.Equal(t, 1, NormalizedPath{IndexElement(big)}.Compare(NormalizedPath{IndexElement(math.MaxInt32)}))
+
+	for _, n := range got {
+		v, ok := n.Path.Resolve(doc)
+		assert.True(t, ok)
+		assert.Equal(t, n.Value, v)
+
+		p, err := ParseNormalizedPath(n.Path.String())
+		require.NoError(t, err)
+		assert.Equal(t, n.Path, p)
+
+		p, err = ParsePointer(n.Path.Pointer())
+		require.NoError(t, err)
+		assert.Equal(t, n.Path, p)
+
+		data, err := n.Path.MarshalJSON()
+		require.NoError(t, err)
+		require.NoError(t, p.UnmarshalJSON(data))
+		assert.Equal(t, n.Path, p)
+	}
+
+	v, ok := ResolvePointer("/sparse/2147483648", doc)
+	assert.True(t, ok)
+	assert.Equal(t, "big", v)
+}
+
+func TestNormalizedPath_Elements(t *testing.T) {
+	t.Parallel()
+
+	p := NormalizedPath{NameElement("a"), IndexElement(math.MaxInt32 + 1), NameElement("0")}
+	var (
+		positions []int
+		names     []string
+		indexes   []int64
+	)
+	for i, e := range p.Elements() {
+		positions = append(positions, i)
+		name, isName := IsName(e)
+		idx, isIndex := IsIndex(e)
+		require.NotEqual(t, isName, isIndex, "every element is exactly one kind")
+		if isName {
+			names = append(names, name)
+			assert.Zero(t, idx)
+		} else {
+			indexes = append(indexes, idx)
+			assert.Empty(t, name)
+		}
+	}
+	assert.Equal(t, []int{0, 1, 2}, positions)
+	assert.Equal(t, []string{"a", "0"}, names)
+	assert.Equal(t, []int64{math.MaxInt32 + 1}, indexes)
+
+	// The iterator stops when asked to.
+	for i := range p.Elements() {
+		require.Zero(t, i)
+		break
+	}
+	for range NormalizedPath(nil).Elements() {
+		t.Fatal("nil path has no elements")
+	}
+
+	_, ok := IsName(nil)
+	assert.False(t, ok)
+	_, ok = IsIndex(nil)
+	assert.False(t, ok)
+}
+
+func TestName_Index(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, NameElement("a"), Name("a"))
+	assert.Equal(t, NameElement(""), Name(""))
+
+	for _, i := range []int64{0, 1, math.MaxInt32 + 1, 1<<53 - 1} {
+		e, err := Index(i)
+		require.NoError(t, err)
+		assert.Equal(t, IndexElement(i), e)
+	}
+	for _, i := range []int64{-1, math.MinInt64} {
+		e, err := Index(i)
+		assert.ErrorIs(t, err, ErrInvalidPath)
+		assert.Nil(t, e)
+	}
+
+	idx, err := Index(0)
+	require.NoError(t, err)
+	p := NormalizedPath{Name("store"), Name("book"), idx}
+	assert.Equal(t, "$['store']['book'][0]", p.String())
+	assert.Equal(t, "/store/book/0", p.Pointer())
+
+	// The negative keys of sparse arrays resolve, but render as a marker
+	// and do not marshal.
+	doc := map[int]any{-1: "z"}
+	got := MustParse("$[*]").SelectLocated(doc)
+	require.Len(t, got, 1)
+	neg := got[0].Path
+	assert.Equal(t, NormalizedPath{IndexElement(-1)}, neg)
+	v, ok := neg.Resolve(doc)
+	assert.True(t, ok)
+	assert.Equal(t, "z", v)
+	assert.Equal(t, "$[%!index(-1)]", neg.String())
+	assert.Equal(t, "/%!index(-1)", neg.Pointer())
+	_, err = ParseNormalizedPath(neg.String())
+	require.ErrorIs(t, err, ErrInvalidPath)
+	_, err = neg.MarshalText()
+	require.ErrorIs(t, err, ErrInvalidPath)
+	assert.EqualError(t, err, "jsonpath: invalid normalized path: element 0: index -1 is negative")
+	_, err = neg.MarshalJSON()
+	require.ErrorIs(t, err, ErrInvalidPath)
+	_, err = neg.RelativeTo(nil)
+	require.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func TestIndexElement_Negative(t *testing.T) {
+	t.Parallel()
+
+	p := NormalizedPath{NameElement("a"), IndexElement(-3), NameElement("b")}
+	assert.Equal(t, "$['a'][%!index(-3)]['b']", p.String())
+	assert.Equal(t, "/a/%!index(-3)/b", p.Pointer())
+	_, err := ParseNormalizedPath(p.String())
+	require.ErrorIs(t, err, ErrInvalidPath)
+
+	// The marker keeps the other elements, and non-negative indexes render
+	// as before.
+	assert.Equal(t, "$['a'][0][%!index(-9223372036854775808)]", NormalizedPath{NameElement("a"), IndexElement(0), IndexElement(math.MinInt64)}.String())
+	assert.Equal(t, "/0/9223372036854775807", NormalizedPath{IndexElement(0), IndexElement(math.MaxInt64)}.Pointer())
+}
+
 func TestNormalizedPath_String(t *testing.T) {
 	t.Parallel()
 
@@ -251,6 +424,206 @@ func TestNormalizedPath_Compare(t *testing.T) {
 	}
 }
 
+// comparePathsReference is the element-by-element ordering Compare must
+// keep: indexes before names, then indexes numerically and names by bytes,
+// then shorter paths first.
+func comparePathsReference(p, q NormalizedPath) int {
+	for i := range min(len(p), len(q)) {
+		n1, isName1 := p[i].(NameElement)
+		n2, isName2 := q[i].(NameElement)
+		switch {
+		case isName1 && isName2:
+			if x := strings.Compare(string(n1), string(n2)); x != 0 {
+				return x
+			}
+		case isName1:
+			return 1
+		case isName2:
+			return -1
+		default:
+			if x := cmp.Compare(p[i].(IndexElement), q[i].(IndexElement)); x != 0 {
+				return x
+			}
+		}
+	}
+	return cmp.Compare(len(p), len(q))
+}
+
+// randomPaths returns n paths with shared prefixes, mixing names that look
+// like indexes with indexes.
+func randomPaths(rng *rand.Rand, n int) []NormalizedPath {
+	elems := []PathElement{
+		NameElement(""), NameElement("0"), NameElement("a"), NameElement("ab"), NameElement("b"),
+		IndexElement(0), IndexElement(1), IndexElement(10), IndexElement(math.MaxInt32 + 1),
+	}
+	paths := make([]NormalizedPath, n)
+	for i := range paths {
+		p := make(NormalizedPath, rng.IntN(5))
+		for j := range p {
+			p[j] = elems[rng.IntN(len(elems))]
+		}
+		paths[i] = p
+	}
+	return paths
+}
+
+func TestNormalizedPath_Compare_Reference(t *testing.T) {
+	t.Parallel()
+
+	paths := randomPaths(rand.New(rand.NewPCG(3, 4)), 300)
+	for _, p := range paths {
+		for _, q := range paths {
+			require.Equal(t, comparePathsReference(p, q), p.Compare(q), "%s vs %s", p, q)
+		}
+	}
+}
+
+func TestLocatedNodeList_Sort_MatchesStableSort(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{0, 1, stableSortMax, stableSortMax + 1, 1000} {
+		list := make(LocatedNodeList, n)
+		for i, p := range randomPaths(rand.New(rand.NewPCG(7, uint64(n))), n) {
+			list[i] = &LocatedNode{Value: i, Path: p}
+		}
+		want := slices.Clone(list)
+		slices.SortStableFunc(want, func(a, b *LocatedNode) int {
+			return comparePathsReference(a.Path, b.Path)
+		})
+		list.Sort()
+		assert.Equal(t, want, list, n)
+	}
+}
+
+func TestLocatedNodeList_Deduplicate_MatchesStringKeys(t *testing.T) {
+	t.Parallel()
+
+	list := make(LocatedNodeList, 2000)
+	for i, p := range randomPaths(rand.New(rand.NewPCG(8, 9)), len(list)) {
+		list[i] = &LocatedNode{Value: i, Path: p}
+	}
+
+	var want LocatedNodeList
+	seen := map[string]bool{}
+	for _, n := range list {
+		// Tag each element with its kind so names and indexes differ.
+		var key strings.Builder
+		for _, e := range n.Path {
+			fmt.Fprintf(&key, "%T:%v/", e, e)
+		}
+		if !seen[key.String()] {
+			seen[key.String()] = true
+			want = append(want, n)
+		}
+	}
+	require.Less(t, len(want), len(list))
+
+	assert.Equal(t, want, list.Deduplicated())
+	assert.Equal(t, want, list.Deduplicate())
+}
+
+func BenchmarkLocatedNodeList_Sort(b *testing.B) {
+	// 100k nodes of a document of 1000 records with 100 fields each.
+	rng := rand.New(rand.NewPCG(5, 6))
+	located := make(LocatedNodeList, 0, 100_000)
+	for i := range 1000 {
+		for j := range 100 {
+			located = append(located, &LocatedNode{Path: NormalizedPath{
+				NameElement("data"), NameElement("records"), IndexElement(i), NameElement(fmt.Sprintf("field%d", j)),
+			}})
+		}
+	}
+	rng.Shuffle(len(located), func(i, j int) { located[i], located[j] = located[j], located[i] })
+
+	work := make(LocatedNodeList, len(located))
+	for b.Loop() {
+		copy(work, located)
+		work.Sort()
+	}
+}
+
+func TestNormalizedPath_Navigation(t *testing.T) {
+	t.Parallel()
+
+	p := NormalizedPath{NameElement("a"), IndexElement(0), NameElement("b")}
+
+	t.Run("parent", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, NormalizedPath{NameElement("a"), IndexElement(0)}, p.Parent())
+		assert.Equal(t, NormalizedPath{}, NormalizedPath{IndexElement(1)}.Parent())
+		assert.Nil(t, NormalizedPath{}.Parent())
+		assert.Nil(t, NormalizedPath(nil).Parent())
+	})
+
+	t.Run("last", func(t *testing.T) {
+		t.Parallel()
+		e, ok := p.Last()
+		assert.True(t, ok)
+		assert.Equal(t, NameElement("b"), e)
+		e, ok = NormalizedPath(nil).Last()
+		assert.False(t, ok)
+		assert.Nil(t, e)
+	})
+
+	t.Run("has_prefix", func(t *testing.T) {
+		t.Parallel()
+		for _, tc := range []struct {
+			name   string
+			prefix NormalizedPath
+			exp    bool
+		}{
+			{"nil", nil, true},
+			{"empty", NormalizedPath{}, true},
+			{"first", NormalizedPath{NameElement("a")}, true},
+			{"parent", NormalizedPath{NameElement("a"), IndexElement(0)}, true},
+			{"self", p, true},
+			{"longer", append(p.Truncate(3), IndexElement(1)), false},
+			{"other_name", NormalizedPath{NameElement("b")}, false},
+			{"other_index", NormalizedPath{NameElement("a"), IndexElement(1)}, false},
+			{"name_like_index", NormalizedPath{NameElement("a"), NameElement("0")}, false},
+			{"index_for_name", NormalizedPath{IndexElement(0)}, false},
+			{"name_prefix", NormalizedPath{NameElement("")}, false},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Parallel()
+				assert.Equal(t, tc.exp, p.HasPrefix(tc.prefix))
+			})
+		}
+
+		q := NormalizedPath{NameElement("0")}
+		assert.False(t, q.HasPrefix(NormalizedPath{IndexElement(0)}))
+		assert.False(t, NormalizedPath{IndexElement(0)}.HasPrefix(q))
+		assert.False(t, NormalizedPath(nil).HasPrefix(q))
+		assert.True(t, NormalizedPath(nil).HasPrefix(nil))
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, NormalizedPath{NameElement("a")}, p.Truncate(1))
+		assert.Equal(t, p, p.Truncate(3))
+		assert.Equal(t, p, p.Truncate(10))
+		assert.Equal(t, NormalizedPath{}, p.Truncate(0))
+		assert.Equal(t, NormalizedPath{}, p.Truncate(-1))
+		assert.Nil(t, NormalizedPath(nil).Truncate(2))
+
+		// Appending to a truncated path leaves the original alone.
+		q := append(p.Truncate(1), NameElement("x"))
+		assert.Equal(t, NormalizedPath{NameElement("a"), NameElement("x")}, q)
+		assert.Equal(t, IndexElement(0), p[1])
+	})
+}
+
+func TestNormalizedPath_Navigation_Allocs(t *testing.T) {
+	p := NormalizedPath{NameElement("a"), IndexElement(0), NameElement("b")}
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = p.Parent()
+		_, _ = p.Last()
+		_ = p.HasPrefix(p[:2])
+		_ = p.Truncate(1)
+	})
+	assert.Zero(t, allocs)
+}
+
 func TestNormalizedPath_MarshalText(t *testing.T) {
 	t.Parallel()
 
@@ -258,4 +631,635 @@ func TestNormalizedPath_MarshalText(t *testing.T) {
 	text, err := p.MarshalText()
 	assert.NoError(t, err)
 	assert.Equal(t, "$['a'][0]", string(text))
+
+	_, err = NormalizedPath{NameElement("a"), NameElement("b\xffc")}.MarshalText()
+	assert.ErrorIs(t, err, ErrInvalidPath)
+	assert.EqualError(t, err, `jsonpath: invalid normalized path: element 1: name "b\xffc" is not valid UTF-8`)
+}
+
+func TestNormalizedPath_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name string
+		path NormalizedPath
+		exp  string
+	}{
+		{"nil", nil, `[]`},
+		{"mixed", NormalizedPath{NameElement("a"), IndexElement(0), NameElement("b")}, `["a",0,"b"]`},
+		{"name_like_index", NormalizedPath{NameElement("0"), IndexElement(10)}, `["0",10]`},
+		{"escapes", NormalizedPath{NameElement("it's \"x\"\n☺")}, `["it's \"x\"\n☺"]`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			data, err := tc.path.MarshalJSON()
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.exp, string(data))
+
+			var got NormalizedPath
+			require.NoError(t, got.UnmarshalJSON(data))
+			if tc.path == nil {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tc.path, got)
+		})
+	}
+
+	_, err := NormalizedPath{NameElement("b\xffc")}.MarshalJSON()
+	assert.ErrorIs(t, err, ErrInvalidPath)
+
+	// Nested in other values through encoding/json.
+	var s struct {
+		Path NormalizedPath `json:"path"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"path":["store","book",1]}`), &s))
+	assert.Equal(t, NormalizedPath{NameElement("store"), NameElement("book"), IndexElement(1)}, s.Path)
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path":["store","book",1]}`, string(data))
+
+	p := NormalizedPath{NameElement("a")}
+	require.NoError(t, p.UnmarshalJSON([]byte("null")))
+	assert.Nil(t, p)
+}
+
+func TestNormalizedPath_UnmarshalJSON_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		``,
+		`"$['a']"`,
+		`{"a":0}`,
+		`[1.5]`,
+		`[1.0]`,
+		`[1e2]`,
+		`[-1]`,
+		`[99999999999999999999]`,
+		`[null]`,
+		`[true]`,
+		`[["a"]]`,
+		`[{"name":"a"}]`,
+		`["a",]`,
+		`["a"] x`,
+		"[\"\xff\"]",
+	} {
+		var p NormalizedPath
+		err := p.UnmarshalJSON([]byte(data))
+		assert.ErrorIs(t, err, ErrInvalidPath, data)
+		assert.Nil(t, p, data)
+	}
+}
+
+func TestNormalizedPath_Resolve(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"title": "A", "tags": []any{"x"}},
+				map[string]any{"title": "B", "isbn": nil},
+			},
+			"a/b~c": 1,
+		},
+		"sparse": map[int]any{7: "seven"},
+	}
+
+	for _, expr := range []string{"$..*", "$", "$..[?@.title]", "$.sparse[7]"} {
+		for _, n := range MustParse(expr).SelectLocated(doc) {
+			got, ok := n.Path.Resolve(doc)
+			require.True(t, ok, n.Path.String())
+			assertSameNode(t, n.Value, got)
+		}
+	}
+
+	for _, path := range []NormalizedPath{
+		{NameElement("missing")},
+		{NameElement("store"), IndexElement(0)},
+		{NameElement("store"), NameElement("book"), IndexElement(2)},
+		{NameElement("store"), NameElement("book"), IndexElement(-1)},
+		{NameElement("store"), NameElement("book"), NameElement("0")},
+		{NameElement("store"), NameElement("a/b~c"), NameElement("x")},
+		{NameElement("sparse"), IndexElement(8)},
+	} {
+		_, ok := path.Resolve(doc)
+		assert.False(t, ok, path.String())
+	}
+}
+
+func TestNormalizedPath_ToPath(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"store": map[string]any{
+			"book": []any{
+				map[string]any{"title": "A", "tags": []any{"x", "y"}},
+				map[string]any{"title": "B", "isbn": nil},
+			},
+			"it's": "\"quoted\"\n",
+		},
+		"sparse": map[int]any{7: "seven"},
+	}
+
+	for _, n := range MustParse("$..*").SelectLocated(doc) {
+		p, err := n.Path.ToPath()
+		require.NoError(t, err)
+		assert.True(t, p.query.IsSingular(), p.String())
+		got := p.Select(doc)
+		require.Len(t, got, 1, p.String())
+		assertSameNode(t, n.Value, got[0])
+
+		// String renders the canonical form, which parses to the same path.
+		assert.Equal(t, p.String(), MustParse(p.String()).String())
+	}
+
+	p, err := NormalizedPath{NameElement("store"), NameElement("it's"), IndexElement(0)}.ToPath()
+	require.NoError(t, err)
+	assert.Equal(t, `$["store"]["it's"][0]`, p.String())
+	assert.True(t, p.query.IsSingular())
+
+	p, err = NormalizedPath(nil).ToPath()
+	require.NoError(t, err)
+	assert.Equal(t, "$", p.String())
+	assert.Equal(t, NodeList{doc}, p.Select(doc))
+
+	p, err = NormalizedPath{NameElement("sparse"), IndexElement(7)}.ToPath()
+	require.NoError(t, err)
+	assert.Equal(t, NodeList{"seven"}, p.Select(doc))
+
+	// Indexes up to 2^53-1 round-trip through String; larger ones do not
+	// parse, so ToPath rejects them.
+	const maxIndex = 1<<53 - 1
+	for _, i := range []IndexElement{maxIndex, -maxIndex} {
+		p, err = NormalizedPath{NameElement("a"), i}.ToPath()
+		require.NoError(t, err)
+		assert.Equal(t, p.String(), MustParse(p.String()).String())
+	}
+	for _, i := range []IndexElement{maxIndex + 1, -maxIndex - 1, 1 << 60, math.MaxInt64, math.MinInt64} {
+		p, err = NormalizedPath{NameElement("a"), i}.ToPath()
+		require.ErrorIs(t, err, ErrInvalidPath, "index %d", i)
+		assert.EqualError(t, err, fmt.Sprintf("jsonpath: invalid normalized path: element 1: index %d is out of range", i))
+		assert.Nil(t, p)
+	}
+}
+
+// assertSameNode asserts that got is want itself: the same map or slice, or
+// an equal scalar.
+func assertSameNode(t *testing.T, want, got any) {
+	t.Helper()
+	if c := ast.ContainerOf(want); c != (ast.Container{}) {
+		assert.Equal(t, c, ast.ContainerOf(got))
+		return
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestResolvePointer(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"foo":    []any{"bar", "baz"},
+		"":       0,
+		"a/b":    1,
+		"c%d":    2,
+		"e^f":    3,
+		"g|h":    4,
+		"i\\j":   5,
+		"k\"l":   6,
+		" ":      7,
+		"m~n":    8,
+		"~1":     9,
+		"sparse": map[int64]any{10: "ten"},
+	}
+
+	// The examples of RFC 6901 section 5.
+	for ptr, exp := range map[string]any{
+		"":       doc,
+		"/foo":   []any{"bar", "baz"},
+		"/foo/0": "bar",
+		"/":      0,
+		"/a~1b":  1,
+		"/c%d":   2,
+		"/e^f":   3,
+		"/g|h":   4,
+		"/i\\j":  5,
+		"/k\"l":  6,
+		"/ ":     7,
+		"/m~0n":  8,
+	} {
+		got, ok := ResolvePointer(ptr, doc)
+		require.True(t, ok, ptr)
+		assert.Equal(t, exp, got, ptr)
+	}
+
+	got, ok := ResolvePointer("/~01", doc)
+	assert.True(t, ok)
+	assert.Equal(t, 9, got)
+	got, ok = ResolvePointer("/sparse/10", doc)
+	assert.True(t, ok)
+	assert.Equal(t, "ten", got)
+
+	for _, ptr := range []string{
+		"foo",
+		"/missing",
+		"/foo/-",
+		"/foo/2",
+		"/foo/01",
+		"/foo/+1",
+		"/foo/-1",
+		"/foo/1e0",
+		"/foo/",
+		"/foo/99999999999999999999",
+		"/foo/0/x",
+		"/a~2b",
+		"/m~",
+		"/sparse/11",
+	} {
+		_, ok := ResolvePointer(ptr, doc)
+		assert.False(t, ok, ptr)
+	}
+
+	// Every located node resolves by its pointer.
+	for _, n := range MustParse("$..*").SelectLocated(doc) {
+		got, ok := ResolvePointer(n.Path.Pointer(), doc)
+		require.True(t, ok, n.Path.Pointer())
+		assertSameNode(t, n.Value, got)
+	}
+}
+
+func TestParseNormalizedPath(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		text string
+		exp  NormalizedPath
+	}{
+		{"$", nil},
+		{"$[0]", NormalizedPath{IndexElement(0)}},
+		{"$['a'][12]", NormalizedPath{NameElement("a"), IndexElement(12)}},
+		{"$['']", NormalizedPath{NameElement("")}},
+		{`$['it\'s']`, NormalizedPath{NameElement("it's")}},
+		{`$['a\\b']`, NormalizedPath{NameElement(`a\b`)}},
+		{`$['\b\f\n\r\t']`, NormalizedPath{NameElement("\b\f\n\r\t")}},
+		{`$['\u0000\u000b\u001f']`, NormalizedPath{NameElement("\x00\x0b\x1f")}},
+		{`$['"☺"']`, NormalizedPath{NameElement(`"☺"`)}},
+		{"$['[0]']['$']", NormalizedPath{NameElement("[0]"), NameElement("$")}},
+		{"$[9007199254740991]", NormalizedPath{IndexElement(1<<53 - 1)}},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			t.Parallel()
+			p, err := ParseNormalizedPath(tc.text)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, p)
+			assert.Equal(t, tc.text, p.String())
+		})
+	}
+
+	for _, text := range []string{
+		"",
+		"$.a",
+		"a",
+		"$[",
+		"$[]",
+		"$[-1]",
+		"$[01]",
+		"$[1 ]",
+		"$[99999999999999999999]",
+		"$[9007199254740992]",
+		"$[9223372036854775807]",
+		"$['a']x",
+		"$['a'",
+		"$['a]",
+		`$["a"]`,
+		"$[*]",
+		`$['\"']`,
+		`$['\/']`,
+		`$['\u000a']`,
+		`$['\u001F']`,
+		`$['\u00']`,
+		`$['\x']`,
+		"$['\n']",
+		"$['\xff']",
+	} {
+		_, err := ParseNormalizedPath(text)
+		assert.ErrorIs(t, err, ErrInvalidPath, text)
+	}
+}
+
+func TestNormalizedPath_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	names := []string{"", "a", "it's", `\`, "\x00\x01\x07\x08\x0b\x1f\x7f", "\t\n", "é☺", "[0]", "/~", "0"}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 500 {
+		var p NormalizedPath
+		for range rng.IntN(5) {
+			if rng.IntN(2) == 0 {
+				p = append(p, IndexElement(rng.IntN(1000)))
+				continue
+			}
+			var b strings.Builder
+			for range rng.IntN(3) {
+				b.WriteString(names[rng.IntN(len(names))])
+			}
+			p = append(p, NameElement(b.String()))
+		}
+
+		text, err := p.MarshalText()
+		require.NoError(t, err)
+		var got NormalizedPath
+		require.NoError(t, got.UnmarshalText(text))
+		assert.Equal(t, p, got, string(text))
+		assert.Equal(t, string(text), got.String())
+
+		ptr, err := ParsePointerNames(p.Pointer())
+		require.NoError(t, err)
+		require.Len(t, ptr, len(p))
+		for i, elem := range p {
+			name, ok := elem.(NameElement)
+			if !ok {
+				name = NameElement(fmt.Sprint(elem))
+			}
+			assert.Equal(t, name, ptr[i])
+		}
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		ptr   string
+		exp   NormalizedPath
+		names NormalizedPath
+	}{
+		{"", nil, nil},
+		{"/", NormalizedPath{NameElement("")}, NormalizedPath{NameElement("")}},
+		{
+			"/foo/0/10",
+			NormalizedPath{NameElement("foo"), IndexElement(0), IndexElement(10)},
+			NormalizedPath{NameElement("foo"), NameElement("0"), NameElement("10")},
+		},
+		{
+			"/a~1b/m~0n/~01",
+			NormalizedPath{NameElement("a/b"), NameElement("m~n"), NameElement("~1")},
+			NormalizedPath{NameElement("a/b"), NameElement("m~n"), NameElement("~1")},
+		},
+		{
+			"/01/-/-1/1e0/99999999999999999999",
+			NormalizedPath{NameElement("01"), NameElement("-"), NameElement("-1"), NameElement("1e0"), NameElement("99999999999999999999")},
+			NormalizedPath{NameElement("01"), NameElement("-"), NameElement("-1"), NameElement("1e0"), NameElement("99999999999999999999")},
+		},
+	} {
+		t.Run(tc.ptr, func(t *testing.T) {
+			t.Parallel()
+			p, err := ParsePointer(tc.ptr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, p)
+			assert.Equal(t, tc.ptr, p.Pointer())
+
+			p, err = ParsePointerNames(tc.ptr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.names, p)
+			assert.Equal(t, tc.ptr, p.Pointer())
+		})
+	}
+
+	for _, ptr := range []string{"foo", "#/foo", "/a~2b", "/m~", "/~/x"} {
+		_, err := ParsePointer(ptr)
+		assert.ErrorIs(t, err, ErrInvalidPointer, ptr)
+		_, err = ParsePointerNames(ptr)
+		assert.ErrorIs(t, err, ErrInvalidPointer, ptr)
+	}
+
+	// Every located node's pointer parses back to its path.
+	doc := map[string]any{"a/b": []any{map[string]any{"~": []any{1, 2}}}}
+	for _, n := range MustParse("$..*").SelectLocated(doc) {
+		p, err := ParsePointer(n.Path.Pointer())
+		require.NoError(t, err)
+		assert.Equal(t, n.Path, p)
+	}
+}
+
+func TestNormalizedPath_RelativeTo(t *testing.T) {
+	t.Parallel()
+
+	a, b := NameElement("a"), NameElement("b")
+	for _, tc := range []struct {
+		name string
+		path NormalizedPath
+		base NormalizedPath
+		exp  string
+	}{
+		{"same", NormalizedPath{a, IndexElement(0)}, NormalizedPath{a, IndexElement(0)}, "0"},
+		{"root", nil, nil, "0"},
+		{"child", NormalizedPath{a, IndexElement(0)}, NormalizedPath{a}, "0/0"},
+		{"parent", NormalizedPath{a}, NormalizedPath{a, IndexElement(0)}, "1"},
+		{"to_root", nil, NormalizedPath{a, b}, "2"},
+		{"from_root", NormalizedPath{a, b}, nil, "0/a/b"},
+		{"sibling", NormalizedPath{a, IndexElement(1)}, NormalizedPath{a, IndexElement(0)}, "1/1"},
+		{"cousin", NormalizedPath{a, NameElement("c"), IndexElement(0)}, NormalizedPath{a, b, IndexElement(1)}, "2/c/0"},
+		{"name_like_index", NormalizedPath{NameElement("0")}, NormalizedPath{IndexElement(0)}, "1/0"},
+		{"escapes", NormalizedPath{NameElement("x/y~z")}, NormalizedPath{b}, "1/x~1y~0z"},
+		{"empty_name", NormalizedPath{a, NameElement("")}, NormalizedPath{a}, "0/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			rel, err := tc.path.RelativeTo(tc.base)
+			require.NoError(t, err)
+			assert.Equal(t, tc.exp, rel)
+		})
+	}
+
+	_, err := NormalizedPath{a, NameElement("b\xffc")}.RelativeTo(NormalizedPath{b})
+	assert.ErrorIs(t, err, ErrInvalidPath)
+	_, err = NormalizedPath{NameElement("b\xffc"), a}.RelativeTo(NormalizedPath{NameElement("b\xffc")})
+	assert.NoError(t, err, "shared names are not written")
+
+	// Every node is reachable from every other one.
+	doc := map[string]any{
+		"store": map[string]any{
+			"book":  []any{map[string]any{"title": "A", "tags": []any{"x", "y"}}, map[string]any{"title": "B"}},
+			"a/b~c": map[string]any{"0": "zero"},
+		},
+		"list": []any{[]any{1, 2}, 3},
+	}
+	located := MustParse("$..*").SelectLocated(doc)
+	located = append(located, &LocatedNode{Value: doc, Path: nil})
+	for _, base := range located {
+		for _, n := range located {
+			rel, err := n.Path.RelativeTo(base.Path)
+			require.NoError(t, err)
+			got, ok := resolveRelativePointer(doc, base.Path, rel)
+			require.True(t, ok, "%s from %s", rel, base.Path)
+			assertSameNode(t, n.Value, got)
+		}
+	}
+}
+
+// resolveRelativePointer resolves the Relative JSON Pointer rel, without
+// index manipulation, against the node at base in doc.
+func resolveRelativePointer(doc any, base NormalizedPath, rel string) (any, bool) {
+	digits := len(rel) - len(strings.TrimLeft(rel, "0123456789"))
+	up, err := strconv.Atoi(rel[:digits])
+	if err != nil || up > len(base) {
+		return nil, false
+	}
+	start, ok := base.Truncate(len(base) - up).Resolve(doc)
+	if !ok {
+		return nil, false
+	}
+	return ResolvePointer(rel[digits:], start)
+}
+
+func TestNodeList_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	data, err := json.Marshal(NodeList{"a", 1.0, nil, map[string]any{"b": []any{true}}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `["a", 1, null, {"b": [true]}]`, string(data))
+
+	for _, list := range []NodeList{nil, {}} {
+		data, err = json.Marshal(list)
+		require.NoError(t, err)
+		assert.Equal(t, "[]", string(data))
+	}
+	data, err = json.Marshal(LocatedNodeList(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(data))
+
+	_, err = json.Marshal(NodeList{func() {}})
+	assert.Error(t, err)
+}
+
+func TestLocatedNodeList_MarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	doc := map[string]any{
+		"a":             []any{1.0, 2.0},
+		"it's":          "quote",
+		"a/b~c":         "pointer escapes",
+		"back\\slash\n": "backslash",
+		"tab\t\u0001":   "control",
+		"café 😀":        map[string]any{"x": nil},
+	}
+	tests := []struct {
+		expr, path, pointer string
+	}{
+		{"$.a[1]", `$['a'][1]`, "/a/1"},
+		{`$["it's"]`, `$['it\'s']`, "/it's"},
+		{`$["a/b~c"]`, `$['a/b~c']`, "/a~1b~0c"},
+		{`$["back\\slash\n"]`, `$['back\\slash\n']`, "/back\\slash\n"},
+		{`$["tab\t\u0001"]`, `$['tab\t\u0001']`, "/tab\t\u0001"},
+		{"$['café 😀'].x", "$['café 😀']['x']", "/café 😀/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+			located := MustParse(tt.expr).SelectLocated(doc)
+			require.Len(t, located, 1)
+
+			data, err := json.Marshal(located)
+			require.NoError(t, err)
+			var decoded []struct {
+				Path    string `json:"path"`
+				Pointer string `json:"pointer"`
+				Value   any    `json:"value"`
+			}
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			require.Len(t, decoded, 1)
+			assert.Equal(t, tt.path, decoded[0].Path)
+			assert.Equal(t, tt.pointer, decoded[0].Pointer)
+			assert.Equal(t, located[0].Value, decoded[0].Value)
+
+			// The decoded normalized path selects the same node again.
+			assert.Equal(t, located, MustParse(decoded[0].Path).SelectLocated(doc))
+
+			// A single node encodes as the same object.
+			one, err := json.Marshal(located[0])
+			require.NoError(t, err)
+			assert.Equal(t, string(data), "["+string(one)+"]")
+		})
+	}
+
+	_, err := json.Marshal(LocatedNode{Path: NormalizedPath{NameElement("b\xffc")}})
+	assert.ErrorIs(t, err, ErrInvalidPath)
+}
+
+func TestSliceArgs(t *testing.T) {
+	t.Parallel()
+
+	arr := []any{"a", "b", "c", "d", "e", "f", "g"}
+	for _, tc := range []struct {
+		expr string
+		args SliceArgs
+	}{
+		{"$[1:3]", SliceArgs{Start: 1, End: 3, HasStart: true, HasEnd: true}},
+		{"$[5:]", SliceArgs{Start: 5, HasStart: true}},
+		{"$[1:5:2]", SliceArgs{Start: 1, End: 5, Step: 2, HasStart: true, HasEnd: true, HasStep: true}},
+		{"$[5:1:-2]", SliceArgs{Start: 5, End: 1, Step: -2, HasStart: true, HasEnd: true, HasStep: true}},
+		{"$[::-1]", SliceArgs{Step: -1, HasStep: true}},
+		{"$[-10::-1]", SliceArgs{Start: -10, Step: -1, HasStart: true, HasStep: true}},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+			got := NodeList{}
+			for i := range tc.args.Indices(len(arr)) {
+				got = append(got, arr[i])
+			}
+			want := MustParse(tc.expr).Select(arr)
+			assert.Equal(t, want, got)
+
+			// Filter sub-queries apply the same semantics.
+			count := fmt.Sprintf("$[?count(@%s) == %d]", tc.expr[1:], len(want))
+			assert.Len(t, MustParse(count).Select([]any{arr}), 1)
+		})
+	}
+}
+
+func TestSelectorKind(t *testing.T) {
+	t.Parallel()
+
+	// Every internal kind with a name must have a public mirror with the
+	// same name, so new internal kinds cannot silently go unmapped.
+	mapped := 0
+	for k := range 256 {
+		internal := ast.SelectorKind(k)
+		known := !strings.HasPrefix(internal.String(), "SelectorKind(")
+		kind, ok := selectorKindOf(internal)
+		assert.Equal(t, known, ok, "internal kind %d", k)
+		if ok {
+			mapped++
+			assert.Equal(t, internal.String(), kind.String())
+		}
+	}
+	assert.Equal(t, 5, mapped)
+	assert.Equal(t, "SelectorKind(9)", SelectorKind(9).String())
+
+	for _, tc := range []struct {
+		expr string
+		want SelectorKind
+	}{
+		{"$.a", SelectorName},
+		{"$[0]", SelectorIndex},
+		{"$[1:2]", SelectorSlice},
+		{"$.*", SelectorWildcard},
+		{"$[?@]", SelectorFilter},
+	} {
+		sel := MustParse(tc.expr).query.Segments()[0].Selectors()[0]
+		kind, ok := selectorKindOf(sel.Kind)
+		assert.True(t, ok)
+		assert.Equal(t, tc.want, kind, tc.expr)
+	}
+}
+
+func TestSegmentKind(t *testing.T) {
+	t.Parallel()
+
+	segs := MustParse("$.a..b").query.Segments()
+	assert.Equal(t, SegmentChild, segmentKindOf(&segs[0]))
+	assert.Equal(t, SegmentDescendant, segmentKindOf(&segs[1]))
+	assert.Equal(t, "child", SegmentChild.String())
+	assert.Equal(t, "descendant", SegmentDescendant.String())
+	assert.Equal(t, "SegmentKind(2)", SegmentKind(2).String())
 }